@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ChamsBouzaiene/dodo/internal/config"
+)
+
+// setFlag collects repeated --set key=value flags.
+type setFlag map[string]string
+
+func (f setFlag) String() string { return "" }
+
+func (f setFlag) Set(v string) error {
+	key, value, ok := strings.Cut(v, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", v)
+	}
+	f[key] = value
+	return nil
+}
+
+// registerConfigFlags adds the command-line config layer to fs. The returned
+// function yields the collected settings after fs.Parse.
+func registerConfigFlags(fs *flag.FlagSet) func() map[string]string {
+	sets := setFlag{}
+	fs.Var(sets, "set", "Override a config setting for this run (key=value, repeatable)")
+	provider := fs.String("provider", "", "LLM provider for this run (same as --set llm_provider=...)")
+	model := fs.String("model", "", "Model for this run (same as --set model=...)")
+	profile := fs.String("profile", "", "Provider profile for this run (same as --set profile=...)")
+
+	return func() map[string]string {
+		out := make(map[string]string, len(sets)+3)
+		for k, v := range sets {
+			out[k] = v
+		}
+		if *profile != "" {
+			out["profile"] = *profile
+		}
+		if *provider != "" {
+			out["llm_provider"] = *provider
+		}
+		if *model != "" {
+			out["model"] = *model
+		}
+		return out
+	}
+}
+
+const configUsage = `usage:
+  dodo config get <key> [--repo DIR]
+  dodo config set <key> <value> [--scope user|project] [--repo DIR]
+  dodo config unset <key> [--scope user|project] [--repo DIR]
+  dodo config list [--scope default|user|project|env|flag] [--repo DIR]
+  dodo config schema user|project
+  dodo config profile list [--repo DIR]
+  dodo config profile add <name> --provider P [--model M] [--base-url URL] [--key-ref env:VAR|store:NAME]
+                          [--temperature T] [--max-output-tokens N] [--scope user|project] [--repo DIR]
+  dodo config profile remove <name> [--scope user|project] [--repo DIR]
+  dodo config mcp trust|untrust [--repo DIR]
+  dodo config credential list
+  dodo config credential set <name>      (reads the key from stdin)
+  dodo config credential remove <name>`
+
+// runConfigCommand implements `dodo config`.
+func runConfigCommand(out io.Writer, args []string) error {
+	if len(args) == 0 {
+		return errors.New(configUsage)
+	}
+	sub := args[0]
+
+	fs := flag.NewFlagSet("config "+sub, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	scopeFlag := fs.String("scope", "", "Config layer to read or write")
+	repoFlag := fs.String("repo", "", "Repository whose project config to use (default: current directory)")
+	var profile config.Profile
+	if sub == "profile" {
+		fs.StringVar(&profile.Provider, "provider", "", "LLM provider")
+		fs.StringVar(&profile.Model, "model", "", "Model name")
+		fs.StringVar(&profile.BaseURL, "base-url", "", "API base URL override")
+		fs.StringVar(&profile.KeyRef, "key-ref", "", "Where the API key is kept (env:VAR or store:NAME)")
+		fs.Float64Var(&profile.Temperature, "temperature", 0, "Sampling temperature")
+		fs.IntVar(&profile.MaxOutputTokens, "max-output-tokens", 0, "Upper bound on tokens per response")
+	}
+	positional, err := parseInterleaved(fs, args[1:])
+	if err != nil {
+		return fmt.Errorf("%w\n%s", err, configUsage)
+	}
+
+	repoRoot := *repoFlag
+	if repoRoot == "" {
+		if repoRoot, err = os.Getwd(); err != nil {
+			return fmt.Errorf("failed to get current directory: %w", err)
+		}
+	}
+	if repoRoot, err = filepath.Abs(repoRoot); err != nil {
+		return fmt.Errorf("failed to resolve repository path: %w", err)
+	}
+
+	loader, err := config.NewLoader(repoRoot, nil)
+	if err != nil {
+		return err
+	}
+
+	writeScope := func() (config.Scope, error) {
+		if *scopeFlag == "" {
+			return config.ScopeUser, nil
+		}
+		return config.ParseScope(*scopeFlag)
+	}
+
+	switch sub {
+	case "get":
+		if len(positional) != 1 {
+			return errors.New(configUsage)
+		}
+		if _, ok := config.LookupKey(positional[0]); !ok {
+			return fmt.Errorf("unknown setting %q", positional[0])
+		}
+		settings, err := loader.Load()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+		v := settings.Get(positional[0])
+		if !v.Set() {
+			return fmt.Errorf("%s is not set", positional[0])
+		}
+		if k, _ := config.LookupKey(v.Key); k.Secret {
+			v.Value = config.MaskSecret(v.Value)
+		}
+		fmt.Fprintln(out, v.Value)
+		return nil
+
+	case "set":
+		if len(positional) != 2 {
+			return errors.New(configUsage)
+		}
+		scope, err := writeScope()
+		if err != nil {
+			return err
+		}
+		return loader.Set(scope, positional[0], positional[1])
+
+	case "unset":
+		if len(positional) != 1 {
+			return errors.New(configUsage)
+		}
+		scope, err := writeScope()
+		if err != nil {
+			return err
+		}
+		return loader.Unset(scope, positional[0])
+
+	case "list":
+		if len(positional) != 0 {
+			return errors.New(configUsage)
+		}
+		var values []config.Value
+		if *scopeFlag == "" {
+			settings, err := loader.Load()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+			}
+			values = settings.All()
+		} else {
+			scope, err := config.ParseScope(*scopeFlag)
+			if err != nil {
+				return err
+			}
+			layer, err := loader.Layer(scope)
+			if layer == nil {
+				return err
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+			}
+			for _, v := range layer {
+				values = append(values, v)
+			}
+			sort.Slice(values, func(i, j int) bool { return values[i].Key < values[j].Key })
+		}
+		return printConfigValues(out, values)
+
+	case "profile":
+		if len(positional) == 0 {
+			return errors.New(configUsage)
+		}
+		switch positional[0] {
+		case "list":
+			return printProfiles(out, loader)
+		case "add":
+			if len(positional) != 2 {
+				return errors.New(configUsage)
+			}
+			scope, err := writeScope()
+			if err != nil {
+				return err
+			}
+			return loader.SetProfile(scope, positional[1], profile)
+		case "remove":
+			if len(positional) != 2 {
+				return errors.New(configUsage)
+			}
+			scope, err := writeScope()
+			if err != nil {
+				return err
+			}
+			return loader.RemoveProfile(scope, positional[1])
+		}
+		return fmt.Errorf("unknown profile subcommand %q\n%s", positional[0], configUsage)
+
+	case "schema":
+		if len(positional) != 1 {
+			return errors.New(configUsage)
+		}
+		kind, err := config.ParseFileKind(positional[0])
+		if err != nil {
+			return err
+		}
+		schema, err := config.Schema(kind)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, string(schema))
+		return nil
+
+	case "mcp":
+		if len(positional) != 1 {
+			return errors.New(configUsage)
+		}
+		switch positional[0] {
+		case "trust":
+			servers, err := loader.TrustProjectMCPServers()
+			if err != nil {
+				return err
+			}
+			printMCPServers(out, servers)
+			fmt.Fprintf(out, "trusted for %s until %s changes them\n", repoRoot, loader.ProjectPath())
+			return nil
+		case "untrust":
+			return loader.UntrustProjectMCPServers()
+		}
+		return fmt.Errorf("unknown mcp subcommand %q\n%s", positional[0], configUsage)
+
+	case "credential":
+		if len(positional) == 0 {
+			return errors.New(configUsage)
+		}
+		store, err := loader.Credentials()
+		if err != nil {
+			return err
+		}
+		switch positional[0] {
+		case "list":
+			names, err := store.Names()
+			if err != nil {
+				return err
+			}
+			for _, name := range names {
+				fmt.Fprintln(out, config.StoreRef(name))
+			}
+			return nil
+		case "set":
+			if len(positional) != 2 {
+				return errors.New(configUsage)
+			}
+			secret, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && err != io.EOF {
+				return fmt.Errorf("failed to read key: %w", err)
+			}
+			secret = strings.TrimSpace(secret)
+			if secret == "" {
+				return errors.New("no key on stdin")
+			}
+			if err := store.Set(positional[1], secret); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "stored; reference it as %s\n", config.StoreRef(positional[1]))
+			return nil
+		case "remove":
+			if len(positional) != 2 {
+				return errors.New(configUsage)
+			}
+			return store.Delete(positional[1])
+		}
+		return fmt.Errorf("unknown credential subcommand %q\n%s", positional[0], configUsage)
+
+	default:
+		return fmt.Errorf("unknown subcommand %q\n%s", sub, configUsage)
+	}
+}
+
+// printProfiles lists profiles from both files; a project profile shadows a
+// user profile of the same name.
+func printProfiles(out io.Writer, loader *config.Loader) error {
+	settings, _ := loader.Load()
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tPROVIDER\tMODEL\tSCOPE\tACTIVE")
+	for _, scope := range []config.Scope{config.ScopeUser, config.ScopeProject} {
+		profiles, err := loader.ProfilesIn(scope)
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			p := profiles[name]
+			active := ""
+			if name == settings.Profile() {
+				active = "*"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", name, p.Provider, p.Model, scope, active)
+		}
+	}
+	return tw.Flush()
+}
+
+// printMCPServers lists what each server runs or connects to.
+func printMCPServers(out io.Writer, servers map[string]config.MCPServer) {
+	names := make([]string, 0, len(servers))
+	for name := range servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s := servers[name]
+		target := s.URL
+		if s.Command != "" {
+			target = strings.Join(append([]string{s.Command}, s.Args...), " ")
+		}
+		fmt.Fprintf(out, "%s: %s\n", name, target)
+	}
+}
+
+// parseInterleaved parses flags that may appear before, between or after
+// positional arguments and returns the positional ones.
+func parseInterleaved(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func printConfigValues(out io.Writer, values []config.Value) error {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tVALUE\tSCOPE\tORIGIN")
+	for _, v := range values {
+		value := v.Value
+		if k, ok := config.LookupKey(v.Key); ok && k.Secret {
+			value = config.MaskSecret(value)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", v.Key, value, v.Scope, v.Origin)
+	}
+	return tw.Flush()
+}
@@ -7,27 +7,58 @@ import (
 	"log"
 	"os"
 	"path/filepath"
-	"strconv"
 	"time"
 
 	"github.com/ChamsBouzaiene/dodo/internal/config"
+	"github.com/ChamsBouzaiene/dodo/internal/engine"
 	"github.com/ChamsBouzaiene/dodo/internal/indexer"
+	"github.com/ChamsBouzaiene/dodo/internal/lsp"
+	"github.com/ChamsBouzaiene/dodo/internal/sandbox"
+	"github.com/ChamsBouzaiene/dodo/internal/tools/execution"
+	"github.com/ChamsBouzaiene/dodo/internal/tools/navigation"
 )
 
+// runtimeEnv is what a process needs before serving anything: the
+// configuration and the repository it was started in.
 type runtimeEnv struct {
+	*repoEnv
+	Config *config.Loader
+}
+
+func (r *runtimeEnv) Close() {
+	r.repoEnv.close()
+}
+
+// repoEnv is the runtime one repository's sessions share: its index,
+// workspace context, sandbox and metrics.
+type repoEnv struct {
 	RepoRoot     string
 	Retrieval    indexer.Retrieval
 	WorkspaceCtx *indexer.WorkspaceContext
+	Runner       execution.Runner
+	Metrics      *engine.AgentMetrics
+	LSP          *lsp.Manager // nil when no language server applies
 	manager      *indexer.Manager
 }
 
-func (r *runtimeEnv) Close() {
+func (r *repoEnv) close() {
+	if r.LSP != nil {
+		r.LSP.Close()
+	}
 	if r.manager != nil {
 		r.manager.Stop()
 	}
 }
 
-func prepareRuntimeEnv(ctx context.Context, repoFlag string) (*runtimeEnv, error) {
+// tools are the repository's tools beyond the built-in ones.
+func (r *repoEnv) tools() engine.ToolRegistry {
+	if r.LSP == nil {
+		return nil
+	}
+	return navigation.NewTools(r.RepoRoot, r.LSP)
+}
+
+func prepareRuntimeEnv(ctx context.Context, repoFlag string, configFlags map[string]string) (*runtimeEnv, error) {
 	// Determine repository root
 	repoRoot := repoFlag
 	if repoRoot == "" {
@@ -39,19 +70,45 @@ func prepareRuntimeEnv(ctx context.Context, repoFlag string) (*runtimeEnv, error
 		}
 	}
 
+	absRepoRoot, err := resolveRepoDir(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Repository root: %s", absRepoRoot)
+
+	// Resolve layered configuration and export it for the env-driven packages
+	loader, err := config.NewLoader(absRepoRoot, configFlags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize config: %w", err)
+	}
+	settings := applyConfig(loader)
+
+	return &runtimeEnv{
+		repoEnv: openRepoEnv(ctx, absRepoRoot, settings),
+		Config:  loader,
+	}, nil
+}
+
+// resolveRepoDir returns repoRoot as an absolute path, which must be an
+// existing directory.
+func resolveRepoDir(repoRoot string) (string, error) {
 	// Resolve absolute path
 	absRepoRoot, err := filepath.Abs(repoRoot)
 	if err != nil {
-		return nil, fmt.Errorf("failed to resolve repository path: %w", err)
+		return "", fmt.Errorf("failed to resolve repository path: %w", err)
 	}
 
 	// Verify directory exists
 	if info, err := os.Stat(absRepoRoot); err != nil || !info.IsDir() {
-		return nil, fmt.Errorf("repository path is not a valid directory: %s", absRepoRoot)
+		return "", fmt.Errorf("repository path is not a valid directory: %s", absRepoRoot)
 	}
+	return absRepoRoot, nil
+}
 
-	log.Printf("Repository root: %s", absRepoRoot)
-
+// openRepoEnv sets up the runtime of the repository at absRepoRoot from
+// its settings. Parts that fail to come up are left out with a warning.
+func openRepoEnv(ctx context.Context, absRepoRoot string, settings *config.Settings) *repoEnv {
 	// Detect git info
 	gitInfo := indexer.DetectGit(ctx, absRepoRoot)
 	if gitInfo.IsGit {
@@ -67,7 +124,7 @@ func prepareRuntimeEnv(ctx context.Context, repoFlag string) (*runtimeEnv, error
 
 	// Set up indexing manager for semantic search
 	var retrieval indexer.Retrieval
-	manager, err := setupIndexingManager(ctx, absRepoRoot)
+	manager, err := setupIndexingManager(ctx, absRepoRoot, settings)
 	if err != nil {
 		log.Printf("⚠️  Failed to setup indexing manager: %v (semantic search will be disabled)", err)
 		retrieval = nil
@@ -81,16 +138,41 @@ func prepareRuntimeEnv(ctx context.Context, repoFlag string) (*runtimeEnv, error
 		log.Println("✅ Semantic search enabled")
 	}
 
-	return &runtimeEnv{
+	runner := sandbox.NewConfiguredRunner(sandboxConfig(settings))
+
+	// Language server, started on first use
+	var lspManager *lsp.Manager
+	if settings.Bool("lsp") {
+		if m := lsp.NewManager(absRepoRoot, runner, settings.String("lsp_command")); m.Available() {
+			log.Printf("Language-server tools enabled (%s)", m.ServerName())
+			lspManager = m
+		}
+	}
+
+	return &repoEnv{
 		RepoRoot:     absRepoRoot,
 		Retrieval:    retrieval,
 		WorkspaceCtx: workspaceCtx,
+		Runner:       runner,
+		Metrics:      engine.NewMetrics(settings.Provider(), settings.Model()),
+		LSP:          lspManager,
 		manager:      manager,
-	}, nil
+	}
+}
+
+// sandboxConfig is the sandbox configuration settings resolve to.
+func sandboxConfig(settings *config.Settings) sandbox.Config {
+	return sandbox.Config{
+		Mode:        sandbox.Mode(settings.SandboxMode()),
+		DockerImage: settings.String("docker_image"),
+		CPU:         settings.String("docker_cpu"),
+		Memory:      settings.String("docker_memory"),
+		CmdTimeout:  settings.Duration("cmd_timeout"),
+	}
 }
 
 // setupIndexingManager creates and configures the indexing manager for semantic search.
-func setupIndexingManager(ctx context.Context, repoRoot string) (*indexer.Manager, error) {
+func setupIndexingManager(ctx context.Context, repoRoot string, settings *config.Settings) (*indexer.Manager, error) {
 	// Generate repo ID from path
 	repoID := generateRepoID(repoRoot)
 
@@ -100,65 +182,14 @@ func setupIndexingManager(ctx context.Context, repoRoot string) (*indexer.Manage
 		return nil, fmt.Errorf("failed to create .dodo directory: %w", err)
 	}
 
-	// Load User Configuration
-	cfgManager, err := config.NewManager()
-	var userConfig *config.Config
-	if err == nil {
-		userConfig, err = cfgManager.Load()
-		if err != nil {
-			log.Printf("⚠️  Failed to load user config: %v", err)
-			userConfig = &config.Config{} // Fallback to empty
-		} else {
-			log.Printf("User config loaded from: %s", cfgManager.GetConfigPath())
-		}
-	} else {
-		log.Printf("⚠️  Failed to initialize config manager: %v", err)
-		userConfig = &config.Config{}
-	}
-
 	// Get embedder from environment (OpenAI if available, NoOp otherwise)
 	var embedder indexer.Embedder
 
-	// Populate environment variables from config
-	// We allow config to override environment if explicitly set.
-	// This ensures that if the user runs the Setup Wizard, their choices (saved in config.json)
-	// take precedence over potentially stale environment variables in the shell or .env files.
-	if userConfig.LLMProvider != "" {
-		os.Setenv("LLM_PROVIDER", userConfig.LLMProvider)
-	}
-
-	if userConfig.APIKey != "" {
-		switch userConfig.LLMProvider {
-		case "openai":
-			// For OpenAI, we set OPENAI_API_KEY
-			os.Setenv("OPENAI_API_KEY", userConfig.APIKey)
-			if userConfig.Model != "" {
-				os.Setenv("OPENAI_MODEL", userConfig.Model)
-			}
-			if userConfig.BaseURL != "" {
-				os.Setenv("OPENAI_BASE_URL", userConfig.BaseURL)
-			}
-		case "anthropic":
-			os.Setenv("ANTHROPIC_API_KEY", userConfig.APIKey)
-			if userConfig.Model != "" {
-				os.Setenv("ANTHROPIC_MODEL", userConfig.Model)
-			}
-		case "kimi":
-			os.Setenv("KIMI_API_KEY", userConfig.APIKey)
-			if userConfig.Model != "" {
-				os.Setenv("KIMI_MODEL", userConfig.Model)
-			}
-		}
-	}
-
-	// For embeddings, we default to OpenAI if we have a key, unless specified otherwise
+	// For embeddings, we default to OpenAI if we have a key, unless specified otherwise.
+	// OPENAI_API_KEY already reflects the config when the provider is OpenAI.
 	embeddingKey := os.Getenv("OPENAI_API_KEY")
 	if embeddingKey == "" {
-		embeddingKey = userConfig.EmbeddingKey
-		if embeddingKey == "" && userConfig.LLMProvider == "openai" {
-			// Fallback to main API key if using OpenAI
-			embeddingKey = userConfig.APIKey
-		}
+		embeddingKey = settings.EmbeddingKey()
 	}
 
 	if embeddingKey != "" {
@@ -169,19 +200,12 @@ func setupIndexingManager(ctx context.Context, repoRoot string) (*indexer.Manage
 		embedder = indexer.NewNoOpEmbedder(384)
 	}
 
-	// Parse code file boost from environment variable (optional)
-	codeFileBoost := 0.0 // 0 means use default
-	if boostStr := os.Getenv("DODO_CODE_FILE_BOOST"); boostStr != "" {
-		if boost, err := strconv.ParseFloat(boostStr, 64); err == nil {
-			// Validate range: 1.0 to 2.0 (reasonable bounds)
-			if boost >= 1.0 && boost <= 2.0 {
-				codeFileBoost = boost
-			} else {
-				log.Printf("WARNING: DODO_CODE_FILE_BOOST value %f is outside valid range [1.0, 2.0], using default", boost)
-			}
-		} else {
-			log.Printf("WARNING: Invalid DODO_CODE_FILE_BOOST value '%s', using default: %v", boostStr, err)
-		}
+	// Code file boost is optional; 0 means use default
+	codeFileBoost := settings.Float("code_file_boost")
+	if codeFileBoost != 0 && (codeFileBoost < 1.0 || codeFileBoost > 2.0) {
+		// Validate range: 1.0 to 2.0 (reasonable bounds)
+		log.Printf("WARNING: code_file_boost value %f (from %s) is outside valid range [1.0, 2.0], using default", codeFileBoost, settings.Get("code_file_boost").Origin)
+		codeFileBoost = 0
 	}
 
 	// Create manager config (disable file watching for REPL to reduce overhead)
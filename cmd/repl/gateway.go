@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	engineprotocol "github.com/ChamsBouzaiene/dodo/internal/engine/protocol"
+	"github.com/google/uuid"
+)
+
+// sseHeartbeat keeps idle event streams from being closed by proxies.
+const sseHeartbeat = 15 * time.Second
+
+// serveHTTP exposes the protocol over HTTP on a loopback address:
+//
+//	POST /v1/commands/{type}        run one command, reply with its events
+//	GET  /v1/sessions/{id}/events   SSE stream of one session's events
+//	GET  /v1/events                 SSE stream of every session's events
+//
+// Every request must carry the token as "Authorization: Bearer <token>" or,
+// for EventSource clients that can't set headers, as ?token=.
+func serveHTTP(ctx context.Context, host *engineHost, addr, token string) error {
+	hostname, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid --http %q: %w", addr, err)
+	}
+	if ip := net.ParseIP(hostname); hostname != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("invalid --http %q: the gateway only listens on loopback addresses", addr)
+	}
+
+	g := &httpGateway{host: host}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/commands/{type}", g.handleCommand)
+	mux.HandleFunc("GET /v1/sessions/{id}/events", g.handleSessionEvents)
+	mux.HandleFunc("GET /v1/events", g.handleAllEvents)
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           requireToken(token, mux),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	stopClose := context.AfterFunc(ctx, func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	})
+	defer stopClose()
+
+	log.Printf("🌐 HTTP gateway listening on http://%s", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("http gateway: %w", err)
+	}
+	return nil
+}
+
+// requireToken rejects requests that don't present token.
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := r.URL.Query().Get("token")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			got = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing or invalid token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type httpGateway struct {
+	host *engineHost
+}
+
+// commandResponse is the body answering POST /v1/commands/{type}.
+type commandResponse struct {
+	Result json.RawMessage   `json:"result"`
+	Events []json.RawMessage `json:"events"`
+}
+
+// handleCommand runs the command named in the path with the JSON body as
+// its fields, and answers once it has finished: for user_message, when the
+// run is over. The response holds the result event and every other event
+// the command produced.
+//
+// A run is cancelled when its client disconnects, unless the request asks
+// for ?detach=true; the run then goes on and its events can be followed on
+// the session's event stream.
+func (g *httpGateway) handleCommand(w http.ResponseWriter, r *http.Request) {
+	fields := map[string]any{}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": err.Error()})
+		return
+	}
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if err := json.Unmarshal(body, &fields); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "body must be a JSON object: " + err.Error()})
+			return
+		}
+	}
+	fields["type"] = r.PathValue("type")
+	requestID, _ := fields["request_id"].(string)
+	if requestID == "" {
+		requestID = "http-" + uuid.NewString()
+		fields["request_id"] = requestID
+	}
+	line, _ := json.Marshal(fields)
+
+	client := g.host.newRunner("")
+	g.host.hub.add(client) // receives the events of the sessions it addresses
+	collected := make(chan []engineprotocol.Event, 1)
+	go func() {
+		var evs []engineprotocol.Event
+		for ev := range client.events {
+			evs = append(evs, ev)
+		}
+		collected <- evs
+	}()
+
+	// Commands run under the engine's context so that a disconnect ends
+	// a run like cancel_request does, not like the engine shutting down.
+	if sessionID, _ := fields["session_id"].(string); sessionID != "" && r.URL.Query().Get("detach") != "true" {
+		stop := context.AfterFunc(r.Context(), func() {
+			if sess, err := g.host.manager.GetSession(sessionID); err == nil && sess.cancelRun(requestID, "HTTP client disconnected") {
+				log.Printf("http gateway: client of %s disconnected; run cancelled", requestID)
+			}
+		})
+		defer stop()
+	}
+	_ = client.handleLine(g.host.ctx, string(line))
+	g.host.hub.remove(client)
+	client.closeEvents()
+
+	resp := commandResponse{Events: []json.RawMessage{}}
+	status := http.StatusOK
+	for _, ev := range <-collected {
+		data, err := engineprotocol.MarshalEvent(ev)
+		if err != nil {
+			continue
+		}
+		switch e := ev.(type) {
+		case engineprotocol.AckEvent:
+			continue
+		case engineprotocol.ResultEvent:
+			if e.RequestID == requestID {
+				resp.Result = data
+				status = resultStatus(e)
+				continue
+			}
+		}
+		resp.Events = append(resp.Events, data)
+	}
+	writeJSON(w, status, resp)
+}
+
+// resultStatus maps a command's result to an HTTP status.
+func resultStatus(e engineprotocol.ResultEvent) int {
+	switch {
+	case e.OK:
+		return http.StatusOK
+	case e.Error.Kind == "invalid_command" || e.Error.Kind == "incompatible_protocol":
+		return http.StatusBadRequest
+	default:
+		return http.StatusUnprocessableEntity
+	}
+}
+
+func (g *httpGateway) handleSessionEvents(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, err := g.host.manager.GetSession(id); err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	}
+	client := g.host.newRunner("")
+	client.subscribe(id)
+	g.streamEvents(w, r, client)
+}
+
+func (g *httpGateway) handleAllEvents(w http.ResponseWriter, r *http.Request) {
+	client := g.host.newRunner("")
+	client.subscribeAll()
+	g.streamEvents(w, r, client)
+}
+
+// streamEvents writes the client's events as Server-Sent Events until the
+// request ends.
+func (g *httpGateway) streamEvents(w http.ResponseWriter, r *http.Request, client *stdioRunner) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "streaming unsupported"})
+		return
+	}
+	g.host.hub.add(client)
+	defer func() {
+		g.host.hub.remove(client)
+		client.closeEvents()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// A reader that stops taking events is disconnected: its writes fail
+	// once the deadline passes, or the hub cuts it off and closes its queue.
+	rc := http.NewResponseController(w)
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			rc.SetWriteDeadline(time.Now().Add(clientWriteTimeout))
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			if rc.Flush() != nil {
+				return
+			}
+		case ev, ok := <-client.events:
+			if !ok {
+				return
+			}
+			data, err := engineprotocol.MarshalEvent(ev)
+			if err != nil {
+				log.Printf("http gateway: marshal %s: %v", ev.GetType(), err)
+				continue
+			}
+			rc.SetWriteDeadline(time.Now().Add(clientWriteTimeout))
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.GetType(), data); err != nil {
+				return
+			}
+			if rc.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("http gateway: write response: %v", err)
+	}
+}
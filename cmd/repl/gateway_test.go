@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChamsBouzaiene/dodo/internal/config"
+	"github.com/ChamsBouzaiene/dodo/internal/engine"
+	engineprotocol "github.com/ChamsBouzaiene/dodo/internal/engine/protocol"
+	"github.com/ChamsBouzaiene/dodo/internal/session"
+)
+
+// newTestHost returns an engine host for a scratch repository, with its
+// session store and config under a scratch home directory.
+func newTestHost(t *testing.T) *engineHost {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("OPENAI_API_KEY", "")
+	ctx, cancel := context.WithCancel(context.Background())
+	env := &runtimeEnv{
+		repoEnv: &repoEnv{RepoRoot: t.TempDir(), Metrics: engine.NewMetrics("", "")},
+		Config:  &config.Loader{UserPath: filepath.Join(home, ".dodo", "config.json")},
+	}
+	host := newEngineHost(ctx, env, false)
+	t.Cleanup(func() {
+		cancel()
+		host.close()
+	})
+	return host
+}
+
+// addTestSession stores a session and loads it idle, without an agent, for
+// commands and events that don't run one.
+func addTestSession(t *testing.T, host *engineHost, id string) *sessionState {
+	t.Helper()
+	now := time.Now()
+	if err := host.manager.store.Save(&session.Session{ID: id, RepoPath: host.manager.env.RepoRoot, Title: "Untitled Session", CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	sess := &sessionState{id: id, repoRoot: host.manager.env.RepoRoot, env: host.manager.env.repoEnv, eventSink: host.manager.events, lastUsed: time.Now()}
+	host.manager.mu.Lock()
+	host.manager.sessions[id] = sess
+	host.manager.mu.Unlock()
+	return sess
+}
+
+func newTestGateway(t *testing.T, host *engineHost) *httptest.Server {
+	t.Helper()
+	g := &httpGateway{host: host}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/commands/{type}", g.handleCommand)
+	mux.HandleFunc("GET /v1/sessions/{id}/events", g.handleSessionEvents)
+	mux.HandleFunc("GET /v1/events", g.handleAllEvents)
+	srv := httptest.NewServer(requireToken("s3cret", mux))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGatewayRequiresToken(t *testing.T) {
+	srv := newTestGateway(t, newTestHost(t))
+	tests := []struct {
+		name string
+		auth string
+		url  string
+		want int
+	}{
+		{"missing", "", "/v1/commands/list_sessions", http.StatusUnauthorized},
+		{"wrong bearer", "Bearer nope", "/v1/commands/list_sessions", http.StatusUnauthorized},
+		{"wrong scheme", "Basic s3cret", "/v1/commands/list_sessions", http.StatusUnauthorized},
+		{"bearer", "Bearer s3cret", "/v1/commands/list_sessions", http.StatusOK},
+		{"query", "", "/v1/commands/list_sessions?token=s3cret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, srv.URL+tt.url, nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func postCommand(t *testing.T, srv *httptest.Server, typ, body string) (int, commandResponse) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/v1/commands/"+typ, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer s3cret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out commandResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("decode %s response: %v", typ, err)
+	}
+	return resp.StatusCode, out
+}
+
+func TestGatewayCommandReplies(t *testing.T) {
+	host := newTestHost(t)
+	srv := newTestGateway(t, host)
+	addTestSession(t, host, "s1")
+
+	status, resp := postCommand(t, srv, "rename_session", `{"session_id": "s1", "title": "Gateway", "request_id": "r1"}`)
+	if status != http.StatusOK {
+		t.Fatalf("rename_session status = %d, body %+v", status, resp)
+	}
+	var result engineprotocol.ResultEvent
+	if err := json.Unmarshal(resp.Result, &result); err != nil || !result.OK || result.RequestID != "r1" {
+		t.Errorf("result = %s, want ok for r1", resp.Result)
+	}
+	for _, raw := range resp.Events {
+		if strings.Contains(string(raw), `"type":"ack"`) {
+			t.Errorf("events include the ack: %s", raw)
+		}
+	}
+
+	status, resp = postCommand(t, srv, "get_session", `{"session_id": "missing"}`)
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("get_session of an unknown session: status = %d, want 422", status)
+	}
+	if err := json.Unmarshal(resp.Result, &result); err != nil || result.OK || !strings.HasPrefix(result.RequestID, "http-") {
+		t.Errorf("result = %s, want a failure with a generated request ID", resp.Result)
+	}
+
+	if status, _ := postCommand(t, srv, "no_such_command", `{}`); status != http.StatusBadRequest {
+		t.Errorf("unknown command: status = %d, want 400", status)
+	}
+	if status, _ := postCommand(t, srv, "list_sessions", `[1, 2]`); status != http.StatusBadRequest {
+		t.Errorf("non-object body: status = %d, want 400", status)
+	}
+}
+
+// readSSE returns the next event of an SSE stream, skipping comments.
+func readSSE(t *testing.T, r *bufio.Reader) (string, string) {
+	t.Helper()
+	var typ, data string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read SSE stream: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			typ = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		case line == "" && typ != "":
+			return typ, data
+		}
+	}
+}
+
+func TestGatewayStreamsSessionEvents(t *testing.T) {
+	host := newTestHost(t)
+	srv := newTestGateway(t, host)
+	s1 := addTestSession(t, host, "s1")
+	s2 := addTestSession(t, host, "s2")
+
+	get := func(path string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	if resp := get("/v1/sessions/missing/events?token=s3cret"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("stream of an unknown session: status = %d, want 404", resp.StatusCode)
+	}
+
+	one := get("/v1/sessions/s1/events?token=s3cret")
+	all := get("/v1/events?token=s3cret")
+	if ct := one.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	// Headers are flushed once the client is attached to the hub.
+	s2.emit(engineprotocol.NewStatusEvent("s2", "thinking", "other"))
+	s1.emit(engineprotocol.NewStatusEvent("s1", "thinking", "mine"))
+
+	oneEvents, allEvents := bufio.NewReader(one.Body), bufio.NewReader(all.Body)
+	typ, data := readSSE(t, oneEvents)
+	if typ != "status" || !strings.Contains(data, `"session_id":"s1"`) || !strings.Contains(data, `"detail":"mine"`) {
+		t.Errorf("session stream got %s %s, want s1's status", typ, data)
+	}
+	for _, want := range []string{"s2", "s1"} {
+		if typ, data := readSSE(t, allEvents); typ != "status" || !strings.Contains(data, `"session_id":"`+want+`"`) {
+			t.Errorf("all-sessions stream got %s %s, want %s's status", typ, data, want)
+		}
+	}
+}
+
+func TestCancelRunOfDisconnectedRequest(t *testing.T) {
+	host := newTestHost(t)
+	sess := addTestSession(t, host, "s1")
+	ctx, cancel := context.WithCancel(context.Background())
+	sess.beginRun("r1")
+	sess.setCancelFunc(cancel)
+
+	if sess.cancelRun("r2", "HTTP client disconnected") || ctx.Err() != nil {
+		t.Fatal("a disconnect cancelled another request's run")
+	}
+	if !sess.cancelRun("r1", "HTTP client disconnected") || ctx.Err() == nil {
+		t.Fatal("the disconnected request's run is still going")
+	}
+	if !sess.lastRunCancelled {
+		t.Error("the next message won't tell the agent about the cancellation")
+	}
+	sess.endRun()
+	if sess.cancelRun("r1", "HTTP client disconnected") {
+		t.Error("cancelRun reported cancelling a finished run")
+	}
+}
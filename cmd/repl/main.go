@@ -10,8 +10,10 @@ import (
 
 	"github.com/joho/godotenv"
 	"github.com/ChamsBouzaiene/dodo/internal/engine"
+	engineprotocol "github.com/ChamsBouzaiene/dodo/internal/engine/protocol"
 	"github.com/ChamsBouzaiene/dodo/internal/factory"
 	"github.com/ChamsBouzaiene/dodo/internal/indexer"
+	"github.com/ChamsBouzaiene/dodo/internal/tools/execution"
 )
 
 func main() {
@@ -21,6 +23,39 @@ func main() {
 	ctx := context.Background()
 
 	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "config" {
+		if err := runConfigCommand(os.Stdout, args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "dodo config: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(args) > 0 && args[0] == "sessions" {
+		if err := runSessionsCommand(os.Stdout, args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "dodo sessions: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(args) > 0 && args[0] == "mcp" {
+		if err := runMCPCommand(ctx, args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "dodo mcp: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(args) > 1 && args[0] == "engine" && args[1] == "schema" {
+		schema, err := engineprotocol.Schema()
+		if err != nil {
+			log.Fatalf("engine schema: %v", err)
+		}
+		fmt.Println(string(schema))
+		return
+	}
+
 	if len(args) > 0 && args[0] == "engine" {
 		if err := runEngineCommand(ctx, args[1:]); err != nil {
 			// Check if we're in stdio mode by looking for --stdio flag
@@ -52,37 +87,47 @@ func runDefaultCommand(ctx context.Context, args []string) error {
 	fs := flag.NewFlagSet("dodo", flag.ExitOnError)
 	enableStreaming := fs.Bool("stream", false, "Enable streaming mode for incremental output")
 	repoFlag := fs.String("repo", "", "Path to repository root (default: current directory)")
+	configFlags := registerConfigFlags(fs)
 
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 
-	env, err := prepareRuntimeEnv(ctx, *repoFlag)
+	env, err := prepareRuntimeEnv(ctx, *repoFlag, configFlags())
 	if err != nil {
 		return err
 	}
 	defer env.Close()
 
-	runBrainMode(ctx, env.RepoRoot, env.Retrieval, env.WorkspaceCtx, *enableStreaming)
+	runBrainMode(ctx, env.RepoRoot, env.Retrieval, env.WorkspaceCtx, env.Runner, env.tools(), *enableStreaming)
 	return nil
 }
 
 func runEngineCommand(ctx context.Context, args []string) error {
 	fs := flag.NewFlagSet("engine", flag.ExitOnError)
 	repoFlag := fs.String("repo", "", "Path to repository root (default: current directory)")
-	enableStreaming := fs.Bool("stream", true, "Enable streaming mode when serving over stdio")
+	enableStreaming := fs.Bool("stream", true, "Enable streaming mode when serving the protocol")
 	stdioMode := fs.Bool("stdio", false, "Serve the engine over the NDJSON stdio protocol")
+	listen := fs.String("listen", "", "Serve the NDJSON protocol on unix:///path or tcp://127.0.0.1:port to several clients")
+	httpAddr := fs.String("http", "", "Serve the protocol as HTTP commands and SSE event streams on a loopback host:port")
+	token := fs.String("token", os.Getenv("DODO_ENGINE_TOKEN"), "Token TCP and HTTP clients must present (default: generated into ~/.dodo/engine.token)")
+	allowRemote := fs.Bool("allow-remote", false, "Allow --listen tcp:// on a non-loopback address")
+	configFlags := registerConfigFlags(fs)
 
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 
+	if *stdioMode && (*listen != "" || *httpAddr != "") {
+		return fmt.Errorf("--stdio cannot be combined with --listen or --http")
+	}
+
 	// Redirect logs to stderr in stdio mode to avoid corrupting the protocol
 	if *stdioMode {
 		log.SetOutput(os.Stderr)
 	}
 
-	env, err := prepareRuntimeEnv(ctx, *repoFlag)
+	env, err := prepareRuntimeEnv(ctx, *repoFlag, configFlags())
 	if err != nil {
 		// In stdio mode, print errors to stderr so they don't corrupt the protocol
 		if *stdioMode {
@@ -95,15 +140,18 @@ func runEngineCommand(ctx context.Context, args []string) error {
 	if *stdioMode {
 		return runStdIOEngine(ctx, env, *enableStreaming)
 	}
+	if *listen != "" || *httpAddr != "" {
+		return runEngineServers(ctx, env, *enableStreaming, *listen, *httpAddr, *token, *allowRemote)
+	}
 
-	runBrainMode(ctx, env.RepoRoot, env.Retrieval, env.WorkspaceCtx, *enableStreaming)
+	runBrainMode(ctx, env.RepoRoot, env.Retrieval, env.WorkspaceCtx, env.Runner, env.tools(), *enableStreaming)
 	return nil
 }
 
-func runBrainMode(ctx context.Context, absRepoRoot string, retrieval indexer.Retrieval, workspaceCtx *indexer.WorkspaceContext, streaming bool) {
+func runBrainMode(ctx context.Context, absRepoRoot string, retrieval indexer.Retrieval, workspaceCtx *indexer.WorkspaceContext, runner execution.Runner, extraTools engine.ToolRegistry, streaming bool) {
 	log.Println("🧠 Starting brain agent (interactive mode)")
 
-	brainAgent, err := factory.BuildBrainAgent(ctx, absRepoRoot, retrieval, workspaceCtx, streaming, false)
+	brainAgent, err := factory.BuildBrainAgent(ctx, absRepoRoot, retrieval, workspaceCtx, runner, extraTools, streaming, false)
 	if err != nil {
 		log.Fatalf("failed to create brain agent: %v", err)
 	}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/ChamsBouzaiene/dodo/internal/config"
+	"github.com/ChamsBouzaiene/dodo/internal/engine"
+	engineprotocol "github.com/ChamsBouzaiene/dodo/internal/engine/protocol"
+	"github.com/ChamsBouzaiene/dodo/internal/mcp"
+)
+
+// connectMCP connects a starting session to the MCP servers configured for
+// its repository and returns their tools. Servers that fail to come up are
+// reported and left out; they don't keep the session from starting.
+func (m *sessionManager) connectMCP(ctx context.Context, sess *sessionState) engine.ToolRegistry {
+	servers, err := m.env.Config.WithRepo(sess.repoRoot).MCPServers()
+	if err != nil {
+		log.Printf("⚠️  MCP configuration: %v", err)
+	}
+	if len(servers) == 0 {
+		return nil
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		tools   = make(engine.ToolRegistry)
+		clients []*mcp.Client
+	)
+	for name, server := range servers {
+		sess.emit(engineprotocol.NewMCPServerStatusEvent(sess.id, name, engineprotocol.MCPStatusConnecting, nil, ""))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client, reg, err := connectMCPServer(ctx, name, server, sess.repoRoot)
+			if err != nil {
+				log.Printf("⚠️  MCP server %s: %v", name, err)
+				sess.emit(engineprotocol.NewMCPServerStatusEvent(sess.id, name, engineprotocol.MCPStatusFailed, nil, err.Error()))
+				return
+			}
+			names := make([]string, 0, len(reg))
+			mu.Lock()
+			for toolName, tool := range reg {
+				tools[toolName] = tool
+				names = append(names, toolName)
+			}
+			clients = append(clients, client)
+			mu.Unlock()
+			sort.Strings(names)
+			log.Printf("MCP server %s ready with %d tools", name, len(names))
+			sess.emit(engineprotocol.NewMCPServerStatusEvent(sess.id, name, engineprotocol.MCPStatusReady, names, ""))
+		}()
+	}
+	wg.Wait()
+
+	sess.mu.Lock()
+	sess.mcpClients = clients
+	sess.mu.Unlock()
+	return tools
+}
+
+func connectMCPServer(ctx context.Context, name string, server config.MCPServer, dir string) (*mcp.Client, engine.ToolRegistry, error) {
+	client, err := mcp.Connect(ctx, name, server, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	reg, err := client.EngineTools(ctx)
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+	return client, reg, nil
+}
+
+// closeMCP disconnects the session from its MCP servers.
+func (s *sessionState) closeMCP() {
+	s.mu.Lock()
+	clients := s.mcpClients
+	s.mcpClients = nil
+	s.mu.Unlock()
+
+	for _, c := range clients {
+		if err := c.Close(); err != nil {
+			log.Printf("closing MCP server %s: %v", c.Name, err)
+		}
+		s.emit(engineprotocol.NewMCPServerStatusEvent(s.id, c.Name, engineprotocol.MCPStatusClosed, nil, ""))
+	}
+}
+
+// closeAllMCP disconnects every live session from its MCP servers, when
+// the engine shuts down.
+func (m *sessionManager) closeAllMCP() {
+	m.mu.Lock()
+	sessions := make([]*sessionState, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		sessions = append(sessions, s)
+	}
+	m.mu.Unlock()
+
+	for _, s := range sessions {
+		s.closeMCP()
+	}
+}
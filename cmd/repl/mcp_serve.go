@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/ChamsBouzaiene/dodo/internal/engine"
+	"github.com/ChamsBouzaiene/dodo/internal/mcp"
+	"github.com/ChamsBouzaiene/dodo/internal/tools"
+)
+
+// mcpReadTools are the tools `dodo mcp serve` always offers.
+var mcpReadTools = []string{"codebase_search", "read_span", "grep", "list_files", "read_file"}
+
+// mcpEditTools are added by --allow-edits.
+var mcpEditTools = []string{"search_replace", "write"}
+
+const mcpInstructions = "Tools over the repository at %s. codebase_search finds code by meaning and keywords using dodo's hybrid index; read_span reads the lines it points at."
+
+func runMCPCommand(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] != "serve" {
+		return fmt.Errorf("usage: dodo mcp serve [--repo DIR] [--allow-edits]")
+	}
+	fs := flag.NewFlagSet("mcp serve", flag.ExitOnError)
+	repoFlag := fs.String("repo", "", "Path to repository root (default: current directory)")
+	allowEdits := fs.Bool("allow-edits", false, "Also offer the search_replace and write editing tools")
+	configFlags := registerConfigFlags(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	// stdout carries the protocol
+	log.SetOutput(os.Stderr)
+
+	env, err := prepareRuntimeEnv(ctx, *repoFlag, configFlags())
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	reg, err := mcpServeTools(env.repoEnv, *allowEdits)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(reg))
+	for name := range reg {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	log.Printf("Serving MCP over stdio with %d tools: %s", len(names), strings.Join(names, ", "))
+
+	server := &mcp.Server{Info: mcp.Implementation{Name: "dodo"}, Tools: reg}
+	if env.Retrieval != nil {
+		server.Instructions = fmt.Sprintf(mcpInstructions, env.RepoRoot)
+	}
+	return server.ServeStdio(ctx, os.Stdin, os.Stdout)
+}
+
+// mcpServeTools picks the tools `dodo mcp serve` offers from the repository's
+// registry, plus its language-server tools. The semantic tools are missing
+// when the index could not be set up.
+func mcpServeTools(env *repoEnv, allowEdits bool) (engine.ToolRegistry, error) {
+	all, err := tools.NewToolRegistry(env.RepoRoot, env.Retrieval, env.Runner, engine.ToolSet{
+		Filesystem: true,
+		Search:     true,
+		Semantic:   env.Retrieval != nil,
+		Editing:    allowEdits,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if env.Retrieval == nil {
+		log.Printf("⚠️  Semantic search is unavailable; codebase_search and read_span are not offered")
+	}
+
+	names := mcpReadTools
+	if allowEdits {
+		names = slices.Concat(mcpReadTools, mcpEditTools)
+	}
+	reg := make(engine.ToolRegistry, len(names))
+	for _, name := range names {
+		if t, ok := all[name]; ok {
+			reg[name] = t
+		}
+	}
+	maps.Copy(reg, env.tools())
+	return reg, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/ChamsBouzaiene/dodo/internal/config"
+	engineprotocol "github.com/ChamsBouzaiene/dodo/internal/engine/protocol"
+	"github.com/ChamsBouzaiene/dodo/internal/memory"
+)
+
+// memoryReply emits ev, or a memory_error when err is set.
+func memoryReply(emit func(engineprotocol.Event), ev engineprotocol.Event, err error) error {
+	if err != nil {
+		emit(engineprotocol.NewErrorEvent("", err.Error(), "memory_error", ""))
+		return err
+	}
+	emit(ev)
+	return nil
+}
+
+func (r *stdioRunner) listMemories(cmd engineprotocol.ListMemoriesCommand) (engineprotocol.Event, error) {
+	repoRoot, err := r.manager.resolveRepo(cmd.RepoRoot)
+	if err != nil {
+		return nil, err
+	}
+	found, err := r.manager.repos.memoryStore(repoRoot).Recall(cmd.Query, cmd.Kind, cmd.Limit)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]engineprotocol.MemoryInfo, 0, len(found))
+	for _, m := range found {
+		infos = append(infos, memoryInfo(m))
+	}
+	return engineprotocol.NewMemoriesListedEvent(cmd.Query, infos), nil
+}
+
+func (r *stdioRunner) saveMemory(cmd engineprotocol.SaveMemoryCommand) (engineprotocol.Event, error) {
+	repoRoot, err := r.manager.resolveRepo(cmd.RepoRoot)
+	if err != nil {
+		return nil, err
+	}
+	store := r.manager.repos.memoryStore(repoRoot)
+	var m memory.Memory
+	if cmd.MemoryID != "" {
+		m, err = store.Update(cmd.MemoryID, cmd.Kind, cmd.Content, cmd.Tags)
+	} else {
+		m, err = store.Remember(cmd.Kind, cmd.Content, cmd.Tags)
+	}
+	if errors.Is(err, memory.ErrNotFound) {
+		return nil, fmt.Errorf("memory not found: %s", cmd.MemoryID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return engineprotocol.NewMemorySavedEvent(memoryInfo(m)), nil
+}
+
+func (r *stdioRunner) forgetMemory(cmd engineprotocol.ForgetMemoryCommand) (engineprotocol.Event, error) {
+	repoRoot, err := r.manager.resolveRepo(cmd.RepoRoot)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.manager.repos.memoryStore(repoRoot).Forget(cmd.MemoryID); errors.Is(err, memory.ErrNotFound) {
+		return nil, fmt.Errorf("memory not found: %s", cmd.MemoryID)
+	} else if err != nil {
+		return nil, err
+	}
+	return engineprotocol.NewMemoryForgottenEvent(cmd.MemoryID), nil
+}
+
+func memoryInfo(m memory.Memory) engineprotocol.MemoryInfo {
+	return engineprotocol.MemoryInfo{
+		ID:        m.ID,
+		Kind:      m.Kind,
+		Content:   m.Content,
+		Tags:      m.Tags,
+		CreatedAt: m.CreatedAt,
+		UpdatedAt: m.UpdatedAt,
+	}
+}
+
+// memoryBudget is the memory_tokens setting of repoRoot.
+func memoryBudget(loader *config.Loader, repoRoot string) int {
+	settings, err := loader.WithRepo(repoRoot).Load()
+	if err != nil {
+		return 0
+	}
+	return settings.Int("memory_tokens")
+}
+
+// recallMemories builds the project memory section of the system prompt
+// for a run about message: the memories relevant to it, then the others
+// that fit in the session's budget.
+func (s *sessionState) recallMemories(message string) {
+	if s.memories == nil || s.memoryBudget <= 0 {
+		return
+	}
+	all, err := s.memories.List()
+	if err != nil {
+		log.Printf("failed to read project memory: %v", err)
+		s.agent.SetSystemContext("")
+		return
+	}
+	picked := memory.Select(all, message, s.memoryBudget)
+	s.agent.SetSystemContext(memory.Section(picked))
+	if len(picked) > 0 {
+		s.emit(engineprotocol.NewStatusEvent(s.id, "memories_recalled", fmt.Sprintf("Recalled %d project memories", len(picked))))
+	}
+}
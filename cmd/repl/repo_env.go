@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/ChamsBouzaiene/dodo/internal/config"
+	"github.com/ChamsBouzaiene/dodo/internal/memory"
+)
+
+// repoEnvs hands out the runtime of each repository an engine hosts
+// sessions for. A repository's runtime is opened when its first session
+// starts and closed when its last one is deleted or unloaded; the one the
+// process was started in stays open for the process's lifetime.
+type repoEnvs struct {
+	ctx    context.Context // indexers run under it, so they outlive the command that opened them
+	config *config.Loader
+	pinned *repoEnv
+	open   func(ctx context.Context, repoRoot string, settings *config.Settings) *repoEnv
+
+	mu       sync.Mutex
+	entries  map[string]*repoEntry
+	memories map[string]*memory.Store // by repository, kept while the engine runs
+}
+
+type repoEntry struct {
+	ready chan struct{} // closed once env is set
+	env   *repoEnv
+	refs  int
+}
+
+func newRepoEnvs(ctx context.Context, env *runtimeEnv) *repoEnvs {
+	r := &repoEnvs{
+		ctx:      ctx,
+		config:   env.Config,
+		pinned:   env.repoEnv,
+		open:     openRepoEnv,
+		entries:  make(map[string]*repoEntry),
+		memories: make(map[string]*memory.Store),
+	}
+	ready := make(chan struct{})
+	close(ready)
+	r.entries[env.RepoRoot] = &repoEntry{ready: ready, env: env.repoEnv}
+	return r
+}
+
+// acquire returns the runtime of the repository at repoRoot, an absolute
+// directory, opening it on first use. Each acquire is paired with a
+// release.
+func (r *repoEnvs) acquire(repoRoot string) *repoEnv {
+	r.mu.Lock()
+	e, ok := r.entries[repoRoot]
+	if ok {
+		e.refs++
+		r.mu.Unlock()
+		<-e.ready
+		return e.env
+	}
+	e = &repoEntry{ready: make(chan struct{}), refs: 1}
+	r.entries[repoRoot] = e
+	r.mu.Unlock()
+
+	// Opening indexes the repository, so other repositories are served
+	// meanwhile; sessions of this one wait on ready.
+	log.Printf("Opening repository %s", repoRoot)
+	settings, err := r.config.WithRepo(repoRoot).Load()
+	if err != nil {
+		log.Printf("⚠️  Ignoring invalid configuration for %s: %v", repoRoot, err)
+	}
+	e.env = r.open(r.ctx, repoRoot, settings)
+	close(e.ready)
+	return e.env
+}
+
+// release drops a reference taken by acquire, closing the repository's
+// runtime when it was the last.
+func (r *repoEnvs) release(env *repoEnv) {
+	if env == nil || env == r.pinned {
+		return
+	}
+	r.mu.Lock()
+	e, ok := r.entries[env.RepoRoot]
+	if !ok || e.env != env {
+		r.mu.Unlock()
+		return
+	}
+	e.refs--
+	if e.refs > 0 {
+		r.mu.Unlock()
+		return
+	}
+	delete(r.entries, env.RepoRoot)
+	r.mu.Unlock()
+
+	steps, toolCalls, tokens := env.Metrics.Counts()
+	log.Printf("Closing repository %s after %d steps, %d tool calls, %d tokens", env.RepoRoot, steps, toolCalls, tokens)
+	env.close()
+}
+
+// memoryStore returns the project memory of the repository at repoRoot.
+// Its sessions and the memory commands share the store, which serializes
+// their writes, whether or not the repository's runtime is open.
+func (r *repoEnvs) memoryStore(repoRoot string) *memory.Store {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	store, ok := r.memories[repoRoot]
+	if !ok {
+		store = memory.NewStore(repoRoot)
+		r.memories[repoRoot] = store
+	}
+	return store
+}
+
+// closeAll closes every runtime but the pinned one, which its runtimeEnv
+// closes.
+func (r *repoEnvs) closeAll() {
+	r.mu.Lock()
+	var envs []*repoEnv
+	for root, e := range r.entries {
+		select {
+		case <-e.ready:
+		default:
+			continue // still opening; it is stopped with ctx
+		}
+		if e.env != r.pinned {
+			envs = append(envs, e.env)
+		}
+		delete(r.entries, root)
+	}
+	r.mu.Unlock()
+
+	for _, env := range envs {
+		env.close()
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ChamsBouzaiene/dodo/internal/config"
+	"github.com/ChamsBouzaiene/dodo/internal/engine"
+	engineprotocol "github.com/ChamsBouzaiene/dodo/internal/engine/protocol"
+)
+
+// newTestRepoEnvs returns repoEnvs pinned to /engine that counts the
+// runtimes it opens instead of indexing anything.
+func newTestRepoEnvs(t *testing.T) (*repoEnvs, *atomic.Int32) {
+	t.Helper()
+	dir := t.TempDir()
+	pinned := &repoEnv{RepoRoot: "/engine"}
+	r := newRepoEnvs(context.Background(), &runtimeEnv{
+		repoEnv: pinned,
+		Config:  &config.Loader{UserPath: filepath.Join(dir, "config.json")},
+	})
+	var opened atomic.Int32
+	r.open = func(ctx context.Context, repoRoot string, settings *config.Settings) *repoEnv {
+		opened.Add(1)
+		time.Sleep(10 * time.Millisecond) // let concurrent acquires wait on ready
+		return &repoEnv{RepoRoot: repoRoot, Metrics: engine.NewMetrics("", "")}
+	}
+	return r, &opened
+}
+
+func (r *repoEnvs) refs(repoRoot string) (int, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.entries[repoRoot]
+	if !ok {
+		return 0, false
+	}
+	return e.refs, true
+}
+
+func TestRepoEnvsShareAndRelease(t *testing.T) {
+	r, opened := newTestRepoEnvs(t)
+
+	var wg sync.WaitGroup
+	envs := make([]*repoEnv, 3)
+	for i := range envs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			envs[i] = r.acquire("/other")
+		}()
+	}
+	wg.Wait()
+	if opened.Load() != 1 || envs[0] != envs[1] || envs[1] != envs[2] {
+		t.Fatalf("three acquires opened %d runtimes, want one shared", opened.Load())
+	}
+	if refs, _ := r.refs("/other"); refs != 3 {
+		t.Errorf("refs = %d, want 3", refs)
+	}
+
+	r.release(envs[0])
+	r.release(envs[1])
+	if _, ok := r.refs("/other"); !ok {
+		t.Fatal("runtime closed while a session still uses it")
+	}
+	r.release(envs[2])
+	if _, ok := r.refs("/other"); ok {
+		t.Fatal("runtime still open after its last release")
+	}
+	r.release(envs[2]) // a stale release is ignored
+
+	if env := r.acquire("/other"); env == envs[0] || opened.Load() != 2 {
+		t.Errorf("acquire after teardown reused the closed runtime (%d opened)", opened.Load())
+	}
+
+	// The engine's own repository is never opened or closed.
+	pinned := r.acquire("/engine")
+	if pinned != r.pinned || opened.Load() != 2 {
+		t.Fatalf("acquire(/engine) = %p, want the pinned runtime", pinned)
+	}
+	r.release(pinned)
+	r.release(pinned)
+	if _, ok := r.refs("/engine"); !ok {
+		t.Error("pinned runtime was released")
+	}
+
+	r.closeAll()
+	if _, ok := r.refs("/other"); ok {
+		t.Error("closeAll left a runtime open")
+	}
+}
+
+func TestRepoEnvsShareMemoryStore(t *testing.T) {
+	r, _ := newTestRepoEnvs(t)
+
+	store := r.memoryStore("/other")
+	env := r.acquire("/other")
+	if r.memoryStore("/other") != store {
+		t.Error("opening the repository replaced its memory store")
+	}
+	r.release(env)
+	if r.memoryStore("/other") != store {
+		t.Error("closing the repository replaced its memory store")
+	}
+	if r.memoryStore("/engine") == store {
+		t.Error("two repositories share a memory store")
+	}
+}
+
+func TestUnloadIdleReleasesRepository(t *testing.T) {
+	r, _ := newTestRepoEnvs(t)
+	events := make(chan engineprotocol.Event, 16)
+	m := &sessionManager{sessions: make(map[string]*sessionState), repos: r, events: events}
+
+	now := time.Now()
+	add := func(id string, lastUsed time.Time, running bool) {
+		m.sessions[id] = &sessionState{id: id, env: r.acquire("/other"), eventSink: events, lastUsed: lastUsed, running: running}
+	}
+	add("idle", now.Add(-time.Hour), false)
+	add("watched", now.Add(-time.Hour), false)
+	add("running", now.Add(-time.Hour), true)
+	add("recent", now, false)
+
+	cutoff := now.Add(-sessionIdleTimeout)
+	m.unloadIdle(cutoff, func(id string) bool { return id == "watched" })
+	if _, ok := m.sessions["idle"]; ok {
+		t.Error("idle session still loaded")
+	}
+	for _, id := range []string{"watched", "running", "recent"} {
+		if _, ok := m.sessions[id]; !ok {
+			t.Errorf("session %s was unloaded", id)
+		}
+	}
+	if refs, _ := r.refs("/other"); refs != 3 {
+		t.Errorf("refs = %d after unloading one of four sessions, want 3", refs)
+	}
+	if ev := <-events; ev.GetSessionID() != "idle" {
+		t.Errorf("event = %+v, want session_unloaded for idle", ev)
+	}
+
+	// Once nothing holds them, the rest go too and the runtime is closed.
+	m.sessions["running"].endRun()
+	m.sessions["running"].lastUsed = now.Add(-time.Hour)
+	m.unloadIdle(now.Add(time.Second), func(string) bool { return false })
+	if len(m.sessions) != 0 {
+		t.Errorf("%d sessions still loaded", len(m.sessions))
+	}
+	if _, ok := r.refs("/other"); ok {
+		t.Error("runtime still open after every session was unloaded")
+	}
+}
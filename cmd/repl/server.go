@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	engineprotocol "github.com/ChamsBouzaiene/dodo/internal/engine/protocol"
+)
+
+var errUnauthorized = errors.New("client has not authenticated")
+
+// clientWriteTimeout is how long a socket or SSE client may take to accept
+// an event before it is disconnected.
+const clientWriteTimeout = 30 * time.Second
+
+// eventHub fans session events out to the clients watching each session.
+type eventHub struct {
+	mu      sync.Mutex
+	clients map[*stdioRunner]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{clients: make(map[*stdioRunner]struct{})}
+}
+
+// run publishes events until the channel is closed.
+func (h *eventHub) run(events <-chan engineprotocol.Event) {
+	for ev := range events {
+		h.publish(ev)
+	}
+}
+
+func (h *eventHub) publish(ev engineprotocol.Event) {
+	h.mu.Lock()
+	targets := make([]*stdioRunner, 0, len(h.clients))
+	for c := range h.clients {
+		targets = append(targets, c)
+	}
+	h.mu.Unlock()
+
+	for _, c := range targets {
+		if c.watches(ev.GetSessionID()) {
+			c.emitEvent(ev)
+		}
+	}
+}
+
+// watching reports whether a client has subscribed to sessionID. Clients
+// receiving every session's events don't keep sessions loaded.
+func (h *eventHub) watching(sessionID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		if c.subscribed(sessionID) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *eventHub) add(c *stdioRunner) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clients[c] = struct{}{}
+}
+
+func (h *eventHub) remove(c *stdioRunner) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients, c)
+}
+
+// runEngineServers serves one engine on a socket (listen: unix:///path or
+// tcp://host:port) and/or the HTTP gateway (httpAddr) until interrupted.
+// Clients share the engine's sessions. TCP and HTTP clients must present
+// token; when it is empty one is generated into ~/.dodo/engine.token.
+// allowRemote lets the socket listen on a non-loopback TCP address.
+func runEngineServers(ctx context.Context, env *runtimeEnv, streaming bool, listen, httpAddr, token string, allowRemote bool) error {
+	needsToken := httpAddr != "" || strings.HasPrefix(listen, "tcp:")
+	if needsToken && token == "" {
+		var err error
+		if token, err = writeEngineToken(); err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	host := newEngineHost(ctx, env, streaming)
+	defer host.close()
+
+	var servers []func() error
+	if listen != "" {
+		servers = append(servers, func() error { return serveSocket(ctx, host, listen, token, allowRemote) })
+	}
+	if httpAddr != "" {
+		servers = append(servers, func() error { return serveHTTP(ctx, host, httpAddr, token) })
+	}
+
+	errCh := make(chan error, len(servers))
+	for _, serve := range servers {
+		go func() { errCh <- serve() }()
+	}
+	var first error
+	for range servers {
+		if err := <-errCh; err != nil && first == nil {
+			first = err
+			stop() // take the other server down too
+		}
+	}
+	return first
+}
+
+// serveSocket serves the NDJSON protocol to every connection on listen.
+// A TCP address must be a loopback one unless allowRemote is set.
+func serveSocket(ctx context.Context, host *engineHost, listen, token string, allowRemote bool) error {
+	network, address, err := parseListenAddr(listen, allowRemote)
+	if err != nil {
+		return err
+	}
+	var ln net.Listener
+	if network == "unix" {
+		token = "" // the socket's file permissions guard it
+		if err := removeStaleSocket(address); err != nil {
+			return err
+		}
+		ln, err = listenUnix(address)
+	} else {
+		ln, err = net.Listen(network, address)
+	}
+	if err != nil {
+		return fmt.Errorf("listen on %s: %w", listen, err)
+	}
+	stopClose := context.AfterFunc(ctx, func() { ln.Close() })
+	defer stopClose()
+	log.Printf("🔌 Engine listening on %s", listen)
+
+	var wg sync.WaitGroup
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			log.Printf("accept: %v", err)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+			// Unblock the client's read on shutdown.
+			stopClose := context.AfterFunc(ctx, func() { conn.Close() })
+			defer stopClose()
+			client := host.newClient(conn, deadlineWriter{conn}, token)
+			client.emitEvent(engineprotocol.NewStatusEvent("", "engine_ready", "socket protocol ready"))
+			client.offerInterrupted()
+			if err := client.Run(ctx); err != nil {
+				log.Printf("client %s: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// deadlineWriter fails a write the client doesn't accept within
+// clientWriteTimeout, so that a stalled client is disconnected.
+type deadlineWriter struct {
+	conn net.Conn
+}
+
+func (w deadlineWriter) Write(p []byte) (int, error) {
+	w.conn.SetWriteDeadline(time.Now().Add(clientWriteTimeout))
+	return w.conn.Write(p)
+}
+
+// parseListenAddr splits a --listen value into a network and an address.
+// A TCP host must be a loopback one unless allowRemote is set.
+func parseListenAddr(listen string, allowRemote bool) (string, string, error) {
+	u, err := url.Parse(listen)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid --listen %q: %w", listen, err)
+	}
+	switch u.Scheme {
+	case "unix":
+		path := u.Path
+		if u.Host != "" { // unix://relative/path
+			path = u.Host + u.Path
+		}
+		if path == "" {
+			return "", "", fmt.Errorf("invalid --listen %q: missing socket path", listen)
+		}
+		return "unix", path, nil
+	case "tcp":
+		if u.Host == "" || u.Port() == "" {
+			return "", "", fmt.Errorf("invalid --listen %q: expected tcp://host:port", listen)
+		}
+		if ip := net.ParseIP(u.Hostname()); u.Hostname() != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			if !allowRemote {
+				return "", "", fmt.Errorf("invalid --listen %q: not a loopback address (pass --allow-remote to accept other hosts' connections)", listen)
+			}
+			log.Printf("⚠️  engine is listening on non-loopback address %s; anyone with the token can drive it", u.Host)
+		}
+		return "tcp", u.Host, nil
+	}
+	return "", "", fmt.Errorf("invalid --listen %q: scheme must be unix or tcp", listen)
+}
+
+// removeStaleSocket deletes a socket file left behind by an engine that is no
+// longer running, and refuses to take over one that is.
+func removeStaleSocket(path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return os.MkdirAll(filepath.Dir(path), 0700)
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("another engine is already listening on %s", path)
+	}
+	return os.Remove(path)
+}
+
+// writeEngineToken generates a client token and stores it in
+// ~/.dodo/engine.token for local clients to read.
+func writeEngineToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate engine token: %w", err)
+	}
+	token := hex.EncodeToString(buf)
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home dir: %w", err)
+	}
+	path := filepath.Join(home, ".dodo", "engine.token")
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("write engine token: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("write engine token: %w", err)
+	}
+	log.Printf("Engine token written to %s", path)
+	return token, nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	engineprotocol "github.com/ChamsBouzaiene/dodo/internal/engine/protocol"
+)
+
+func TestParseListenAddr(t *testing.T) {
+	tests := []struct {
+		listen      string
+		allowRemote bool
+		network     string
+		address     string
+		wantErr     string
+	}{
+		{listen: "unix:///run/dodo.sock", network: "unix", address: "/run/dodo.sock"},
+		{listen: "unix://engine.sock", network: "unix", address: "engine.sock"},
+		{listen: "tcp://127.0.0.1:7777", network: "tcp", address: "127.0.0.1:7777"},
+		{listen: "tcp://localhost:7777", network: "tcp", address: "localhost:7777"},
+		{listen: "tcp://[::1]:7777", network: "tcp", address: "[::1]:7777"},
+		{listen: "tcp://0.0.0.0:7777", wantErr: "--allow-remote"},
+		{listen: "tcp://example.com:7777", wantErr: "--allow-remote"},
+		{listen: "tcp://0.0.0.0:7777", allowRemote: true, network: "tcp", address: "0.0.0.0:7777"},
+		{listen: "tcp://127.0.0.1", wantErr: "expected tcp://host:port"},
+		{listen: "unix://", wantErr: "missing socket path"},
+		{listen: "http://127.0.0.1:7777", wantErr: "scheme must be unix or tcp"},
+	}
+	for _, tt := range tests {
+		network, address, err := parseListenAddr(tt.listen, tt.allowRemote)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseListenAddr(%q) error = %v, want %q", tt.listen, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || network != tt.network || address != tt.address {
+			t.Errorf("parseListenAddr(%q) = %q, %q, %v", tt.listen, network, address, err)
+		}
+	}
+}
+
+// socketClient speaks the protocol over one connection.
+type socketClient struct {
+	t      *testing.T
+	conn   net.Conn
+	events *bufio.Scanner
+}
+
+func dialSocket(t *testing.T, path string) *socketClient {
+	t.Helper()
+	var conn net.Conn
+	var err error
+	for range 100 {
+		if conn, err = net.Dial("unix", path); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("dial %s: %v", path, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &socketClient{t: t, conn: conn, events: bufio.NewScanner(conn)}
+}
+
+func (c *socketClient) send(line string) {
+	c.t.Helper()
+	if _, err := c.conn.Write([]byte(line + "\n")); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// next returns the next event of type typ, skipping the others.
+func (c *socketClient) next(typ engineprotocol.EventType) map[string]any {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for c.events.Scan() {
+		var ev map[string]any
+		if err := json.Unmarshal(c.events.Bytes(), &ev); err != nil {
+			c.t.Fatalf("bad event %s: %v", c.events.Text(), err)
+		}
+		if ev["type"] == string(typ) {
+			return ev
+		}
+	}
+	c.t.Fatalf("no %s event: %v", typ, c.events.Err())
+	return nil
+}
+
+// result returns the result of the command sent with requestID.
+func (c *socketClient) result(requestID string) map[string]any {
+	c.t.Helper()
+	for {
+		if ev := c.next(engineprotocol.EventResult); ev["request_id"] == requestID {
+			return ev
+		}
+	}
+}
+
+// hello performs the handshake.
+func (c *socketClient) hello() {
+	c.t.Helper()
+	c.next(engineprotocol.EventStatus) // engine_ready
+	c.send(`{"type":"hello","protocol_version":"` + engineprotocol.ProtocolVersion + `","capabilities":["subscriptions"],"request_id":"h"}`)
+	welcome := c.next(engineprotocol.EventWelcome)
+	if welcome["protocol_version"] != engineprotocol.ProtocolVersion {
+		c.t.Errorf("welcome = %v", welcome)
+	}
+	c.result("h")
+}
+
+// serveTestSocket serves host on a unix socket until the test ends and
+// returns the socket's path.
+func serveTestSocket(t *testing.T, host *engineHost) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("socket modes are a unix feature")
+	}
+	path := filepath.Join(t.TempDir(), "engine.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- serveSocket(ctx, host, "unix://"+path, "", false) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("serveSocket: %v", err)
+		}
+	})
+	return path
+}
+
+func TestSocketServerSharesSessions(t *testing.T) {
+	host := newTestHost(t)
+	s1 := addTestSession(t, host, "s1")
+	path := serveTestSocket(t, host)
+
+	watcher, other := dialSocket(t, path), dialSocket(t, path)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("socket mode = %o, want 600", perm)
+	}
+
+	watcher.hello()
+	other.hello()
+	if _, err := net.Dial("unix", path); err != nil {
+		t.Fatalf("third client refused: %v", err)
+	}
+
+	watcher.send(`{"type":"subscribe","session_id":"s1","request_id":"sub"}`)
+	if result := watcher.result("sub"); result["ok"] != true {
+		t.Fatalf("subscribe result = %v", result)
+	}
+	s1.emit(engineprotocol.NewStatusEvent("s1", "thinking", "for the watcher"))
+	if ev := watcher.next(engineprotocol.EventStatus); ev["session_id"] != "s1" || ev["detail"] != "for the watcher" {
+		t.Errorf("watcher got %v, want s1's status", ev)
+	}
+
+	// The other client only gets the sessions it subscribes to: its next
+	// event is the reply to its own command, not s1's status.
+	other.send(`{"type":"list_sessions","request_id":"ls"}`)
+	for {
+		other.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if !other.events.Scan() {
+			t.Fatalf("no reply to list_sessions: %v", other.events.Err())
+		}
+		var ev map[string]any
+		json.Unmarshal(other.events.Bytes(), &ev)
+		if ev["session_id"] == "s1" {
+			t.Fatalf("unsubscribed client got %v", ev)
+		}
+		if ev["type"] == string(engineprotocol.EventResult) {
+			break
+		}
+	}
+}
+
+func TestSocketServerCutsOffStalledClient(t *testing.T) {
+	host := newTestHost(t)
+	s1 := addTestSession(t, host, "s1")
+	path := serveTestSocket(t, host)
+
+	stalled, reader := dialSocket(t, path), dialSocket(t, path)
+	for i, c := range []*socketClient{stalled, reader} {
+		c.hello()
+		id := fmt.Sprintf("sub%d", i)
+		c.send(`{"type":"subscribe","session_id":"s1","request_id":"` + id + `"}`)
+		c.result(id)
+	}
+
+	// The stalled client reads nothing more; its socket and queue fill up
+	// long before the events run out, while the reader keeps pace.
+	text := strings.Repeat("x", 4096)
+	for i := range 2000 {
+		emitted := make(chan struct{})
+		go func() {
+			s1.emit(engineprotocol.NewAssistantTextEvent("s1", text, "", false))
+			close(emitted)
+		}()
+		select {
+		case <-emitted:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("event %d: the stalled client holds back the session", i)
+		}
+		reader.next(engineprotocol.EventAssistantText)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		host.hub.mu.Lock()
+		clients := len(host.hub.clients)
+		host.hub.mu.Unlock()
+		if clients == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d clients attached, want the stalled one disconnected", clients)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/ChamsBouzaiene/dodo/internal/engine"
+	engineprotocol "github.com/ChamsBouzaiene/dodo/internal/engine/protocol"
+	"github.com/ChamsBouzaiene/dodo/internal/session"
+)
+
+var errNoSessionStore = errors.New("session store unavailable: home directory not found")
+
+// reply emits ev, or a session_error when err is set.
+func reply(emit func(engineprotocol.Event), sessionID string, ev engineprotocol.Event, err error) error {
+	if err != nil {
+		emit(engineprotocol.NewErrorEvent(sessionID, err.Error(), "session_error", ""))
+		return err
+	}
+	emit(ev)
+	return nil
+}
+
+func (r *stdioRunner) listSessions(cmd engineprotocol.ListSessionsCommand) (engineprotocol.Event, error) {
+	m := r.manager
+	if m.store == nil {
+		return nil, errNoSessionStore
+	}
+	repoRoot, err := m.resolveRepo(cmd.RepoRoot)
+	if err != nil {
+		return nil, err
+	}
+	metas, total, err := m.store.Page(repoRoot, session.ListOptions{
+		Offset:          cmd.Offset,
+		Limit:           cmd.Limit,
+		IncludeArchived: cmd.IncludeArchived,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]engineprotocol.SessionInfo, 0, len(metas))
+	for _, meta := range metas {
+		infos = append(infos, m.sessionInfo(meta))
+	}
+	next := 0
+	if end := cmd.Offset + len(metas); cmd.Limit > 0 && end < total {
+		next = end
+	}
+	return engineprotocol.NewSessionsListedEvent(infos, total, next), nil
+}
+
+func (r *stdioRunner) searchSessions(cmd engineprotocol.SearchSessionsCommand) (engineprotocol.Event, error) {
+	m := r.manager
+	repoRoot, err := m.storeRepo(cmd.RepoRoot)
+	if err != nil {
+		return nil, err
+	}
+	found, err := m.store.Search(repoRoot, cmd.Query, session.ListOptions{Limit: cmd.Limit, IncludeArchived: cmd.IncludeArchived})
+	if err != nil {
+		return nil, err
+	}
+	results := make([]engineprotocol.SessionSearchResult, 0, len(found))
+	for _, f := range found {
+		res := engineprotocol.SessionSearchResult{Session: m.sessionInfo(f.Meta), Snippet: f.Snippet}
+		if f.MessageIndex >= 0 {
+			res.MessageIndex = &f.MessageIndex
+		}
+		results = append(results, res)
+	}
+	return engineprotocol.NewSessionsFoundEvent(cmd.Query, results), nil
+}
+
+func (r *stdioRunner) getSession(cmd engineprotocol.GetSessionCommand) (engineprotocol.Event, error) {
+	sess, err := r.manager.loadStored(cmd.SessionID, cmd.RepoRoot)
+	if err != nil {
+		return nil, err
+	}
+	var messages []engineprotocol.HistoryMessage
+	if cmd.IncludeMessages {
+		messages = historyMessages(sess.History)
+	}
+	return engineprotocol.NewSessionInfoEvent(r.manager.sessionInfo(sess.Meta()), messages), nil
+}
+
+func (r *stdioRunner) renameSession(cmd engineprotocol.RenameSessionCommand) (engineprotocol.Event, error) {
+	m := r.manager
+	repoRoot, err := m.storeRepo(cmd.RepoRoot)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := m.store.Rename(cmd.SessionID, repoRoot, cmd.Title)
+	if err != nil {
+		return nil, err
+	}
+	if live, err := m.GetSession(cmd.SessionID); err == nil {
+		live.mu.Lock()
+		live.title = sess.Title
+		live.mu.Unlock()
+	}
+	return engineprotocol.NewSessionUpdatedEvent(m.sessionInfo(sess.Meta())), nil
+}
+
+func (r *stdioRunner) archiveSession(cmd engineprotocol.ArchiveSessionCommand) (engineprotocol.Event, error) {
+	m := r.manager
+	repoRoot, err := m.storeRepo(cmd.RepoRoot)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := m.store.SetArchived(cmd.SessionID, repoRoot, !cmd.Restore)
+	if err != nil {
+		return nil, err
+	}
+	if live, err := m.GetSession(cmd.SessionID); err == nil {
+		live.mu.Lock()
+		live.archived = sess.Archived
+		live.mu.Unlock()
+	}
+	return engineprotocol.NewSessionUpdatedEvent(m.sessionInfo(sess.Meta())), nil
+}
+
+func (r *stdioRunner) pinSession(cmd engineprotocol.PinSessionCommand) (engineprotocol.Event, error) {
+	m := r.manager
+	repoRoot, err := m.storeRepo(cmd.RepoRoot)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := m.store.SetPinned(cmd.SessionID, repoRoot, !cmd.Unpin)
+	if err != nil {
+		return nil, err
+	}
+	if live, err := m.GetSession(cmd.SessionID); err == nil {
+		live.mu.Lock()
+		live.pinned = sess.Pinned
+		live.mu.Unlock()
+	}
+	return engineprotocol.NewSessionUpdatedEvent(m.sessionInfo(sess.Meta())), nil
+}
+
+func (r *stdioRunner) deleteSession(cmd engineprotocol.DeleteSessionCommand) (engineprotocol.Event, error) {
+	m := r.manager
+	repoRoot, err := m.storeRepo(cmd.RepoRoot)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.closeSession(cmd.SessionID); err != nil {
+		return nil, err
+	}
+	if err := m.store.Delete(cmd.SessionID, repoRoot); err != nil {
+		return nil, err
+	}
+	return engineprotocol.NewSessionDeletedEvent(cmd.SessionID), nil
+}
+
+func (r *stdioRunner) exportSession(cmd engineprotocol.ExportSessionCommand) (engineprotocol.Event, error) {
+	sess, err := r.manager.loadStored(cmd.SessionID, cmd.RepoRoot)
+	if err != nil {
+		return nil, err
+	}
+	content, err := exportSession(sess, cmd.Format)
+	if err != nil {
+		return nil, err
+	}
+	return engineprotocol.NewSessionExportedEvent(sess.ID, cmd.Format, content), nil
+}
+
+// exportSession renders a stored session in one of the export formats.
+// The JSON document leaves out the file checkpoints kept for forking.
+func exportSession(sess *session.Session, format string) (string, error) {
+	if format != engineprotocol.ExportFormatJSON {
+		return renderTranscript(sess, format)
+	}
+	doc := *sess
+	doc.Checkpoints = nil
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("export session: %w", err)
+	}
+	return string(data), nil
+}
+
+func (r *stdioRunner) forkSession(cmd engineprotocol.ForkSessionCommand) (engineprotocol.Event, error) {
+	m := r.manager
+	repoRoot, err := m.storeRepo(cmd.RepoRoot)
+	if err != nil {
+		return nil, err
+	}
+	live, liveErr := m.GetSession(cmd.SessionID)
+	if liveErr == nil && cmd.RestoreFiles {
+		if _, running := live.status(); running {
+			return nil, fmt.Errorf("session %s is processing a request; cancel it before restoring its files", cmd.SessionID)
+		}
+	}
+	parent, err := m.store.Load(cmd.SessionID, repoRoot)
+	if err != nil {
+		return nil, fmt.Errorf("session not found: %s", cmd.SessionID)
+	}
+	index, err := historyIndex(parent.History, cmd.MessageIndex)
+	if err != nil {
+		return nil, err
+	}
+	fork, err := m.store.Fork(parent.ID, repoRoot, engineprotocol.NewSessionID(), index)
+	if err != nil {
+		return nil, err
+	}
+
+	var restored, unrestored []string
+	if cmd.RestoreFiles {
+		restored, unrestored, err = session.RestoreCheckpoints(repoRoot, parent.Checkpoints, index)
+		if err != nil {
+			return nil, fmt.Errorf("session %s forked as %s, but restoring files failed: %w", parent.ID, fork.ID, err)
+		}
+	}
+	return engineprotocol.NewSessionForkedEvent(m.sessionInfo(fork.Meta()), restored, unrestored), nil
+}
+
+// storeRepo resolves repoRoot for a command that needs the session store.
+func (m *sessionManager) storeRepo(repoRoot string) (string, error) {
+	if m.store == nil {
+		return "", errNoSessionStore
+	}
+	return m.resolveRepo(repoRoot)
+}
+
+// loadStored loads a session from the store, with the title of its live
+// copy when it is loaded in the engine.
+func (m *sessionManager) loadStored(id, repoRoot string) (*session.Session, error) {
+	repoRoot, err := m.storeRepo(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := m.store.Load(id, repoRoot)
+	if err != nil {
+		return nil, fmt.Errorf("session not found: %s", id)
+	}
+	if live, err := m.GetSession(id); err == nil {
+		sess.Title, _ = live.status()
+	}
+	return sess, nil
+}
+
+// closeSession unloads a live session so it can be deleted, releasing its
+// repository's runtime. Sessions with a run in progress are left alone.
+func (m *sessionManager) closeSession(id string) error {
+	m.mu.Lock()
+	live, ok := m.sessions[id]
+	if !ok {
+		m.mu.Unlock()
+		return nil
+	}
+	if _, running := live.status(); running {
+		m.mu.Unlock()
+		return fmt.Errorf("session %s is processing a request; cancel it first", id)
+	}
+	delete(m.sessions, id)
+	m.mu.Unlock()
+
+	live.closeMCP()
+	m.repos.release(live.env)
+	return nil
+}
+
+// sessionIdleTimeout is how long a session no client subscribes to stays
+// loaded after its last command or run. start_session with its ID loads
+// it again.
+const sessionIdleTimeout = 30 * time.Minute
+
+// unloadIdle unloads the sessions idle since before cutoff that watched
+// doesn't report, so that the runtimes of repositories nobody works in are
+// closed.
+func (m *sessionManager) unloadIdle(cutoff time.Time, watched func(sessionID string) bool) {
+	m.mu.Lock()
+	ids := slices.Collect(maps.Keys(m.sessions))
+	m.mu.Unlock()
+	ids = slices.DeleteFunc(ids, watched)
+
+	m.mu.Lock()
+	var idle []*sessionState
+	for _, id := range ids {
+		if s, ok := m.sessions[id]; ok && s.idleSince(cutoff) {
+			delete(m.sessions, id)
+			idle = append(idle, s)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, s := range idle {
+		log.Printf("Unloading idle session %s", s.id)
+		s.emit(engineprotocol.NewStatusEvent(s.id, "session_unloaded", "idle; start_session with its ID resumes it"))
+		s.closeMCP()
+		m.repos.release(s.env)
+	}
+}
+
+// sessionInfo converts stored metadata, adding the live state of sessions
+// loaded in the engine.
+func (m *sessionManager) sessionInfo(meta session.SessionMeta) engineprotocol.SessionInfo {
+	info := engineprotocol.SessionInfo{
+		ID:           meta.ID,
+		Title:        meta.Title,
+		CreatedAt:    meta.CreatedAt,
+		UpdatedAt:    meta.UpdatedAt,
+		Summary:      meta.Summary,
+		MessageCount: meta.MessageCount,
+		TokensUsed:   meta.TokensUsed,
+		FilesTouched: slices.Clone(meta.FilesTouched),
+		Archived:     meta.Archived,
+		Pinned:       meta.Pinned,
+		ParentID:     meta.ParentID,
+	}
+	if live, err := m.GetSession(meta.ID); err == nil {
+		info.Live = true
+		info.Title, info.Running = live.status()
+	}
+	return info
+}
+
+// historyMessages returns the user-visible turns of a conversation.
+func historyMessages(history []engine.ChatMessage) []engineprotocol.HistoryMessage {
+	var out []engineprotocol.HistoryMessage
+	for _, msg := range history {
+		switch msg.Role {
+		case engine.RoleUser, engine.RoleAssistant, engine.RoleSystem:
+			if msg.Content == "" {
+				continue
+			}
+			out = append(out, engineprotocol.HistoryMessage{Role: string(msg.Role), Content: msg.Content})
+		}
+	}
+	return out
+}
+
+// historyIndex returns where in history the message at index of
+// historyMessages(history) is; the length of history for the index past
+// the last one.
+func historyIndex(history []engine.ChatMessage, index int) (int, error) {
+	visible := 0
+	for i, msg := range history {
+		switch msg.Role {
+		case engine.RoleUser, engine.RoleAssistant, engine.RoleSystem:
+			if msg.Content == "" {
+				continue
+			}
+			if visible == index {
+				return i, nil
+			}
+			visible++
+		}
+	}
+	if visible == index {
+		return len(history), nil
+	}
+	return 0, fmt.Errorf("message_index %d is out of range (the session has %d messages)", index, visible)
+}
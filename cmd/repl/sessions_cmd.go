@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ChamsBouzaiene/dodo/internal/config"
+	engineprotocol "github.com/ChamsBouzaiene/dodo/internal/engine/protocol"
+	"github.com/ChamsBouzaiene/dodo/internal/session"
+)
+
+const sessionsUsage = `usage:
+  dodo sessions export <id> [--format md|html|json] [--output FILE] [--repo DIR]
+  dodo sessions pin <id> [--unpin] [--repo DIR]
+  dodo sessions gc [--dry-run]`
+
+// runSessionsCommand implements `dodo sessions`.
+func runSessionsCommand(out io.Writer, args []string) error {
+	if len(args) == 0 {
+		return errors.New(sessionsUsage)
+	}
+	switch args[0] {
+	case "export":
+		return runSessionsExport(out, args[1:])
+	case "pin":
+		return runSessionsPin(out, args[1:])
+	case "gc":
+		return runSessionsGC(out, args[1:])
+	}
+	return errors.New(sessionsUsage)
+}
+
+func runSessionsExport(out io.Writer, args []string) error {
+	fs := flag.NewFlagSet("sessions export", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	format := fs.String("format", engineprotocol.ExportFormatMarkdown, "Transcript format: md, html or json")
+	output := fs.String("output", "", "File to write the transcript to (default: stdout)")
+	repoFlag := fs.String("repo", "", "Repository the session belongs to (default: current directory)")
+	positional, err := parseInterleaved(fs, args)
+	if err != nil {
+		return fmt.Errorf("%w\n%s", err, sessionsUsage)
+	}
+	if len(positional) != 1 {
+		return errors.New(sessionsUsage)
+	}
+	switch *format {
+	case engineprotocol.ExportFormatMarkdown, engineprotocol.ExportFormatHTML, engineprotocol.ExportFormatJSON:
+	default:
+		return fmt.Errorf("unsupported format %q (use md, html or json)", *format)
+	}
+
+	repoRoot, err := sessionsRepo(*repoFlag)
+	if err != nil {
+		return err
+	}
+	store, err := openSessionStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	sess, err := store.Load(positional[0], repoRoot)
+	if err != nil {
+		return fmt.Errorf("session %s not found in %s", positional[0], repoRoot)
+	}
+	content, err := exportSession(sess, *format)
+	if err != nil {
+		return err
+	}
+	if *output != "" {
+		return os.WriteFile(*output, []byte(content), 0644)
+	}
+	_, err = io.WriteString(out, content)
+	return err
+}
+
+func runSessionsPin(out io.Writer, args []string) error {
+	fs := flag.NewFlagSet("sessions pin", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	unpin := fs.Bool("unpin", false, "Make the session collectable again")
+	repoFlag := fs.String("repo", "", "Repository the session belongs to (default: current directory)")
+	positional, err := parseInterleaved(fs, args)
+	if err != nil {
+		return fmt.Errorf("%w\n%s", err, sessionsUsage)
+	}
+	if len(positional) != 1 {
+		return errors.New(sessionsUsage)
+	}
+
+	repoRoot, err := sessionsRepo(*repoFlag)
+	if err != nil {
+		return err
+	}
+	store, err := openSessionStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	sess, err := store.SetPinned(positional[0], repoRoot, !*unpin)
+	if err != nil {
+		return fmt.Errorf("session %s not found in %s", positional[0], repoRoot)
+	}
+	if sess.Pinned {
+		fmt.Fprintf(out, "Pinned %s (%s)\n", sess.ID, sess.Title)
+	} else {
+		fmt.Fprintf(out, "Unpinned %s (%s)\n", sess.ID, sess.Title)
+	}
+	return nil
+}
+
+func runSessionsGC(out io.Writer, args []string) error {
+	fs := flag.NewFlagSet("sessions gc", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	dryRun := fs.Bool("dry-run", false, "Show what would be collected without changing anything")
+	positional, err := parseInterleaved(fs, args)
+	if err != nil {
+		return fmt.Errorf("%w\n%s", err, sessionsUsage)
+	}
+	if len(positional) != 0 {
+		return errors.New(sessionsUsage)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+	loader, err := config.NewLoader(wd, nil)
+	if err != nil {
+		return err
+	}
+	settings, err := loader.Load()
+	if err != nil {
+		return err
+	}
+	store, err := openSessionStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	actions, err := store.GC(retentionPolicy(settings), *dryRun)
+	for _, a := range actions {
+		verb := "deleted"
+		if a.Reason == session.GCArchived {
+			verb = "archived"
+		}
+		if *dryRun {
+			verb = "would be " + verb
+		}
+		fmt.Fprintf(out, "%s  %s  %q (%s, %s)\n", a.ID, a.RepoPath, a.Title, verb, gcReason(a))
+	}
+	if len(actions) == 0 {
+		fmt.Fprintln(out, "Nothing to collect")
+	}
+	return err
+}
+
+// gcReason explains why garbage collection picked a session.
+func gcReason(a session.GCAction) string {
+	switch a.Reason {
+	case session.GCAge:
+		return "too old"
+	case session.GCCount:
+		return "too many sessions in the repository"
+	case session.GCSize:
+		return fmt.Sprintf("over the total size limit, %d KB", a.Bytes/1024)
+	}
+	return fmt.Sprintf("history of %d KB", a.Bytes/1024)
+}
+
+// retentionPolicy is the garbage collection policy settings configure.
+func retentionPolicy(settings *config.Settings) session.RetentionPolicy {
+	return session.RetentionPolicy{
+		MaxAge:          time.Duration(settings.Int("session_max_age_days")) * 24 * time.Hour,
+		MaxPerRepo:      settings.Int("session_max_per_repo"),
+		MaxTotalBytes:   int64(settings.Int("session_max_total_mb")) << 20,
+		MaxHistoryBytes: int64(settings.Int("session_archive_kb")) << 10,
+	}
+}
+
+// sessionsRepo resolves --repo, defaulting to the current directory.
+func sessionsRepo(repoFlag string) (string, error) {
+	repoRoot := repoFlag
+	if repoRoot == "" {
+		var err error
+		if repoRoot, err = os.Getwd(); err != nil {
+			return "", fmt.Errorf("failed to get current directory: %w", err)
+		}
+	}
+	repoRoot, err := filepath.Abs(repoRoot)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve repository path: %w", err)
+	}
+	return repoRoot, nil
+}
+
+// openSessionStore opens the store in ~/.dodo.
+func openSessionStore() (*session.Store, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, errNoSessionStore
+	}
+	return session.NewStore(filepath.Join(homeDir, ".dodo"))
+}
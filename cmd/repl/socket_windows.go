@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+package main
+
+import "net"
+
+// listenUnix creates the socket at path. Windows has no file modes to
+// narrow; the socket's directory ACL guards it.
+func listenUnix(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
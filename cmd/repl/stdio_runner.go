@@ -3,13 +3,17 @@ package main
 import (
 	"bufio"
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -18,6 +22,8 @@ import (
 	"github.com/ChamsBouzaiene/dodo/internal/engine"
 	engineprotocol "github.com/ChamsBouzaiene/dodo/internal/engine/protocol"
 	"github.com/ChamsBouzaiene/dodo/internal/factory"
+	"github.com/ChamsBouzaiene/dodo/internal/mcp"
+	"github.com/ChamsBouzaiene/dodo/internal/memory"
 	"github.com/ChamsBouzaiene/dodo/internal/project"
 	"github.com/ChamsBouzaiene/dodo/internal/providers"
 	"github.com/ChamsBouzaiene/dodo/internal/session"
@@ -26,48 +32,155 @@ import (
 
 func runStdIOEngine(ctx context.Context, env *runtimeEnv, streaming bool) error {
 	log.Println("🔌 Starting engine stdio bridge (--stdio)")
-	runner := newStdIORunner(os.Stdin, os.Stdout, env, streaming)
+	host := newEngineHost(ctx, env, streaming)
+	defer host.close()
+	runner := host.newClient(os.Stdin, os.Stdout, "")
+	runner.subscribeAll()
 	runner.emitEvent(engineprotocol.NewStatusEvent("", "engine_ready", "stdio protocol ready"))
+	runner.offerInterrupted()
 	return runner.Run(ctx)
 }
 
+// engineHost holds what every client of one engine process shares: the
+// sessions, the configuration and the hub fanning session events out.
+type engineHost struct {
+	ctx       context.Context // commands run under it, so they outlive the client that sent them
+	manager   *sessionManager
+	config    *config.Manager
+	models    *providers.ModelLister
+	hub       *eventHub
+	streaming bool // --stream; a client can only turn it off
+}
+
+func newEngineHost(ctx context.Context, env *runtimeEnv, streaming bool) *engineHost {
+	cfgManager, _ := config.NewManager() // Ignoring error for now, as it just gets the path
+	events := make(chan engineprotocol.Event, 256)
+	hub := newEventHub()
+	go hub.run(events)
+
+	h := &engineHost{
+		ctx:       ctx,
+		manager:   newSessionManager(ctx, env, events),
+		config:    cfgManager,
+		models:    providers.NewModelLister(),
+		hub:       hub,
+		streaming: streaming,
+	}
+	go h.unloadIdleSessions()
+	return h
+}
+
+// unloadIdleSessions periodically unloads the sessions that no client
+// subscribes to and that have been idle for sessionIdleTimeout, releasing
+// their repositories' runtimes.
+func (h *engineHost) unloadIdleSessions() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case now := <-ticker.C:
+			h.manager.unloadIdle(now.Add(-sessionIdleTimeout), h.hub.watching)
+		}
+	}
+}
+
+// close disconnects sessions from their MCP servers, shuts down the
+// runtimes of the repositories sessions were started in besides the
+// engine's own, and closes the session store.
+func (h *engineHost) close() {
+	h.manager.closeAllMCP()
+	h.manager.repos.closeAll()
+	if h.manager.store != nil {
+		h.manager.store.Close()
+	}
+}
+
+// stdioRunner serves the NDJSON protocol to one client: the process's
+// stdin/stdout, or one connection in --listen mode.
 type stdioRunner struct {
+	*engineHost
+
 	scanner *bufio.Scanner
 	writer  *bufio.Writer
-	events  chan engineprotocol.Event
-	manager *sessionManager
-	config  *config.Manager
+
+	mu        sync.Mutex
+	sendMu    sync.RWMutex // held for reading while sending on events
+	events    chan engineprotocol.Event
+	closed    bool
+	behind    bool   // cut off for missing an event its queue had no room for
+	hangUp    func() // closes the client's connection, ending Run; nil = none
+	streaming bool   // sessions this client starts stream deltas
+	token     string // required in hello before other commands; "" = none
+	authed    bool
+	all       bool            // receives every session's events
+	watching  map[string]bool // session IDs whose events it receives
 }
 
-func newStdIORunner(in io.Reader, out io.Writer, env *runtimeEnv, streaming bool) *stdioRunner {
+// newClient attaches a client reading commands from in and writing events
+// to out. With a token, the client must open with a hello carrying it.
+func (h *engineHost) newClient(in io.Reader, out io.Writer, token string) *stdioRunner {
 	scanner := bufio.NewScanner(in)
 	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
 
-	writer := bufio.NewWriter(out)
-	events := make(chan engineprotocol.Event, 256)
+	r := h.newRunner(token)
+	r.scanner = scanner
+	r.writer = bufio.NewWriter(out)
+	if c, ok := in.(io.Closer); ok {
+		r.hangUp = func() { c.Close() }
+	}
 
 	// Check if config exists
-	cfgManager, _ := config.NewManager() // Ignoring error for now, as it just gets the path
-	if cfgManager != nil && !cfgManager.Exists() {
-		// Emit initial setup event BEFORE creating session manager
-		select {
-		case events <- engineprotocol.NewSetupRequiredEvent():
-		default:
-		}
+	if h.config != nil && !h.config.Exists() {
+		// Emit initial setup event before anything else
+		r.emitEvent(engineprotocol.NewSetupRequiredEvent())
+	}
+	h.hub.add(r)
+	return r
+}
+
+// offerInterrupted sends the client a session_history event marked
+// interrupted for each session of the engine's repository whose last run
+// the engine running it died in. start_session with the session's ID
+// resumes it.
+func (r *stdioRunner) offerInterrupted() {
+	m := r.manager
+	if m.store == nil {
+		return
+	}
+	runs, err := m.store.Interrupted(m.env.RepoRoot)
+	if err != nil {
+		log.Printf("failed to look up interrupted runs: %v", err)
+		return
+	}
+	for _, run := range runs {
+		ev := engineprotocol.NewSessionHistoryEvent(run.Meta.ID, run.Meta.Title, run.Meta.Summary, nil)
+		ev.Interrupted = true
+		ev.InterruptedMessage = run.Message
+		r.emitEvent(ev)
 	}
+}
 
+// newRunner creates a client without a transport; the caller reads its
+// events channel. It isn't attached to the hub.
+func (h *engineHost) newRunner(token string) *stdioRunner {
 	return &stdioRunner{
-		scanner: scanner,
-		writer:  writer,
-		events:  events,
-		manager: newSessionManager(env, streaming, events),
-		config:  cfgManager,
+		engineHost: h,
+		events:     make(chan engineprotocol.Event, 256),
+		streaming:  h.streaming,
+		token:      token,
+		authed:     token == "",
+		watching:   make(map[string]bool),
 	}
 }
 
+// Run serves the client until its input ends or ctx is cancelled. Sessions
+// it started keep running.
 func (r *stdioRunner) Run(ctx context.Context) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
+	defer r.hub.remove(r)
 
 	errCh := make(chan error, 1)
 	go r.flushEvents(ctx, errCh)
@@ -75,7 +188,7 @@ func (r *stdioRunner) Run(ctx context.Context) error {
 	for {
 		select {
 		case <-ctx.Done():
-			close(r.events)
+			r.closeEvents()
 			return <-errCh
 		default:
 		}
@@ -87,10 +200,18 @@ func (r *stdioRunner) Run(ctx context.Context) error {
 		if line == "" {
 			continue
 		}
+		// The handshake is handled in order, so the commands after it see
+		// the negotiated capabilities and the authentication.
+		if typ, _ := engineprotocol.PeekCommand([]byte(line)); typ == engineprotocol.CommandHello || !r.authenticated() {
+			if err := r.handleLine(r.engineHost.ctx, line); err != nil {
+				log.Printf("stdio command error: %v", err)
+			}
+			continue
+		}
 		// Run command handler asynchronously to prevent blocking the input loop
 		// This is crucial for handling CancelRequest while another command is running
 		go func(l string) {
-			if err := r.handleLine(ctx, l); err != nil {
+			if err := r.handleLine(r.engineHost.ctx, l); err != nil {
 				log.Printf("stdio command error: %v", err)
 			}
 		}(line)
@@ -98,18 +219,18 @@ func (r *stdioRunner) Run(ctx context.Context) error {
 
 	if err := r.scanner.Err(); err != nil && !errors.Is(err, io.EOF) {
 		r.emitEvent(engineprotocol.NewErrorEvent("", fmt.Sprintf("stdin error: %v", err), "protocol_error", ""))
-		close(r.events)
-		return <-errCh
 	}
-
-	close(r.events)
+	r.closeEvents()
 	return <-errCh
 }
 
+// flushEvents writes the client's events until its stream ends. When it
+// stops early, the stream is closed so senders waiting on it give up.
 func (r *stdioRunner) flushEvents(ctx context.Context, errCh chan<- error) {
 	for {
 		select {
 		case <-ctx.Done():
+			r.closeEvents()
 			errCh <- nil
 			return
 		case ev, ok := <-r.events:
@@ -122,6 +243,8 @@ func (r *stdioRunner) flushEvents(ctx context.Context, errCh chan<- error) {
 				return
 			}
 			if err := r.writeEvent(ev); err != nil {
+				r.closeEvents()
+				r.disconnect()
 				errCh <- err
 				return
 			}
@@ -142,241 +265,314 @@ func (r *stdioRunner) writeEvent(ev engineprotocol.Event) error {
 	return r.writer.Flush()
 }
 
+// emitEvent queues ev for the client without ever waiting: it is called
+// by the hub on behalf of every session. When the queue is full, lossy
+// events are dropped; for the others the client is cut off, to reconnect
+// and resync, rather than hold back the sessions all clients share.
 func (r *stdioRunner) emitEvent(ev engineprotocol.Event) {
+	r.sendMu.RLock()
+	defer r.sendMu.RUnlock()
+	r.mu.Lock()
+	closed := r.closed || r.behind
+	r.mu.Unlock()
+	if closed {
+		return
+	}
+
 	select {
 	case r.events <- ev:
+		return
 	default:
-		log.Printf("stdio: dropping event %s due to full buffer", ev.GetType())
 	}
+	if ev.GetType().Lossy() {
+		log.Printf("stdio: dropping %s event for a slow client", ev.GetType())
+		return
+	}
+	r.mu.Lock()
+	r.behind = true
+	r.mu.Unlock()
+	log.Printf("stdio: client fell behind and missed a %s event; disconnecting it", ev.GetType())
+	// closeEvents waits for senders such as this one to let go of sendMu.
+	go func() {
+		r.closeEvents()
+		r.disconnect()
+	}()
+}
+
+// disconnect closes the client's connection, if it has one.
+func (r *stdioRunner) disconnect() {
+	if r.hangUp != nil {
+		r.hangUp()
+	}
+}
+
+// closeEvents stops the client's event stream; later events are dropped.
+func (r *stdioRunner) closeEvents() {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.closed = true
+	r.mu.Unlock()
+
+	// Wait for senders to let go of the queue.
+	r.sendMu.Lock()
+	defer r.sendMu.Unlock()
+	close(r.events)
+}
+
+func (r *stdioRunner) subscribeAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.all = true
+}
+
+func (r *stdioRunner) subscribe(sessionID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.watching[sessionID] = true
+}
+
+func (r *stdioRunner) unsubscribe(sessionID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.watching, sessionID)
+}
+
+// subscribed reports whether the client subscribed to sessionID itself.
+func (r *stdioRunner) subscribed(sessionID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.watching[sessionID]
+}
+
+// watches reports whether the client receives events of sessionID. Events
+// outside any session go to every authenticated client.
+func (r *stdioRunner) watches(sessionID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.authed && (sessionID == "" || r.all || r.watching[sessionID])
+}
+
+func (r *stdioRunner) authenticated() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.authed
+}
+
+// authorize checks a hello against the client's token.
+func (r *stdioRunner) authorize(cmd engineprotocol.Command) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.authed {
+		return true
+	}
+	hello, ok := cmd.(engineprotocol.HelloCommand)
+	if ok && subtle.ConstantTimeCompare([]byte(hello.Token), []byte(r.token)) == 1 {
+		r.authed = true
+	}
+	return r.authed
+}
+
+func (r *stdioRunner) setStreaming(on bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.streaming = on
+}
+
+func (r *stdioRunner) streamingEnabled() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.streaming
 }
 
 func (r *stdioRunner) handleLine(ctx context.Context, line string) error {
 	cmd, err := engineprotocol.DecodeCommand([]byte(line))
 	if err != nil {
-		r.emitEvent(engineprotocol.NewErrorEvent("", err.Error(), "invalid_command", truncate(line, 256)))
+		typ, requestID := engineprotocol.PeekCommand([]byte(line))
+		req := &commandRequest{runner: r, id: requestID, command: typ}
+		var verr *engineprotocol.VersionError
+		if errors.As(err, &verr) {
+			req.emit(engineprotocol.NewErrorEvent("", err.Error(), "incompatible_protocol",
+				fmt.Sprintf("engine=%s client=%s", verr.EngineVersion, verr.ClientVersion)))
+		} else {
+			req.emit(engineprotocol.NewErrorEvent("", err.Error(), "invalid_command", truncate(line, 256)))
+		}
+		req.finish("", err)
 		return err
 	}
 
+	req := &commandRequest{runner: r, id: cmd.GetRequestID(), command: cmd.GetType()}
+	if !r.authorize(cmd) {
+		req.emit(engineprotocol.NewErrorEvent("", "send hello with the engine token first", "unauthorized", ""))
+		req.finish("", errUnauthorized)
+		return errUnauthorized
+	}
+	if sessionID := commandSessionID(cmd); sessionID != "" {
+		r.subscribe(sessionID)
+	}
+	if req.id != "" {
+		r.emitEvent(engineprotocol.NewAckEvent(commandSessionID(cmd), req.id, cmd.GetType()))
+	}
+	err = r.dispatch(ctx, cmd, req.emit)
+	req.finish(commandSessionID(cmd), err)
+	return err
+}
+
+// dispatch runs one command. Events it emits in reply go through emit so
+// they carry the command's request ID.
+func (r *stdioRunner) dispatch(ctx context.Context, cmd engineprotocol.Command, emit func(engineprotocol.Event)) error {
 	switch c := cmd.(type) {
+	case engineprotocol.HelloCommand:
+		caps := engineprotocol.NegotiateCapabilities(c.Capabilities)
+		r.setStreaming(r.engineHost.streaming && slices.Contains(caps, engineprotocol.CapabilityStreaming))
+		log.Printf("stdio: client %q speaks protocol %s, capabilities %v", c.Client, c.ProtocolVersion, caps)
+		emit(engineprotocol.NewWelcomeEvent(caps))
+		return nil
 	case engineprotocol.StartSessionCommand:
-		session, serr := r.manager.StartSession(ctx, c)
+		session, serr := r.manager.StartSession(ctx, c, r.streamingEnabled())
 		if serr != nil {
-			r.emitEvent(engineprotocol.NewErrorEvent(c.SessionID, serr.Error(), "session_error", ""))
+			emit(engineprotocol.NewErrorEvent(c.SessionID, serr.Error(), "session_error", ""))
 			return serr
 		}
-		r.emitEvent(engineprotocol.NewStatusEvent(session.id, "session_ready", fmt.Sprintf("repo=%s", session.repoRoot)))
+		r.subscribe(session.id)
+		emit(engineprotocol.NewStatusEvent(session.id, "session_ready", fmt.Sprintf("repo=%s", session.repoRoot)))
 		// Emit debug config info to verify what the backend sees
-		r.emitEvent(engineprotocol.NewStatusEvent(session.id, "debug_config", fmt.Sprintf("provider=%s openai_model=%s kimi_model=%s", os.Getenv("LLM_PROVIDER"), os.Getenv("OPENAI_MODEL"), os.Getenv("KIMI_MODEL"))))
+		emit(engineprotocol.NewStatusEvent(session.id, "debug_config", fmt.Sprintf("provider=%s openai_model=%s kimi_model=%s", os.Getenv("LLM_PROVIDER"), os.Getenv("OPENAI_MODEL"), os.Getenv("KIMI_MODEL"))))
 
 		// Check for project-level indexing permission
-		if !project.ConfigExists(session.repoRoot) {
-			r.emitEvent(engineprotocol.NewProjectPermissionRequiredEvent(session.id, session.repoRoot))
+		if !project.HasIndexingDecision(session.repoRoot) {
+			emit(engineprotocol.NewProjectPermissionRequiredEvent(session.id, session.repoRoot))
 		} else if cfg, err := project.LoadConfig(session.repoRoot); err == nil && cfg != nil {
 			// Emit rules loaded status if rules file exists
 			if rules, _ := project.LoadRules(session.repoRoot); rules != "" {
-				r.emitEvent(engineprotocol.NewStatusEvent(session.id, "rules_loaded", "Custom rules active from .dodo/rules"))
+				emit(engineprotocol.NewStatusEvent(session.id, "rules_loaded", "Custom rules active from .dodo/rules"))
 			}
 		}
 		return nil
 	case engineprotocol.UserMessageCommand:
 		if uerr := r.manager.HandleUserMessage(ctx, c); uerr != nil {
-			r.emitEvent(engineprotocol.NewErrorEvent(c.SessionID, uerr.Error(), "engine_error", ""))
+			emit(engineprotocol.NewErrorEvent(c.SessionID, uerr.Error(), "engine_error", ""))
 			return uerr
 		}
 		return nil
 	case engineprotocol.SaveConfigCommand:
 		if r.config == nil {
-			r.emitEvent(engineprotocol.NewErrorEvent("", "config manager not initialized", "config_error", ""))
+			emit(engineprotocol.NewErrorEvent("", "config manager not initialized", "config_error", ""))
 			return fmt.Errorf("config manager not initialized")
 		}
-		// Map map[string]string to config.Config
-		cfg := &config.Config{
-			LLMProvider:  c.Config["llm_provider"],
-			APIKey:       c.Config["api_key"],
-			Model:        c.Config["model"],
-			BaseURL:      c.Config["base_url"],
-			EmbeddingKey: c.Config["embedding_key"],
-			AutoIndex:    c.Config["auto_index"] == "true",
+		// Map map[string]string onto the stored config.Config so that
+		// settings the wizard doesn't edit (profiles, rate limits) survive.
+		cfg, err := r.config.Load()
+		if cfg == nil {
+			cfg = &config.Config{}
+		}
+		// get_config only hands out masked keys; a client echoing one back
+		// leaves the stored key unchanged.
+		apiKey, err := config.UnmaskSecret(c.Config["api_key"], cfg.APIKey)
+		if err == nil {
+			cfg.EmbeddingKey, err = config.UnmaskSecret(c.Config["embedding_key"], cfg.EmbeddingKey)
 		}
+		if err != nil {
+			emit(engineprotocol.NewErrorEvent("", err.Error(), "config_save_error", ""))
+			return err
+		}
+		cfg.LLMProvider = c.Config["llm_provider"]
+		cfg.APIKey = apiKey
+		cfg.Model = c.Config["model"]
+		cfg.BaseURL = c.Config["base_url"]
+		cfg.AutoIndex = c.Config["auto_index"] == "true"
 		if err := r.config.Save(cfg); err != nil {
-			r.emitEvent(engineprotocol.NewErrorEvent("", err.Error(), "config_save_error", ""))
+			emit(engineprotocol.NewErrorEvent("", err.Error(), "config_save_error", ""))
 			return err
 		}
 
-		// Apply config to environment so next StartSession picks it up
-		log.Printf("[DEBUG] Applying config to env. Provider: %s, Model: %s", cfg.LLMProvider, cfg.Model)
-		if cfg.LLMProvider != "" {
-			os.Setenv("LLM_PROVIDER", cfg.LLMProvider)
-		}
-		if cfg.APIKey != "" {
-			switch cfg.LLMProvider {
-			case "openai":
-				os.Setenv("OPENAI_API_KEY", cfg.APIKey)
-			case "anthropic":
-				os.Setenv("ANTHROPIC_API_KEY", cfg.APIKey)
-			case "kimi":
-				os.Setenv("KIMI_API_KEY", cfg.APIKey)
-			case "gemini":
-				os.Setenv("GEMINI_API_KEY", cfg.APIKey)
-			case "deepseek":
-				os.Setenv("DEEPSEEK_API_KEY", cfg.APIKey)
-			case "groq":
-				os.Setenv("GROQ_API_KEY", cfg.APIKey)
-			case "lmstudio":
-				os.Setenv("LMSTUDIO_API_KEY", cfg.APIKey)
-			case "ollama":
-				os.Setenv("OLLAMA_API_KEY", cfg.APIKey)
-			case "glm":
-				os.Setenv("GLM_API_KEY", cfg.APIKey)
-			case "minimax":
-				os.Setenv("MINIMAX_API_KEY", cfg.APIKey)
-			}
-		}
-		if cfg.Model != "" {
-			switch cfg.LLMProvider {
-			case "openai":
-				os.Setenv("OPENAI_MODEL", cfg.Model)
-			case "anthropic":
-				os.Setenv("ANTHROPIC_MODEL", cfg.Model)
-			case "kimi":
-				os.Setenv("KIMI_MODEL", cfg.Model)
-			case "gemini":
-				os.Setenv("GEMINI_MODEL", cfg.Model)
-			case "deepseek":
-				os.Setenv("DEEPSEEK_MODEL", cfg.Model)
-			case "groq":
-				os.Setenv("GROQ_MODEL", cfg.Model)
-			case "lmstudio":
-				os.Setenv("LMSTUDIO_MODEL", cfg.Model)
-			case "ollama":
-				os.Setenv("OLLAMA_MODEL", cfg.Model)
-			case "glm":
-				os.Setenv("GLM_MODEL", cfg.Model)
-			case "minimax":
-				os.Setenv("MINIMAX_MODEL", cfg.Model)
-			}
-		}
-		if cfg.BaseURL != "" {
-			switch cfg.LLMProvider {
-			case "openai":
-				os.Setenv("OPENAI_BASE_URL", cfg.BaseURL)
-			case "kimi":
-				os.Setenv("KIMI_BASE_URL", cfg.BaseURL)
-			}
-		}
-		log.Printf("[DEBUG] Env updated. LLM_PROVIDER=%s, OPENAI_MODEL=%s, KIMI_MODEL=%s", os.Getenv("LLM_PROVIDER"), os.Getenv("OPENAI_MODEL"), os.Getenv("KIMI_MODEL"))
+		// Re-resolve layers so next StartSession picks it up
+		r.applyConfig()
 
 		// Emit success event (maybe just a status?)
-		r.emitEvent(engineprotocol.NewStatusEvent("", "setup_complete", "configuration saved"))
+		emit(engineprotocol.NewStatusEvent("", "setup_complete", "configuration saved"))
 		return nil
 	case engineprotocol.GetConfigCommand:
 		if r.config == nil {
-			r.emitEvent(engineprotocol.NewErrorEvent("", "config manager not initialized", "config_error", ""))
+			emit(engineprotocol.NewErrorEvent("", "config manager not initialized", "config_error", ""))
 			return fmt.Errorf("config manager not initialized")
 		}
 
 		cfg, err := r.config.Load()
-		if err != nil {
+		if cfg == nil {
 			// If config doesn't exist, return empty config but success
 			// OR return error? Better to return empty config event so UI knows it's fresh.
 			// But Load() returns error if file missing? Check config manager implementation.
 			// Assuming Load returns error on missing file.
 			// Let's return empty config map.
-			r.emitEvent(engineprotocol.NewConfigLoadedEvent(map[string]string{}))
+			emit(engineprotocol.NewConfigLoadedEvent(map[string]string{}))
 			return nil
 		}
-
-		// Convert Config struct to map
-		cfgMap := map[string]string{
-			"llm_provider":  cfg.LLMProvider,
-			"api_key":       cfg.APIKey,
-			"model":         cfg.Model,
-			"base_url":      cfg.BaseURL,
-			"embedding_key": cfg.EmbeddingKey,
-			"auto_index":    fmt.Sprintf("%t", cfg.AutoIndex),
+		if err != nil {
+			log.Printf("⚠️  Config keys unavailable: %v", err)
 		}
 
-		r.emitEvent(engineprotocol.NewConfigLoadedEvent(cfgMap))
+		// Convert Config struct to map. Keys never leave the engine unmasked.
+		cfgMap := map[string]string{
+			"llm_provider":      cfg.LLMProvider,
+			"api_key":           config.MaskSecret(cfg.APIKey),
+			"api_key_ref":       cfg.APIKeyRef,
+			"model":             cfg.Model,
+			"base_url":          cfg.BaseURL,
+			"embedding_key":     config.MaskSecret(cfg.EmbeddingKey),
+			"embedding_key_ref": cfg.EmbeddingKeyRef,
+			"auto_index":        fmt.Sprintf("%t", cfg.AutoIndex),
+			"profile":           cfg.Profile,
+		}
+
+		emit(engineprotocol.NewConfigLoadedEvent(cfgMap))
 		return nil
 	case engineprotocol.ReloadConfigCommand:
 		// Reload configuration and swap LLM client in existing session
 		if r.config == nil {
-			r.emitEvent(engineprotocol.NewErrorEvent(c.SessionID, "config manager not initialized", "config_error", ""))
+			emit(engineprotocol.NewErrorEvent(c.SessionID, "config manager not initialized", "config_error", ""))
 			return fmt.Errorf("config manager not initialized")
 		}
 
-		// Load new config from disk
-		cfg, err := r.config.Load()
-		if err != nil {
-			r.emitEvent(engineprotocol.NewErrorEvent(c.SessionID, fmt.Sprintf("failed to load config: %v", err), "config_error", ""))
-			return fmt.Errorf("failed to load config: %w", err)
-		}
-
-		// Update environment variables with new config
-		if cfg.LLMProvider != "" {
-			os.Setenv("LLM_PROVIDER", cfg.LLMProvider)
-		}
-		if cfg.APIKey != "" {
-			switch cfg.LLMProvider {
-			case "openai":
-				os.Setenv("OPENAI_API_KEY", cfg.APIKey)
-				if cfg.Model != "" {
-					os.Setenv("OPENAI_MODEL", cfg.Model)
-				}
-				if cfg.BaseURL != "" {
-					os.Setenv("OPENAI_BASE_URL", cfg.BaseURL)
-				}
-			case "anthropic":
-				os.Setenv("ANTHROPIC_API_KEY", cfg.APIKey)
-				if cfg.Model != "" {
-					os.Setenv("ANTHROPIC_MODEL", cfg.Model)
-				}
-			case "kimi":
-				os.Setenv("KIMI_API_KEY", cfg.APIKey)
-				if cfg.Model != "" {
-					os.Setenv("KIMI_MODEL", cfg.Model)
-				}
-			}
-		}
+		// Re-resolve every config layer and update the environment
+		settings := r.applyConfig()
 
 		// Create new LLM client with updated config
 		ctx := context.Background()
 		newLLM, newModelName, err := providers.NewLLMClientFromEnv(ctx)
 		if err != nil {
-			r.emitEvent(engineprotocol.NewErrorEvent(c.SessionID, fmt.Sprintf("failed to create new LLM client: %v", err), "config_error", ""))
+			emit(engineprotocol.NewErrorEvent(c.SessionID, fmt.Sprintf("failed to create new LLM client: %v", err), "config_error", ""))
 			return fmt.Errorf("failed to create new LLM client: %w", err)
 		}
 
 		// Find the session and swap its LLM client
 		session, err := r.manager.GetSession(c.SessionID)
 		if err != nil {
-			r.emitEvent(engineprotocol.NewErrorEvent(c.SessionID, fmt.Sprintf("session not found: %v", err), "session_error", ""))
+			emit(engineprotocol.NewErrorEvent(c.SessionID, fmt.Sprintf("session not found: %v", err), "session_error", ""))
 			return fmt.Errorf("session not found: %w", err)
 		}
 
 		// Swap the LLM client in the existing agent
 		session.agent.SetLLM(newLLM, newModelName)
+		session.setProfile(settings.Profile())
 
 		// Emit success event
-		r.emitEvent(engineprotocol.NewConfigReloadedEvent(c.SessionID, cfg.LLMProvider, newModelName))
+		emit(engineprotocol.NewConfigReloadedEvent(c.SessionID, settings.Provider(), newModelName))
 		return nil
 	case engineprotocol.CancelRequestCommand:
 		// Cancel the currently running task for this session
 		session, err := r.manager.GetSession(c.SessionID)
 		if err != nil {
-			r.emitEvent(engineprotocol.NewErrorEvent(c.SessionID, fmt.Sprintf("session not found: %v", err), "session_error", ""))
+			emit(engineprotocol.NewErrorEvent(c.SessionID, fmt.Sprintf("session not found: %v", err), "session_error", ""))
 			return nil // Don't fail hard on cancel of unknown session
 		}
 
 		// Try to cancel
 		log.Printf("DEBUG: Received CancelRequest for session %s", c.SessionID)
-		cancelled := session.cancel()
-		if cancelled {
+		if session.cancelRun("", "Cancelled by user request") {
 			log.Printf("DEBUG: Cancel successful for session %s", c.SessionID)
-			session.mu.Lock()
-			session.lastRunCancelled = true
-			session.mu.Unlock()
-			session.emit(engineprotocol.NewCancelledEvent(c.SessionID, "Cancelled by user request"))
 		} else {
 			log.Printf("DEBUG: Cancel failed (no active cancelFunc) for session %s", c.SessionID)
 		}
@@ -385,7 +581,7 @@ func (r *stdioRunner) handleLine(ctx context.Context, line string) error {
 		// Handle project permission response from UI
 		session, err := r.manager.GetSession(c.SessionID)
 		if err != nil {
-			r.emitEvent(engineprotocol.NewErrorEvent(c.SessionID, fmt.Sprintf("session not found: %v", err), "session_error", ""))
+			emit(engineprotocol.NewErrorEvent(c.SessionID, fmt.Sprintf("session not found: %v", err), "session_error", ""))
 			return nil
 		}
 
@@ -394,34 +590,300 @@ func (r *stdioRunner) handleLine(ctx context.Context, line string) error {
 			IndexingEnabled: c.IndexingEnabled,
 		}
 		if err := project.SaveConfig(session.repoRoot, cfg); err != nil {
-			r.emitEvent(engineprotocol.NewErrorEvent(c.SessionID, fmt.Sprintf("failed to save project config: %v", err), "config_error", ""))
+			emit(engineprotocol.NewErrorEvent(c.SessionID, fmt.Sprintf("failed to save project config: %v", err), "config_error", ""))
 			return err
 		}
 
 		// Emit status to inform UI
 		if c.IndexingEnabled {
-			r.emitEvent(engineprotocol.NewStatusEvent(c.SessionID, "project_config_saved", "Indexing enabled. Add custom rules in .dodo/rules"))
+			emit(engineprotocol.NewStatusEvent(c.SessionID, "project_config_saved", "Indexing enabled. Add custom rules in .dodo/rules"))
 		} else {
-			r.emitEvent(engineprotocol.NewStatusEvent(c.SessionID, "project_config_saved", "Indexing disabled for this project"))
+			emit(engineprotocol.NewStatusEvent(c.SessionID, "project_config_saved", "Indexing disabled for this project"))
+		}
+		return nil
+	case engineprotocol.ListModelsCommand:
+		emit(r.listModels(ctx, c))
+		return nil
+	case engineprotocol.SwitchProfileCommand:
+		ev, err := r.switchProfile(ctx, c)
+		if err != nil {
+			emit(engineprotocol.NewErrorEvent(c.SessionID, err.Error(), "config_error", ""))
+			return err
 		}
+		emit(ev)
 		return nil
+	case engineprotocol.SubscribeCommand:
+		session, err := r.manager.GetSession(c.SessionID)
+		if err != nil {
+			emit(engineprotocol.NewErrorEvent(c.SessionID, err.Error(), "session_error", ""))
+			return err
+		}
+		r.subscribe(session.id)
+		title, running := session.status()
+		emit(engineprotocol.NewSubscribedEvent(session.id, title, running))
+		return nil
+	case engineprotocol.UnsubscribeCommand:
+		r.unsubscribe(c.SessionID)
+		return nil
+	case engineprotocol.ResyncCommand:
+		session, err := r.manager.GetSession(c.SessionID)
+		if err != nil {
+			emit(engineprotocol.NewErrorEvent(c.SessionID, err.Error(), "session_error", ""))
+			return err
+		}
+		// Replayed events keep their seq and request ID; live events sent
+		// meanwhile may arrive twice and are told apart by seq.
+		events, lastSeq, truncated := session.replaySince(c.FromSeq)
+		for _, ev := range events {
+			r.emitEvent(ev)
+		}
+		emit(engineprotocol.NewResyncedEvent(session.id, c.FromSeq, len(events), lastSeq, truncated))
+		return nil
+	case engineprotocol.ListProfilesCommand:
+		ev, err := r.listProfiles(c)
+		if err != nil {
+			emit(engineprotocol.NewErrorEvent(c.SessionID, err.Error(), "config_error", ""))
+			return err
+		}
+		emit(ev)
+		return nil
+	case engineprotocol.ListSessionsCommand:
+		ev, err := r.listSessions(c)
+		return reply(emit, "", ev, err)
+	case engineprotocol.SearchSessionsCommand:
+		ev, err := r.searchSessions(c)
+		return reply(emit, "", ev, err)
+	case engineprotocol.GetSessionCommand:
+		ev, err := r.getSession(c)
+		return reply(emit, c.SessionID, ev, err)
+	case engineprotocol.RenameSessionCommand:
+		ev, err := r.renameSession(c)
+		return reply(emit, c.SessionID, ev, err)
+	case engineprotocol.ArchiveSessionCommand:
+		ev, err := r.archiveSession(c)
+		return reply(emit, c.SessionID, ev, err)
+	case engineprotocol.PinSessionCommand:
+		ev, err := r.pinSession(c)
+		return reply(emit, c.SessionID, ev, err)
+	case engineprotocol.DeleteSessionCommand:
+		ev, err := r.deleteSession(c)
+		return reply(emit, c.SessionID, ev, err)
+	case engineprotocol.ExportSessionCommand:
+		ev, err := r.exportSession(c)
+		return reply(emit, c.SessionID, ev, err)
+	case engineprotocol.ForkSessionCommand:
+		ev, err := r.forkSession(c)
+		return reply(emit, c.SessionID, ev, err)
+	case engineprotocol.ListMemoriesCommand:
+		ev, err := r.listMemories(c)
+		return memoryReply(emit, ev, err)
+	case engineprotocol.SaveMemoryCommand:
+		ev, err := r.saveMemory(c)
+		return memoryReply(emit, ev, err)
+	case engineprotocol.ForgetMemoryCommand:
+		ev, err := r.forgetMemory(c)
+		return memoryReply(emit, ev, err)
 	default:
-		r.emitEvent(engineprotocol.NewErrorEvent("", "unsupported command", "invalid_command", ""))
+		emit(engineprotocol.NewErrorEvent("", "unsupported command", "invalid_command", ""))
 		return fmt.Errorf("unsupported command type %T", cmd)
 	}
 }
 
+// commandRequest tracks the events of one command for its result.
+type commandRequest struct {
+	runner  *stdioRunner
+	id      string
+	command engineprotocol.CommandType
+	failure *engineprotocol.CommandError // first error event emitted
+}
+
+func (q *commandRequest) emit(ev engineprotocol.Event) {
+	if e, ok := ev.(engineprotocol.ErrorEvent); ok && q.failure == nil {
+		q.failure = &engineprotocol.CommandError{Kind: e.Kind, Message: e.Message, Details: e.Details}
+	}
+	q.runner.emitEvent(engineprotocol.WithRequestID(ev, q.id))
+}
+
+// finish emits the result event when the command had a request ID.
+func (q *commandRequest) finish(sessionID string, err error) {
+	if q.id == "" {
+		return
+	}
+	failure := q.failure
+	if err == nil {
+		failure = nil
+	} else if failure == nil {
+		failure = &engineprotocol.CommandError{Kind: "engine_error", Message: err.Error()}
+	}
+	q.runner.emitEvent(engineprotocol.NewResultEvent(sessionID, q.id, q.command, failure))
+}
+
+// commandSessionID returns the session a command addresses, if any.
+func commandSessionID(cmd engineprotocol.Command) string {
+	switch c := cmd.(type) {
+	case engineprotocol.StartSessionCommand:
+		return c.SessionID
+	case engineprotocol.UserMessageCommand:
+		return c.SessionID
+	case engineprotocol.ReloadConfigCommand:
+		return c.SessionID
+	case engineprotocol.CancelRequestCommand:
+		return c.SessionID
+	case engineprotocol.ProjectPermissionCommand:
+		return c.SessionID
+	case engineprotocol.SwitchProfileCommand:
+		return c.SessionID
+	case engineprotocol.ListProfilesCommand:
+		return c.SessionID
+	case engineprotocol.ResyncCommand:
+		return c.SessionID
+	}
+	return ""
+}
+
+// applyConfig re-resolves the layered configuration after a change on disk.
+func (r *stdioRunner) applyConfig() *config.Settings {
+	return applyConfig(r.manager.env.Config)
+}
+
+// listModels queries the requested (or every configured) provider in parallel.
+// Failures are reported per provider so one unreachable local server doesn't
+// hide the models of the others.
+func (r *stdioRunner) listModels(ctx context.Context, cmd engineprotocol.ListModelsCommand) engineprotocol.ModelsListedEvent {
+	targets := providers.ConfiguredProviders()
+	if cmd.Provider != "" {
+		targets = []string{cmd.Provider}
+	}
+
+	activeProvider := os.Getenv("LLM_PROVIDER")
+	if activeProvider == "" {
+		activeProvider = "openai"
+	}
+	activeModel := os.Getenv(strings.ToUpper(activeProvider) + "_MODEL")
+
+	results := make([][]providers.ModelInfo, len(targets))
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i, p := range targets {
+		wg.Add(1)
+		go func(i int, p string) {
+			defer wg.Done()
+			results[i], errs[i] = r.models.List(ctx, p, cmd.Refresh)
+		}(i, p)
+	}
+	wg.Wait()
+
+	models := []engineprotocol.ModelInfo{}
+	var failures []engineprotocol.ProviderError
+	for i, p := range targets {
+		if errs[i] != nil {
+			failures = append(failures, engineprotocol.ProviderError{Provider: p, Message: errs[i].Error()})
+			continue
+		}
+		for _, m := range results[i] {
+			models = append(models, engineprotocol.ModelInfo{
+				ID:              m.ID,
+				Provider:        m.Provider,
+				DisplayName:     m.DisplayName,
+				ContextWindow:   m.ContextWindow,
+				MaxOutputTokens: m.MaxOutputTokens,
+				InputCostPer1M:  m.InputCostPer1M,
+				OutputCostPer1M: m.OutputCostPer1M,
+				Current:         m.Provider == activeProvider && m.ID == activeModel,
+			})
+		}
+	}
+	return engineprotocol.NewModelsListedEvent(models, failures)
+}
+
+// switchProfile points a running session at a named profile. Only that
+// session changes; new sessions still start with the configured profile.
+func (r *stdioRunner) switchProfile(ctx context.Context, cmd engineprotocol.SwitchProfileCommand) (engineprotocol.ProfileSwitchedEvent, error) {
+	session, err := r.manager.GetSession(cmd.SessionID)
+	if err != nil {
+		return engineprotocol.ProfileSwitchedEvent{}, err
+	}
+	loader := r.manager.env.Config.WithRepo(session.repoRoot)
+	profile, err := loader.Profile(cmd.Profile)
+	if err != nil {
+		return engineprotocol.ProfileSwitchedEvent{}, err
+	}
+
+	apiKey, err := loader.ResolveKeyRef(profile.KeyReference())
+	if err != nil {
+		return engineprotocol.ProfileSwitchedEvent{}, fmt.Errorf("profile %q: %w", cmd.Profile, err)
+	}
+
+	llm, modelName, err := providers.NewLLMClient(ctx, providers.ClientSettings{
+		Provider:        profile.Provider,
+		Model:           profile.Model,
+		BaseURL:         profile.BaseURL,
+		APIKey:          apiKey,
+		Temperature:     float32(profile.Temperature),
+		MaxOutputTokens: profile.MaxOutputTokens,
+	})
+	if err != nil {
+		return engineprotocol.ProfileSwitchedEvent{}, fmt.Errorf("profile %q: %w", cmd.Profile, err)
+	}
+
+	session.agent.SetLLM(llm, modelName)
+	session.setProfile(cmd.Profile)
+	return engineprotocol.NewProfileSwitchedEvent(session.id, cmd.Profile, profile.Provider, modelName), nil
+}
+
+// listProfiles reports the profiles visible to the session's repository, or
+// to the engine's repository without a session.
+func (r *stdioRunner) listProfiles(cmd engineprotocol.ListProfilesCommand) (engineprotocol.ProfilesListedEvent, error) {
+	loader := r.manager.env.Config
+	active := os.Getenv("DODO_PROFILE")
+	if cmd.SessionID != "" {
+		session, err := r.manager.GetSession(cmd.SessionID)
+		if err != nil {
+			return engineprotocol.ProfilesListedEvent{}, err
+		}
+		loader = loader.WithRepo(session.repoRoot)
+		active = session.currentProfile()
+	}
+
+	byName := make(map[string]engineprotocol.ProfileInfo)
+	for _, scope := range []config.Scope{config.ScopeUser, config.ScopeProject} {
+		profiles, err := loader.ProfilesIn(scope)
+		if err != nil {
+			return engineprotocol.ProfilesListedEvent{}, err
+		}
+		for name, p := range profiles {
+			byName[name] = engineprotocol.ProfileInfo{
+				Name:            name,
+				Provider:        p.Provider,
+				Model:           p.Model,
+				BaseURL:         p.BaseURL,
+				Temperature:     p.Temperature,
+				MaxOutputTokens: p.MaxOutputTokens,
+				Scope:           string(scope),
+				Active:          name == active,
+			}
+		}
+	}
+
+	out := make([]engineprotocol.ProfileInfo, 0, len(byName))
+	for _, info := range byName {
+		out = append(out, info)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return engineprotocol.NewProfilesListedEvent(cmd.SessionID, out), nil
+}
+
 type sessionManager struct {
 	mu         sync.Mutex
 	sessions   map[string]*sessionState
 	env        *runtimeEnv
-	streaming  bool
+	repos      *repoEnvs
 	events     chan<- engineprotocol.Event
 	store      *session.Store
 	summarizer *session.Summarizer
 }
 
-func newSessionManager(env *runtimeEnv, streaming bool, sink chan<- engineprotocol.Event) *sessionManager {
+func newSessionManager(ctx context.Context, env *runtimeEnv, sink chan<- engineprotocol.Event) *sessionManager {
 	// Check home dir
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
@@ -430,16 +892,18 @@ func newSessionManager(env *runtimeEnv, streaming bool, sink chan<- engineprotoc
 
 	var store *session.Store
 	if homeDir != "" {
-		store = session.NewStore(filepath.Join(homeDir, ".dodo"))
+		if store, err = session.NewStore(filepath.Join(homeDir, ".dodo")); err != nil {
+			log.Printf("session store unavailable: %v", err)
+		}
 	}
-
-	// Try to load config and apply to env
-	if cfgManager, _ := config.NewManager(); cfgManager != nil {
-		if cfg, err := cfgManager.Load(); err == nil {
-			applyConfigToEnv(cfg)
+	if store != nil && env.Config != nil {
+		if settings, err := env.Config.Load(); err == nil && settings.Bool("session_gc") {
+			collectSessions(store, retentionPolicy(settings))
 		}
 	}
 
+	// Configuration was resolved and exported by prepareRuntimeEnv
+
 	// Initialize summarizer if configs are available
 	var summarizer *session.Summarizer
 	if llm, model, err := providers.NewLLMClientFromEnv(context.Background()); err == nil {
@@ -452,32 +916,51 @@ func newSessionManager(env *runtimeEnv, streaming bool, sink chan<- engineprotoc
 	return &sessionManager{
 		sessions:   make(map[string]*sessionState),
 		env:        env,
-		streaming:  streaming,
+		repos:      newRepoEnvs(ctx, env),
 		events:     sink,
 		store:      store,
 		summarizer: summarizer,
 	}
 }
 
-func (m *sessionManager) StartSession(ctx context.Context, cmd engineprotocol.StartSessionCommand) (*sessionState, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	repoRoot := cmd.RepoRoot
-	if repoRoot == "" {
-		repoRoot = m.env.RepoRoot
-	} else {
-		absRepo, err := filepath.Abs(repoRoot)
-		if err != nil {
-			return nil, fmt.Errorf("invalid repo_root: %w", err)
+// collectSessions garbage-collects the store as policy says, before any
+// session is loaded.
+func collectSessions(store *session.Store, policy session.RetentionPolicy) {
+	actions, err := store.GC(policy, false)
+	if err != nil {
+		log.Printf("session garbage collection: %v", err)
+	}
+	for _, a := range actions {
+		what := "deleted"
+		if a.Reason == session.GCArchived {
+			what = "archived the history of"
 		}
-		repoRoot = absRepo
+		log.Printf("session garbage collection: %s session %s (%s)", what, a.ID, gcReason(a))
 	}
+}
 
-	if m.env.RepoRoot != "" && repoRoot != m.env.RepoRoot {
-		return nil, fmt.Errorf("repo_root %s does not match running process repo %s", repoRoot, m.env.RepoRoot)
+// StartSession creates or resumes a session in any repository. streaming
+// selects delta events for it, as negotiated by the client starting it.
+func (m *sessionManager) StartSession(ctx context.Context, cmd engineprotocol.StartSessionCommand, streaming bool) (_ *sessionState, err error) {
+	repoRoot, err := m.resolveRepo(cmd.RepoRoot)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := resolveRepoDir(repoRoot); err != nil {
+		return nil, err
 	}
 
+	// Opening a repository indexes it, so it happens before taking the lock.
+	env := m.repos.acquire(repoRoot)
+	defer func() {
+		if err != nil {
+			m.repos.release(env)
+		}
+	}()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	// Determine Session ID and Load/Create
 	var sessionID string
 	var loadedSession *session.Session
@@ -503,40 +986,60 @@ func (m *sessionManager) StartSession(ctx context.Context, cmd engineprotocol.St
 	sessState := &sessionState{
 		id:         sessionID,
 		repoRoot:   repoRoot,
+		env:        env,
 		eventSink:  m.events,
-		streaming:  m.streaming,
+		streaming:  streaming,
 		store:      m.store,
 		summarizer: m.summarizer,
 		createdAt:  time.Now(),
+		lastUsed:   time.Now(),
 		title:      "Untitled Session",
+		profile:    os.Getenv("DODO_PROFILE"),
 	}
 
 	if loadedSession != nil {
 		sessState.title = loadedSession.Title
 		sessState.lastSummary = loadedSession.Summary
 		sessState.createdAt = loadedSession.CreatedAt
+		sessState.archived = loadedSession.Archived
+		sessState.pinned = loadedSession.Pinned
+		sessState.priorTokens = loadedSession.TokensUsed
+		sessState.filesTouched = loadedSession.FilesTouched
+		sessState.parentID = loadedSession.ParentID
+		sessState.forkIndex = loadedSession.ForkIndex
+		sessState.checkpoints = loadedSession.Checkpoints
+		if m.store != nil {
+			sessState.interruptedRun = m.interruptedRun(sessionID, repoRoot)
+		}
 	}
 
 	hook := newProtocolHook(sessState)
-	agent, err := factory.BuildBrainAgent(ctx, repoRoot, m.env.Retrieval, m.env.WorkspaceCtx, m.streaming, true, hook)
+	extraTools := make(engine.ToolRegistry)
+	maps.Copy(extraTools, env.tools())
+	maps.Copy(extraTools, m.connectMCP(ctx, sessState))
+	agent, err := factory.BuildBrainAgent(ctx, repoRoot, env.Retrieval, env.WorkspaceCtx, env.Runner, extraTools, streaming, true, hook, engine.MetricsHook{M: env.Metrics})
 	if err != nil {
+		sessState.closeMCP()
 		return nil, err
 	}
 
 	// Populate History or Inject Context
 	if loadedSession != nil {
 		// Restore history
-		for _, msg := range loadedSession.History {
+		for _, msg := range session.AnswerPendingToolCalls(loadedSession.History) {
 			agent.Append(msg)
 		}
 
 		// Emit history to UI so user can see previous conversation summary
-		m.events <- engineprotocol.NewSessionHistoryEvent(
+		ev := engineprotocol.NewSessionHistoryEvent(
 			sessionID,
 			loadedSession.Title,
 			loadedSession.Summary,
 			nil, // Don't send full history for display to keep UI clean
 		)
+		ev.Interrupted = sessState.interruptedRun != ""
+		ev.InterruptedMessage = sessState.interruptedRun
+		sessState.emit(ev)
 	} else if isNew && m.store != nil {
 		// Inject previous context for NEW sessions
 		if metas, err := m.store.List(repoRoot); err == nil && len(metas) > 0 {
@@ -552,10 +1055,12 @@ func (m *sessionManager) StartSession(ctx context.Context, cmd engineprotocol.St
 	}
 
 	sessState.agent = agent
+	sessState.memories = m.repos.memoryStore(repoRoot)
+	sessState.memoryBudget = memoryBudget(m.env.Config, repoRoot)
 	m.sessions[sessionID] = sessState
 
 	// Save session immediately on creation so it persists even if interaction is interrupted
-	if isNew && m.store != nil {
+	if loadedSession == nil && m.store != nil {
 		model := &session.Session{
 			ID:        sessionID,
 			RepoPath:  repoRoot,
@@ -575,6 +1080,40 @@ func (m *sessionManager) StartSession(ctx context.Context, cmd engineprotocol.St
 	return sessState, nil
 }
 
+// interruptedRun returns the message the last run of a stored session was
+// running when the engine running it died, or "" if the run ended. The run
+// is taken over: it is no longer reported as interrupted.
+func (m *sessionManager) interruptedRun(id, repoRoot string) string {
+	runs, err := m.store.Interrupted(repoRoot)
+	if err != nil {
+		log.Printf("failed to look up interrupted runs: %v", err)
+		return ""
+	}
+	for _, run := range runs {
+		if run.Meta.ID != id {
+			continue
+		}
+		if err := m.store.EndRun(id, repoRoot); err != nil {
+			log.Printf("failed to clear interrupted run of session %s: %v", id, err)
+		}
+		return run.Message
+	}
+	return ""
+}
+
+// resolveRepo returns the absolute repository a command addresses; the one
+// the engine was started in when it names none.
+func (m *sessionManager) resolveRepo(repoRoot string) (string, error) {
+	if repoRoot == "" {
+		return m.env.RepoRoot, nil
+	}
+	absRepo, err := filepath.Abs(repoRoot)
+	if err != nil {
+		return "", fmt.Errorf("invalid repo_root: %w", err)
+	}
+	return absRepo, nil
+}
+
 // GetSession retrieves an existing session by ID.
 func (m *sessionManager) GetSession(sessionID string) (*sessionState, error) {
 	m.mu.Lock()
@@ -584,6 +1123,7 @@ func (m *sessionManager) GetSession(sessionID string) (*sessionState, error) {
 	if !exists {
 		return nil, fmt.Errorf("session not found: %s", sessionID)
 	}
+	session.touch()
 	return session, nil
 }
 
@@ -593,10 +1133,18 @@ func (m *sessionManager) HandleUserMessage(ctx context.Context, cmd engineprotoc
 		return err
 	}
 
-	if !session.beginRun() {
+	if !session.beginRun(cmd.RequestID) {
 		return fmt.Errorf("session %s is already processing a request", cmd.SessionID)
 	}
 	defer session.endRun()
+	session.markRun(cmd.Message)
+	defer func() {
+		// A run cut short by the engine shutting down stays marked, so
+		// that it is offered for resuming when the engine restarts.
+		if ctx.Err() == nil {
+			session.markRun("")
+		}
+	}()
 
 	// Create a cancellable context for this run
 	runCtx, cancel := context.WithCancel(ctx)
@@ -616,6 +1164,11 @@ func (m *sessionManager) HandleUserMessage(ctx context.Context, cmd engineprotoc
 		message = "[System Note: The user cancelled the previous task. Please inquire if they want to resume or start something new.] " + message
 		session.lastRunCancelled = false
 	}
+	if session.interruptedRun != "" {
+		message = fmt.Sprintf("[System Note: Your previous run was interrupted because the engine stopped. It was working on: %q. Tool calls it had not finished are marked as failed; check the state of the files before continuing.] ", session.interruptedRun) + message
+		session.interruptedRun = ""
+	}
+	session.recallMemories(cmd.Message)
 
 	if err := session.agent.Run(runCtx, message); err != nil {
 		// Check if this was a cancellation - that's not a real error
@@ -638,45 +1191,129 @@ func (m *sessionManager) session(id string) (*sessionState, error) {
 	if !ok {
 		return nil, fmt.Errorf("unknown session_id: %s", id)
 	}
+	session.touch()
 	return session, nil
 }
 
 type sessionState struct {
 	id         string
 	repoRoot   string
+	env        *repoEnv // runtime of repoRoot, released when the session is closed
 	agent      *engine.Agent
 	eventSink  chan<- engineprotocol.Event
 	streaming  bool
 	store      *session.Store
 	summarizer *session.Summarizer
 
+	emitMu sync.Mutex // keeps events in seq order on the sink
+
 	mu          sync.Mutex
+	seq         uint64                 // of the last event emitted
+	replay      []engineprotocol.Event // the last replayBufferSize events, for resync
 	running     bool
+	requestID   string // of the user_message being run
 	cancelFunc  context.CancelFunc
 	lastSummary string
 	files       []string
 	title       string
 	createdAt   time.Time
+	lastUsed    time.Time // of the last command or run, for unloading idle sessions
+
+	// Metadata carried over from the stored session
+	archived     bool
+	pinned       bool
+	priorTokens  int      // tokens used before the session was resumed
+	filesTouched []string // every file changed across runs
+	parentID     string   // the session this one was forked from
+	forkIndex    int
+	checkpoints  []session.Checkpoint // files before the session's edits
 
 	// Track if the last run was cancelled to inject context
 	lastRunCancelled bool
+	// The message an interrupted run was running when the session was
+	// resumed, to inject context
+	interruptedRun string
+
+	persisted int // messages of the agent's history the store holds
+
+	// Project memory, put in the system prompt of each run
+	memories     *memory.Store
+	memoryBudget int // tokens of memories per run; 0 = none
+
+	// Profile the agent's LLM client was built from ("" = plain settings)
+	profile string
+
+	mcpClients []*mcp.Client // connected MCP servers, closed with the session
 }
 
+func (s *sessionState) setProfile(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.profile = name
+}
+
+func (s *sessionState) currentProfile() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.profile
+}
+
+// replayBufferSize is how many of a session's latest events resync can
+// resend.
+const replayBufferSize = 1024
+
+// emit sends a session event, tagged with the request ID of the
+// user_message being run and the session's next seq. When the sink is
+// full, lossy events are dropped (resync can still resend them) and the
+// others wait.
 func (s *sessionState) emit(ev engineprotocol.Event) {
+	s.emitMu.Lock()
+	defer s.emitMu.Unlock()
+
+	s.mu.Lock()
+	s.seq++
+	ev = engineprotocol.WithSeq(engineprotocol.WithRequestID(ev, s.requestID), s.seq)
+	s.replay = append(s.replay, ev)
+	if len(s.replay) > replayBufferSize {
+		s.replay = s.replay[len(s.replay)-replayBufferSize:]
+	}
+	s.mu.Unlock()
+
+	if !ev.GetType().Lossy() {
+		s.eventSink <- ev
+		return
+	}
 	select {
 	case s.eventSink <- ev:
 	default:
-		log.Printf("stdio session %s: dropping event %s due to full buffer", s.id, ev.GetType())
+		log.Printf("stdio session %s: dropping %s event due to full buffer", s.id, ev.GetType())
+	}
+}
+
+// replaySince returns the buffered events from seq from on, the session's
+// latest seq, and whether some events from from on are no longer buffered.
+func (s *sessionState) replaySince(from uint64) ([]engineprotocol.Event, uint64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	from = max(from, 1)
+	oldest := s.seq - uint64(len(s.replay)) + 1
+	if from < oldest {
+		return slices.Clone(s.replay), s.seq, true
 	}
+	if from > s.seq {
+		return nil, s.seq, false
+	}
+	return slices.Clone(s.replay[from-oldest:]), s.seq, false
 }
 
-func (s *sessionState) beginRun() bool {
+func (s *sessionState) beginRun(requestID string) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if s.running {
 		return false
 	}
 	s.running = true
+	s.requestID = requestID
 	return true
 }
 
@@ -684,16 +1321,27 @@ func (s *sessionState) endRun() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.running = false
+	s.requestID = ""
+	s.lastUsed = time.Now()
 }
 
-func (s *sessionState) recordSummary(summary string, files []string) {
-	// 1. Get History (safe sync access)
-	var history []engine.ChatMessage
-	if s.agent != nil && s.agent.LastState() != nil {
-		history = s.agent.LastState().History
-	}
+func (s *sessionState) touch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastUsed = time.Now()
+}
+
+// idleSince reports whether s has neither run nor been addressed since t.
+func (s *sessionState) idleSince(t time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.running && s.lastUsed.Before(t)
+}
+
+func (s *sessionState) recordSummary(st *engine.State, summary string, files []string) {
+	history := st.History
 
-	// 2. Generate Title if needed
+	// 1. Generate Title if needed
 	s.mu.Lock()
 	needsTitle := s.title == "Untitled Session"
 	summarizer := s.summarizer
@@ -723,7 +1371,7 @@ func (s *sessionState) recordSummary(summary string, files []string) {
 		}
 	}
 
-	// 3. Update State and Save
+	// 2. Update State and Save
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -732,26 +1380,90 @@ func (s *sessionState) recordSummary(summary string, files []string) {
 	}
 	s.lastSummary = summary
 	s.files = append([]string(nil), files...)
+	for _, f := range files {
+		if !slices.Contains(s.filesTouched, f) {
+			s.filesTouched = append(s.filesTouched, f)
+		}
+	}
+	s.saveLocked(st)
+}
+
+// persist saves the messages st added since the last save, and the
+// session's metadata, so that a crash or kill mid-run loses at most the
+// step in progress.
+func (s *sessionState) persist(st *engine.State) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveLocked(st)
+}
 
-	// Create model snapshot while holding lock
+// saveLocked saves the session with st's history; s.mu must be held, which
+// keeps saves sequential.
+func (s *sessionState) saveLocked(st *engine.State) {
+	if s.store == nil {
+		return
+	}
 	model := &session.Session{
-		ID:        s.id,
-		RepoPath:  s.repoRoot,
-		Title:     s.title,
-		Summary:   s.lastSummary,
-		CreatedAt: s.createdAt,
-		UpdatedAt: time.Now(),
-		History:   history,
+		ID:           s.id,
+		RepoPath:     s.repoRoot,
+		Title:        s.title,
+		Summary:      s.lastSummary,
+		CreatedAt:    s.createdAt,
+		UpdatedAt:    time.Now(),
+		History:      st.History,
+		Archived:     s.archived,
+		Pinned:       s.pinned,
+		TokensUsed:   s.priorTokens + st.Totals.Total,
+		FilesTouched: slices.Clone(s.filesTouched),
+		ParentID:     s.parentID,
+		ForkIndex:    s.forkIndex,
+		Checkpoints:  slices.Clone(s.checkpoints),
+	}
+	if err := s.store.Append(model, s.persisted); err != nil {
+		log.Printf("failed to save session %s: %v", s.id, err)
+		return
 	}
-	store := s.store
+	s.persisted = len(st.History)
+}
 
-	// Persist (we can do this under lock to ensure sequential saves, or move out if blocking is issue)
-	// For now, doing it under lock prevents race conditions on file writes if recordSummary called concurrently (unlikely)
-	if store != nil {
-		if err := store.Save(model); err != nil {
-			log.Printf("failed to save session %s: %v", s.id, err)
-		}
+// markRun records in the store that the session is running message, or
+// with message "" that its run ended, so that a run the engine dies in can
+// be offered for resuming on restart.
+func (s *sessionState) markRun(message string) {
+	if s.store == nil {
+		return
+	}
+	var err error
+	if message == "" {
+		err = s.store.EndRun(s.id, s.repoRoot)
+	} else {
+		err = s.store.BeginRun(s.id, s.repoRoot, message)
+	}
+	if err != nil {
+		log.Printf("session %s: %v", s.id, err)
+	}
+}
+
+// checkpoint keeps the file a tool call is about to edit as it is, unless
+// it was already kept for the assistant message making the call, so that a
+// fork from before that message can restore it. Tool calls run
+// concurrently; the first to get here, before any of them edited the file,
+// is kept.
+func (s *sessionState) checkpoint(st *engine.State, call engine.ToolCall) {
+	rel, ok := session.EditedPath(call)
+	if !ok || len(st.History) == 0 {
+		return
+	}
+	index := len(st.History) - 1 // the assistant message with the call
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp, err := session.TakeCheckpoint(s.repoRoot, rel, index)
+	if err != nil {
+		log.Printf("checkpoint %s: %v", rel, err)
+		return
 	}
+	s.checkpoints = session.AddCheckpoint(s.checkpoints, cp)
 }
 
 // cancel attempts to cancel the current running task.
@@ -767,6 +1479,26 @@ func (s *sessionState) cancel() bool {
 	return false
 }
 
+// cancelRun cancels the run in progress, when requestID is "" or the
+// user_message that started it, and tells the agent so on the next
+// message.
+func (s *sessionState) cancelRun(requestID, reason string) bool {
+	s.mu.Lock()
+	if s.running && requestID != "" && s.requestID != requestID {
+		s.mu.Unlock()
+		return false
+	}
+	s.mu.Unlock()
+	if !s.cancel() {
+		return false
+	}
+	s.mu.Lock()
+	s.lastRunCancelled = true
+	s.mu.Unlock()
+	s.emit(engineprotocol.NewCancelledEvent(s.id, reason))
+	return true
+}
+
 // setCancelFunc stores the cancel function for the current run.
 func (s *sessionState) setCancelFunc(cancel context.CancelFunc) {
 	s.mu.Lock()
@@ -774,6 +1506,13 @@ func (s *sessionState) setCancelFunc(cancel context.CancelFunc) {
 	s.cancelFunc = cancel
 }
 
+// status returns the session's title and whether a run is in progress.
+func (s *sessionState) status() (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.title, s.running
+}
+
 func (s *sessionState) snapshot() (string, []string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -814,6 +1553,12 @@ func (h *protocolHook) OnStepStart(ctx context.Context, st *engine.State) {
 
 	detail := fmt.Sprintf("step=%d phase=%s", st.Step+1, st.Phase)
 	h.session.emit(engineprotocol.NewStatusEvent(h.session.id, "step_start", detail))
+	h.session.persist(st)
+}
+
+// OnHistoryChanged saves the messages a step added.
+func (h *protocolHook) OnHistoryChanged(ctx context.Context, st *engine.State) {
+	h.session.persist(st)
 }
 
 func (h *protocolHook) OnBeforeLLM(ctx context.Context, st *engine.State, messages []engine.ChatMessage, schemas []engine.ToolSchema) {
@@ -887,6 +1632,7 @@ func (h *protocolHook) OnAfterLLM(ctx context.Context, st *engine.State, resp en
 }
 
 func (h *protocolHook) OnToolCall(ctx context.Context, st *engine.State, call engine.ToolCall) {
+	h.session.checkpoint(st, call)
 	h.session.emit(engineprotocol.NewToolEvent(h.session.id, call.Name, "start", nil, ""))
 
 	// Generate stable invocation ID
@@ -989,7 +1735,7 @@ func (h *protocolHook) OnToolResult(ctx context.Context, st *engine.State, call
 	// Extract code changes for editing tools
 	var codeChange *engineprotocol.CodeChange
 	if call.Name == "search_replace" || call.Name == "propose_diff" || call.Name == "write" {
-		codeChange = extractCodeChange(call, result)
+		codeChange = extractCodeChange(call, result, codeChangePreview)
 	}
 
 	activityType := "tool"
@@ -1089,7 +1835,7 @@ func (h *protocolHook) OnToolResult(ctx context.Context, st *engine.State, call
 
 	// Handle RESPOND tool result (only on success)
 	if call.Name == "respond" && success {
-		h.handleRespondResult(result)
+		h.handleRespondResult(st, result)
 	}
 	// On failure, error is already captured in metadata above
 }
@@ -1143,7 +1889,7 @@ func (h *protocolHook) OnDone(ctx context.Context, st *engine.State) {
 	h.session.emit(engineprotocol.NewDoneEvent(h.session.id, summary, files))
 }
 
-func (h *protocolHook) handleRespondResult(result string) {
+func (h *protocolHook) handleRespondResult(st *engine.State, result string) {
 	trimmed := strings.TrimSpace(result)
 	if !strings.HasPrefix(trimmed, "{") {
 		// If result doesn't start with JSON, it might be an error message
@@ -1158,7 +1904,7 @@ func (h *protocolHook) handleRespondResult(result string) {
 		return
 	}
 
-	h.session.recordSummary(resp.Summary, resp.FilesChanged)
+	h.session.recordSummary(st, resp.Summary, resp.FilesChanged)
 	if len(resp.FilesChanged) > 0 {
 		h.session.emit(engineprotocol.NewFilesChangedEvent(h.session.id, resp.FilesChanged))
 	}
@@ -1420,17 +2166,30 @@ func extractThinkSummary(reasoning string) string {
 	return "Planning next action"
 }
 
-// extractCodeChange extracts code diff from editing tool results
-func extractCodeChange(call engine.ToolCall, result string) *engineprotocol.CodeChange {
+// codeChangePreview caps each side of the code changes in activity events.
+const codeChangePreview = 500
+
+// extractCodeChange extracts code diff from editing tool results, each side
+// truncated to limit bytes (0 for no limit)
+func extractCodeChange(call engine.ToolCall, result string, limit int) *engineprotocol.CodeChange {
 	// Try to parse result as JSON
 	var resultData map[string]any
 	if err := json.Unmarshal([]byte(result), &resultData); err != nil {
 		return nil
 	}
 
+	clip := func(s string) string {
+		if limit > 0 {
+			return truncate(s, limit)
+		}
+		return s
+	}
+
 	filePath := ""
 	if path, ok := call.Args["file_path"].(string); ok {
 		filePath = path
+	} else if path, ok := call.Args["path"].(string); ok {
+		filePath = path // write
 	}
 
 	if filePath == "" {
@@ -1445,19 +2204,19 @@ func extractCodeChange(call engine.ToolCall, result string) *engineprotocol.Code
 		if oldStr != "" || newStr != "" {
 			return &engineprotocol.CodeChange{
 				File:   filePath,
-				Before: truncate(oldStr, 500),
-				After:  truncate(newStr, 500),
+				Before: clip(oldStr),
+				After:  clip(newStr),
 			}
 		}
 	}
 
 	// For write tool, show that file was written
 	if call.Name == "write" {
-		if contents, ok := call.Args["contents"].(string); ok {
+		if contents, ok := call.Args["content"].(string); ok {
 			return &engineprotocol.CodeChange{
 				File:   filePath,
 				Before: "",
-				After:  truncate(contents, 500),
+				After:  clip(contents),
 			}
 		}
 	}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"maps"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ChamsBouzaiene/dodo/internal/engine"
+	engineprotocol "github.com/ChamsBouzaiene/dodo/internal/engine/protocol"
+	"github.com/ChamsBouzaiene/dodo/internal/session"
+)
+
+// maxTranscriptResult caps the tool results a transcript shows.
+const maxTranscriptResult = 20000
+
+// transcriptEntry is one message or tool call of a transcript.
+type transcriptEntry struct {
+	Role    string // user, assistant or system; "" for a tool call
+	Content string
+
+	Tool   string
+	Args   string // indented JSON, without the arguments Change shows
+	Result string
+	Change *engineprotocol.CodeChange
+	Plan   string
+}
+
+// transcriptEntries turns a conversation into what a transcript shows,
+// pairing each tool call with its result.
+func transcriptEntries(history []engine.ChatMessage) []transcriptEntry {
+	results := make(map[string]string)
+	for _, msg := range history {
+		if msg.Role == engine.RoleTool {
+			results[msg.Name] = msg.Content
+		}
+	}
+
+	var entries []transcriptEntry
+	for _, msg := range history {
+		switch msg.Role {
+		case engine.RoleUser, engine.RoleAssistant, engine.RoleSystem:
+			if msg.Content != "" {
+				entries = append(entries, transcriptEntry{Role: string(msg.Role), Content: msg.Content})
+			}
+		}
+		for _, call := range msg.ToolCalls {
+			result := results[call.ID]
+			entry := transcriptEntry{Tool: call.Name, Result: result, Plan: planSnapshot(call, result)}
+			args := maps.Clone(call.Args)
+			if entry.Change = extractCodeChange(call, result, 0); entry.Change != nil {
+				for _, k := range []string{"file_path", "path", "old_string", "new_string", "content"} {
+					delete(args, k)
+				}
+			}
+			if len(args) > 0 {
+				data, _ := json.MarshalIndent(args, "", "  ")
+				entry.Args = string(data)
+			}
+			if len(entry.Result) > maxTranscriptResult {
+				cut := maxTranscriptResult
+				for cut > 0 && !utf8.RuneStart(result[cut]) {
+					cut--
+				}
+				entry.Result = result[:cut] + fmt.Sprintf("\n... (truncated, %d bytes total)", len(result))
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// planSnapshot returns the plan a planning tool call wrote or read, if any.
+func planSnapshot(call engine.ToolCall, result string) string {
+	switch call.Name {
+	case "plan", "revise_plan":
+		return result
+	case "project_plan":
+		switch mode, _ := call.Args["mode"].(string); mode {
+		case "read":
+			return result
+		case "update":
+			content, _ := call.Args["content"].(string)
+			return content
+		}
+	}
+	return ""
+}
+
+// diffLines renders a code change as unified-diff lines.
+func diffLines(c *engineprotocol.CodeChange) []string {
+	lines := []string{"--- a/" + c.File, "+++ b/" + c.File}
+	if c.Before != "" {
+		for _, l := range strings.Split(strings.TrimSuffix(c.Before, "\n"), "\n") {
+			lines = append(lines, "-"+l)
+		}
+	}
+	if c.After != "" {
+		for _, l := range strings.Split(strings.TrimSuffix(c.After, "\n"), "\n") {
+			lines = append(lines, "+"+l)
+		}
+	}
+	return lines
+}
+
+// renderTranscript renders a stored session as a Markdown or HTML
+// transcript.
+func renderTranscript(sess *session.Session, format string) (string, error) {
+	entries := transcriptEntries(sess.History)
+	switch format {
+	case engineprotocol.ExportFormatMarkdown:
+		return markdownTranscript(sess, entries), nil
+	case engineprotocol.ExportFormatHTML:
+		var b strings.Builder
+		err := htmlTranscript.Execute(&b, map[string]any{
+			"Session": sess,
+			"Entries": entries,
+			"Created": sess.CreatedAt.Format(time.RFC1123),
+			"Updated": sess.UpdatedAt.Format(time.RFC1123),
+		})
+		return b.String(), err
+	}
+	return "", fmt.Errorf("unsupported transcript format %q", format)
+}
+
+func markdownTranscript(sess *session.Session, entries []transcriptEntry) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", sess.Title)
+	fmt.Fprintf(&b, "- Session: `%s`\n", sess.ID)
+	fmt.Fprintf(&b, "- Repository: `%s`\n", sess.RepoPath)
+	fmt.Fprintf(&b, "- Created: %s\n", sess.CreatedAt.Format(time.RFC1123))
+	fmt.Fprintf(&b, "- Updated: %s\n", sess.UpdatedAt.Format(time.RFC1123))
+	if sess.ParentID != "" {
+		fmt.Fprintf(&b, "- Forked from: `%s`\n", sess.ParentID)
+	}
+	fmt.Fprintf(&b, "- Tokens used: %d\n", sess.TokensUsed)
+	if sess.Summary != "" {
+		fmt.Fprintf(&b, "\n> %s\n", strings.ReplaceAll(sess.Summary, "\n", "\n> "))
+	}
+
+	for _, e := range entries {
+		b.WriteString("\n")
+		switch {
+		case e.Role == string(engine.RoleSystem):
+			fmt.Fprintf(&b, "<details><summary>System</summary>\n\n%s\n</details>\n", fenced("", e.Content))
+		case e.Role != "":
+			fmt.Fprintf(&b, "## %s\n\n%s\n", strings.ToUpper(e.Role[:1])+e.Role[1:], e.Content)
+		default:
+			fmt.Fprintf(&b, "**Tool call: `%s`**\n", e.Tool)
+			if e.Args != "" {
+				fmt.Fprintf(&b, "\n%s", fenced("json", e.Args))
+			}
+			if e.Change != nil {
+				fmt.Fprintf(&b, "\n%s", fenced("diff", strings.Join(diffLines(e.Change), "\n")))
+			}
+			if e.Plan != "" {
+				fmt.Fprintf(&b, "\nPlan:\n\n%s", fenced("markdown", e.Plan))
+			} else if e.Result != "" {
+				fmt.Fprintf(&b, "\n<details><summary>Result</summary>\n\n%s\n</details>\n", fenced("", e.Result))
+			}
+		}
+	}
+	return b.String()
+}
+
+// fenced puts s in a code block whose fence no backtick run in s can close.
+func fenced(lang, s string) string {
+	fence := "```"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	return fmt.Sprintf("%s%s\n%s\n%s\n", fence, lang, strings.TrimSuffix(s, "\n"), fence)
+}
+
+var htmlTranscript = template.Must(template.New("transcript").Funcs(template.FuncMap{
+	"diff": diffLines,
+	"diffClass": func(line string) string {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			return "file"
+		case strings.HasPrefix(line, "+"):
+			return "add"
+		case strings.HasPrefix(line, "-"):
+			return "del"
+		}
+		return ""
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Session.Title}}</title>
+<style>
+body { font: 15px/1.5 -apple-system, "Segoe UI", sans-serif; max-width: 60rem; margin: 2rem auto; padding: 0 1rem; color: #1f2328; }
+.meta { color: #59636e; font-size: 13px; }
+.msg { margin: 1.2rem 0; padding: .6rem 1rem; border-radius: 6px; white-space: pre-wrap; }
+.user { background: #ddf4ff; }
+.assistant { background: #f6f8fa; }
+.role { font-weight: 600; display: block; }
+.tool { margin: .6rem 0 .6rem 1.5rem; }
+pre { background: #f6f8fa; padding: .6rem; overflow-x: auto; font-size: 13px; }
+.add { color: #116329; background: #dafbe1; }
+.del { color: #82071e; background: #ffebe9; }
+.file { color: #59636e; }
+summary { cursor: pointer; color: #59636e; }
+</style>
+</head>
+<body>
+<h1>{{.Session.Title}}</h1>
+<p class="meta">Session <code>{{.Session.ID}}</code> in <code>{{.Session.RepoPath}}</code><br>
+Created {{.Created}}, updated {{.Updated}}<br>
+{{if .Session.ParentID}}Forked from <code>{{.Session.ParentID}}</code><br>{{end}}
+Tokens used: {{.Session.TokensUsed}}</p>
+{{if .Session.Summary}}<blockquote>{{.Session.Summary}}</blockquote>{{end}}
+{{range .Entries}}{{if eq .Role "system"}}<details class="tool"><summary>System</summary><pre>{{.Content}}</pre></details>
+{{else if .Role}}<div class="msg {{.Role}}"><span class="role">{{.Role}}</span>{{.Content}}</div>
+{{else}}<div class="tool"><strong>Tool call: <code>{{.Tool}}</code></strong>
+{{if .Args}}<pre>{{.Args}}</pre>{{end}}
+{{if .Change}}<pre>{{range diff .Change}}<span class="{{diffClass .}}">{{.}}</span>
+{{end}}</pre>{{end}}
+{{if .Plan}}<p>Plan:</p><pre>{{.Plan}}</pre>{{else if .Result}}<details><summary>Result</summary><pre>{{.Result}}</pre></details>{{end}}
+</div>
+{{end}}{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ChamsBouzaiene/dodo/internal/engine"
+	engineprotocol "github.com/ChamsBouzaiene/dodo/internal/engine/protocol"
+	"github.com/ChamsBouzaiene/dodo/internal/session"
+)
+
+var update = flag.Bool("update", false, "rewrite the transcripts in testdata")
+
+// transcriptSession is a stored session with a message of every kind a
+// transcript shows.
+func transcriptSession() *session.Session {
+	created := time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC)
+	return &session.Session{
+		ID:         "sess-1",
+		RepoPath:   "/src/app",
+		Title:      "Fix <script> escaping & more",
+		CreatedAt:  created,
+		UpdatedAt:  created.Add(25 * time.Minute),
+		Summary:    "Escaped the title.\nAdded a test.",
+		TokensUsed: 1234,
+		ParentID:   "sess-0",
+		History: []engine.ChatMessage{
+			{Role: engine.RoleSystem, Content: "You are a coding agent."},
+			{Role: engine.RoleUser, Content: "Titles with <b>tags</b> break the page & the ```fence```."},
+			{Role: engine.RoleAssistant, Content: "Let me plan.", ToolCalls: []engine.ToolCall{
+				{ID: "c1", Name: "project_plan", Args: map[string]any{"mode": "update", "content": "1. Escape titles\n2. Test <marquee>"}},
+			}},
+			{Role: engine.RoleTool, Name: "c1", Content: `{"ok": true}`},
+			{Role: engine.RoleAssistant, ToolCalls: []engine.ToolCall{
+				{ID: "c2", Name: "search_replace", Args: map[string]any{"file_path": "page.go", "old_string": "title := raw\n", "new_string": "title := html.EscapeString(raw)\n", "replace_all": false}},
+				{ID: "c3", Name: "run_cmd", Args: map[string]any{"command": "go test ./..."}},
+			}},
+			{Role: engine.RoleTool, Name: "c2", Content: `{"success": true, "file_path": "page.go"}`},
+			{Role: engine.RoleTool, Name: "c3", Content: "ok  \tapp\t0.01s\n<done>"},
+			{Role: engine.RoleAssistant, Content: "Titles are escaped now."},
+		},
+		Checkpoints: []session.Checkpoint{{MessageIndex: 4, Path: "page.go", Exists: true, Content: []byte("title := raw\n")}},
+	}
+}
+
+// TestExportTranscripts compares each export format with its golden file
+// in testdata, rewritten with
+//
+//	go test ./cmd/repl -run TestExportTranscripts -update
+func TestExportTranscripts(t *testing.T) {
+	for _, format := range []string{engineprotocol.ExportFormatMarkdown, engineprotocol.ExportFormatHTML, engineprotocol.ExportFormatJSON} {
+		t.Run(format, func(t *testing.T) {
+			got, err := exportSession(transcriptSession(), format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join("testdata", "transcript."+format)
+			if *update {
+				if err := os.MkdirAll("testdata", 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("%v (run with -update to create it)", err)
+			}
+			if got != string(want) {
+				t.Errorf("%s transcript differs from %s:\n%s", format, path, got)
+			}
+		})
+	}
+}
+
+func TestTranscriptEscapesHTML(t *testing.T) {
+	got, err := exportSession(transcriptSession(), engineprotocol.ExportFormatHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, raw := range []string{"<script>", "<b>tags</b>", "<marquee>", "<done>"} {
+		if strings.Contains(got, raw) {
+			t.Errorf("HTML transcript contains unescaped %s", raw)
+		}
+	}
+	if !strings.Contains(got, "Fix &lt;script&gt; escaping &amp; more") {
+		t.Error("HTML transcript lacks the escaped title")
+	}
+}
+
+func TestTranscriptTruncatesOnRuneBoundary(t *testing.T) {
+	// A two-byte rune straddles the cap.
+	result := strings.Repeat("a", maxTranscriptResult-1) + "é" + strings.Repeat("b", 10)
+	entries := transcriptEntries([]engine.ChatMessage{
+		{Role: engine.RoleAssistant, ToolCalls: []engine.ToolCall{{ID: "c1", Name: "read_file"}}},
+		{Role: engine.RoleTool, Name: "c1", Content: result},
+	})
+	if len(entries) != 1 {
+		t.Fatalf("%d entries, want 1", len(entries))
+	}
+	got := entries[0].Result
+	if !utf8.ValidString(got) {
+		t.Error("truncated result is not valid UTF-8")
+	}
+	if !strings.HasPrefix(got, strings.Repeat("a", maxTranscriptResult-1)+"\n... (truncated") {
+		t.Errorf("truncated result ends %q", got[maxTranscriptResult-10:])
+	}
+}
@@ -15,6 +15,7 @@ import (
 
 	"github.com/ChamsBouzaiene/dodo/internal/prompts"
 	toolsengine "github.com/ChamsBouzaiene/dodo/internal/tools"
+	"github.com/ChamsBouzaiene/dodo/internal/tools/execution"
 )
 
 const defaultBeaconCacheTTL = 10 * time.Minute
@@ -26,6 +27,7 @@ type CodeBeaconAgent struct {
 	repoRoot     string
 	retrieval    indexer.Retrieval
 	workspaceCtx *indexer.WorkspaceContext
+	runner       execution.Runner
 
 	mu       sync.Mutex
 	cache    map[string]cachedBeaconReport
@@ -38,11 +40,12 @@ type cachedBeaconReport struct {
 }
 
 // NewCodeBeaconAgent wires up a factory for short-lived CodeBeacon sessions.
-func NewCodeBeaconAgent(ctx context.Context, repoRoot string, retrieval indexer.Retrieval, workspaceCtx *indexer.WorkspaceContext) (*CodeBeaconAgent, error) {
+func NewCodeBeaconAgent(ctx context.Context, repoRoot string, retrieval indexer.Retrieval, workspaceCtx *indexer.WorkspaceContext, runner execution.Runner) (*CodeBeaconAgent, error) {
 	return &CodeBeaconAgent{
 		repoRoot:     repoRoot,
 		retrieval:    retrieval,
 		workspaceCtx: workspaceCtx,
+		runner:       runner,
 		cache:        make(map[string]cachedBeaconReport),
 		cacheTTL:     defaultBeaconCacheTTL,
 	}, nil
@@ -134,7 +137,7 @@ func (b *CodeBeaconAgent) newSession(ctx context.Context) (*engine.Agent, error)
 		return nil, fmt.Errorf("failed to set prompt: %w", err)
 	}
 
-	reg, err := toolsengine.NewToolRegistry(b.repoRoot, b.retrieval, readOnlyTools)
+	reg, err := toolsengine.NewToolRegistry(b.repoRoot, b.retrieval, b.runner, readOnlyTools)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create tool registry: %w", err)
 	}
@@ -4,14 +4,18 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
+	"strconv"
 
 	"github.com/ChamsBouzaiene/dodo/internal/engine"
 	"github.com/ChamsBouzaiene/dodo/internal/indexer"
+	"github.com/ChamsBouzaiene/dodo/internal/memory"
 	"github.com/ChamsBouzaiene/dodo/internal/project"
 	"github.com/ChamsBouzaiene/dodo/internal/providers"
 
 	"github.com/ChamsBouzaiene/dodo/internal/prompts"
 	toolsengine "github.com/ChamsBouzaiene/dodo/internal/tools"
+	"github.com/ChamsBouzaiene/dodo/internal/tools/execution"
 	"github.com/ChamsBouzaiene/dodo/internal/tools/reasoning"
 )
 
@@ -31,8 +35,17 @@ func WithTool(name string, tool engine.Tool) Option {
 	}
 }
 
+// maxStepsFromEnv returns the step cap from DODO_MAX_STEPS (set directly or via
+// the max_steps config key), falling back to the interactive default.
+func maxStepsFromEnv() int {
+	if n, err := strconv.Atoi(os.Getenv("DODO_MAX_STEPS")); err == nil && n > 0 {
+		return n
+	}
+	return engine.DefaultInteractiveMaxSteps
+}
+
 // NewAgent creates a fully configured CoderAgent.
-func NewAgent(ctx context.Context, repoRoot string, retrieval indexer.Retrieval, workspaceCtx *indexer.WorkspaceContext, streaming bool, muteResponse bool, extraHooks []engine.Hook, opts ...Option) (*CoderAgent, error) {
+func NewAgent(ctx context.Context, repoRoot string, retrieval indexer.Retrieval, workspaceCtx *indexer.WorkspaceContext, runner execution.Runner, streaming bool, muteResponse bool, extraHooks []engine.Hook, opts ...Option) (*CoderAgent, error) {
 	standardToolSet := engine.ToolSet{
 		Filesystem: true,
 		Search:     true,
@@ -42,7 +55,7 @@ func NewAgent(ctx context.Context, repoRoot string, retrieval indexer.Retrieval,
 		Meta:       true,
 	}
 
-	baseRegistry, err := toolsengine.NewToolRegistry(repoRoot, retrieval, standardToolSet)
+	baseRegistry, err := toolsengine.NewToolRegistry(repoRoot, retrieval, runner, standardToolSet)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create tool registry: %w", err)
 	}
@@ -52,6 +65,12 @@ func NewAgent(ctx context.Context, repoRoot string, retrieval indexer.Retrieval,
 	baseRegistry["revise_plan"] = reasoning.NewRevisePlanTool()
 	baseRegistry["project_plan"] = reasoning.NewProjectPlanTool(repoRoot)
 
+	// Project memory shared by every session in the repository
+	memories := memory.NewStore(repoRoot)
+	baseRegistry["remember"] = reasoning.NewRememberTool(memories)
+	baseRegistry["recall"] = reasoning.NewRecallTool(memories)
+	baseRegistry["forget"] = reasoning.NewForgetTool(memories)
+
 	// Apply options (inject custom tools like code_beacon)
 	for _, opt := range opts {
 		opt(&baseRegistry)
@@ -67,7 +86,7 @@ func NewAgent(ctx context.Context, repoRoot string, retrieval indexer.Retrieval,
 		WithLLM(llm).
 		WithModel(modelName).
 		WithStreaming(streaming).
-		WithMaxSteps(engine.DefaultInteractiveMaxSteps).
+		WithMaxSteps(maxStepsFromEnv()).
 		WithPlanningEnforcement(true).
 		WithToolRegistry(baseRegistry, repoRoot, retrieval, standardToolSet)
 
@@ -0,0 +1,392 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Config files never hold key material. They hold key references that are
+// resolved when settings are loaded:
+//
+//	env:OPENAI_API_KEY   the environment variable OPENAI_API_KEY
+//	store:openai         the entry "openai" in the credential store
+//
+// A bare name is an environment variable, so profiles written before
+// references existed keep working.
+const (
+	refEnv   = "env"
+	refStore = "store"
+)
+
+var (
+	// ErrCredentialNotFound is returned for names the store doesn't hold.
+	ErrCredentialNotFound = errors.New("credential not found")
+	// ErrReadOnlyStore is returned when writing to the env backend.
+	ErrReadOnlyStore = errors.New("credential store is read-only")
+)
+
+// ParseKeyRef splits a key reference into its scheme and name.
+func ParseKeyRef(ref string) (scheme, name string, err error) {
+	scheme, name, ok := strings.Cut(ref, ":")
+	if !ok {
+		scheme, name = refEnv, ref
+	}
+	switch scheme {
+	case refEnv:
+		if !envVarPattern.MatchString(name) {
+			return "", "", fmt.Errorf("key reference %q: %q is not an environment variable name", ref, name)
+		}
+	case refStore:
+		if !credentialNamePattern.MatchString(name) {
+			return "", "", fmt.Errorf("key reference %q: invalid credential name %q", ref, name)
+		}
+	default:
+		return "", "", fmt.Errorf("key reference %q: unknown scheme %q (valid: env, store)", ref, scheme)
+	}
+	return scheme, name, nil
+}
+
+// StoreRef returns the reference to the credential store entry name.
+func StoreRef(name string) string { return refStore + ":" + name }
+
+// EnvRef returns the reference to the environment variable name.
+func EnvRef(name string) string { return refEnv + ":" + name }
+
+var credentialNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// CredentialStore holds API keys outside the config files.
+type CredentialStore interface {
+	// Get returns the secret stored under name or ErrCredentialNotFound.
+	Get(name string) (string, error)
+	Set(name, secret string) error
+	Delete(name string) error
+	// Names lists the stored names in sorted order.
+	Names() ([]string, error)
+}
+
+// EnvStore is the env-only backend: store:NAME reads the environment
+// variable NAME and nothing can be written.
+type EnvStore struct {
+	Env map[string]string
+}
+
+// Get implements CredentialStore.
+func (s EnvStore) Get(name string) (string, error) {
+	if v := s.Env[name]; v != "" {
+		return v, nil
+	}
+	return "", fmt.Errorf("%w: environment variable %s is not set", ErrCredentialNotFound, name)
+}
+
+// Set implements CredentialStore.
+func (s EnvStore) Set(name, secret string) error {
+	return fmt.Errorf("%w: credential_store is env, set the key in the environment instead", ErrReadOnlyStore)
+}
+
+// Delete implements CredentialStore.
+func (s EnvStore) Delete(name string) error {
+	return fmt.Errorf("%w: credential_store is env", ErrReadOnlyStore)
+}
+
+// Names implements CredentialStore. The environment isn't enumerated.
+func (s EnvStore) Names() ([]string, error) { return nil, nil }
+
+// FileStore keeps credentials in one AES-256-GCM encrypted file. The key is
+// derived from Passphrase with PBKDF2 when one is given and from the
+// contents of KeyFile with HKDF otherwise; the key file is generated on the
+// first write. A store file remembers which of the two sealed it, so
+// setting a passphrase later doesn't lock out an existing key-file store.
+type FileStore struct {
+	Path       string
+	KeyFile    string
+	Passphrase string
+}
+
+const (
+	kdfPBKDF2 = "pbkdf2-sha256"
+	kdfHKDF   = "hkdf-sha256"
+
+	pbkdf2Iterations = 600_000
+	keyFileBytes     = 32
+)
+
+// sealedFile is the on-disk format of a FileStore.
+type sealedFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations,omitempty"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+var (
+	// fileStoreMu serializes read-modify-write cycles within the process.
+	fileStoreMu sync.Mutex
+	// passphraseKeys caches PBKDF2 output by passphrase digest and salt.
+	passphraseKeys sync.Map
+)
+
+// Get implements CredentialStore.
+func (s *FileStore) Get(name string) (string, error) {
+	fileStoreMu.Lock()
+	defer fileStoreMu.Unlock()
+	entries, _, err := s.open()
+	if err != nil {
+		return "", err
+	}
+	v, ok := entries[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrCredentialNotFound, name)
+	}
+	return v, nil
+}
+
+// Set implements CredentialStore.
+func (s *FileStore) Set(name, secret string) error {
+	if !credentialNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid credential name %q", name)
+	}
+	if secret == "" {
+		return s.Delete(name)
+	}
+	fileStoreMu.Lock()
+	defer fileStoreMu.Unlock()
+	entries, kdf, err := s.open()
+	if err != nil {
+		return err
+	}
+	entries[name] = secret
+	return s.seal(entries, kdf)
+}
+
+// Delete implements CredentialStore.
+func (s *FileStore) Delete(name string) error {
+	fileStoreMu.Lock()
+	defer fileStoreMu.Unlock()
+	entries, kdf, err := s.open()
+	if err != nil {
+		return err
+	}
+	if _, ok := entries[name]; !ok {
+		return nil
+	}
+	delete(entries, name)
+	return s.seal(entries, kdf)
+}
+
+// Names implements CredentialStore.
+func (s *FileStore) Names() ([]string, error) {
+	fileStoreMu.Lock()
+	defer fileStoreMu.Unlock()
+	entries, _, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// open decrypts the store. A missing file is an empty store sealed with the
+// KDF matching the configured key source.
+func (s *FileStore) open() (map[string]string, string, error) {
+	data, err := os.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		kdf := kdfHKDF
+		if s.Passphrase != "" {
+			kdf = kdfPBKDF2
+		}
+		return map[string]string{}, kdf, nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read credential store: %w", err)
+	}
+
+	var f sealedFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, "", fmt.Errorf("failed to parse %s: %w", s.Path, err)
+	}
+	if f.Version != 1 {
+		return nil, "", fmt.Errorf("%s: unsupported credential store version %d", s.Path, f.Version)
+	}
+	key, err := s.deriveKey(f.KDF, f.Salt, f.Iterations, false)
+	if err != nil {
+		return nil, "", err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, "", err
+	}
+	plain, err := aead.Open(nil, f.Nonce, f.Ciphertext, []byte(f.KDF))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decrypt %s: wrong passphrase or key file", s.Path)
+	}
+	entries := make(map[string]string)
+	if err := json.Unmarshal(plain, &entries); err != nil {
+		return nil, "", fmt.Errorf("failed to decode %s: %w", s.Path, err)
+	}
+	return entries, f.KDF, nil
+}
+
+// seal encrypts entries under a fresh salt and nonce and replaces the file.
+func (s *FileStore) seal(entries map[string]string, kdf string) error {
+	f := sealedFile{Version: 1, KDF: kdf, Salt: make([]byte, 16)}
+	if kdf == kdfPBKDF2 {
+		f.Iterations = pbkdf2Iterations
+	}
+	if _, err := rand.Read(f.Salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+	key, err := s.deriveKey(kdf, f.Salt, f.Iterations, true)
+	if err != nil {
+		return err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	f.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	plain, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode credentials: %w", err)
+	}
+	f.Ciphertext = aead.Seal(nil, f.Nonce, plain, []byte(kdf))
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode credential store: %w", err)
+	}
+	return writeFileAtomic(s.Path, append(data, '\n'), 0600)
+}
+
+func (s *FileStore) deriveKey(kdf string, salt []byte, iterations int, create bool) ([]byte, error) {
+	switch kdf {
+	case kdfPBKDF2:
+		if s.Passphrase == "" {
+			return nil, fmt.Errorf("%s is passphrase-protected: set DODO_CREDENTIAL_PASSPHRASE", s.Path)
+		}
+		// Deriving takes a noticeable fraction of a second and settings
+		// are resolved several times per session.
+		digest := sha256.Sum256([]byte(s.Passphrase))
+		cacheKey := fmt.Sprintf("%x/%x/%d", digest, salt, iterations)
+		if key, ok := passphraseKeys.Load(cacheKey); ok {
+			return key.([]byte), nil
+		}
+		key, err := pbkdf2.Key(sha256.New, s.Passphrase, salt, iterations, 32)
+		if err != nil {
+			return nil, err
+		}
+		passphraseKeys.Store(cacheKey, key)
+		return key, nil
+	case kdfHKDF:
+		secret, err := s.keyFileSecret(create)
+		if err != nil {
+			return nil, err
+		}
+		return hkdf.Key(sha256.New, secret, salt, "dodo credential store", 32)
+	default:
+		return nil, fmt.Errorf("%s: unknown key derivation %q", s.Path, kdf)
+	}
+}
+
+// keyFileSecret reads the key file, generating it when create is set.
+func (s *FileStore) keyFileSecret(create bool) ([]byte, error) {
+	data, err := os.ReadFile(s.KeyFile)
+	if os.IsNotExist(err) && create {
+		secret := make([]byte, keyFileBytes)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("failed to generate key file: %w", err)
+		}
+		encoded := hex.EncodeToString(secret)
+		if err := writeFileAtomic(s.KeyFile, []byte(encoded+"\n"), 0600); err != nil {
+			return nil, err
+		}
+		return []byte(encoded), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credential key file: %w", err)
+	}
+	secret := []byte(strings.TrimSpace(string(data)))
+	if len(secret) < keyFileBytes {
+		return nil, fmt.Errorf("credential key file %s is too short", s.KeyFile)
+	}
+	return secret, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// Credentials returns the backend selected by the credential_store setting.
+// The encrypted file lives next to the user config file. Project files
+// can't choose the backend: a cloned repository must not redirect where
+// keys are read from.
+func (l *Loader) Credentials() (CredentialStore, error) {
+	// The user file is read as is: migrating it may itself need the store.
+	defaults, _ := l.Layer(ScopeDefault)
+	raw, err := readRawFile(l.userReadPath())
+	if err != nil {
+		return nil, err
+	}
+	flags, _ := l.Layer(ScopeFlag)
+	layers := []map[string]Value{defaults, layerFromRaw(raw, l.userReadPath(), ScopeUser), l.envLayer(""), flags}
+
+	switch backend := lastValue(layers, "credential_store").Value; backend {
+	case "env":
+		return EnvStore{Env: l.Env}, nil
+	case "file", "":
+		dir := filepath.Dir(l.UserPath)
+		keyFile := lastValue(layers, "credential_key_file").Value
+		if keyFile == "" {
+			keyFile = filepath.Join(dir, "credentials.key")
+		}
+		return &FileStore{
+			Path:       filepath.Join(dir, "credentials.enc"),
+			KeyFile:    keyFile,
+			Passphrase: l.Env["DODO_CREDENTIAL_PASSPHRASE"],
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown credential_store %q (valid: file, env)", backend)
+	}
+}
+
+// ResolveKeyRef returns the key a reference points to.
+func (l *Loader) ResolveKeyRef(ref string) (string, error) {
+	scheme, name, err := ParseKeyRef(ref)
+	if err != nil {
+		return "", err
+	}
+	if scheme == refEnv {
+		return l.Env[name], nil
+	}
+	store, err := l.Credentials()
+	if err != nil {
+		return "", err
+	}
+	return store.Get(name)
+}
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kind is the type of a configuration value.
+type Kind int
+
+const (
+	KindString Kind = iota
+	KindBool
+	KindInt
+	KindFloat
+	KindDuration
+	KindKeyRef
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindBool:
+		return "bool"
+	case KindInt:
+		return "int"
+	case KindFloat:
+		return "float"
+	case KindDuration:
+		return "duration"
+	case KindKeyRef:
+		return "key reference"
+	default:
+		return "string"
+	}
+}
+
+// providerPlaceholder in Key.Env is replaced by the upper-cased active provider.
+const providerPlaceholder = "{PROVIDER}"
+
+// Key describes one configuration setting.
+type Key struct {
+	Name        string
+	Kind        Kind
+	Default     string
+	Env         string   // environment variable that overrides the files; may contain {PROVIDER}
+	Allowed     []string // permitted values, if restricted
+	Secret      bool     // kept in the credential store, never in a config file, and masked when listed
+	Ref         string   // for secrets, the setting that holds the key reference
+	UserOnly    bool     // ignored in project files, which a cloned repository controls
+	Description string
+}
+
+// Keys lists every supported setting in display order.
+var Keys = []Key{
+	{Name: "profile", Env: "DODO_PROFILE", Description: "Named provider profile to use"},
+	{Name: "llm_provider", Default: "openai", Env: "LLM_PROVIDER", Description: "LLM provider (openai, anthropic, kimi, ...)"},
+	{Name: "model", Env: "{PROVIDER}_MODEL", Description: "Model name for the selected provider"},
+	{Name: "api_key", Env: "{PROVIDER}_API_KEY", Secret: true, Ref: "api_key_ref", Description: "API key for the selected provider"},
+	{Name: "api_key_ref", Kind: KindKeyRef, UserOnly: true, Description: "Where the API key is kept (env:VAR or store:NAME)"},
+	{Name: "base_url", Env: "{PROVIDER}_BASE_URL", UserOnly: true, Description: "Override for the provider API base URL"},
+	{Name: "temperature", Kind: KindFloat, Env: "DODO_TEMPERATURE", Description: "Sampling temperature (0 = provider default)"},
+	{Name: "max_output_tokens", Kind: KindInt, Env: "DODO_MAX_OUTPUT_TOKENS", Description: "Upper bound on tokens per model response (0 = no cap)"},
+	{Name: "embedding_key", Secret: true, Ref: "embedding_key_ref", Description: "Separate OpenAI key for embeddings"},
+	{Name: "embedding_key_ref", Kind: KindKeyRef, UserOnly: true, Description: "Where the embeddings key is kept (env:VAR or store:NAME)"},
+	{Name: "credential_store", Default: "file", Env: "DODO_CREDENTIAL_STORE", Allowed: []string{"file", "env"}, UserOnly: true, Description: "Credential backend: encrypted file or environment only"},
+	{Name: "credential_key_file", Env: "DODO_CREDENTIAL_KEY_FILE", UserOnly: true, Description: "Key file for the encrypted store (default ~/.dodo/credentials.key)"},
+	{Name: "auto_index", Kind: KindBool, Default: "false", Description: "Index new projects without asking"},
+	{Name: "requests_per_minute", Kind: KindInt, Env: "{PROVIDER}_RPM", Description: "Client-side request rate limit (0 = from response headers)"},
+	{Name: "tokens_per_minute", Kind: KindInt, Env: "{PROVIDER}_TPM", Description: "Client-side token rate limit (0 = from response headers)"},
+	{Name: "embedding_requests_per_minute", Kind: KindInt, Env: "OPENAI_EMBEDDING_RPM", Description: "Client-side request rate limit for indexing embeddings (0 = from response headers)"},
+	{Name: "embedding_tokens_per_minute", Kind: KindInt, Env: "OPENAI_EMBEDDING_TPM", Description: "Client-side token rate limit for indexing embeddings (0 = from response headers)"},
+	{Name: "max_steps", Kind: KindInt, Env: "DODO_MAX_STEPS", Description: "Maximum agent steps per request (0 = engine default)"},
+	{Name: "sandbox_mode", Default: "auto", Env: "DODO_SANDBOX_MODE", Allowed: []string{"auto", "docker", "host"}, Description: "Where commands run"},
+	{Name: "docker_image", Env: "DODO_DOCKER_IMAGE", UserOnly: true, Description: "Docker image override for the sandbox"},
+	{Name: "docker_cpu", Default: "2", Env: "DODO_DOCKER_CPU", Description: "CPU limit for sandbox containers"},
+	{Name: "docker_memory", Default: "1g", Env: "DODO_DOCKER_MEMORY", Description: "Memory limit for sandbox containers"},
+	{Name: "cmd_timeout", Kind: KindDuration, Default: "2m", Env: "DODO_CMD_TIMEOUT", Description: "Default command timeout"},
+	{Name: "lsp", Kind: KindBool, Default: "true", Env: "DODO_LSP", Description: "Offer language-server tools (definitions, references, diagnostics)"},
+	{Name: "lsp_command", Env: "DODO_LSP_COMMAND", UserOnly: true, Description: "Language server command line, instead of the one for the project type"},
+	{Name: "session_gc", Kind: KindBool, Default: "true", Env: "DODO_SESSION_GC", UserOnly: true, Description: "Collect stored sessions past the limits below when the engine starts"},
+	{Name: "session_max_age_days", Kind: KindInt, Default: "90", UserOnly: true, Description: "Delete sessions not updated for this many days (0 = keep)"},
+	{Name: "session_max_per_repo", Kind: KindInt, Default: "200", UserOnly: true, Description: "Sessions kept per repository, newest first (0 = all)"},
+	{Name: "session_max_total_mb", Kind: KindInt, Default: "1024", UserOnly: true, Description: "Space stored sessions may take; the oldest are deleted first (0 = no limit)"},
+	{Name: "session_archive_kb", Kind: KindInt, Default: "512", UserOnly: true, Description: "Compress histories larger than this into archive files (0 = never)"},
+	{Name: "memory_tokens", Kind: KindInt, Default: "1000", Description: "Tokens of project memory put in context with each message (0 = none)"},
+	{Name: "code_file_boost", Kind: KindFloat, Env: "DODO_CODE_FILE_BOOST", Description: "Search score boost for code files (1.0-2.0)"},
+}
+
+// LookupKey returns the definition of the named setting.
+func LookupKey(name string) (Key, bool) {
+	for _, k := range Keys {
+		if k.Name == name {
+			return k, true
+		}
+	}
+	return Key{}, false
+}
+
+// EnvVar returns the environment variable for k given the active provider, or
+// "" if the key has none.
+func (k Key) EnvVar(provider string) string {
+	if k.Env == "" {
+		return ""
+	}
+	return strings.ReplaceAll(k.Env, providerPlaceholder, strings.ToUpper(provider))
+}
+
+// Validate checks that value is acceptable for k.
+func (k Key) Validate(value string) error {
+	var err error
+	switch k.Kind {
+	case KindBool:
+		_, err = strconv.ParseBool(value)
+	case KindInt:
+		var n int
+		if n, err = strconv.Atoi(value); err == nil && n < 0 {
+			return fmt.Errorf("%s: must not be negative, got %d", k.Name, n)
+		}
+	case KindFloat:
+		_, err = strconv.ParseFloat(value, 64)
+	case KindDuration:
+		_, err = time.ParseDuration(value)
+	case KindKeyRef:
+		if _, _, err := ParseKeyRef(value); err != nil {
+			return fmt.Errorf("%s: %w", k.Name, err)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s: invalid %s %q", k.Name, k.Kind, value)
+	}
+
+	if len(k.Allowed) > 0 {
+		for _, a := range k.Allowed {
+			if value == a {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: %q is not one of %s", k.Name, value, strings.Join(k.Allowed, ", "))
+	}
+	return nil
+}
+
+// MaskSecret hides all but the last four characters of a secret.
+func MaskSecret(s string) string {
+	if len(s) <= 8 {
+		return strings.Repeat("*", len(s))
+	}
+	return strings.Repeat("*", 8) + s[len(s)-4:]
+}
+
+// UnmaskSecret returns the secret a client meant when it sent value back:
+// the stored secret if value is its mask, value itself otherwise. A mask of
+// some other secret is an error rather than a new key.
+func UnmaskSecret(value, stored string) (string, error) {
+	if value == "" || !strings.HasPrefix(value, "*") {
+		return value, nil
+	}
+	if value == MaskSecret(stored) {
+		return stored, nil
+	}
+	return "", errors.New("masked key does not match the stored key; enter the key again")
+}
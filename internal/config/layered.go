@@ -0,0 +1,729 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scope identifies a configuration layer. Later layers override earlier ones:
+// defaults, then the user file, then the project file, then the environment,
+// then command-line flags.
+type Scope string
+
+const (
+	ScopeDefault Scope = "default"
+	ScopeUser    Scope = "user"
+	ScopeProject Scope = "project"
+	ScopeEnv     Scope = "env"
+	ScopeFlag    Scope = "flag"
+)
+
+// Scopes lists the layers from lowest to highest precedence.
+var Scopes = []Scope{ScopeDefault, ScopeUser, ScopeProject, ScopeEnv, ScopeFlag}
+
+// ParseScope validates a scope name.
+func ParseScope(s string) (Scope, error) {
+	for _, scope := range Scopes {
+		if string(scope) == s {
+			return scope, nil
+		}
+	}
+	return "", fmt.Errorf("unknown scope %q (valid: default, user, project, env, flag)", s)
+}
+
+// Value is a resolved setting together with where it came from.
+type Value struct {
+	Key    string
+	Value  string
+	Scope  Scope
+	Origin string // file path, environment variable or flag that set the value
+}
+
+// Set reports whether any layer, including defaults, supplied the value.
+func (v Value) Set() bool {
+	return v.Scope != ""
+}
+
+// Loader resolves settings for one repository.
+type Loader struct {
+	UserPath   string            // ~/.dodo/config.json
+	LegacyPath string            // pre-layering location, read when UserPath is missing
+	RepoRoot   string            // project layer is RepoRoot/.dodo/config.json; empty disables it
+	Env        map[string]string // environment snapshot
+	Flags      map[string]string // key -> value from the command line
+}
+
+var (
+	envOnce     sync.Once
+	envSnapshot map[string]string
+)
+
+// processEnv returns the environment as it was the first time it was asked
+// for. Settings exported by ApplyEnv must not be mistaken for user-provided
+// environment variables on the next resolution.
+func processEnv() map[string]string {
+	envOnce.Do(func() {
+		envSnapshot = make(map[string]string)
+		for _, kv := range os.Environ() {
+			if k, v, ok := strings.Cut(kv, "="); ok {
+				envSnapshot[k] = v
+			}
+		}
+	})
+	return envSnapshot
+}
+
+// NewLoader returns a loader for repoRoot with the standard file locations.
+func NewLoader(repoRoot string, flags map[string]string) (*Loader, error) {
+	userPath, err := UserConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	return &Loader{
+		UserPath:   userPath,
+		LegacyPath: legacyConfigPath(),
+		RepoRoot:   repoRoot,
+		Env:        processEnv(),
+		Flags:      flags,
+	}, nil
+}
+
+// WithRepo returns a copy of l that resolves the project layer of repoRoot.
+func (l *Loader) WithRepo(repoRoot string) *Loader {
+	cp := *l
+	cp.RepoRoot = repoRoot
+	return &cp
+}
+
+// ProjectPath returns the project config file, or "" without a repository.
+func (l *Loader) ProjectPath() string {
+	if l.RepoRoot == "" {
+		return ""
+	}
+	return filepath.Join(l.RepoRoot, ".dodo", "config.json")
+}
+
+// userReadPath returns the user file to read, falling back to the legacy one.
+func (l *Loader) userReadPath() string {
+	if _, err := os.Stat(l.UserPath); err != nil && l.LegacyPath != "" {
+		if _, lerr := os.Stat(l.LegacyPath); lerr == nil {
+			return l.LegacyPath
+		}
+	}
+	return l.UserPath
+}
+
+// Layer returns the values a single scope defines, without resolving the
+// other layers. Environment variables are looked up for the provider the
+// full resolution selects. Config files are migrated and validated first;
+// the layer is returned along with any problems found unless the file
+// couldn't be read.
+func (l *Loader) Layer(scope Scope) (map[string]Value, error) {
+	switch scope {
+	case ScopeDefault:
+		out := make(map[string]Value)
+		for _, k := range Keys {
+			if k.Default != "" {
+				out[k.Name] = Value{Key: k.Name, Value: k.Default, Scope: ScopeDefault, Origin: "built-in"}
+			}
+		}
+		return out, nil
+	case ScopeUser, ScopeProject:
+		raw, path, err := l.readFile(scope)
+		if raw == nil {
+			return nil, err
+		}
+		return layerFromRaw(raw, path, scope), err
+	case ScopeEnv:
+		s, err := l.Load()
+		return l.envLayer(s.Provider()), err
+	case ScopeFlag:
+		out := make(map[string]Value)
+		for name, v := range l.Flags {
+			out[name] = Value{Key: name, Value: v, Scope: ScopeFlag, Origin: "command line"}
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unknown scope %q", scope)
+	}
+}
+
+func (l *Loader) envLayer(provider string) map[string]Value {
+	out := make(map[string]Value)
+	for _, k := range Keys {
+		name := k.EnvVar(provider)
+		if name == "" {
+			continue
+		}
+		if v := l.Env[name]; v != "" {
+			out[k.Name] = Value{Key: k.Name, Value: v, Scope: ScopeEnv, Origin: name}
+		}
+	}
+	return out
+}
+
+// sandboxIsolation orders the sandbox modes from least to most isolated.
+var sandboxIsolation = map[string]int{"host": 0, "auto": 1, "docker": 2}
+
+// Load resolves every setting. Values that fail validation are skipped and
+// reported in the returned error; the Settings are usable either way.
+//
+// Selecting a profile counts as setting the profile's values in the scope
+// that selected it: they override that scope and the ones below, and are
+// overridden by the ones above.
+func (l *Loader) Load() (*Settings, error) {
+	var errs []error
+	var layers []map[string]Value
+	for _, scope := range []Scope{ScopeDefault, ScopeUser, ScopeProject} {
+		layer, err := l.Layer(scope)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if layer == nil {
+			layer = map[string]Value{}
+		}
+		layers = append(layers, layer)
+	}
+	flags, _ := l.Layer(ScopeFlag)
+
+	// A cloned repository controls the project file, so it mustn't pick
+	// where keys come from or where they are sent. ValidateFile reports
+	// what is dropped here.
+	for name := range layers[2] {
+		if k, ok := LookupKey(name); ok && (k.Secret || k.UserOnly) {
+			delete(layers[2], name)
+		}
+	}
+	// Nor may it take commands out of the sandbox.
+	if v, ok := layers[2]["sandbox_mode"]; ok {
+		below := lastValue(layers[:2], "sandbox_mode")
+		if rank, known := sandboxIsolation[v.Value]; known && rank < sandboxIsolation[below.Value] {
+			errs = append(errs, fmt.Errorf("%s: sandbox_mode %q is less isolated than %q from %s; the project file may only tighten it",
+				v.Origin, v.Value, below.Value, below.Origin))
+			delete(layers[2], "sandbox_mode")
+		}
+	}
+
+	profile := lastValue(append(layers, l.envLayer(""), flags), "profile")
+	var profileLayer map[string]Value
+	if profile.Value != "" {
+		p, err := l.Profile(profile.Value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", profile.Origin, err))
+		} else {
+			profileLayer = make(map[string]Value)
+			for name, v := range p.settings() {
+				profileLayer[name] = Value{Key: name, Value: v, Scope: profile.Scope, Origin: "profile " + profile.Value}
+			}
+			// A stored api_key still applies when the profile keeps the
+			// provider it belongs to.
+			if p.KeyRef == "" && lastValue(layers, "llm_provider").Value == p.Provider {
+				delete(profileLayer, "api_key_ref")
+			}
+		}
+	}
+
+	// The provider decides which environment variables apply to the
+	// provider-specific keys, so it is resolved first.
+	provider := "openai"
+	if v := lastValue(withProfile(append(layers, l.envLayer(""), flags), profile.Scope, profileLayer), "llm_provider"); v.Value != "" {
+		provider = v.Value
+	}
+	layers = withProfile(append(layers, l.envLayer(provider), flags), profile.Scope, profileLayer)
+	for _, layer := range layers {
+		errs = append(errs, l.resolveKeyRefs(layer)...)
+	}
+
+	s := &Settings{values: make(map[string]Value), env: l.Env}
+	for _, layer := range layers {
+		for name, v := range layer {
+			k, ok := LookupKey(name)
+			if !ok {
+				// Files may carry settings owned by other packages
+				// (e.g. indexing_enabled); flags may not.
+				if v.Scope == ScopeFlag {
+					errs = append(errs, fmt.Errorf("%s: unknown setting %q", v.Origin, name))
+				}
+				continue
+			}
+			if v.Value == "" {
+				// A profile clearing a value of another provider, or a
+				// key reference to an unset environment variable.
+				delete(s.values, name)
+				continue
+			}
+			if err := k.Validate(v.Value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", v.Origin, err))
+				continue
+			}
+			s.values[name] = v
+		}
+	}
+	return s, errors.Join(errs...)
+}
+
+// resolveKeyRefs adds the secret each key reference in layer points to, in
+// the reference's scope. Plain secrets from older config files stay as they
+// are unless a reference in the same layer replaces them.
+func (l *Loader) resolveKeyRefs(layer map[string]Value) []error {
+	var errs []error
+	for _, k := range Keys {
+		ref, ok := layer[k.Ref]
+		if k.Ref == "" || !ok || ref.Value == "" {
+			continue
+		}
+		secret, err := l.ResolveKeyRef(ref.Value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: %w", ref.Origin, k.Ref, err))
+			continue
+		}
+		layer[k.Name] = Value{Key: k.Name, Value: secret, Scope: ref.Scope, Origin: ref.Origin + " (" + ref.Value + ")"}
+	}
+	return errs
+}
+
+// lastValue returns the highest-precedence value of key in layers.
+func lastValue(layers []map[string]Value, key string) Value {
+	var out Value
+	for _, layer := range layers {
+		if v, ok := layer[key]; ok && v.Value != "" {
+			out = v
+		}
+	}
+	return out
+}
+
+// withProfile inserts the profile layer after the last layer of scope.
+func withProfile(layers []map[string]Value, scope Scope, profile map[string]Value) []map[string]Value {
+	if profile == nil {
+		return layers
+	}
+	at := 0
+	for i, layer := range layers {
+		for _, v := range layer {
+			if v.Scope == scope {
+				at = i + 1
+			}
+			break
+		}
+	}
+	out := make([]map[string]Value, 0, len(layers)+1)
+	out = append(out, layers[:at]...)
+	out = append(out, profile)
+	return append(out, layers[at:]...)
+}
+
+// layerFromRaw returns the scalar settings of a config file.
+func layerFromRaw(raw map[string]json.RawMessage, path string, scope Scope) map[string]Value {
+	out := make(map[string]Value, len(raw))
+	for name, msg := range raw {
+		if name == "version" {
+			continue
+		}
+		var v any
+		if err := json.Unmarshal(msg, &v); err != nil {
+			continue
+		}
+		var str string
+		switch tv := v.(type) {
+		case string:
+			str = tv
+		case bool:
+			str = strconv.FormatBool(tv)
+		case float64:
+			str = strconv.FormatFloat(tv, 'f', -1, 64)
+		default:
+			// null, objects and arrays are not plain settings
+			continue
+		}
+		if str == "" {
+			continue
+		}
+		out[name] = Value{Key: name, Value: str, Scope: scope, Origin: path}
+	}
+	return out
+}
+
+func readRawFile(path string) (map[string]json.RawMessage, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return map[string]json.RawMessage{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return parseRawFile(path, data)
+}
+
+func parseRawFile(path string, data []byte) (map[string]json.RawMessage, error) {
+	raw := make(map[string]json.RawMessage)
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return raw, nil
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return raw, nil
+}
+
+// writeRawFile replaces path atomically.
+func writeRawFile(path string, raw map[string]json.RawMessage, perm os.FileMode) error {
+	data, err := json.MarshalIndent(raw, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	return writeFileAtomic(path, append(data, '\n'), perm)
+}
+
+// writeFileAtomic writes data to a temp file next to path and renames it
+// into place, creating the directory if needed.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create config dir: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// writablePath returns the file backing scope and its permissions.
+func (l *Loader) writablePath(scope Scope) (string, os.FileMode, error) {
+	switch scope {
+	case ScopeUser:
+		return l.UserPath, 0600, nil
+	case ScopeProject:
+		if l.RepoRoot == "" {
+			return "", 0, errors.New("project scope requires a repository")
+		}
+		return l.ProjectPath(), 0644, nil
+	default:
+		return "", 0, fmt.Errorf("scope %q is read-only (writable: user, project)", scope)
+	}
+}
+
+// Set stores key=value in the file behind scope, keeping every other entry.
+func (l *Loader) Set(scope Scope, key, value string) error {
+	k, ok := LookupKey(key)
+	if !ok {
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	if err := k.Validate(value); err != nil {
+		return err
+	}
+	if k.Secret && scope == ScopeProject {
+		return fmt.Errorf("%s is a secret and cannot be stored in project scope", key)
+	}
+	if k.UserOnly && scope == ScopeProject {
+		return fmt.Errorf("%s can only be set in user scope", key)
+	}
+	if key == "sandbox_mode" && value == "host" && scope == ScopeProject {
+		return errors.New("the project file may only tighten sandbox_mode, not set it to host")
+	}
+
+	path, perm, err := l.writablePath(scope)
+	if err != nil {
+		return err
+	}
+	raw, err := l.rawForWrite(scope, path)
+	if err != nil {
+		return err
+	}
+	if k.Secret {
+		// The file only gets a reference to the stored key.
+		name := credentialName(k, raw)
+		store, err := l.Credentials()
+		if err != nil {
+			return err
+		}
+		if err := store.Set(name, value); err != nil {
+			return err
+		}
+		delete(raw, k.Name)
+		key, value = k.Ref, StoreRef(name)
+		k, _ = LookupKey(key)
+	}
+
+	var typed any = value
+	switch k.Kind {
+	case KindBool:
+		typed, _ = strconv.ParseBool(value)
+	case KindInt:
+		typed, _ = strconv.Atoi(value)
+	case KindFloat:
+		typed, _ = strconv.ParseFloat(value, 64)
+	}
+	encoded, err := json.Marshal(typed)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+	raw[key] = encoded
+	return writeRawFile(path, raw, perm)
+}
+
+// Unset removes key from the file behind scope.
+func (l *Loader) Unset(scope Scope, key string) error {
+	if _, ok := LookupKey(key); !ok {
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	path, perm, err := l.writablePath(scope)
+	if err != nil {
+		return err
+	}
+	raw, err := l.rawForWrite(scope, path)
+	if err != nil {
+		return err
+	}
+	k, _ := LookupKey(key)
+	_, hasRef := raw[k.Ref]
+	if _, ok := raw[key]; !ok && !(k.Secret && hasRef) {
+		return nil
+	}
+	delete(raw, key)
+	if k.Secret {
+		// The stored key is left in place; profiles may refer to it.
+		delete(raw, k.Ref)
+	}
+	return writeRawFile(path, raw, perm)
+}
+
+// rawForWrite loads the current file contents, migrated to SchemaVersion.
+// The first write to the user scope starts from the legacy file so nothing
+// is lost in the move.
+func (l *Loader) rawForWrite(scope Scope, path string) (map[string]json.RawMessage, error) {
+	raw, _, err := l.readFile(scope)
+	if raw == nil {
+		return nil, err
+	}
+	// Validation problems are reported on load; they mustn't block the
+	// write that fixes them. Migration failures must.
+	if _, err := splitFileErrors(err); err != nil {
+		return nil, err
+	}
+	if scope == ScopeUser {
+		if err := l.moveSecretsToStore(raw); err != nil {
+			return nil, err
+		}
+		// The env backend keeps no keys on disk: plain-text keys the
+		// move had to leave behind are dropped and must come from the
+		// environment.
+		for _, k := range Keys {
+			if k.Secret {
+				delete(raw, k.Name)
+			}
+		}
+	}
+	raw["version"] = json.RawMessage(strconv.Itoa(SchemaVersion))
+	return raw, nil
+}
+
+// unwrapJoined returns the errors joined in err.
+func unwrapJoined(err error) []error {
+	if err == nil {
+		return nil
+	}
+	if j, ok := err.(interface{ Unwrap() []error }); ok {
+		return j.Unwrap()
+	}
+	return []error{err}
+}
+
+// moveSecretsToStore replaces plain-text secrets in raw with references to
+// the credential store. With the read-only env backend they stay put;
+// rawForWrite drops them.
+func (l *Loader) moveSecretsToStore(raw map[string]json.RawMessage) error {
+	for _, k := range Keys {
+		msg, ok := raw[k.Name]
+		if !k.Secret || !ok {
+			continue
+		}
+		var secret string
+		if err := json.Unmarshal(msg, &secret); err != nil || secret == "" {
+			delete(raw, k.Name)
+			continue
+		}
+		store, err := l.Credentials()
+		if err != nil {
+			return err
+		}
+		name := credentialName(k, raw)
+		if err := store.Set(name, secret); errors.Is(err, ErrReadOnlyStore) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to move %s to the credential store: %w", k.Name, err)
+		}
+		ref, _ := json.Marshal(StoreRef(name))
+		raw[k.Ref] = ref
+		delete(raw, k.Name)
+	}
+	return nil
+}
+
+// credentialName returns the store entry for secret k: the provider the
+// file selects for api_key, the setting name otherwise.
+func credentialName(k Key, raw map[string]json.RawMessage) string {
+	if k.Name != "api_key" {
+		return k.Name
+	}
+	provider := "openai"
+	var p string
+	if err := json.Unmarshal(raw["llm_provider"], &p); err == nil && p != "" {
+		provider = p
+	}
+	return provider
+}
+
+// Settings is a resolved configuration.
+type Settings struct {
+	values map[string]Value
+	env    map[string]string
+}
+
+// Get returns a setting with its provenance. The zero Value means unset.
+func (s *Settings) Get(key string) Value {
+	return s.values[key]
+}
+
+// String returns a setting as a string.
+func (s *Settings) String(key string) string {
+	return s.values[key].Value
+}
+
+// Bool returns a boolean setting; unset is false.
+func (s *Settings) Bool(key string) bool {
+	b, _ := strconv.ParseBool(s.values[key].Value)
+	return b
+}
+
+// Int returns an integer setting; unset is 0.
+func (s *Settings) Int(key string) int {
+	n, _ := strconv.Atoi(s.values[key].Value)
+	return n
+}
+
+// Float returns a float setting; unset is 0.
+func (s *Settings) Float(key string) float64 {
+	f, _ := strconv.ParseFloat(s.values[key].Value, 64)
+	return f
+}
+
+// Duration returns a duration setting; unset is 0.
+func (s *Settings) Duration(key string) time.Duration {
+	d, _ := time.ParseDuration(s.values[key].Value)
+	return d
+}
+
+// Profile returns the selected profile name, if any.
+func (s *Settings) Profile() string { return s.String("profile") }
+
+// Provider returns the active LLM provider.
+func (s *Settings) Provider() string {
+	if p := s.String("llm_provider"); p != "" {
+		return p
+	}
+	return "openai"
+}
+
+// Model returns the configured model, or "" for the provider default.
+func (s *Settings) Model() string { return s.String("model") }
+
+// APIKey returns the key for the active provider.
+func (s *Settings) APIKey() string { return s.String("api_key") }
+
+// BaseURL returns the API base URL override for the active provider.
+func (s *Settings) BaseURL() string { return s.String("base_url") }
+
+// EmbeddingKey returns the separate embeddings key, if any.
+func (s *Settings) EmbeddingKey() string { return s.String("embedding_key") }
+
+// AutoIndex reports whether new projects are indexed without asking.
+func (s *Settings) AutoIndex() bool { return s.Bool("auto_index") }
+
+// MaxSteps returns the per-request step cap, or 0 for the engine default.
+func (s *Settings) MaxSteps() int { return s.Int("max_steps") }
+
+// SandboxMode returns auto, docker or host.
+func (s *Settings) SandboxMode() string { return s.String("sandbox_mode") }
+
+// All returns every set value in Keys order.
+func (s *Settings) All() []Value {
+	out := make([]Value, 0, len(s.values))
+	for _, k := range Keys {
+		if v, ok := s.values[k.Name]; ok {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+var (
+	exportMu sync.Mutex
+	exported = make(map[string]bool)
+)
+
+// ApplyEnv exports file- and flag-provided settings as the environment
+// variables the rest of dodo reads (LLM_PROVIDER, OPENAI_MODEL, ...).
+// Variables exported by a previous call that are no longer configured are
+// restored to their original value.
+func (s *Settings) ApplyEnv() {
+	provider := s.Provider()
+	want := make(map[string]string)
+	for _, k := range Keys {
+		name := k.EnvVar(provider)
+		if name == "" {
+			continue
+		}
+		v, ok := s.values[k.Name]
+		if !ok || v.Scope == ScopeEnv || v.Scope == ScopeDefault {
+			continue
+		}
+		want[name] = v.Value
+	}
+
+	exportMu.Lock()
+	defer exportMu.Unlock()
+
+	stale := make([]string, 0, len(exported))
+	for name := range exported {
+		if _, ok := want[name]; !ok {
+			stale = append(stale, name)
+		}
+	}
+	sort.Strings(stale)
+	for _, name := range stale {
+		if orig, ok := s.env[name]; ok {
+			os.Setenv(name, orig)
+		} else {
+			os.Unsetenv(name)
+		}
+		delete(exported, name)
+	}
+	for name, v := range want {
+		os.Setenv(name, v)
+		exported[name] = true
+	}
+}
@@ -2,90 +2,228 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 )
 
 // Config holds the user's persistent configuration preferences.
 type Config struct {
-	LLMProvider  string `json:"llm_provider,omitempty"`  // openai, anthropic, kimi, etc.
-	APIKey       string `json:"api_key,omitempty"`       // The API key for the selected provider
-	Model        string `json:"model,omitempty"`         // Default model name
-	AutoIndex    bool   `json:"auto_index"`              // Whether to auto-index new projects
-	BaseURL      string `json:"base_url,omitempty"`      // Optional override for API base URL
-	EmbeddingKey string `json:"embedding_key,omitempty"` // Optional separate key for embeddings
+	Version int `json:"version,omitempty"` // file format, see SchemaVersion
+
+	LLMProvider string `json:"llm_provider,omitempty"` // openai, anthropic, kimi, etc.
+	Model       string `json:"model,omitempty"`        // Default model name
+	AutoIndex   bool   `json:"auto_index"`             // Whether to auto-index new projects
+	BaseURL     string `json:"base_url,omitempty"`     // Optional override for API base URL
+
+	// Where the keys are kept (env:VAR or store:NAME)
+	APIKeyRef       string `json:"api_key_ref,omitempty"`
+	EmbeddingKeyRef string `json:"embedding_key_ref,omitempty"`
+
+	// The keys themselves, resolved on Load and moved to the credential
+	// store on Save; never written to the file
+	APIKey       string `json:"-"`
+	EmbeddingKey string `json:"-"`
+
+	// Client-side rate limits for the selected provider (0 = learn from response headers)
+	RequestsPerMinute int `json:"requests_per_minute,omitempty"`
+	TokensPerMinute   int `json:"tokens_per_minute,omitempty"`
+
+	// Named provider setups and the one new sessions start with
+	Profiles map[string]Profile `json:"profiles,omitempty"`
+	Profile  string             `json:"profile,omitempty"`
 }
 
-// Manager handles loading and saving the configuration.
+// Manager handles loading and saving the user-level configuration file.
 type Manager struct {
-	configDir string
+	path       string
+	legacyPath string
+	loader     *Loader // user layer only; resolves key references
 }
 
-// NewManager creates a new configuration manager.
-func NewManager() (*Manager, error) {
+// UserConfigPath returns ~/.dodo/config.json.
+func UserConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home dir: %w", err)
+	}
+	return filepath.Join(home, ".dodo", "config.json"), nil
+}
+
+// legacyConfigPath returns the pre-layering location under the OS config dir,
+// which is still read until the first save moves it to ~/.dodo.
+func legacyConfigPath() string {
 	configDir, err := os.UserConfigDir()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user config dir: %w", err)
+		return ""
 	}
+	return filepath.Join(configDir, "dodo", "config.json")
+}
 
-	dodoConfigDir := filepath.Join(configDir, "dodo")
+// NewManager creates a new configuration manager.
+func NewManager() (*Manager, error) {
+	path, err := UserConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	legacyPath := legacyConfigPath()
 	return &Manager{
-		configDir: dodoConfigDir,
+		path:       path,
+		legacyPath: legacyPath,
+		loader:     &Loader{UserPath: path, LegacyPath: legacyPath, Env: processEnv()},
 	}, nil
 }
 
 // GetConfigPath returns the absolute path to the config.json file.
 func (m *Manager) GetConfigPath() string {
-	return filepath.Join(m.configDir, "config.json")
+	return m.path
+}
+
+// readPath returns the file to read, falling back to the legacy location.
+func (m *Manager) readPath() string {
+	if _, err := os.Stat(m.path); os.IsNotExist(err) && m.legacyPath != "" {
+		if _, err := os.Stat(m.legacyPath); err == nil {
+			return m.legacyPath
+		}
+	}
+	return m.path
 }
 
 // Load reads the configuration from disk.
 // If the file does not exist, it returns an empty Config and no error.
 func (m *Manager) Load() (*Config, error) {
-	path := m.GetConfigPath()
-
-	// Check if file exists
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return &Config{}, nil
+	// Older files are migrated first; validation problems are reported
+	// alongside the config rather than failing the load.
+	raw, _, err := m.loader.readFile(ScopeUser)
+	if raw == nil {
+		return nil, err
 	}
+	errs := unwrapJoined(err)
 
-	data, err := os.ReadFile(path)
+	data, err := json.Marshal(raw)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, fmt.Errorf("failed to read config: %w", err)
 	}
-
 	var cfg Config
 	if err := json.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse config json: %w", err)
+		errs = append(errs, fmt.Errorf("failed to parse config json: %w", err))
 	}
 
-	return &cfg, nil
+	// With the env credential backend, keys from before the credential
+	// store stay in the file in place of the references until the next
+	// write drops them.
+	var legacy struct {
+		APIKey       string `json:"api_key"`
+		EmbeddingKey string `json:"embedding_key"`
+	}
+	_ = json.Unmarshal(data, &legacy)
+	cfg.APIKey, errs = m.resolveKey(cfg.APIKeyRef, legacy.APIKey, errs)
+	cfg.EmbeddingKey, errs = m.resolveKey(cfg.EmbeddingKeyRef, legacy.EmbeddingKey, errs)
+
+	return &cfg, errors.Join(errs...)
+}
+
+func (m *Manager) resolveKey(ref, legacy string, errs []error) (string, []error) {
+	if ref == "" {
+		return legacy, errs
+	}
+	key, err := m.loader.ResolveKeyRef(ref)
+	if err != nil {
+		return "", append(errs, fmt.Errorf("failed to resolve %s: %w", ref, err))
+	}
+	return key, errs
 }
 
 // Save writes the configuration to disk with restricted permissions (0600).
+// Settings not covered by Config (e.g. ones written by `dodo config set`) are
+// preserved. Keys that differ from what their reference resolves to are
+// written to the credential store and referenced from the file.
 func (m *Manager) Save(cfg *Config) error {
-	// Ensure directory exists
-	if err := os.MkdirAll(m.configDir, 0755); err != nil {
-		return fmt.Errorf("failed to create config dir: %w", err)
+	raw, err := m.loader.rawForWrite(ScopeUser, m.path)
+	if err != nil {
+		return err
+	}
+
+	cp := *cfg
+	cp.Version = SchemaVersion
+	if cp.APIKeyRef, err = m.storeKey(cp.APIKeyRef, cp.APIKey, firstNonEmpty(cp.LLMProvider, "openai")); err != nil {
+		return err
+	}
+	if cp.EmbeddingKeyRef, err = m.storeKey(cp.EmbeddingKeyRef, cp.EmbeddingKey, "embedding_key"); err != nil {
+		return err
 	}
+	cfg = &cp
 
-	data, err := json.MarshalIndent(cfg, "", "  ")
+	data, err := json.Marshal(cfg)
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	// Config fields are authoritative: drop the ones left empty so that
+	// clearing a value in the setup wizard clears it on disk.
+	for _, name := range configFieldNames() {
+		delete(raw, name)
+	}
+	for name, v := range fields {
+		raw[name] = v
+	}
 
-	path := m.GetConfigPath()
 	// Write with 0600 permissions (read/write only by owner)
-	if err := os.WriteFile(path, data, 0600); err != nil {
-		return fmt.Errorf("failed to write config file: %w", err)
+	return writeRawFile(m.path, raw, 0600)
+}
+
+// storeKey returns the reference to save for key. An unchanged key keeps its
+// reference and an empty one drops it.
+func (m *Manager) storeKey(ref, key, name string) (string, error) {
+	if key == "" {
+		return "", nil
+	}
+	if ref != "" {
+		if current, err := m.loader.ResolveKeyRef(ref); err == nil && current == key {
+			return ref, nil
+		}
+	}
+	store, err := m.loader.Credentials()
+	if err != nil {
+		return "", err
 	}
+	if err := store.Set(name, key); err != nil {
+		return "", err
+	}
+	return StoreRef(name), nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
 
-	return nil
+// configFieldNames returns the JSON names of Config's fields.
+func configFieldNames() []string {
+	t := reflect.TypeOf(Config{})
+	names := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
 }
 
 // Exists checks if the configuration file has been created.
 func (m *Manager) Exists() bool {
-	_, err := os.Stat(m.GetConfigPath())
+	_, err := os.Stat(m.readPath())
 	return !os.IsNotExist(err)
 }
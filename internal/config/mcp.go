@@ -0,0 +1,253 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MCPServer is a Model Context Protocol server whose tools sessions may
+// call. Servers live under "mcp_servers" in the user or project config
+// file, keyed by a name that prefixes their tools. A server is either a
+// command speaking the protocol on stdin/stdout or an HTTP endpoint.
+//
+// A cloned repository controls its project file, so the servers declared
+// there would choose the commands run on the host and where tokens are
+// sent. They are only used once the user trusts them for that repository
+// (see TrustProjectMCPServers).
+type MCPServer struct {
+	Command  string            `json:"command,omitempty"`
+	Args     []string          `json:"args,omitempty"`
+	Env      map[string]string `json:"env,omitempty"` // added to the command's environment; ${VAR} is expanded
+	URL      string            `json:"url,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"` // sent with every HTTP request; ${VAR} is expanded
+	Timeout  string            `json:"timeout,omitempty"` // per request; default DefaultMCPTimeout
+	Disabled bool              `json:"disabled,omitempty"`
+}
+
+// DefaultMCPTimeout bounds each request to an MCP server that sets no
+// timeout of its own.
+const DefaultMCPTimeout = 30 * time.Second
+
+var mcpServerNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// Validate checks that s is usable.
+func (s MCPServer) Validate() error {
+	switch {
+	case s.Command == "" && s.URL == "":
+		return errors.New("command or url is required")
+	case s.Command != "" && s.URL != "":
+		return errors.New("command and url are mutually exclusive")
+	}
+	if s.URL != "" {
+		u, err := url.Parse(s.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("url must be an http(s) URL, got %q", s.URL)
+		}
+	}
+	if s.Timeout != "" {
+		if d, err := time.ParseDuration(s.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("timeout must be a positive duration, got %q", s.Timeout)
+		}
+	}
+	return nil
+}
+
+// RequestTimeout returns how long a request to s may take.
+func (s MCPServer) RequestTimeout() time.Duration {
+	if d, err := time.ParseDuration(s.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return DefaultMCPTimeout
+}
+
+// MCPServersIn returns the MCP servers declared in the file behind scope.
+func (l *Loader) MCPServersIn(scope Scope) (map[string]MCPServer, error) {
+	if scope != ScopeUser && scope != ScopeProject {
+		return map[string]MCPServer{}, nil
+	}
+	raw, path, err := l.readFile(scope)
+	if raw == nil {
+		return nil, err
+	}
+	servers := make(map[string]MCPServer)
+	if msg, ok := raw["mcp_servers"]; ok {
+		if err := json.Unmarshal(msg, &servers); err != nil {
+			return nil, fmt.Errorf("%s: mcp_servers: %w", path, err)
+		}
+	}
+	return servers, nil
+}
+
+// MCPServers returns the enabled MCP servers, with ${VAR} references in
+// their env and headers expanded. The project file's servers are included
+// only if the user trusts them, and then replace user servers of the same
+// name. Invalid or untrusted servers are left out and reported in the
+// error.
+func (l *Loader) MCPServers() (map[string]MCPServer, error) {
+	merged, err := l.MCPServersIn(ScopeUser)
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	project, err := l.MCPServersIn(ScopeProject)
+	if err != nil {
+		return nil, err
+	}
+	if len(project) > 0 {
+		trusted, err := l.ProjectMCPServersTrusted()
+		switch {
+		case err != nil:
+			errs = append(errs, err)
+		case !trusted:
+			names := make([]string, 0, len(project))
+			for name := range project {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			errs = append(errs, fmt.Errorf("%s declares MCP servers that aren't trusted (%s); run `dodo config mcp trust` in the repository to use them",
+				l.ProjectPath(), strings.Join(names, ", ")))
+		default:
+			for name, s := range project {
+				merged[name] = s
+			}
+		}
+	}
+
+	out := make(map[string]MCPServer, len(merged))
+	for name, s := range merged {
+		if s.Disabled {
+			continue
+		}
+		if !mcpServerNamePattern.MatchString(name) {
+			errs = append(errs, fmt.Errorf("invalid MCP server name %q", name))
+			continue
+		}
+		if err := s.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("MCP server %q: %w", name, err))
+			continue
+		}
+		s.Env = l.expandAll(s.Env)
+		s.Headers = l.expandAll(s.Headers)
+		out[name] = s
+	}
+	return out, errors.Join(errs...)
+}
+
+// mcpDigest identifies a declaration of servers, so that trust in it lapses
+// when the repository changes it.
+func mcpDigest(servers map[string]MCPServer) string {
+	encoded, _ := json.Marshal(servers) // map keys are sorted
+	sum := sha256.Sum256(encoded)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// trustedRepos returns the user file's "trusted_repos": the digest of the
+// project servers the user trusted, by repository root.
+func (l *Loader) trustedRepos(raw map[string]json.RawMessage) (map[string]string, error) {
+	trusted := make(map[string]string)
+	if msg, ok := raw["trusted_repos"]; ok {
+		if err := json.Unmarshal(msg, &trusted); err != nil {
+			return nil, fmt.Errorf("%s: trusted_repos: %w", l.userReadPath(), err)
+		}
+	}
+	return trusted, nil
+}
+
+// ProjectMCPServersTrusted reports whether the user trusts the MCP servers
+// the project file declares, as they are declared now.
+func (l *Loader) ProjectMCPServersTrusted() (bool, error) {
+	if l.RepoRoot == "" {
+		return false, nil
+	}
+	raw, _, err := l.readFile(ScopeUser)
+	if raw == nil {
+		return false, err
+	}
+	trusted, err := l.trustedRepos(raw)
+	if err != nil {
+		return false, err
+	}
+	project, err := l.MCPServersIn(ScopeProject)
+	if err != nil {
+		return false, err
+	}
+	digest, ok := trusted[filepath.Clean(l.RepoRoot)]
+	return ok && digest == mcpDigest(project), nil
+}
+
+// TrustProjectMCPServers records in the user file that the MCP servers the
+// project file declares may run, and returns them. A later change to the
+// declaration has to be trusted again.
+func (l *Loader) TrustProjectMCPServers() (map[string]MCPServer, error) {
+	if l.RepoRoot == "" {
+		return nil, errors.New("trusting MCP servers requires a repository")
+	}
+	project, err := l.MCPServersIn(ScopeProject)
+	if err != nil {
+		return nil, err
+	}
+	if len(project) == 0 {
+		return nil, fmt.Errorf("%s declares no MCP servers", l.ProjectPath())
+	}
+	return project, l.updateTrustedRepos(func(trusted map[string]string) {
+		trusted[filepath.Clean(l.RepoRoot)] = mcpDigest(project)
+	})
+}
+
+// UntrustProjectMCPServers withdraws the trust TrustProjectMCPServers gave.
+func (l *Loader) UntrustProjectMCPServers() error {
+	if l.RepoRoot == "" {
+		return errors.New("untrusting MCP servers requires a repository")
+	}
+	return l.updateTrustedRepos(func(trusted map[string]string) {
+		delete(trusted, filepath.Clean(l.RepoRoot))
+	})
+}
+
+func (l *Loader) updateTrustedRepos(update func(map[string]string)) error {
+	path, perm, err := l.writablePath(ScopeUser)
+	if err != nil {
+		return err
+	}
+	raw, err := l.rawForWrite(ScopeUser, path)
+	if err != nil {
+		return err
+	}
+	trusted, err := l.trustedRepos(raw)
+	if err != nil {
+		return err
+	}
+	update(trusted)
+
+	if len(trusted) == 0 {
+		delete(raw, "trusted_repos")
+	} else {
+		encoded, err := json.Marshal(trusted)
+		if err != nil {
+			return fmt.Errorf("failed to encode trusted_repos: %w", err)
+		}
+		raw["trusted_repos"] = encoded
+	}
+	return writeRawFile(path, raw, perm)
+}
+
+func (l *Loader) expandAll(values map[string]string) map[string]string {
+	if len(values) == 0 {
+		return values
+	}
+	out := make(map[string]string, len(values))
+	for k, v := range values {
+		out[k] = os.Expand(v, func(name string) string { return l.Env[name] })
+	}
+	return out
+}
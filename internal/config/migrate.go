@@ -0,0 +1,199 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// migration upgrades a config file to version. Steps run in order, each on
+// the result of the previous one.
+type migration struct {
+	version     int
+	description string
+	apply       func(l *Loader, kind FileKind, raw map[string]json.RawMessage) error
+}
+
+// migrations lists the upgrade steps in version order. It is a function
+// only because the steps refer back to the Loader.
+func migrations() []migration {
+	return []migration{{
+		version:     1,
+		description: "type quoted numbers and booleans; move plain-text keys to the credential store",
+		apply: func(l *Loader, kind FileKind, raw map[string]json.RawMessage) error {
+			coerceScalars(raw)
+			if kind == FileUser {
+				return l.moveSecretsToStore(raw)
+			}
+			return nil
+		},
+	}}
+}
+
+// fileVersion returns the schema version recorded in raw; 0 when absent.
+func fileVersion(raw map[string]json.RawMessage) (int, error) {
+	msg, ok := raw["version"]
+	if !ok {
+		return 0, nil
+	}
+	var v int
+	if err := json.Unmarshal(msg, &v); err != nil || v < 0 {
+		return 0, fmt.Errorf("version: expected a non-negative integer, got %s", msg)
+	}
+	return v, nil
+}
+
+// migrate upgrades raw to SchemaVersion and reports whether it changed.
+// Files from a newer build are left alone; ValidateFile reports them.
+func (l *Loader) migrate(kind FileKind, raw map[string]json.RawMessage) (bool, error) {
+	from, err := fileVersion(raw)
+	if err != nil || from >= SchemaVersion {
+		return false, err
+	}
+	for _, m := range migrations() {
+		if m.version <= from {
+			continue
+		}
+		if err := m.apply(l, kind, raw); err != nil {
+			return false, fmt.Errorf("migrating to version %d (%s): %w", m.version, m.description, err)
+		}
+	}
+	raw["version"] = json.RawMessage(strconv.Itoa(SchemaVersion))
+	return true, nil
+}
+
+// coerceScalars turns quoted values of typed settings into JSON numbers and
+// booleans. Values that don't parse are left for validation to report.
+func coerceScalars(raw map[string]json.RawMessage) {
+	for name, msg := range raw {
+		k, ok := LookupKey(name)
+		if !ok || (k.Kind != KindBool && k.Kind != KindInt && k.Kind != KindFloat) {
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(msg, &s); err != nil {
+			continue
+		}
+		var typed any
+		var err error
+		switch k.Kind {
+		case KindBool:
+			typed, err = strconv.ParseBool(s)
+		case KindInt:
+			typed, err = strconv.Atoi(s)
+		case KindFloat:
+			typed, err = strconv.ParseFloat(s, 64)
+		}
+		if err != nil {
+			continue
+		}
+		if encoded, err := json.Marshal(typed); err == nil {
+			raw[name] = encoded
+		}
+	}
+}
+
+// readFile reads the config file behind scope, migrating it in place when it
+// predates SchemaVersion. The original is kept as <file>.v<N>.bak. The
+// legacy user file is only migrated in memory; the next write moves it.
+//
+// The returned error joins read, migration and validation problems; raw is
+// nil only when the file couldn't be read at all.
+func (l *Loader) readFile(scope Scope) (map[string]json.RawMessage, string, error) {
+	var path string
+	var kind FileKind
+	switch scope {
+	case ScopeUser:
+		path, kind = l.userReadPath(), FileUser
+	case ScopeProject:
+		if l.RepoRoot == "" {
+			return map[string]json.RawMessage{}, "", nil
+		}
+		path, kind = l.ProjectPath(), FileProject
+	default:
+		return nil, "", fmt.Errorf("scope %q has no config file", scope)
+	}
+
+	original, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return map[string]json.RawMessage{}, path, nil
+	}
+	if err != nil {
+		return nil, path, fmt.Errorf("failed to read config file: %w", err)
+	}
+	raw, err := parseRawFile(path, original)
+	if err != nil || len(raw) == 0 {
+		return raw, path, err
+	}
+
+	var errs []error
+	from, _ := fileVersion(raw)
+	before := make(map[string]json.RawMessage, len(raw))
+	for name, v := range raw {
+		before[name] = v
+	}
+	changed, err := l.migrate(kind, raw)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", path, err))
+	} else if changed && path != l.LegacyPath {
+		if err := writeMigrated(path, kind, original, before, from, raw); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	errs = append(errs, ValidateFile(kind, path, raw)...)
+	return raw, path, errors.Join(errs...)
+}
+
+// writeMigrated backs up the original contents and replaces path with raw,
+// keeping the file's permissions. Keys the migration moved to the
+// credential store are left out of the backup, so it doesn't undo the move.
+func writeMigrated(path string, kind FileKind, original []byte, before map[string]json.RawMessage, from int, raw map[string]json.RawMessage) error {
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	if kind == FileUser {
+		perm = 0600
+	}
+
+	backup := fmt.Sprintf("%s.v%d.bak", path, from)
+	var err error
+	if moved := movedSecrets(before, raw); len(moved) > 0 {
+		for _, name := range moved {
+			delete(before, name)
+		}
+		err = writeRawFile(backup, before, perm)
+	} else {
+		err = writeFileAtomic(backup, original, perm)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to back up %s before migrating: %w", filepath.Base(path), err)
+	}
+	return writeRawFile(path, raw, perm)
+}
+
+// movedSecrets returns the secret settings present in before but not after.
+func movedSecrets(before, after map[string]json.RawMessage) []string {
+	var out []string
+	for _, k := range Keys {
+		_, was := before[k.Name]
+		_, is := after[k.Name]
+		if k.Secret && was && !is {
+			out = append(out, k.Name)
+		}
+	}
+	return out
+}
+
+// MigrateProjectFile upgrades <repoRoot>/.dodo/config.json in place and
+// validates it. The error is set when the file couldn't be read or
+// upgraded; validation problems are returned separately.
+func MigrateProjectFile(repoRoot string) ([]*FileError, error) {
+	l := &Loader{RepoRoot: repoRoot}
+	_, _, err := l.readFile(ScopeProject)
+	return splitFileErrors(err)
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMigrateUnversionedFiles(t *testing.T) {
+	const user = `{"max_steps": "30", "auto_index": "true", "api_key": "sk-user-1234"}`
+	const project = `{"indexing_enabled": true, "code_file_boost": "1.5"}`
+	l := newTestLoader(t, user, project, nil, nil)
+
+	s, err := l.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if s.MaxSteps() != 30 || !s.AutoIndex() || s.Float("code_file_boost") != 1.5 || s.APIKey() != "sk-user-1234" {
+		t.Errorf("settings after migration = %+v", s.All())
+	}
+
+	raw, err := readRawFile(l.UserPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"version": "1", "max_steps": "30", "auto_index": "true", "api_key_ref": `"store:openai"`}
+	for k, v := range want {
+		if got := string(raw[k]); got != v {
+			t.Errorf("user file %s = %s, want %s", k, got, v)
+		}
+	}
+	if _, ok := raw["api_key"]; ok {
+		t.Error("migration left the plain-text key in the user file")
+	}
+
+	backup, err := os.ReadFile(l.ProjectPath() + ".v0.bak")
+	if err != nil || string(backup) != project {
+		t.Errorf("project backup = %q, %v; want the original contents", backup, err)
+	}
+	userBackup, err := readRawFile(l.UserPath + ".v0.bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(userBackup["max_steps"]) != `"30"` || userBackup["api_key"] != nil {
+		t.Errorf("user backup = %s, want the original without the moved key", userBackup)
+	}
+	if info, err := os.Stat(l.UserPath + ".v0.bak"); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("user backup mode = %v, want 0600 (err %v)", info.Mode().Perm(), err)
+	}
+
+	// A second load leaves the migrated files alone.
+	if err := os.Remove(l.UserPath + ".v0.bak"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Load(); err != nil {
+		t.Fatalf("second Load() error = %v", err)
+	}
+	if _, err := os.Stat(l.UserPath + ".v0.bak"); !os.IsNotExist(err) {
+		t.Error("current file was migrated again")
+	}
+}
+
+func TestValidateFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		kind    FileKind
+		content string
+		want    []string
+	}{
+		{
+			name:    "newer version",
+			kind:    FileUser,
+			content: `{"version": 99, "model": "gpt-4o"}`,
+			want:    []string{"version: file format 99 is newer than this build supports (1); upgrade dodo"},
+		},
+		{
+			name:    "unknown setting",
+			kind:    FileUser,
+			content: `{"version": 1, "colour": "blue"}`,
+			want:    []string{"colour: unknown setting"},
+		},
+		{
+			name:    "secret in project file",
+			kind:    FileProject,
+			content: `{"version": 1, "api_key": "sk-1"}`,
+			want:    []string{"api_key: secrets cannot be stored in the project file (set api_key_ref in the user config file)"},
+		},
+		{
+			name:    "user-only setting in project file",
+			kind:    FileProject,
+			content: `{"version": 1, "credential_store": "env"}`,
+			want:    []string{"credential_store: only allowed in the user config file"},
+		},
+		{
+			name:    "key destination in project file",
+			kind:    FileProject,
+			content: `{"version": 1, "api_key_ref": "env:OPENAI_API_KEY", "base_url": "https://attacker.example", "profiles": {"p": {"provider": "openai", "base_url": "https://attacker.example", "key_ref": "store:openai"}}}`,
+			want:    []string{"api_key_ref: only allowed in the user config file", "base_url: only allowed in the user config file", "profiles.p.base_url: only allowed in user profiles", "profiles.p.key_ref: only allowed in user profiles"},
+		},
+		{
+			name:    "malformed profile",
+			kind:    FileUser,
+			content: `{"version": 1, "profiles": {"local": {"model": "x", "temperature": 5, "colour": 1}}}`,
+			want:    []string{"profiles.local: provider is required", "profiles.local.colour: unknown field", "profiles.local.temperature: Must be less than or equal to 2"},
+		},
+		{
+			name:    "object for scalar setting",
+			kind:    FileUser,
+			content: `{"version": 1, "max_steps": {"value": 3}}`,
+			want:    []string{"max_steps: Invalid type. Expected: integer, given: object"},
+		},
+		{
+			name:    "indexing decision type",
+			kind:    FileProject,
+			content: `{"version": 1, "indexing_enabled": "yes"}`,
+			want:    []string{"indexing_enabled: Invalid type. Expected: boolean, given: string"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := parseRawFile("config.json", []byte(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range ValidateFile(tt.kind, "config.json", raw) {
+				got = append(got, strings.TrimPrefix(e.Error(), "config.json: "))
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("ValidateFile() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestValidateFileAcceptsWrittenFiles(t *testing.T) {
+	l := newTestLoader(t, "", "", nil, nil)
+	if err := l.Set(ScopeUser, "sandbox_mode", "docker"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.SetProfile(ScopeUser, "work", Profile{Provider: "openai", BaseURL: "https://proxy.example.com", KeyRef: "store:work"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.SetProfile(ScopeProject, "local", Profile{Provider: "ollama", Model: "qwen3"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.SetProfile(ScopeProject, "evil", Profile{Provider: "openai", BaseURL: "https://attacker.example"}); err == nil {
+		t.Error("SetProfile stored a base_url in project scope")
+	}
+	if err := l.Set(ScopeProject, "cmd_timeout", "90s"); err != nil {
+		t.Fatal(err)
+	}
+	for kind, path := range map[FileKind]string{FileUser: l.UserPath, FileProject: l.ProjectPath()} {
+		raw, err := readRawFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if errs := ValidateFile(kind, path, raw); len(errs) != 0 {
+			t.Errorf("%s file %s fails its schema: %v", kind, raw, errs)
+		}
+	}
+
+	// The schemas themselves are valid JSON.
+	for _, kind := range []FileKind{FileUser, FileProject} {
+		doc, err := Schema(kind)
+		if err != nil || !json.Valid(doc) {
+			t.Errorf("Schema(%s) = invalid, %v", kind, err)
+		}
+	}
+}
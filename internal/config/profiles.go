@@ -0,0 +1,189 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Profile is a named provider setup. Profiles live under "profiles" in the
+// user or project config file; the "profile" setting selects one for new
+// sessions and switch_profile swaps a running session to another. Only
+// user profiles may set BaseURL and KeyRef, so a cloned repository can't
+// send the user's keys to a host it chooses.
+type Profile struct {
+	Provider        string  `json:"provider"`
+	Model           string  `json:"model,omitempty"`
+	BaseURL         string  `json:"base_url,omitempty"`
+	KeyRef          string  `json:"key_ref,omitempty"` // env:VAR or store:NAME; default env:<PROVIDER>_API_KEY
+	Temperature     float64 `json:"temperature,omitempty"`
+	MaxOutputTokens int     `json:"max_output_tokens,omitempty"`
+}
+
+var (
+	profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+	envVarPattern      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Validate checks that p is usable.
+func (p Profile) Validate() error {
+	if p.Provider == "" {
+		return errors.New("provider is required")
+	}
+	if p.KeyRef != "" {
+		if _, _, err := ParseKeyRef(p.KeyRef); err != nil {
+			return fmt.Errorf("key_ref: %w", err)
+		}
+	}
+	if p.Temperature < 0 || p.Temperature > 2 {
+		return fmt.Errorf("temperature must be between 0 and 2, got %g", p.Temperature)
+	}
+	if p.MaxOutputTokens < 0 {
+		return fmt.Errorf("max_output_tokens must not be negative, got %d", p.MaxOutputTokens)
+	}
+	return nil
+}
+
+// KeyReference returns where p's API key is kept: KeyRef, or the
+// provider's <PROVIDER>_API_KEY environment variable.
+func (p Profile) KeyReference() string {
+	if p.KeyRef != "" {
+		return p.KeyRef
+	}
+	return EnvRef(strings.ToUpper(p.Provider) + "_API_KEY")
+}
+
+// settings returns the values p contributes when selected. Every
+// provider-specific key is present, empty when p leaves it to the provider
+// default, so values configured for a different provider don't leak through.
+func (p Profile) settings() map[string]string {
+	out := map[string]string{
+		"llm_provider":      p.Provider,
+		"model":             p.Model,
+		"base_url":          p.BaseURL,
+		"api_key_ref":       p.KeyReference(),
+		"temperature":       "",
+		"max_output_tokens": "",
+	}
+	if p.Temperature > 0 {
+		out["temperature"] = strconv.FormatFloat(p.Temperature, 'f', -1, 64)
+	}
+	if p.MaxOutputTokens > 0 {
+		out["max_output_tokens"] = strconv.Itoa(p.MaxOutputTokens)
+	}
+	return out
+}
+
+// ProfilesIn returns the profiles defined in the file behind scope.
+func (l *Loader) ProfilesIn(scope Scope) (map[string]Profile, error) {
+	if scope != ScopeUser && scope != ScopeProject {
+		return map[string]Profile{}, nil
+	}
+	raw, path, err := l.readFile(scope)
+	if raw == nil {
+		return nil, err
+	}
+	profiles := make(map[string]Profile)
+	if msg, ok := raw["profiles"]; ok {
+		if err := json.Unmarshal(msg, &profiles); err != nil {
+			return nil, fmt.Errorf("%s: profiles: %w", path, err)
+		}
+	}
+	return profiles, nil
+}
+
+// Profiles returns every defined profile. A project profile replaces a user
+// profile of the same name; its base_url and key_ref are ignored
+// (ValidateFile reports them).
+func (l *Loader) Profiles() (map[string]Profile, error) {
+	out := make(map[string]Profile)
+	for _, scope := range []Scope{ScopeUser, ScopeProject} {
+		profiles, err := l.ProfilesIn(scope)
+		if err != nil {
+			return nil, err
+		}
+		for name, p := range profiles {
+			if scope == ScopeProject {
+				p.BaseURL, p.KeyRef = "", ""
+			}
+			out[name] = p
+		}
+	}
+	return out, nil
+}
+
+// Profile returns the named profile.
+func (l *Loader) Profile(name string) (Profile, error) {
+	profiles, err := l.Profiles()
+	if err != nil {
+		return Profile{}, err
+	}
+	p, ok := profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("profile %q is not defined", name)
+	}
+	if err := p.Validate(); err != nil {
+		return Profile{}, fmt.Errorf("profile %q: %w", name, err)
+	}
+	return p, nil
+}
+
+// SetProfile stores p under name in the file behind scope.
+func (l *Loader) SetProfile(scope Scope, name string, p Profile) error {
+	if !profileNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q", name)
+	}
+	if err := p.Validate(); err != nil {
+		return fmt.Errorf("profile %q: %w", name, err)
+	}
+	if scope == ScopeProject && (p.BaseURL != "" || p.KeyRef != "") {
+		return fmt.Errorf("profile %q: base_url and key_ref can only be set in user scope", name)
+	}
+	return l.updateProfiles(scope, func(profiles map[string]Profile) bool {
+		profiles[name] = p
+		return true
+	})
+}
+
+// RemoveProfile deletes the named profile from the file behind scope.
+func (l *Loader) RemoveProfile(scope Scope, name string) error {
+	return l.updateProfiles(scope, func(profiles map[string]Profile) bool {
+		if _, ok := profiles[name]; !ok {
+			return false
+		}
+		delete(profiles, name)
+		return true
+	})
+}
+
+func (l *Loader) updateProfiles(scope Scope, update func(map[string]Profile) bool) error {
+	path, perm, err := l.writablePath(scope)
+	if err != nil {
+		return err
+	}
+	raw, err := l.rawForWrite(scope, path)
+	if err != nil {
+		return err
+	}
+	profiles, err := l.ProfilesIn(scope)
+	if err != nil {
+		return err
+	}
+	if !update(profiles) {
+		return nil
+	}
+
+	if len(profiles) == 0 {
+		delete(raw, "profiles")
+	} else {
+		encoded, err := json.Marshal(profiles)
+		if err != nil {
+			return fmt.Errorf("failed to encode profiles: %w", err)
+		}
+		raw["profiles"] = encoded
+	}
+	return writeRawFile(path, raw, perm)
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoaderProfileSelection(t *testing.T) {
+	const user = `{
+		"llm_provider": "openai",
+		"model": "gpt-4o",
+		"base_url": "https://proxy.example.com",
+		"profile": "local",
+		"profiles": {
+			"local": {"provider": "ollama", "model": "qwen2.5-coder", "temperature": 0.2},
+			"frontier": {"provider": "anthropic", "model": "claude-sonnet-4", "key_ref": "WORK_ANTHROPIC_KEY"}
+		}
+	}`
+	env := map[string]string{"WORK_ANTHROPIC_KEY": "sk-ant"}
+
+	tests := []struct {
+		name    string
+		project string
+		flags   map[string]string
+		want    map[string]string
+	}{
+		{
+			name: "user selection",
+			want: map[string]string{"llm_provider": "ollama", "model": "qwen2.5-coder", "temperature": "0.2", "base_url": ""},
+		},
+		{
+			name:  "flag selection with key reference",
+			flags: map[string]string{"profile": "frontier"},
+			want:  map[string]string{"llm_provider": "anthropic", "model": "claude-sonnet-4", "api_key": "sk-ant", "temperature": ""},
+		},
+		{
+			name:    "project profile shadows user profile",
+			project: `{"profiles": {"local": {"provider": "lmstudio", "model": "devstral"}}}`,
+			want:    map[string]string{"llm_provider": "lmstudio", "model": "devstral"},
+		},
+		{
+			name:    "project setting overrides user-selected profile",
+			project: `{"model": "llama3.1"}`,
+			want:    map[string]string{"llm_provider": "ollama", "model": "llama3.1"},
+		},
+		{
+			name:  "flag overrides selected profile",
+			flags: map[string]string{"model": "qwen3"},
+			want:  map[string]string{"llm_provider": "ollama", "model": "qwen3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestLoader(t, user, tt.project, env, tt.flags)
+			s, err := l.Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			for key, want := range tt.want {
+				if got := s.String(key); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoaderUnknownProfile(t *testing.T) {
+	l := newTestLoader(t, `{"model": "gpt-4o", "profile": "missing"}`, "", nil, nil)
+	s, err := l.Load()
+	if err == nil || !strings.Contains(err.Error(), `profile "missing" is not defined`) {
+		t.Fatalf("Load() error = %v, want undefined profile", err)
+	}
+	if got := s.Model(); got != "gpt-4o" {
+		t.Errorf("Model() = %q, want the plain settings to still apply", got)
+	}
+}
+
+func TestLoaderSetRemoveProfile(t *testing.T) {
+	l := newTestLoader(t, `{"api_key": "sk-123"}`, "", nil, nil)
+
+	if err := l.SetProfile(ScopeProject, "local", Profile{Provider: "ollama", Model: "qwen2.5-coder"}); err != nil {
+		t.Fatalf("SetProfile() error = %v", err)
+	}
+	if err := l.SetProfile(ScopeUser, "bad name", Profile{Provider: "openai"}); err == nil {
+		t.Error("SetProfile() accepted an invalid name")
+	}
+	if err := l.SetProfile(ScopeUser, "hot", Profile{Provider: "openai", Temperature: 3}); err == nil {
+		t.Error("SetProfile() accepted an out-of-range temperature")
+	}
+
+	p, err := l.Profile("local")
+	if err != nil {
+		t.Fatalf("Profile() error = %v", err)
+	}
+	if p.Provider != "ollama" || p.Model != "qwen2.5-coder" {
+		t.Errorf("Profile() = %+v", p)
+	}
+	if user, _ := l.ProfilesIn(ScopeUser); len(user) != 0 {
+		t.Errorf("user profiles = %v, want none", user)
+	}
+
+	if err := l.RemoveProfile(ScopeProject, "local"); err != nil {
+		t.Fatalf("RemoveProfile() error = %v", err)
+	}
+	if _, err := l.Profile("local"); err == nil {
+		t.Error("Profile() found a removed profile")
+	}
+	raw, err := readRawFile(l.ProjectPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := raw["profiles"]; ok {
+		t.Error("empty profiles object left in project file")
+	}
+}
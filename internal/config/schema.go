@@ -0,0 +1,285 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// SchemaVersion is the config file format this build reads and writes.
+// Files without a "version" field are version 0 and are migrated on load.
+const SchemaVersion = 1
+
+// FileKind identifies one of the two config file formats.
+type FileKind string
+
+const (
+	FileUser    FileKind = "user"    // ~/.dodo/config.json
+	FileProject FileKind = "project" // <repo>/.dodo/config.json
+)
+
+// ParseFileKind validates a file kind name.
+func ParseFileKind(s string) (FileKind, error) {
+	switch FileKind(s) {
+	case FileUser, FileProject:
+		return FileKind(s), nil
+	}
+	return "", fmt.Errorf("unknown config file %q (valid: user, project)", s)
+}
+
+var (
+	durationPattern = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+	keyRefPattern   = `^((env:)?[A-Za-z_][A-Za-z0-9_]*|store:[A-Za-z0-9][A-Za-z0-9_.-]*)$`
+)
+
+// Schema returns the JSON Schema (draft-07) for kind. It is generated from
+// Keys, so a new setting is covered as soon as it is declared.
+func Schema(kind FileKind) ([]byte, error) {
+	props := map[string]any{
+		"$schema": map[string]any{"type": "string"},
+		"version": map[string]any{
+			"type":        "integer",
+			"minimum":     0,
+			"description": fmt.Sprintf("Config file format; this build writes %d", SchemaVersion),
+		},
+		"profiles": map[string]any{
+			"type":                 "object",
+			"description":          "Named provider profiles",
+			"propertyNames":        map[string]any{"pattern": profileNamePattern.String()},
+			"additionalProperties": profileSchema(kind),
+		},
+		"mcp_servers": map[string]any{
+			"type":                 "object",
+			"description":          "Model Context Protocol servers whose tools sessions may call",
+			"propertyNames":        map[string]any{"pattern": mcpServerNamePattern.String()},
+			"additionalProperties": mcpServerSchema(),
+		},
+	}
+	if kind == FileUser {
+		// Only the user can trust a repository's servers.
+		props["trusted_repos"] = map[string]any{
+			"type":                 "object",
+			"description":          "Repositories whose project MCP servers may run, with the digest of the trusted declaration",
+			"additionalProperties": map[string]any{"type": "string", "pattern": `^sha256:[0-9a-f]{64}$`},
+		}
+	}
+	for _, k := range Keys {
+		if (k.Secret || k.UserOnly) && kind == FileProject {
+			continue
+		}
+		props[k.Name] = keySchema(k)
+	}
+	title := "dodo user configuration"
+	if kind == FileProject {
+		title = "dodo project configuration"
+		// Owned by internal/project, which shares the file.
+		props["indexing_enabled"] = map[string]any{
+			"type":        "boolean",
+			"description": "Whether the project may be indexed for semantic search",
+		}
+	}
+
+	return json.MarshalIndent(map[string]any{
+		"$schema":              "http://json-schema.org/draft-07/schema#",
+		"title":                title,
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}, "", "  ")
+}
+
+func keySchema(k Key) map[string]any {
+	s := map[string]any{"description": k.Description}
+	switch k.Kind {
+	case KindBool:
+		s["type"] = "boolean"
+	case KindInt:
+		s["type"] = "integer"
+		s["minimum"] = 0
+	case KindFloat:
+		s["type"] = "number"
+	case KindDuration:
+		s["type"] = "string"
+		s["pattern"] = durationPattern
+	case KindKeyRef:
+		s["type"] = "string"
+		s["pattern"] = keyRefPattern
+	default:
+		s["type"] = "string"
+	}
+	if len(k.Allowed) > 0 {
+		s["enum"] = k.Allowed
+	}
+	if k.Secret {
+		s["description"] = k.Description + " (deprecated: use " + k.Ref + ")"
+	}
+	return s
+}
+
+func profileSchema(kind FileKind) map[string]any {
+	props := map[string]any{
+		"provider":          map[string]any{"type": "string", "minLength": 1},
+		"model":             map[string]any{"type": "string"},
+		"temperature":       map[string]any{"type": "number", "minimum": 0, "maximum": 2},
+		"max_output_tokens": map[string]any{"type": "integer", "minimum": 0},
+	}
+	if kind == FileUser {
+		props["base_url"] = map[string]any{"type": "string"}
+		props["key_ref"] = map[string]any{"type": "string", "pattern": keyRefPattern}
+	}
+	return map[string]any{
+		"type":                 "object",
+		"required":             []string{"provider"},
+		"additionalProperties": false,
+		"properties":           props,
+	}
+}
+
+func mcpServerSchema() map[string]any {
+	stringMap := map[string]any{
+		"type":                 "object",
+		"additionalProperties": map[string]any{"type": "string"},
+	}
+	return map[string]any{
+		"type":                 "object",
+		"additionalProperties": false,
+		"properties": map[string]any{
+			"command":  map[string]any{"type": "string", "minLength": 1},
+			"args":     map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			"env":      stringMap,
+			"url":      map[string]any{"type": "string", "pattern": "^https?://"},
+			"headers":  stringMap,
+			"timeout":  map[string]any{"type": "string", "pattern": durationPattern},
+			"disabled": map[string]any{"type": "boolean"},
+		},
+	}
+}
+
+var (
+	compiledMu      sync.Mutex
+	compiledSchemas = make(map[FileKind]*gojsonschema.Schema)
+)
+
+func compiledSchema(kind FileKind) (*gojsonschema.Schema, error) {
+	compiledMu.Lock()
+	defer compiledMu.Unlock()
+	if s, ok := compiledSchemas[kind]; ok {
+		return s, nil
+	}
+	doc, err := Schema(kind)
+	if err != nil {
+		return nil, err
+	}
+	s, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(doc))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s config schema: %w", kind, err)
+	}
+	compiledSchemas[kind] = s
+	return s, nil
+}
+
+// FileError is a problem found while validating a config file.
+type FileError struct {
+	Path    string
+	Field   string // dotted path, e.g. profiles.local.temperature
+	Message string
+}
+
+func (e *FileError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("%s: %s", e.Path, e.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.Path, e.Field, e.Message)
+}
+
+// ValidateFile checks the contents of a config file against the schema for
+// kind and returns one *FileError per problem, sorted by field. Scalar
+// values of known settings are left to Key.Validate, which Load applies to
+// every layer alike.
+func ValidateFile(kind FileKind, path string, raw map[string]json.RawMessage) []error {
+	var errs []error
+	if v, err := fileVersion(raw); err == nil && v > SchemaVersion {
+		errs = append(errs, &FileError{Path: path, Field: "version", Message: fmt.Sprintf(
+			"file format %d is newer than this build supports (%d); upgrade dodo", v, SchemaVersion)})
+	}
+
+	schema, err := compiledSchema(kind)
+	if err != nil {
+		return append(errs, err)
+	}
+	doc, err := json.Marshal(raw)
+	if err != nil {
+		return append(errs, &FileError{Path: path, Message: err.Error()})
+	}
+	result, err := schema.Validate(gojsonschema.NewBytesLoader(doc))
+	if err != nil {
+		return append(errs, &FileError{Path: path, Message: err.Error()})
+	}
+
+	var found []*FileError
+	for _, re := range result.Errors() {
+		field := re.Field()
+		if field == "(root)" {
+			field = ""
+		}
+		msg := re.Description()
+		if re.Type() == "additional_property_not_allowed" {
+			prop, _ := re.Details()["property"].(string)
+			switch k, known := LookupKey(prop); {
+			case kind == FileProject && strings.HasPrefix(field, "profiles.") && (prop == "base_url" || prop == "key_ref"):
+				msg = "only allowed in user profiles"
+			case field != "":
+				msg = "unknown field"
+			case known && k.Secret:
+				msg = fmt.Sprintf("secrets cannot be stored in the project file (set %s in the user config file)", k.Ref)
+			case known && k.UserOnly, prop == "trusted_repos":
+				msg = "only allowed in the user config file"
+			default:
+				msg = "unknown setting"
+			}
+			field = strings.TrimPrefix(field+"."+prop, ".")
+		} else if _, known := LookupKey(field); known && isScalar(raw[field]) {
+			// Load reports these in Key.Validate's words.
+			continue
+		}
+		found = append(found, &FileError{Path: path, Field: field, Message: msg})
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].Field < found[j].Field })
+	for _, e := range found {
+		errs = append(errs, e)
+	}
+	return errs
+}
+
+func isScalar(msg json.RawMessage) bool {
+	var v any
+	if err := json.Unmarshal(msg, &v); err != nil {
+		return false
+	}
+	switch v.(type) {
+	case string, bool, float64:
+		return true
+	}
+	return false
+}
+
+// splitFileErrors separates the validation problems joined in err from
+// the other errors, which are joined again.
+func splitFileErrors(err error) ([]*FileError, error) {
+	var problems []*FileError
+	var others []error
+	for _, e := range unwrapJoined(err) {
+		var fe *FileError
+		if errors.As(e, &fe) {
+			problems = append(problems, fe)
+		} else {
+			others = append(others, e)
+		}
+	}
+	return problems, errors.Join(others...)
+}
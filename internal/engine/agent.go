@@ -14,6 +14,8 @@ type Agent struct {
 	hooks     Hooks
 	prompt    *prompts.Prompt
 	lastState *State
+
+	systemContext string // see SetSystemContext
 }
 
 // Run executes a single user message through the agent.
@@ -30,6 +32,7 @@ func (a *Agent) Run(ctx context.Context, userMessage string) error {
 			MaxSteps:        a.config.MaxSteps,
 			Budget:          a.config.Budget,
 			Totals:          a.lastState.Totals, // Preserve accumulated token usage
+			SystemContext:   a.systemContext,
 			EditToolBlocked: a.config.EnforcePlanning,
 			FailureCounts:   make(map[string]int),
 			FileReadCache:   make(map[string]bool),
@@ -61,6 +64,7 @@ func (a *Agent) Run(ctx context.Context, userMessage string) error {
 			Model:           a.config.Model,
 			MaxSteps:        a.config.MaxSteps,
 			Budget:          a.config.Budget,
+			SystemContext:   a.systemContext,
 			EditToolBlocked: a.config.EnforcePlanning,
 			FailureCounts:   make(map[string]int),
 			FileReadCache:   make(map[string]bool),
@@ -141,6 +145,13 @@ func (a *Agent) Append(msg ChatMessage) {
 	a.lastState.Append(msg)
 }
 
+// SetSystemContext sets text added to the system prompt of the requests
+// of the following runs. Unlike Append, it does not stay in the history:
+// each run gets the context set last.
+func (a *Agent) SetSystemContext(text string) {
+	a.systemContext = text
+}
+
 // LastState returns the most recent conversation state after Run completes.
 // Callers should treat the returned state as read-only.
 func (a *Agent) LastState() *State {
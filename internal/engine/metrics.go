@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
@@ -25,18 +26,41 @@ type AgentMetrics struct {
 // Global metrics instance (set by NewAgentMetrics)
 var globalMetrics *AgentMetrics
 
-// NewAgentMetrics creates a new metrics tracker and sets it as the global instance.
-func NewAgentMetrics(provider, modelName string) *AgentMetrics {
-	m := &AgentMetrics{
+// NewMetrics creates a metrics tracker without making it the global
+// instance, for processes that keep one per repository.
+func NewMetrics(provider, modelName string) *AgentMetrics {
+	return &AgentMetrics{
 		StartTime:       time.Now(),
 		ModelName:       modelName,
 		Provider:        provider,
 		ToolCallsByName: make(map[string]int),
 	}
+}
+
+// NewAgentMetrics creates a new metrics tracker and sets it as the global instance.
+func NewAgentMetrics(provider, modelName string) *AgentMetrics {
+	m := NewMetrics(provider, modelName)
 	globalMetrics = m
 	return m
 }
 
+// MetricsHook records the steps, tool calls and tokens of the agents it is
+// attached to in M.
+type MetricsHook struct {
+	NopHook
+	M *AgentMetrics
+}
+
+func (h MetricsHook) OnStepStart(context.Context, *State) { h.M.RecordStep() }
+
+func (h MetricsHook) OnAfterLLM(_ context.Context, _ *State, resp LLMResponse) {
+	h.M.RecordTokens(resp.Usage.Prompt, resp.Usage.Completion, 0)
+}
+
+func (h MetricsHook) OnToolCall(_ context.Context, _ *State, call ToolCall) {
+	h.M.RecordToolCall(call.Name)
+}
+
 // GetGlobalMetrics returns the global metrics instance (or nil if not set).
 func GetGlobalMetrics() *AgentMetrics {
 	return globalMetrics
@@ -67,6 +91,13 @@ func (m *AgentMetrics) RecordTokens(input, output, cached int) {
 	m.EstimatedCost = m.calculateCost()
 }
 
+// Counts returns the steps, tool calls and tokens recorded so far.
+func (m *AgentMetrics) Counts() (steps, toolCalls, tokens int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.TotalSteps, m.TotalToolCalls, m.InputTokens + m.OutputTokens
+}
+
 // Finish marks the end time.
 func (m *AgentMetrics) Finish() {
 	m.mu.Lock()
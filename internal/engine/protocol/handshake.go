@@ -0,0 +1,150 @@
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ProtocolVersion is the semantic version of the NDJSON protocol spoken by
+// this engine. The major version changes when existing commands or events
+// change incompatibly; additions bump the minor version. docs/PROTO.md
+// lists what each minor version added.
+const ProtocolVersion = "1.12.0"
+
+// Capabilities name optional protocol features. A client lists the ones it
+// understands in hello; welcome answers with those the engine also offers.
+const (
+	CapabilityStreaming         = "streaming"          // assistant_text deltas while the model generates
+	CapabilityCancellation      = "cancellation"       // cancel_request
+	CapabilitySessionResume     = "session_resume"     // start_session with an existing id replays session_history
+	CapabilityConfig            = "config"             // get_config, save_config, reload_config
+	CapabilityModels            = "models"             // list_models
+	CapabilityProfiles          = "profiles"           // list_profiles, switch_profile
+	CapabilityProjectPermission = "project_permission" // project_permission_required / project_permission
+	CapabilitySubscriptions     = "subscriptions"      // subscribe, unsubscribe; several clients per engine
+	CapabilitySessions          = "sessions"           // list, search, get, rename, archive, pin, delete, export and fork stored sessions
+	CapabilityResync            = "resync"             // seq on session events; resync replays missed ones
+	CapabilityMCP               = "mcp"                // tools of configured MCP servers; mcp_server_status
+	CapabilityMemory            = "memory"             // list_memories, save_memory, forget_memory
+)
+
+// EngineCapabilities lists every capability this engine offers.
+var EngineCapabilities = []string{
+	CapabilityStreaming,
+	CapabilityCancellation,
+	CapabilitySessionResume,
+	CapabilityConfig,
+	CapabilityModels,
+	CapabilityProfiles,
+	CapabilityProjectPermission,
+	CapabilitySubscriptions,
+	CapabilitySessions,
+	CapabilityResync,
+	CapabilityMCP,
+	CapabilityMemory,
+}
+
+// HelloCommand opens the protocol handshake. Clients that skip it are
+// treated as speaking the current version with every capability.
+type HelloCommand struct {
+	Type            CommandType `json:"type"`
+	ProtocolVersion string      `json:"protocol_version"`
+	Client          string      `json:"client,omitempty"` // name/version, for logs
+	Capabilities    []string    `json:"capabilities,omitempty"`
+	Token           string      `json:"token,omitempty"` // required by engines listening on TCP
+	RequestID       string      `json:"request_id,omitempty"`
+}
+
+// GetType implements Command.
+func (c HelloCommand) GetType() CommandType { return CommandHello }
+
+// GetRequestID implements Command.
+func (c HelloCommand) GetRequestID() string { return c.RequestID }
+
+// WelcomeEvent answers hello.
+type WelcomeEvent struct {
+	eventBase
+	ProtocolVersion string   `json:"protocol_version"`
+	Capabilities    []string `json:"capabilities"` // negotiated: offered by both sides
+}
+
+// NewWelcomeEvent constructs a welcome event.
+func NewWelcomeEvent(capabilities []string) WelcomeEvent {
+	return WelcomeEvent{
+		eventBase:       eventBase{Type: EventWelcome},
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    capabilities,
+	}
+}
+
+// GetType implements Event.
+func (e WelcomeEvent) GetType() EventType { return e.Type }
+
+// VersionError reports a hello from a client whose protocol version the
+// engine cannot speak.
+type VersionError struct {
+	ClientVersion string
+	EngineVersion string
+	Reason        string
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("incompatible protocol version %q: %s (engine speaks %s)", e.ClientVersion, e.Reason, e.EngineVersion)
+}
+
+// CheckCompatible reports whether a client speaking clientVersion can talk
+// to this engine. Versions are compatible when their major versions match;
+// before 1.0.0 the minor versions must match too.
+func CheckCompatible(clientVersion string) error {
+	client, err := parseSemver(clientVersion)
+	if err != nil {
+		return &VersionError{ClientVersion: clientVersion, EngineVersion: ProtocolVersion, Reason: err.Error()}
+	}
+	engine, _ := parseSemver(ProtocolVersion)
+	switch {
+	case client[0] != engine[0]:
+		return &VersionError{ClientVersion: clientVersion, EngineVersion: ProtocolVersion,
+			Reason: fmt.Sprintf("major version %d is not supported", client[0])}
+	case engine[0] == 0 && client[1] != engine[1]:
+		return &VersionError{ClientVersion: clientVersion, EngineVersion: ProtocolVersion,
+			Reason: fmt.Sprintf("pre-release version 0.%d is not supported", client[1])}
+	}
+	return nil
+}
+
+// NegotiateCapabilities returns the engine capabilities the client also
+// listed, in the engine's order. Unknown client capabilities are ignored.
+func NegotiateCapabilities(client []string) []string {
+	wanted := make(map[string]bool, len(client))
+	for _, c := range client {
+		wanted[c] = true
+	}
+	out := []string{}
+	for _, c := range EngineCapabilities {
+		if wanted[c] {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// parseSemver parses MAJOR.MINOR.PATCH, ignoring pre-release and build
+// suffixes.
+func parseSemver(v string) ([3]int, error) {
+	var out [3]int
+	core, _, _ := strings.Cut(strings.TrimPrefix(v, "v"), "+")
+	core, _, _ = strings.Cut(core, "-")
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return out, fmt.Errorf("expected MAJOR.MINOR.PATCH")
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return out, fmt.Errorf("expected MAJOR.MINOR.PATCH")
+		}
+		out[i] = n
+	}
+	return out, nil
+}
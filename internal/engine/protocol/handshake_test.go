@@ -0,0 +1,59 @@
+package protocol
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeHello(t *testing.T) {
+	tests := []struct {
+		name        string
+		line        string
+		wantVersion bool // error is a *VersionError
+		wantErr     bool
+	}{
+		{name: "same version", line: `{"type":"hello","protocol_version":"1.0.0"}`},
+		{name: "newer minor", line: `{"type":"hello","protocol_version":"1.4.2","capabilities":["streaming"]}`},
+		{name: "pre-release suffix", line: `{"type":"hello","protocol_version":"1.1.0-beta.1"}`},
+		{name: "older major", line: `{"type":"hello","protocol_version":"0.9.0"}`, wantVersion: true, wantErr: true},
+		{name: "newer major", line: `{"type":"hello","protocol_version":"2.0.0"}`, wantVersion: true, wantErr: true},
+		{name: "not semver", line: `{"type":"hello","protocol_version":"1.0"}`, wantVersion: true, wantErr: true},
+		{name: "missing version", line: `{"type":"hello"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := DecodeCommand([]byte(tt.line))
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("DecodeCommand() error = %v", err)
+				}
+				if _, ok := cmd.(HelloCommand); !ok {
+					t.Fatalf("DecodeCommand() = %T, want HelloCommand", cmd)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("DecodeCommand() accepted an incompatible hello")
+			}
+			var verr *VersionError
+			if got := errors.As(err, &verr); got != tt.wantVersion {
+				t.Errorf("error %v is VersionError = %v, want %v", err, got, tt.wantVersion)
+			}
+			if verr != nil && verr.EngineVersion != ProtocolVersion {
+				t.Errorf("VersionError.EngineVersion = %q, want %q", verr.EngineVersion, ProtocolVersion)
+			}
+		})
+	}
+}
+
+func TestNegotiateCapabilities(t *testing.T) {
+	got := NegotiateCapabilities([]string{"profiles", "approvals", "streaming"})
+	want := []string{CapabilityStreaming, CapabilityProfiles}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NegotiateCapabilities() = %v, want %v", got, want)
+	}
+	if got := NegotiateCapabilities(nil); got == nil || len(got) != 0 {
+		t.Errorf("NegotiateCapabilities(nil) = %#v, want an empty list", got)
+	}
+}
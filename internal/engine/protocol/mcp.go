@@ -0,0 +1,33 @@
+package protocol
+
+// Statuses of a session's connection to an MCP server.
+const (
+	MCPStatusConnecting = "connecting"
+	MCPStatusReady      = "ready"
+	MCPStatusFailed     = "failed"
+	MCPStatusClosed     = "closed"
+)
+
+// MCPServerStatusEvent reports the connection of a session to one of the
+// MCP servers configured for its repository.
+type MCPServerStatusEvent struct {
+	eventBase
+	Server string   `json:"server"`
+	Status string   `json:"status"`          // connecting, ready, failed or closed
+	Tools  []string `json:"tools,omitempty"` // names the server's tools were registered under, once ready
+	Error  string   `json:"error,omitempty"` // why it failed
+}
+
+// NewMCPServerStatusEvent constructs an mcp_server_status event.
+func NewMCPServerStatusEvent(sessionID, server, status string, tools []string, errMsg string) MCPServerStatusEvent {
+	return MCPServerStatusEvent{
+		eventBase: eventBase{Type: EventMCPServerStatus, SessionID: sessionID},
+		Server:    server,
+		Status:    status,
+		Tools:     tools,
+		Error:     errMsg,
+	}
+}
+
+// GetType implements Event.
+func (e MCPServerStatusEvent) GetType() EventType { return e.Type }
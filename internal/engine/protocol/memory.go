@@ -0,0 +1,124 @@
+package protocol
+
+import "time"
+
+// Kinds of project memory.
+const (
+	MemoryKindFact       = "fact"
+	MemoryKindConvention = "convention"
+	MemoryKindDecision   = "decision"
+)
+
+func validMemoryKind(kind string) bool {
+	switch kind {
+	case MemoryKindFact, MemoryKindConvention, MemoryKindDecision:
+		return true
+	}
+	return false
+}
+
+// ListMemoriesCommand asks for a repository's project memories: with query,
+// those relevant to it, best match first; otherwise all of them, most
+// recently updated first.
+type ListMemoriesCommand struct {
+	Type      CommandType `json:"type"`
+	RepoRoot  string      `json:"repo_root,omitempty"` // defaults to the engine's repository
+	Query     string      `json:"query,omitempty"`
+	Kind      string      `json:"kind,omitempty"`  // fact, convention or decision
+	Limit     int         `json:"limit,omitempty"` // 0 means every memory
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// GetType implements Command.
+func (c ListMemoriesCommand) GetType() CommandType { return CommandListMemories }
+
+// GetRequestID implements Command.
+func (c ListMemoriesCommand) GetRequestID() string { return c.RequestID }
+
+// SaveMemoryCommand adds a memory or, with memory_id, replaces one.
+type SaveMemoryCommand struct {
+	Type      CommandType `json:"type"`
+	RepoRoot  string      `json:"repo_root,omitempty"`
+	MemoryID  string      `json:"memory_id,omitempty"`
+	Kind      string      `json:"kind"`
+	Content   string      `json:"content"`
+	Tags      []string    `json:"tags,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// GetType implements Command.
+func (c SaveMemoryCommand) GetType() CommandType { return CommandSaveMemory }
+
+// GetRequestID implements Command.
+func (c SaveMemoryCommand) GetRequestID() string { return c.RequestID }
+
+// ForgetMemoryCommand deletes a memory.
+type ForgetMemoryCommand struct {
+	Type      CommandType `json:"type"`
+	RepoRoot  string      `json:"repo_root,omitempty"`
+	MemoryID  string      `json:"memory_id"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// GetType implements Command.
+func (c ForgetMemoryCommand) GetType() CommandType { return CommandForgetMemory }
+
+// GetRequestID implements Command.
+func (c ForgetMemoryCommand) GetRequestID() string { return c.RequestID }
+
+// MemoryInfo describes a project memory.
+type MemoryInfo struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Content   string    `json:"content"`
+	Tags      []string  `json:"tags,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// MemoriesListedEvent answers list_memories.
+type MemoriesListedEvent struct {
+	eventBase
+	Query    string       `json:"query,omitempty"`
+	Memories []MemoryInfo `json:"memories"`
+}
+
+// NewMemoriesListedEvent constructs a memories_listed event.
+func NewMemoriesListedEvent(query string, memories []MemoryInfo) MemoriesListedEvent {
+	return MemoriesListedEvent{
+		eventBase: eventBase{Type: EventMemoriesListed},
+		Query:     query,
+		Memories:  memories,
+	}
+}
+
+// GetType implements Event.
+func (e MemoriesListedEvent) GetType() EventType { return e.Type }
+
+// MemorySavedEvent answers save_memory with the memory as stored.
+type MemorySavedEvent struct {
+	eventBase
+	Memory MemoryInfo `json:"memory"`
+}
+
+// NewMemorySavedEvent constructs a memory_saved event.
+func NewMemorySavedEvent(info MemoryInfo) MemorySavedEvent {
+	return MemorySavedEvent{eventBase: eventBase{Type: EventMemorySaved}, Memory: info}
+}
+
+// GetType implements Event.
+func (e MemorySavedEvent) GetType() EventType { return e.Type }
+
+// MemoryForgottenEvent confirms forget_memory.
+type MemoryForgottenEvent struct {
+	eventBase
+	MemoryID string `json:"memory_id"`
+}
+
+// NewMemoryForgottenEvent constructs a memory_forgotten event.
+func NewMemoryForgottenEvent(memoryID string) MemoryForgottenEvent {
+	return MemoryForgottenEvent{eventBase: eventBase{Type: EventMemoryForgotten}, MemoryID: memoryID}
+}
+
+// GetType implements Event.
+func (e MemoryForgottenEvent) GetType() EventType { return e.Type }
@@ -0,0 +1,30 @@
+package protocol
+
+import "testing"
+
+func TestDecodeMemoryCommands(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		wantErr bool
+	}{
+		{name: "list", line: `{"type":"list_memories"}`},
+		{name: "list query", line: `{"type":"list_memories","query":"tests","kind":"convention","limit":5}`},
+		{name: "list unknown kind", line: `{"type":"list_memories","kind":"opinion"}`, wantErr: true},
+		{name: "list negative limit", line: `{"type":"list_memories","limit":-1}`, wantErr: true},
+		{name: "save", line: `{"type":"save_memory","kind":"fact","content":"Run make gen after editing the schema","tags":["schema"]}`},
+		{name: "save edit", line: `{"type":"save_memory","memory_id":"1a2b3c4d","kind":"decision","content":"Keep the v1 API"}`},
+		{name: "save blank content", line: `{"type":"save_memory","kind":"fact","content":" "}`, wantErr: true},
+		{name: "save without kind", line: `{"type":"save_memory","content":"x"}`, wantErr: true},
+		{name: "forget", line: `{"type":"forget_memory","memory_id":"1a2b3c4d"}`},
+		{name: "forget without id", line: `{"type":"forget_memory"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeCommand([]byte(tt.line))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
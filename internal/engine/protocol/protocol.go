@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/google/uuid"
 )
@@ -19,11 +20,33 @@ const (
 	CommandReloadConfig      CommandType = "reload_config"
 	CommandCancelRequest     CommandType = "cancel_request"
 	CommandProjectPermission CommandType = "project_permission"
+	CommandListModels        CommandType = "list_models"
+	CommandSwitchProfile     CommandType = "switch_profile"
+	CommandListProfiles      CommandType = "list_profiles"
+	CommandHello             CommandType = "hello"
+	CommandSubscribe         CommandType = "subscribe"
+	CommandUnsubscribe       CommandType = "unsubscribe"
+	CommandListSessions      CommandType = "list_sessions"
+	CommandGetSession        CommandType = "get_session"
+	CommandSearchSessions    CommandType = "search_sessions"
+	CommandRenameSession     CommandType = "rename_session"
+	CommandDeleteSession     CommandType = "delete_session"
+	CommandArchiveSession    CommandType = "archive_session"
+	CommandPinSession        CommandType = "pin_session"
+	CommandExportSession     CommandType = "export_session"
+	CommandForkSession       CommandType = "fork_session"
+	CommandListMemories      CommandType = "list_memories"
+	CommandSaveMemory        CommandType = "save_memory"
+	CommandForgetMemory      CommandType = "forget_memory"
+	CommandResync            CommandType = "resync"
 )
 
 // Command is a marker interface implemented by all protocol commands.
+// Every command may carry a client-chosen request_id, echoed in the ack and
+// result events and in the events the command causes.
 type Command interface {
 	GetType() CommandType
+	GetRequestID() string
 }
 
 // StartSessionCommand initializes (or resumes) a session.
@@ -33,11 +56,15 @@ type StartSessionCommand struct {
 	RepoRoot  string            `json:"repo_root,omitempty"`
 	Meta      map[string]any    `json:"meta,omitempty"`
 	Config    map[string]string `json:"config,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
 }
 
 // GetType implements Command.
 func (c StartSessionCommand) GetType() CommandType { return CommandStartSession }
 
+// GetRequestID implements Command.
+func (c StartSessionCommand) GetRequestID() string { return c.RequestID }
+
 // UserMessageCommand sends a user instruction to the engine.
 type UserMessageCommand struct {
 	Type      CommandType `json:"type"`
@@ -49,17 +76,25 @@ type UserMessageCommand struct {
 // GetType implements Command.
 func (c UserMessageCommand) GetType() CommandType { return CommandUserMessage }
 
+// GetRequestID implements Command.
+func (c UserMessageCommand) GetRequestID() string { return c.RequestID }
+
 // SaveConfigCommand persists user configuration.
 type SaveConfigCommand struct {
-	Type   CommandType       `json:"type"`
-	Config map[string]string `json:"config"`
+	Type      CommandType       `json:"type"`
+	Config    map[string]string `json:"config"`
+	RequestID string            `json:"request_id,omitempty"`
 }
 
 // GetType implements Command.
 func (c SaveConfigCommand) GetType() CommandType { return CommandSaveConfig }
 
+// GetRequestID implements Command.
+func (c SaveConfigCommand) GetRequestID() string { return c.RequestID }
+
 type rawCommand struct {
-	Type CommandType `json:"type"`
+	Type      CommandType `json:"type"`
+	RequestID string      `json:"request_id,omitempty"`
 }
 
 // DecodeCommand converts raw JSON into a strongly typed command.
@@ -70,6 +105,18 @@ func DecodeCommand(data []byte) (Command, error) {
 	}
 
 	switch base.Type {
+	case CommandHello:
+		var cmd HelloCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			return nil, fmt.Errorf("decode hello: %w", err)
+		}
+		if cmd.ProtocolVersion == "" {
+			return nil, errors.New("hello requires protocol_version")
+		}
+		if err := CheckCompatible(cmd.ProtocolVersion); err != nil {
+			return nil, err
+		}
+		return cmd, nil
 	case CommandStartSession:
 		var cmd StartSessionCommand
 		if err := json.Unmarshal(data, &cmd); err != nil {
@@ -130,6 +177,188 @@ func DecodeCommand(data []byte) (Command, error) {
 			return nil, errors.New("project_permission requires session_id")
 		}
 		return cmd, nil
+	case CommandListModels:
+		var cmd ListModelsCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			return nil, fmt.Errorf("decode list_models: %w", err)
+		}
+		return cmd, nil
+	case CommandSwitchProfile:
+		var cmd SwitchProfileCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			return nil, fmt.Errorf("decode switch_profile: %w", err)
+		}
+		if cmd.SessionID == "" {
+			return nil, errors.New("switch_profile requires session_id")
+		}
+		if cmd.Profile == "" {
+			return nil, errors.New("switch_profile requires profile")
+		}
+		return cmd, nil
+	case CommandListProfiles:
+		var cmd ListProfilesCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			return nil, fmt.Errorf("decode list_profiles: %w", err)
+		}
+		return cmd, nil
+	case CommandSubscribe:
+		var cmd SubscribeCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			return nil, fmt.Errorf("decode subscribe: %w", err)
+		}
+		if cmd.SessionID == "" {
+			return nil, errors.New("subscribe requires session_id")
+		}
+		return cmd, nil
+	case CommandUnsubscribe:
+		var cmd UnsubscribeCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			return nil, fmt.Errorf("decode unsubscribe: %w", err)
+		}
+		if cmd.SessionID == "" {
+			return nil, errors.New("unsubscribe requires session_id")
+		}
+		return cmd, nil
+	case CommandListSessions:
+		var cmd ListSessionsCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			return nil, fmt.Errorf("decode list_sessions: %w", err)
+		}
+		if cmd.Offset < 0 || cmd.Limit < 0 {
+			return nil, errors.New("list_sessions requires a non-negative offset and limit")
+		}
+		return cmd, nil
+	case CommandSearchSessions:
+		var cmd SearchSessionsCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			return nil, fmt.Errorf("decode search_sessions: %w", err)
+		}
+		if strings.TrimSpace(cmd.Query) == "" {
+			return nil, errors.New("search_sessions requires query")
+		}
+		if cmd.Limit < 0 {
+			return nil, errors.New("search_sessions requires a non-negative limit")
+		}
+		return cmd, nil
+	case CommandGetSession:
+		var cmd GetSessionCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			return nil, fmt.Errorf("decode get_session: %w", err)
+		}
+		if cmd.SessionID == "" {
+			return nil, errors.New("get_session requires session_id")
+		}
+		return cmd, nil
+	case CommandRenameSession:
+		var cmd RenameSessionCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			return nil, fmt.Errorf("decode rename_session: %w", err)
+		}
+		if cmd.SessionID == "" {
+			return nil, errors.New("rename_session requires session_id")
+		}
+		if strings.TrimSpace(cmd.Title) == "" {
+			return nil, errors.New("rename_session requires title")
+		}
+		return cmd, nil
+	case CommandDeleteSession:
+		var cmd DeleteSessionCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			return nil, fmt.Errorf("decode delete_session: %w", err)
+		}
+		if cmd.SessionID == "" {
+			return nil, errors.New("delete_session requires session_id")
+		}
+		return cmd, nil
+	case CommandArchiveSession:
+		var cmd ArchiveSessionCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			return nil, fmt.Errorf("decode archive_session: %w", err)
+		}
+		if cmd.SessionID == "" {
+			return nil, errors.New("archive_session requires session_id")
+		}
+		return cmd, nil
+	case CommandPinSession:
+		var cmd PinSessionCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			return nil, fmt.Errorf("decode pin_session: %w", err)
+		}
+		if cmd.SessionID == "" {
+			return nil, errors.New("pin_session requires session_id")
+		}
+		return cmd, nil
+	case CommandExportSession:
+		var cmd ExportSessionCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			return nil, fmt.Errorf("decode export_session: %w", err)
+		}
+		if cmd.SessionID == "" {
+			return nil, errors.New("export_session requires session_id")
+		}
+		if cmd.Format == "" {
+			cmd.Format = ExportFormatJSON
+		}
+		switch cmd.Format {
+		case ExportFormatJSON, ExportFormatMarkdown, ExportFormatHTML:
+		default:
+			return nil, fmt.Errorf("export_session: unsupported format %q", cmd.Format)
+		}
+		return cmd, nil
+	case CommandForkSession:
+		var cmd ForkSessionCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			return nil, fmt.Errorf("decode fork_session: %w", err)
+		}
+		if cmd.SessionID == "" {
+			return nil, errors.New("fork_session requires session_id")
+		}
+		if cmd.MessageIndex < 0 {
+			return nil, errors.New("fork_session requires a non-negative message_index")
+		}
+		return cmd, nil
+	case CommandListMemories:
+		var cmd ListMemoriesCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			return nil, fmt.Errorf("decode list_memories: %w", err)
+		}
+		if cmd.Kind != "" && !validMemoryKind(cmd.Kind) {
+			return nil, fmt.Errorf("list_memories: unknown kind %q", cmd.Kind)
+		}
+		if cmd.Limit < 0 {
+			return nil, errors.New("list_memories requires a non-negative limit")
+		}
+		return cmd, nil
+	case CommandSaveMemory:
+		var cmd SaveMemoryCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			return nil, fmt.Errorf("decode save_memory: %w", err)
+		}
+		if !validMemoryKind(cmd.Kind) {
+			return nil, fmt.Errorf("save_memory: unknown kind %q", cmd.Kind)
+		}
+		if strings.TrimSpace(cmd.Content) == "" {
+			return nil, errors.New("save_memory requires content")
+		}
+		return cmd, nil
+	case CommandForgetMemory:
+		var cmd ForgetMemoryCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			return nil, fmt.Errorf("decode forget_memory: %w", err)
+		}
+		if cmd.MemoryID == "" {
+			return nil, errors.New("forget_memory requires memory_id")
+		}
+		return cmd, nil
+	case CommandResync:
+		var cmd ResyncCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			return nil, fmt.Errorf("decode resync: %w", err)
+		}
+		if cmd.SessionID == "" {
+			return nil, errors.New("resync requires session_id")
+		}
+		return cmd, nil
 	default:
 		return nil, fmt.Errorf("unknown command type: %s", base.Type)
 	}
@@ -161,12 +390,32 @@ const (
 	EventCancelled                 EventType = "cancelled"
 	EventSessionHistory            EventType = "session_history"
 	EventProjectPermissionRequired EventType = "project_permission_required"
+	EventModelsListed              EventType = "models_listed"
+	EventProfileSwitched           EventType = "profile_switched"
+	EventProfilesListed            EventType = "profiles_listed"
+	EventWelcome                   EventType = "welcome"
+	EventAck                       EventType = "ack"
+	EventResult                    EventType = "result"
+	EventSubscribed                EventType = "subscribed"
+	EventSessionsListed            EventType = "sessions_listed"
+	EventSessionInfo               EventType = "session_info"
+	EventSessionsFound             EventType = "sessions_found"
+	EventSessionUpdated            EventType = "session_updated"
+	EventSessionDeleted            EventType = "session_deleted"
+	EventSessionExported           EventType = "session_exported"
+	EventSessionForked             EventType = "session_forked"
+	EventMemoriesListed            EventType = "memories_listed"
+	EventMemorySaved               EventType = "memory_saved"
+	EventMemoryForgotten           EventType = "memory_forgotten"
+	EventResynced                  EventType = "resynced"
+	EventMCPServerStatus           EventType = "mcp_server_status"
 )
 
 // Event is implemented by every outgoing message.
 type Event interface {
 	isEvent()
 	GetType() EventType
+	GetSessionID() string
 }
 
 // MarshalEvent serializes an event into JSON for NDJSON transport.
@@ -181,6 +430,9 @@ type eventBase struct {
 
 func (eventBase) isEvent() {}
 
+// GetSessionID returns the session the event belongs to; "" for global events.
+func (b eventBase) GetSessionID() string { return b.SessionID }
+
 // AssistantTextEvent streams assistant text/content back to the CLI.
 type AssistantTextEvent struct {
 	eventBase
@@ -468,21 +720,29 @@ func (e SetupRequiredEvent) GetType() EventType { return e.Type }
 
 // GetConfigCommand requests the current configuration.
 type GetConfigCommand struct {
-	Type CommandType `json:"type"`
+	Type      CommandType `json:"type"`
+	RequestID string      `json:"request_id,omitempty"`
 }
 
 // GetType implements Command.
 func (c GetConfigCommand) GetType() CommandType { return CommandGetConfig }
 
+// GetRequestID implements Command.
+func (c GetConfigCommand) GetRequestID() string { return c.RequestID }
+
 // ReloadConfigCommand triggers a hot-reload of the configuration for an existing session.
 type ReloadConfigCommand struct {
 	Type      CommandType `json:"type"`
 	SessionID string      `json:"session_id"`
+	RequestID string      `json:"request_id,omitempty"`
 }
 
 // GetType implements Command.
 func (c ReloadConfigCommand) GetType() CommandType { return CommandReloadConfig }
 
+// GetRequestID implements Command.
+func (c ReloadConfigCommand) GetRequestID() string { return c.RequestID }
+
 // ConfigLoadedEvent returns the current configuration.
 type ConfigLoadedEvent struct {
 	eventBase
@@ -523,11 +783,15 @@ func (e ConfigReloadedEvent) GetType() EventType { return e.Type }
 type CancelRequestCommand struct {
 	Type      CommandType `json:"type"`
 	SessionID string      `json:"session_id"`
+	RequestID string      `json:"request_id,omitempty"`
 }
 
 // GetType implements Command.
 func (c CancelRequestCommand) GetType() CommandType { return CommandCancelRequest }
 
+// GetRequestID implements Command.
+func (c CancelRequestCommand) GetRequestID() string { return c.RequestID }
+
 // CancelledEvent signals that a task was cancelled by user request.
 type CancelledEvent struct {
 	eventBase
@@ -557,6 +821,11 @@ type SessionHistoryEvent struct {
 	Title    string           `json:"title"`
 	Summary  string           `json:"summary,omitempty"`
 	Messages []HistoryMessage `json:"messages"`
+
+	// Interrupted marks a session whose last run stopped before finishing
+	// because the engine running it exited, with the message it was running.
+	Interrupted        bool   `json:"interrupted,omitempty"`
+	InterruptedMessage string `json:"interrupted_message,omitempty"`
 }
 
 // NewSessionHistoryEvent constructs a session_history event.
@@ -577,11 +846,15 @@ type ProjectPermissionCommand struct {
 	Type            CommandType `json:"type"`
 	SessionID       string      `json:"session_id"`
 	IndexingEnabled bool        `json:"indexing_enabled"`
+	RequestID       string      `json:"request_id,omitempty"`
 }
 
 // GetType implements Command.
 func (c ProjectPermissionCommand) GetType() CommandType { return CommandProjectPermission }
 
+// GetRequestID implements Command.
+func (c ProjectPermissionCommand) GetRequestID() string { return c.RequestID }
+
 // ProjectPermissionRequiredEvent signals that the project needs indexing permission.
 type ProjectPermissionRequiredEvent struct {
 	eventBase
@@ -598,3 +871,182 @@ func NewProjectPermissionRequiredEvent(sessionID, repoRoot string) ProjectPermis
 
 // GetType implements Event.
 func (e ProjectPermissionRequiredEvent) GetType() EventType { return e.Type }
+
+// ListModelsCommand asks for the models offered by the configured providers.
+// Provider limits the query to one provider; Refresh bypasses the cache.
+type ListModelsCommand struct {
+	Type      CommandType `json:"type"`
+	Provider  string      `json:"provider,omitempty"`
+	Refresh   bool        `json:"refresh,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// GetType implements Command.
+func (c ListModelsCommand) GetType() CommandType { return CommandListModels }
+
+// GetRequestID implements Command.
+func (c ListModelsCommand) GetRequestID() string { return c.RequestID }
+
+// ModelInfo describes one model available from a provider.
+// Catalog fields are zero when the model is not in the engine's catalog.
+type ModelInfo struct {
+	ID              string  `json:"id"`
+	Provider        string  `json:"provider"`
+	DisplayName     string  `json:"display_name,omitempty"`
+	ContextWindow   int     `json:"context_window,omitempty"`
+	MaxOutputTokens int     `json:"max_output_tokens,omitempty"`
+	InputCostPer1M  float64 `json:"input_cost_per_1m,omitempty"`
+	OutputCostPer1M float64 `json:"output_cost_per_1m,omitempty"`
+	Current         bool    `json:"current,omitempty"` // configured model for the active provider
+}
+
+// ProviderError reports a provider that could not be queried.
+type ProviderError struct {
+	Provider string `json:"provider"`
+	Message  string `json:"message"`
+}
+
+// ModelsListedEvent answers list_models.
+type ModelsListedEvent struct {
+	eventBase
+	Models []ModelInfo     `json:"models"`
+	Errors []ProviderError `json:"errors,omitempty"`
+}
+
+// NewModelsListedEvent constructs a models_listed event.
+func NewModelsListedEvent(models []ModelInfo, errs []ProviderError) ModelsListedEvent {
+	return ModelsListedEvent{
+		eventBase: eventBase{Type: EventModelsListed},
+		Models:    models,
+		Errors:    errs,
+	}
+}
+
+// GetType implements Event.
+func (e ModelsListedEvent) GetType() EventType { return e.Type }
+
+// SwitchProfileCommand swaps a running session to a named provider profile.
+// The conversation history is kept.
+type SwitchProfileCommand struct {
+	Type      CommandType `json:"type"`
+	SessionID string      `json:"session_id"`
+	Profile   string      `json:"profile"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// GetType implements Command.
+func (c SwitchProfileCommand) GetType() CommandType { return CommandSwitchProfile }
+
+// GetRequestID implements Command.
+func (c SwitchProfileCommand) GetRequestID() string { return c.RequestID }
+
+// ProfileSwitchedEvent confirms switch_profile.
+type ProfileSwitchedEvent struct {
+	eventBase
+	Profile   string `json:"profile"`
+	Provider  string `json:"provider"`
+	ModelName string `json:"model_name"`
+}
+
+// NewProfileSwitchedEvent constructs a profile_switched event.
+func NewProfileSwitchedEvent(sessionID, profile, provider, modelName string) ProfileSwitchedEvent {
+	return ProfileSwitchedEvent{
+		eventBase: eventBase{Type: EventProfileSwitched, SessionID: sessionID},
+		Profile:   profile,
+		Provider:  provider,
+		ModelName: modelName,
+	}
+}
+
+// GetType implements Event.
+func (e ProfileSwitchedEvent) GetType() EventType { return e.Type }
+
+// ListProfilesCommand asks for the configured provider profiles. With a
+// session ID, the profile that session uses is marked active.
+type ListProfilesCommand struct {
+	Type      CommandType `json:"type"`
+	SessionID string      `json:"session_id,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// GetType implements Command.
+func (c ListProfilesCommand) GetType() CommandType { return CommandListProfiles }
+
+// GetRequestID implements Command.
+func (c ListProfilesCommand) GetRequestID() string { return c.RequestID }
+
+// ProfileInfo describes one provider profile. API keys are never included.
+type ProfileInfo struct {
+	Name            string  `json:"name"`
+	Provider        string  `json:"provider"`
+	Model           string  `json:"model,omitempty"`
+	BaseURL         string  `json:"base_url,omitempty"`
+	Temperature     float64 `json:"temperature,omitempty"`
+	MaxOutputTokens int     `json:"max_output_tokens,omitempty"`
+	Scope           string  `json:"scope"` // user or project
+	Active          bool    `json:"active,omitempty"`
+}
+
+// ProfilesListedEvent answers list_profiles.
+type ProfilesListedEvent struct {
+	eventBase
+	Profiles []ProfileInfo `json:"profiles"`
+}
+
+// NewProfilesListedEvent constructs a profiles_listed event.
+func NewProfilesListedEvent(sessionID string, profiles []ProfileInfo) ProfilesListedEvent {
+	return ProfilesListedEvent{
+		eventBase: eventBase{Type: EventProfilesListed, SessionID: sessionID},
+		Profiles:  profiles,
+	}
+}
+
+// GetType implements Event.
+func (e ProfilesListedEvent) GetType() EventType { return e.Type }
+
+// SubscribeCommand attaches the client to a live session's events, e.g.
+// after reconnecting to an engine started with --listen. Sending any command
+// that names a session subscribes to it as well.
+type SubscribeCommand struct {
+	Type      CommandType `json:"type"`
+	SessionID string      `json:"session_id"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// GetType implements Command.
+func (c SubscribeCommand) GetType() CommandType { return CommandSubscribe }
+
+// GetRequestID implements Command.
+func (c SubscribeCommand) GetRequestID() string { return c.RequestID }
+
+// UnsubscribeCommand stops the client receiving a session's events.
+type UnsubscribeCommand struct {
+	Type      CommandType `json:"type"`
+	SessionID string      `json:"session_id"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// GetType implements Command.
+func (c UnsubscribeCommand) GetType() CommandType { return CommandUnsubscribe }
+
+// GetRequestID implements Command.
+func (c UnsubscribeCommand) GetRequestID() string { return c.RequestID }
+
+// SubscribedEvent answers subscribe with the session's current state.
+type SubscribedEvent struct {
+	eventBase
+	Title   string `json:"title"`
+	Running bool   `json:"running"` // a user_message is being processed
+}
+
+// NewSubscribedEvent constructs a subscribed event.
+func NewSubscribedEvent(sessionID, title string, running bool) SubscribedEvent {
+	return SubscribedEvent{
+		eventBase: eventBase{Type: EventSubscribed, SessionID: sessionID},
+		Title:     title,
+		Running:   running,
+	}
+}
+
+// GetType implements Event.
+func (e SubscribedEvent) GetType() EventType { return e.Type }
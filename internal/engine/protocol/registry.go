@@ -0,0 +1,150 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// commandPrototypes maps every command type to its Go type. A new command
+// must be added here as well as to DecodeCommand.
+var commandPrototypes = map[CommandType]Command{
+	CommandHello:             HelloCommand{},
+	CommandStartSession:      StartSessionCommand{},
+	CommandUserMessage:       UserMessageCommand{},
+	CommandSaveConfig:        SaveConfigCommand{},
+	CommandGetConfig:         GetConfigCommand{},
+	CommandReloadConfig:      ReloadConfigCommand{},
+	CommandCancelRequest:     CancelRequestCommand{},
+	CommandProjectPermission: ProjectPermissionCommand{},
+	CommandListModels:        ListModelsCommand{},
+	CommandSwitchProfile:     SwitchProfileCommand{},
+	CommandListProfiles:      ListProfilesCommand{},
+	CommandSubscribe:         SubscribeCommand{},
+	CommandUnsubscribe:       UnsubscribeCommand{},
+	CommandListSessions:      ListSessionsCommand{},
+	CommandGetSession:        GetSessionCommand{},
+	CommandSearchSessions:    SearchSessionsCommand{},
+	CommandRenameSession:     RenameSessionCommand{},
+	CommandDeleteSession:     DeleteSessionCommand{},
+	CommandArchiveSession:    ArchiveSessionCommand{},
+	CommandPinSession:        PinSessionCommand{},
+	CommandExportSession:     ExportSessionCommand{},
+	CommandForkSession:       ForkSessionCommand{},
+	CommandListMemories:      ListMemoriesCommand{},
+	CommandSaveMemory:        SaveMemoryCommand{},
+	CommandForgetMemory:      ForgetMemoryCommand{},
+	CommandResync:            ResyncCommand{},
+}
+
+// commandRequired lists the fields DecodeCommand insists on, besides type.
+var commandRequired = map[CommandType][]string{
+	CommandHello:             {"protocol_version"},
+	CommandUserMessage:       {"session_id", "message"},
+	CommandReloadConfig:      {"session_id"},
+	CommandCancelRequest:     {"session_id"},
+	CommandSwitchProfile:     {"session_id", "profile"},
+	CommandSubscribe:         {"session_id"},
+	CommandUnsubscribe:       {"session_id"},
+	CommandGetSession:        {"session_id"},
+	CommandSearchSessions:    {"query"},
+	CommandRenameSession:     {"session_id", "title"},
+	CommandDeleteSession:     {"session_id"},
+	CommandArchiveSession:    {"session_id"},
+	CommandPinSession:        {"session_id"},
+	CommandExportSession:     {"session_id"},
+	CommandForkSession:       {"session_id", "message_index"},
+	CommandSaveMemory:        {"kind", "content"},
+	CommandForgetMemory:      {"memory_id"},
+	CommandProjectPermission: {"session_id"},
+	CommandResync:            {"session_id"},
+}
+
+// eventPrototypes maps every event type to its Go type.
+var eventPrototypes = map[EventType]Event{
+	EventAssistantText:             AssistantTextEvent{},
+	EventStatus:                    StatusEvent{},
+	EventTool:                      ToolEvent{},
+	EventFilesChanged:              FilesChangedEvent{},
+	EventDone:                      DoneEvent{},
+	EventError:                     ErrorEvent{},
+	EventActivity:                  ActivityEvent{},
+	EventTokenUsage:                TokenUsageEvent{},
+	EventProjectPlan:               ProjectPlanEvent{},
+	EventToolOutput:                ToolOutputEvent{},
+	EventContext:                   ContextEvent{},
+	EventSetupRequired:             SetupRequiredEvent{},
+	EventConfigLoaded:              ConfigLoadedEvent{},
+	EventConfigReloaded:            ConfigReloadedEvent{},
+	EventCancelled:                 CancelledEvent{},
+	EventSessionHistory:            SessionHistoryEvent{},
+	EventProjectPermissionRequired: ProjectPermissionRequiredEvent{},
+	EventModelsListed:              ModelsListedEvent{},
+	EventProfileSwitched:           ProfileSwitchedEvent{},
+	EventProfilesListed:            ProfilesListedEvent{},
+	EventWelcome:                   WelcomeEvent{},
+	EventAck:                       AckEvent{},
+	EventResult:                    ResultEvent{},
+	EventSubscribed:                SubscribedEvent{},
+	EventSessionsListed:            SessionsListedEvent{},
+	EventSessionInfo:               SessionInfoEvent{},
+	EventSessionsFound:             SessionsFoundEvent{},
+	EventSessionUpdated:            SessionUpdatedEvent{},
+	EventSessionDeleted:            SessionDeletedEvent{},
+	EventSessionExported:           SessionExportedEvent{},
+	EventSessionForked:             SessionForkedEvent{},
+	EventMemoriesListed:            MemoriesListedEvent{},
+	EventMemorySaved:               MemorySavedEvent{},
+	EventMemoryForgotten:           MemoryForgottenEvent{},
+	EventResynced:                  ResyncedEvent{},
+	EventMCPServerStatus:           MCPServerStatusEvent{},
+}
+
+// CommandTypes returns every command type, sorted.
+func CommandTypes() []CommandType {
+	out := make([]CommandType, 0, len(commandPrototypes))
+	for t := range commandPrototypes {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// EventTypes returns every event type, sorted.
+func EventTypes() []EventType {
+	out := make([]EventType, 0, len(eventPrototypes))
+	for t := range eventPrototypes {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// Tags are the fields the engine adds to an event when it is sent.
+type Tags struct {
+	RequestID string `json:"request_id,omitempty"` // of the command that caused it
+	Seq       uint64 `json:"seq,omitempty"`        // position in its session's event stream
+}
+
+// DecodeEvent converts one NDJSON line from the engine into a typed event
+// and the tags it was sent with. Clients use it to read the engine's
+// output.
+func DecodeEvent(data []byte) (Event, Tags, error) {
+	var base struct {
+		Type EventType `json:"type"`
+		Tags
+	}
+	if err := json.Unmarshal(data, &base); err != nil {
+		return nil, Tags{}, fmt.Errorf("decode event: %w", err)
+	}
+	proto, ok := eventPrototypes[base.Type]
+	if !ok {
+		return nil, base.Tags, fmt.Errorf("unknown event type: %s", base.Type)
+	}
+	ptr := reflect.New(reflect.TypeOf(proto))
+	if err := json.Unmarshal(data, ptr.Interface()); err != nil {
+		return nil, base.Tags, fmt.Errorf("decode %s: %w", base.Type, err)
+	}
+	return ptr.Elem().Interface().(Event), base.Tags, nil
+}
@@ -0,0 +1,139 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// PeekCommand returns the type and request_id of a raw command line, even
+// when the command itself doesn't decode, so the failure can still be
+// answered.
+func PeekCommand(data []byte) (CommandType, string) {
+	var base rawCommand
+	_ = json.Unmarshal(data, &base)
+	return base.Type, base.RequestID
+}
+
+// CommandError is the structured failure reported in a result event.
+// Kind matches the kind of the error event emitted alongside it.
+type CommandError struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+	Details string `json:"details,omitempty"`
+}
+
+func (e *CommandError) Error() string { return e.Message }
+
+// AckEvent confirms that a command with a request_id was accepted and is
+// being handled.
+type AckEvent struct {
+	eventBase
+	RequestID string      `json:"request_id"`
+	Command   CommandType `json:"command"`
+}
+
+// NewAckEvent constructs an ack event.
+func NewAckEvent(sessionID, requestID string, command CommandType) AckEvent {
+	return AckEvent{
+		eventBase: eventBase{Type: EventAck, SessionID: sessionID},
+		RequestID: requestID,
+		Command:   command,
+	}
+}
+
+// GetType implements Event.
+func (e AckEvent) GetType() EventType { return e.Type }
+
+// ResultEvent reports how a command with a request_id finished. For
+// user_message it follows the run's last event.
+type ResultEvent struct {
+	eventBase
+	RequestID string        `json:"request_id"`
+	Command   CommandType   `json:"command,omitempty"` // empty when the command didn't decode
+	OK        bool          `json:"ok"`
+	Error     *CommandError `json:"error,omitempty"`
+}
+
+// NewResultEvent constructs a result event; err nil means success.
+func NewResultEvent(sessionID, requestID string, command CommandType, err *CommandError) ResultEvent {
+	return ResultEvent{
+		eventBase: eventBase{Type: EventResult, SessionID: sessionID},
+		RequestID: requestID,
+		Command:   command,
+		OK:        err == nil,
+		Error:     err,
+	}
+}
+
+// GetType implements Event.
+func (e ResultEvent) GetType() EventType { return e.Type }
+
+// WithRequestID tags e with the request that caused it. The ID is added as
+// a request_id field when the event is marshaled.
+func WithRequestID(e Event, requestID string) Event {
+	switch e.(type) {
+	case AckEvent, ResultEvent:
+		return e
+	}
+	if requestID == "" {
+		return e
+	}
+	t := tag(e)
+	if t.requestID == "" {
+		t.requestID = requestID
+	}
+	return t
+}
+
+// WithSeq tags e with its position in its session's event stream. The
+// number is added as a seq field when the event is marshaled.
+func WithSeq(e Event, seq uint64) Event {
+	t := tag(e)
+	t.seq = seq
+	return t
+}
+
+// Untag returns the event e was tagged from.
+func Untag(e Event) Event {
+	if t, ok := e.(correlatedEvent); ok {
+		return t.Event
+	}
+	return e
+}
+
+func tag(e Event) correlatedEvent {
+	if t, ok := e.(correlatedEvent); ok {
+		return t
+	}
+	return correlatedEvent{Event: e}
+}
+
+// correlatedEvent is an event tagged with a request ID and/or a sequence
+// number.
+type correlatedEvent struct {
+	Event
+	requestID string
+	seq       uint64
+}
+
+func (e correlatedEvent) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(e.Event)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 2 || data[len(data)-1] != '}' {
+		return nil, fmt.Errorf("tag %s event: not a JSON object", e.GetType())
+	}
+	out := data[: len(data)-1 : len(data)-1]
+	if e.requestID != "" {
+		id, _ := json.Marshal(e.requestID)
+		out = append(out, `,"request_id":`...)
+		out = append(out, id...)
+	}
+	if e.seq != 0 {
+		out = append(out, `,"seq":`...)
+		out = strconv.AppendUint(out, e.seq, 10)
+	}
+	return append(out, '}'), nil
+}
@@ -0,0 +1,93 @@
+package protocol
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCommandsCarryRequestID(t *testing.T) {
+	lines := []string{
+		`{"type":"save_config","config":{},"request_id":"r1"}`,
+		`{"type":"reload_config","session_id":"s","request_id":"r1"}`,
+		`{"type":"project_permission","session_id":"s","indexing_enabled":true,"request_id":"r1"}`,
+		`{"type":"user_message","session_id":"s","message":"hi","request_id":"r1"}`,
+		`{"type":"hello","protocol_version":"1.0.0","request_id":"r1"}`,
+	}
+	for _, line := range lines {
+		cmd, err := DecodeCommand([]byte(line))
+		if err != nil {
+			t.Fatalf("DecodeCommand(%s) error = %v", line, err)
+		}
+		if got := cmd.GetRequestID(); got != "r1" {
+			t.Errorf("%s: GetRequestID() = %q, want r1", cmd.GetType(), got)
+		}
+	}
+
+	bad := []byte(`{"type":"user_message","request_id":"r2"}`)
+	if _, err := DecodeCommand(bad); err == nil {
+		t.Fatal("DecodeCommand accepted a user_message without session_id")
+	}
+	if typ, id := PeekCommand(bad); typ != CommandUserMessage || id != "r2" {
+		t.Errorf("PeekCommand() = %q, %q; want user_message, r2", typ, id)
+	}
+}
+
+func TestWithRequestID(t *testing.T) {
+	tagged := WithRequestID(NewStatusEvent("s1", "thinking", ""), "r1")
+	if tagged.GetType() != EventStatus {
+		t.Errorf("GetType() = %q, want status", tagged.GetType())
+	}
+	data, err := MarshalEvent(tagged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["request_id"] != "r1" || got["status"] != "thinking" || got["session_id"] != "s1" {
+		t.Errorf("tagged event = %s", data)
+	}
+
+	if ev := WithRequestID(NewStatusEvent("", "x", ""), ""); ev.GetType() != EventStatus {
+		t.Errorf("untagged event changed type")
+	}
+	if _, ok := WithRequestID(tagged, "r2").(correlatedEvent); !ok {
+		t.Error("retagging wrapped the event twice")
+	}
+}
+
+func TestWithSeq(t *testing.T) {
+	ev := WithSeq(WithRequestID(NewStatusEvent("s1", "thinking", ""), "r1"), 42)
+	data, err := MarshalEvent(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"type":"status","session_id":"s1","status":"thinking","request_id":"r1","seq":42}`
+	if string(data) != want {
+		t.Errorf("tagged event = %s\nwant %s", data, want)
+	}
+	if _, ok := Untag(ev).(StatusEvent); !ok {
+		t.Errorf("Untag() = %T, want StatusEvent", Untag(ev))
+	}
+
+	decoded, tags, err := DecodeEvent(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags != (Tags{RequestID: "r1", Seq: 42}) || decoded.GetType() != EventStatus {
+		t.Errorf("DecodeEvent() = %v, %+v", decoded, tags)
+	}
+}
+
+func TestResultEvent(t *testing.T) {
+	data, err := MarshalEvent(NewResultEvent("", "r1", CommandSaveConfig,
+		&CommandError{Kind: "config_save_error", Message: "disk full"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"type":"result","request_id":"r1","command":"save_config","ok":false,"error":{"kind":"config_save_error","message":"disk full"}}`
+	if string(data) != want {
+		t.Errorf("result = %s\nwant %s", data, want)
+	}
+}
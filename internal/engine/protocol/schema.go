@@ -0,0 +1,153 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Schema returns the JSON Schema (draft-07) of the protocol. It is
+// generated from the Go types of every command and event: definitions
+// hold one schema per type, and the Command and Event definitions accept
+// any one of them. testdata/protocol.schema.json holds the checked-in copy.
+func Schema() ([]byte, error) {
+	g := &schemaGen{defs: map[string]any{}}
+
+	var commands []any
+	for _, t := range CommandTypes() {
+		name := g.object(reflect.TypeOf(commandPrototypes[t]), string(t), commandRequired[t], false)
+		commands = append(commands, ref(name))
+	}
+	var events []any
+	for _, t := range EventTypes() {
+		name := g.object(reflect.TypeOf(eventPrototypes[t]), string(t), nil, true)
+		events = append(events, ref(name))
+	}
+	g.defs["Command"] = map[string]any{"oneOf": commands}
+	g.defs["Event"] = map[string]any{"oneOf": events}
+
+	return json.MarshalIndent(map[string]any{
+		"$schema":     "http://json-schema.org/draft-07/schema#",
+		"title":       "dodo engine protocol " + ProtocolVersion,
+		"description": "One NDJSON line: a Command sent to the engine or an Event it emits",
+		"oneOf":       []any{ref("Command"), ref("Event")},
+		"definitions": g.defs,
+	}, "", "  ")
+}
+
+type schemaGen struct {
+	defs map[string]any
+}
+
+func ref(name string) map[string]any {
+	return map[string]any{"$ref": "#/definitions/" + name}
+}
+
+// object adds the schema of struct type t to the definitions and returns
+// its name. For a command or event, typeName pins the "type" property. In
+// what the engine writes (fromEngine), every field without omitempty is
+// required; commands require type and the fields listed in required.
+func (g *schemaGen) object(t reflect.Type, typeName string, required []string, fromEngine bool) string {
+	name := t.Name()
+	if _, done := g.defs[name]; done {
+		return name
+	}
+	g.defs[name] = nil // reserve against recursion
+
+	props := map[string]any{}
+	var req []string
+	g.fields(t, props, &req)
+	if typeName != "" {
+		props["type"] = map[string]any{"const": typeName}
+		if fromEngine {
+			// Tags the engine adds when sending an event.
+			props["request_id"] = map[string]any{"type": "string"}
+			props["seq"] = map[string]any{"type": "integer", "minimum": 1}
+		}
+	}
+	if !fromEngine {
+		req = append([]string(nil), required...)
+		if typeName != "" {
+			req = append(req, "type")
+		}
+	}
+	slices.Sort(req)
+	req = slices.Compact(req)
+
+	s := map[string]any{"type": "object", "properties": props}
+	if len(req) > 0 {
+		s["required"] = req
+	}
+	g.defs[name] = s
+	return name
+}
+
+// fields adds the JSON properties of struct t, flattening embedded structs.
+func (g *schemaGen) fields(t reflect.Type, props map[string]any, req *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			g.fields(f.Type, props, req)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		omitempty := strings.Contains(opts, "omitempty")
+		props[name] = g.schema(f.Type, !omitempty)
+		if !omitempty {
+			*req = append(*req, name)
+		}
+	}
+}
+
+// schema returns the schema of a field of type t. nullable marks slices and
+// maps that marshal as null when nil.
+func (g *schemaGen) schema(t reflect.Type, nullable bool) map[string]any {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	if t == reflect.TypeOf(json.RawMessage{}) {
+		return map[string]any{}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schema(t.Elem(), false)
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": nullableType("array", nullable), "items": g.schema(t.Elem(), false)}
+	case reflect.Map:
+		return map[string]any{"type": nullableType("object", nullable), "additionalProperties": g.schema(t.Elem(), false)}
+	case reflect.Struct:
+		return ref(g.object(t, "", nil, true))
+	case reflect.Interface:
+		return map[string]any{}
+	}
+	panic(fmt.Sprintf("protocol schema: unsupported field type %s", t))
+}
+
+func nullableType(typ string, nullable bool) any {
+	if nullable {
+		return []string{typ, "null"}
+	}
+	return typ
+}
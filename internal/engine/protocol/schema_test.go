@@ -0,0 +1,121 @@
+package protocol
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/protocol.schema.json")
+
+// TestSchemaGolden fails when a command or event changes shape without the
+// checked-in schema being regenerated with
+//
+//	go test ./internal/engine/protocol -run TestSchemaGolden -update
+func TestSchemaGolden(t *testing.T) {
+	got, err := Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
+	path := filepath.Join("testdata", "protocol.schema.json")
+	if *update {
+		// The schema's title carries the version, so a change can only be
+		// checked in along with a bump.
+		old, err := os.ReadFile(path)
+		if err == nil && !bytes.Equal(old, got) && bytes.Contains(old, []byte(`"dodo engine protocol `+ProtocolVersion+`"`)) {
+			t.Fatalf("protocol schema changed but ProtocolVersion is still %s; bump it first", ProtocolVersion)
+		}
+		if err := os.MkdirAll("testdata", 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("protocol schema drifted from %s; if the change is intended, bump ProtocolVersion and rerun with -update", path)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	for typ, cmd := range commandPrototypes {
+		if cmd.GetType() != typ {
+			t.Errorf("commandPrototypes[%s] is a %s command", typ, cmd.GetType())
+		}
+		_, err := DecodeCommand([]byte(`{"type":"` + string(typ) + `"}`))
+		if err != nil && strings.Contains(err.Error(), "unknown command type") {
+			t.Errorf("DecodeCommand does not handle %s", typ)
+		}
+		if (err != nil) != (len(commandRequired[typ]) > 0) {
+			t.Errorf("%s: decoding without fields gave %v, but commandRequired lists %v", typ, err, commandRequired[typ])
+		}
+	}
+	for typ := range eventPrototypes {
+		ev, _, err := DecodeEvent([]byte(`{"type":"` + string(typ) + `"}`))
+		if err != nil || ev.GetType() != typ {
+			t.Errorf("DecodeEvent(%s) = %v, %v", typ, ev, err)
+		}
+	}
+}
+
+func TestSchemaValidatesMessages(t *testing.T) {
+	doc, err := Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(doc))
+	if err != nil {
+		t.Fatalf("schema does not compile: %v", err)
+	}
+
+	var lines []string
+	for _, ev := range []Event{
+		NewWelcomeEvent([]string{CapabilityStreaming}),
+		NewStatusEvent("s1", "thinking", ""),
+		WithRequestID(NewErrorEvent("s1", "boom", "engine_error", ""), "r1"),
+		NewResultEvent("", "r1", CommandSaveConfig, &CommandError{Kind: "config_save_error", Message: "disk full"}),
+		NewSessionsListedEvent([]SessionInfo{{ID: "s1", Title: "t"}}, 1, 0),
+	} {
+		data, err := MarshalEvent(ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, string(data))
+	}
+	lines = append(lines,
+		`{"type":"hello","protocol_version":"1.0.0","capabilities":["streaming"]}`,
+		`{"type":"user_message","session_id":"s1","message":"hi","request_id":"r1"}`,
+	)
+	for _, line := range lines {
+		result, err := schema.Validate(gojsonschema.NewStringLoader(line))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Valid() {
+			t.Errorf("%s does not match the schema: %v", line, result.Errors())
+		}
+	}
+
+	for _, line := range []string{
+		`{"type":"user_message","session_id":"s1"}`,
+		`{"type":"no_such_thing"}`,
+	} {
+		result, err := schema.Validate(gojsonschema.NewStringLoader(line))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Valid() {
+			t.Errorf("schema accepted %s", line)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package protocol
+
+import "time"
+
+// Formats of export_session.
+const (
+	ExportFormatJSON     = "json" // the JSON document the engine stores
+	ExportFormatMarkdown = "md"   // a transcript for reading, e.g. in a review
+	ExportFormatHTML     = "html" // the same as a standalone page
+)
+
+// ListSessionsCommand asks for a page of a repository's stored sessions,
+// most recently updated first.
+type ListSessionsCommand struct {
+	Type            CommandType `json:"type"`
+	RepoRoot        string      `json:"repo_root,omitempty"` // defaults to the engine's repository
+	Offset          int         `json:"offset,omitempty"`
+	Limit           int         `json:"limit,omitempty"` // 0 means every session
+	IncludeArchived bool        `json:"include_archived,omitempty"`
+	RequestID       string      `json:"request_id,omitempty"`
+}
+
+// GetType implements Command.
+func (c ListSessionsCommand) GetType() CommandType { return CommandListSessions }
+
+// GetRequestID implements Command.
+func (c ListSessionsCommand) GetRequestID() string { return c.RequestID }
+
+// SearchSessionsCommand asks for a repository's stored sessions whose
+// title, summary or messages contain any word of query, best match first.
+type SearchSessionsCommand struct {
+	Type            CommandType `json:"type"`
+	Query           string      `json:"query"`
+	RepoRoot        string      `json:"repo_root,omitempty"`
+	Limit           int         `json:"limit,omitempty"` // 0 means every match
+	IncludeArchived bool        `json:"include_archived,omitempty"`
+	RequestID       string      `json:"request_id,omitempty"`
+}
+
+// GetType implements Command.
+func (c SearchSessionsCommand) GetType() CommandType { return CommandSearchSessions }
+
+// GetRequestID implements Command.
+func (c SearchSessionsCommand) GetRequestID() string { return c.RequestID }
+
+// GetSessionCommand asks for one session's metadata and, optionally, its
+// conversation.
+type GetSessionCommand struct {
+	Type            CommandType `json:"type"`
+	SessionID       string      `json:"session_id"`
+	RepoRoot        string      `json:"repo_root,omitempty"`
+	IncludeMessages bool        `json:"include_messages,omitempty"`
+	RequestID       string      `json:"request_id,omitempty"`
+}
+
+// GetType implements Command.
+func (c GetSessionCommand) GetType() CommandType { return CommandGetSession }
+
+// GetRequestID implements Command.
+func (c GetSessionCommand) GetRequestID() string { return c.RequestID }
+
+// RenameSessionCommand changes a session's title.
+type RenameSessionCommand struct {
+	Type      CommandType `json:"type"`
+	SessionID string      `json:"session_id"`
+	RepoRoot  string      `json:"repo_root,omitempty"`
+	Title     string      `json:"title"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// GetType implements Command.
+func (c RenameSessionCommand) GetType() CommandType { return CommandRenameSession }
+
+// GetRequestID implements Command.
+func (c RenameSessionCommand) GetRequestID() string { return c.RequestID }
+
+// DeleteSessionCommand removes a stored session. Sessions with a
+// user_message in progress cannot be deleted.
+type DeleteSessionCommand struct {
+	Type      CommandType `json:"type"`
+	SessionID string      `json:"session_id"`
+	RepoRoot  string      `json:"repo_root,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// GetType implements Command.
+func (c DeleteSessionCommand) GetType() CommandType { return CommandDeleteSession }
+
+// GetRequestID implements Command.
+func (c DeleteSessionCommand) GetRequestID() string { return c.RequestID }
+
+// ArchiveSessionCommand hides a session from list_sessions, or with
+// restore brings it back.
+type ArchiveSessionCommand struct {
+	Type      CommandType `json:"type"`
+	SessionID string      `json:"session_id"`
+	RepoRoot  string      `json:"repo_root,omitempty"`
+	Restore   bool        `json:"restore,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// GetType implements Command.
+func (c ArchiveSessionCommand) GetType() CommandType { return CommandArchiveSession }
+
+// GetRequestID implements Command.
+func (c ArchiveSessionCommand) GetRequestID() string { return c.RequestID }
+
+// PinSessionCommand exempts a session from garbage collection, or with
+// Unpin makes it collectable again.
+type PinSessionCommand struct {
+	Type      CommandType `json:"type"`
+	SessionID string      `json:"session_id"`
+	RepoRoot  string      `json:"repo_root,omitempty"`
+	Unpin     bool        `json:"unpin,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// GetType implements Command.
+func (c PinSessionCommand) GetType() CommandType { return CommandPinSession }
+
+// GetRequestID implements Command.
+func (c PinSessionCommand) GetRequestID() string { return c.RequestID }
+
+// ExportSessionCommand asks for a session's full transcript.
+type ExportSessionCommand struct {
+	Type      CommandType `json:"type"`
+	SessionID string      `json:"session_id"`
+	RepoRoot  string      `json:"repo_root,omitempty"`
+	Format    string      `json:"format,omitempty"` // json (default), md or html
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// GetType implements Command.
+func (c ExportSessionCommand) GetType() CommandType { return CommandExportSession }
+
+// GetRequestID implements Command.
+func (c ExportSessionCommand) GetRequestID() string { return c.RequestID }
+
+// ForkSessionCommand starts a new stored session from the first
+// message_index messages of another's conversation, counted as get_session
+// lists them, so that forking at a user message retries it. With
+// restore_files, files the session changed from that message on are put
+// back as they were.
+type ForkSessionCommand struct {
+	Type         CommandType `json:"type"`
+	SessionID    string      `json:"session_id"`
+	RepoRoot     string      `json:"repo_root,omitempty"`
+	MessageIndex int         `json:"message_index"`
+	RestoreFiles bool        `json:"restore_files,omitempty"`
+	RequestID    string      `json:"request_id,omitempty"`
+}
+
+// GetType implements Command.
+func (c ForkSessionCommand) GetType() CommandType { return CommandForkSession }
+
+// GetRequestID implements Command.
+func (c ForkSessionCommand) GetRequestID() string { return c.RequestID }
+
+// SessionInfo describes a stored session.
+type SessionInfo struct {
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	Summary      string    `json:"summary,omitempty"`
+	MessageCount int       `json:"message_count"`
+	TokensUsed   int       `json:"tokens_used"`
+	FilesTouched []string  `json:"files_touched,omitempty"`
+	Archived     bool      `json:"archived,omitempty"`
+	Pinned       bool      `json:"pinned,omitempty"`    // exempt from garbage collection
+	ParentID     string    `json:"parent_id,omitempty"` // the session this one was forked from
+	Live         bool      `json:"live,omitempty"`      // loaded in this engine
+	Running      bool      `json:"running,omitempty"`   // a user_message is being processed
+}
+
+// SessionsListedEvent answers list_sessions.
+type SessionsListedEvent struct {
+	eventBase
+	Sessions   []SessionInfo `json:"sessions"`
+	Total      int           `json:"total"`                 // sessions matching, across all pages
+	NextOffset int           `json:"next_offset,omitempty"` // absent on the last page
+}
+
+// NewSessionsListedEvent constructs a sessions_listed event.
+func NewSessionsListedEvent(sessions []SessionInfo, total, nextOffset int) SessionsListedEvent {
+	return SessionsListedEvent{
+		eventBase:  eventBase{Type: EventSessionsListed},
+		Sessions:   sessions,
+		Total:      total,
+		NextOffset: nextOffset,
+	}
+}
+
+// GetType implements Event.
+func (e SessionsListedEvent) GetType() EventType { return e.Type }
+
+// SessionSearchResult is a session matching search_sessions.
+type SessionSearchResult struct {
+	Session      SessionInfo `json:"session"`
+	Snippet      string      `json:"snippet"`                 // the best matching text, its matching words marked with ** **
+	MessageIndex *int        `json:"message_index,omitempty"` // of the matching message, as get_session lists them; absent when the title or summary matched
+}
+
+// SessionsFoundEvent answers search_sessions.
+type SessionsFoundEvent struct {
+	eventBase
+	Query   string                `json:"query"`
+	Results []SessionSearchResult `json:"results"`
+}
+
+// NewSessionsFoundEvent constructs a sessions_found event.
+func NewSessionsFoundEvent(query string, results []SessionSearchResult) SessionsFoundEvent {
+	return SessionsFoundEvent{
+		eventBase: eventBase{Type: EventSessionsFound},
+		Query:     query,
+		Results:   results,
+	}
+}
+
+// GetType implements Event.
+func (e SessionsFoundEvent) GetType() EventType { return e.Type }
+
+// SessionInfoEvent answers get_session.
+type SessionInfoEvent struct {
+	eventBase
+	Session  SessionInfo      `json:"session"`
+	Messages []HistoryMessage `json:"messages,omitempty"` // with include_messages
+}
+
+// NewSessionInfoEvent constructs a session_info event.
+func NewSessionInfoEvent(info SessionInfo, messages []HistoryMessage) SessionInfoEvent {
+	return SessionInfoEvent{
+		eventBase: eventBase{Type: EventSessionInfo, SessionID: info.ID},
+		Session:   info,
+		Messages:  messages,
+	}
+}
+
+// GetType implements Event.
+func (e SessionInfoEvent) GetType() EventType { return e.Type }
+
+// SessionUpdatedEvent answers rename_session, archive_session and
+// pin_session with the session's new metadata.
+type SessionUpdatedEvent struct {
+	eventBase
+	Session SessionInfo `json:"session"`
+}
+
+// NewSessionUpdatedEvent constructs a session_updated event.
+func NewSessionUpdatedEvent(info SessionInfo) SessionUpdatedEvent {
+	return SessionUpdatedEvent{
+		eventBase: eventBase{Type: EventSessionUpdated, SessionID: info.ID},
+		Session:   info,
+	}
+}
+
+// GetType implements Event.
+func (e SessionUpdatedEvent) GetType() EventType { return e.Type }
+
+// SessionDeletedEvent confirms delete_session.
+type SessionDeletedEvent struct {
+	eventBase
+}
+
+// NewSessionDeletedEvent constructs a session_deleted event.
+func NewSessionDeletedEvent(sessionID string) SessionDeletedEvent {
+	return SessionDeletedEvent{eventBase: eventBase{Type: EventSessionDeleted, SessionID: sessionID}}
+}
+
+// GetType implements Event.
+func (e SessionDeletedEvent) GetType() EventType { return e.Type }
+
+// SessionExportedEvent answers export_session.
+type SessionExportedEvent struct {
+	eventBase
+	Format  string `json:"format"`
+	Content string `json:"content"`
+}
+
+// NewSessionExportedEvent constructs a session_exported event.
+func NewSessionExportedEvent(sessionID, format, content string) SessionExportedEvent {
+	return SessionExportedEvent{
+		eventBase: eventBase{Type: EventSessionExported, SessionID: sessionID},
+		Format:    format,
+		Content:   content,
+	}
+}
+
+// GetType implements Event.
+func (e SessionExportedEvent) GetType() EventType { return e.Type }
+
+// SessionForkedEvent answers fork_session with the new session, which
+// start_session resumes like any stored session.
+type SessionForkedEvent struct {
+	eventBase
+	Session         SessionInfo `json:"session"`
+	RestoredFiles   []string    `json:"restored_files,omitempty"`
+	UnrestoredFiles []string    `json:"unrestored_files,omitempty"` // too large to have been kept
+}
+
+// NewSessionForkedEvent constructs a session_forked event.
+func NewSessionForkedEvent(info SessionInfo, restored, unrestored []string) SessionForkedEvent {
+	return SessionForkedEvent{
+		eventBase:       eventBase{Type: EventSessionForked, SessionID: info.ID},
+		Session:         info,
+		RestoredFiles:   restored,
+		UnrestoredFiles: unrestored,
+	}
+}
+
+// GetType implements Event.
+func (e SessionForkedEvent) GetType() EventType { return e.Type }
@@ -0,0 +1,53 @@
+package protocol
+
+import "testing"
+
+func TestDecodeSessionCommands(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		wantErr bool
+	}{
+		{name: "list", line: `{"type":"list_sessions","offset":20,"limit":20,"include_archived":true}`},
+		{name: "list negative offset", line: `{"type":"list_sessions","offset":-1}`, wantErr: true},
+		{name: "search", line: `{"type":"search_sessions","query":"bleve mapping","limit":5}`},
+		{name: "search blank query", line: `{"type":"search_sessions","query":" "}`, wantErr: true},
+		{name: "get", line: `{"type":"get_session","session_id":"s","include_messages":true}`},
+		{name: "get without id", line: `{"type":"get_session"}`, wantErr: true},
+		{name: "rename", line: `{"type":"rename_session","session_id":"s","title":"Fix login"}`},
+		{name: "rename blank title", line: `{"type":"rename_session","session_id":"s","title":"  "}`, wantErr: true},
+		{name: "delete", line: `{"type":"delete_session","session_id":"s"}`},
+		{name: "archive", line: `{"type":"archive_session","session_id":"s","restore":true}`},
+		{name: "archive without id", line: `{"type":"archive_session"}`, wantErr: true},
+		{name: "pin", line: `{"type":"pin_session","session_id":"s","unpin":true}`},
+		{name: "pin without id", line: `{"type":"pin_session"}`, wantErr: true},
+		{name: "export", line: `{"type":"export_session","session_id":"s"}`},
+		{name: "fork", line: `{"type":"fork_session","session_id":"s","message_index":2,"restore_files":true}`},
+		{name: "fork negative index", line: `{"type":"fork_session","session_id":"s","message_index":-1}`, wantErr: true},
+		{name: "export markdown", line: `{"type":"export_session","session_id":"s","format":"md"}`},
+		{name: "export unknown format", line: `{"type":"export_session","session_id":"s","format":"pdf"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeCommand([]byte(tt.line))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	cmd, _ := DecodeCommand([]byte(`{"type":"export_session","session_id":"s"}`))
+	if got := cmd.(ExportSessionCommand).Format; got != ExportFormatJSON {
+		t.Errorf("default export format = %q, want json", got)
+	}
+}
+
+func TestSessionsListedEvent(t *testing.T) {
+	data, err := MarshalEvent(NewSessionsListedEvent([]SessionInfo{}, 3, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"type":"sessions_listed","sessions":[],"total":3}`; string(data) != want {
+		t.Errorf("last page = %s\nwant %s", data, want)
+	}
+}
@@ -0,0 +1,51 @@
+package protocol
+
+// Lossy reports whether events of type t may be dropped when a client
+// falls behind: they are superseded by later events or only inform
+// progress. Other events are delivered with backpressure instead. A client
+// that notices a gap in a session's seq numbers recovers with resync.
+func (t EventType) Lossy() bool {
+	switch t {
+	case EventStatus, EventTokenUsage, EventToolOutput:
+		return true
+	}
+	return false
+}
+
+// ResyncCommand asks the engine to resend a session's events from FromSeq
+// on, e.g. after a reconnect or a gap in seq numbers.
+type ResyncCommand struct {
+	Type      CommandType `json:"type"`
+	SessionID string      `json:"session_id"`
+	FromSeq   uint64      `json:"from_seq"` // first seq to resend; 0 or 1 for everything still buffered
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// GetType implements Command.
+func (c ResyncCommand) GetType() CommandType { return CommandResync }
+
+// GetRequestID implements Command.
+func (c ResyncCommand) GetRequestID() string { return c.RequestID }
+
+// ResyncedEvent follows the events replayed for resync.
+type ResyncedEvent struct {
+	eventBase
+	FromSeq   uint64 `json:"from_seq"`
+	Replayed  int    `json:"replayed"`
+	LastSeq   uint64 `json:"last_seq"`            // latest seq of the session; 0 before its first event
+	Truncated bool   `json:"truncated,omitempty"` // events from from_seq on were no longer all buffered
+}
+
+// NewResyncedEvent constructs a resynced event.
+func NewResyncedEvent(sessionID string, fromSeq uint64, replayed int, lastSeq uint64, truncated bool) ResyncedEvent {
+	return ResyncedEvent{
+		eventBase: eventBase{Type: EventResynced, SessionID: sessionID},
+		FromSeq:   fromSeq,
+		Replayed:  replayed,
+		LastSeq:   lastSeq,
+		Truncated: truncated,
+	}
+}
+
+// GetType implements Event.
+func (e ResyncedEvent) GetType() EventType { return e.Type }
@@ -24,6 +24,10 @@ type State struct {
 	Budget   BudgetConfig  // Token budget configuration (zero value = unlimited)
 	Totals   Usage         // Accumulated token usage across all calls
 
+	// SystemContext is added to the system prompt of each request without
+	// becoming part of History, for context that is rebuilt every run.
+	SystemContext string
+
 	// Brain agent enhancements for SOTA behavior
 	MiniPlan        *MiniPlan       // Internal plan
 	ToolCallCount   int             // Total tool calls this run (for soft caps)
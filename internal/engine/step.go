@@ -91,6 +91,9 @@ func executeToolsWithRetry(ctx context.Context, calls []ToolCall, reg ToolRegist
 // It applies processors and enforces budget limits with compression if needed.
 func prepareMessages(ctx context.Context, st *State, llm LLMClient, hooks Hooks, compressionCfg *CompressionConfig) ([]ChatMessage, error) {
 	msgs := append([]ChatMessage(nil), st.History...)
+	if st.SystemContext != "" && len(msgs) > 0 && msgs[0].Role == RoleSystem {
+		msgs[0].Content += "\n\n" + st.SystemContext
+	}
 
 	// Use provided config or default
 	cfg := compressionCfg
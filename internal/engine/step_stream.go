@@ -33,6 +33,7 @@ func stepOnceStream(ctx context.Context, llm LLMClient, reg ToolRegistry, st *St
 	var assistantBuffer strings.Builder
 	var respUsage Usage
 	var toolCalls []ToolCall
+	var finishReason string
 
 	for {
 		select {
@@ -53,6 +54,8 @@ func stepOnceStream(ctx context.Context, llm LLMClient, reg ToolRegistry, st *St
 				toolCalls = append(toolCalls, ev.ToolCall)
 			case "usage":
 				respUsage = ev.Usage
+			case "finish":
+				finishReason = ev.FinishReason
 			}
 		case err, ok := <-errCh:
 			if !ok {
@@ -75,8 +78,16 @@ func stepOnceStream(ctx context.Context, llm LLMClient, reg ToolRegistry, st *St
 		}
 	}
 
+	if finishReason == "" {
+		// Providers that don't report a finish reason while streaming
+		finishReason = "stop"
+		if len(toolCalls) > 0 {
+			finishReason = "tool_calls"
+		}
+	}
+
 	assistant := ChatMessage{Role: RoleAssistant, Content: assistantBuffer.String()}
-	resp := LLMResponse{Assistant: assistant, ToolCalls: toolCalls, Usage: respUsage}
+	resp := LLMResponse{Assistant: assistant, ToolCalls: toolCalls, Usage: respUsage, FinishReason: finishReason}
 
 	// Process LLM response
 	processLLMResponse(resp, st, hooks, ctx)
@@ -198,3 +198,23 @@ func TestIsEditTool(t *testing.T) {
 		})
 	}
 }
+
+func TestPrepareMessagesAddsSystemContext(t *testing.T) {
+	st := &State{
+		History: []ChatMessage{
+			{Role: RoleSystem, Content: "You are a test assistant."},
+			{Role: RoleUser, Content: "Hello"},
+		},
+		SystemContext: "[PROJECT MEMORY]\n- a fact\n[END PROJECT MEMORY]",
+	}
+	msgs, err := prepareMessages(context.Background(), st, &MockLLMClient{}, Hooks{}, &CompressionConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "You are a test assistant.\n\n" + st.SystemContext; msgs[0].Content != want {
+		t.Errorf("system prompt = %q, want %q", msgs[0].Content, want)
+	}
+	if st.History[0].Content != "You are a test assistant." || len(msgs) != len(st.History) {
+		t.Errorf("the system context leaked into the history: %+v", st.History)
+	}
+}
@@ -89,12 +89,13 @@ type ToolSchema struct {
 
 // StreamEvent represents a streaming event from the LLM.
 type StreamEvent struct {
-	Type       string   // "text_delta" | "tool_call" | "tool_result" | "usage"
-	Text       string   // for text_delta
-	ToolCall   ToolCall // for tool_call
-	ToolCallID string   // for tool_result (ID of the tool call this result belongs to)
-	Content    string   // for tool_result (error message or result)
-	Usage      Usage    // for usage
+	Type         string   // "text_delta" | "tool_call" | "tool_result" | "usage" | "finish"
+	Text         string   // for text_delta
+	ToolCall     ToolCall // for tool_call
+	ToolCallID   string   // for tool_result (ID of the tool call this result belongs to)
+	Content      string   // for tool_result (error message or result)
+	Usage        Usage    // for usage
+	FinishReason string   // for finish (same values as LLMResponse.FinishReason)
 }
 
 // BudgetConfig defines token budget limits and compression settings.
@@ -7,16 +7,23 @@ import (
 	"github.com/ChamsBouzaiene/dodo/internal/coder"
 	"github.com/ChamsBouzaiene/dodo/internal/engine"
 	"github.com/ChamsBouzaiene/dodo/internal/indexer"
+	"github.com/ChamsBouzaiene/dodo/internal/tools/execution"
 )
 
 // BuildBrainAgent creates a fully configured brain agent for the REPL.
 // It now delegates to the CoderAgent constructor.
-func BuildBrainAgent(ctx context.Context, repoRoot string, retrieval indexer.Retrieval, workspaceCtx *indexer.WorkspaceContext, streaming bool, muteResponse bool, extraHooks ...engine.Hook) (*engine.Agent, error) {
+// Commands run through runner; nil selects the default sandbox runner.
+// extraTools (e.g. those of MCP servers) are registered alongside the
+// built-in ones.
+func BuildBrainAgent(ctx context.Context, repoRoot string, retrieval indexer.Retrieval, workspaceCtx *indexer.WorkspaceContext, runner execution.Runner, extraTools engine.ToolRegistry, streaming bool, muteResponse bool, extraHooks ...engine.Hook) (*engine.Agent, error) {
 	var opts []coder.Option
+	for name, tool := range extraTools {
+		opts = append(opts, coder.WithTool(name, tool))
+	}
 
 	// Attempt to add CodeBeacon for deep code understanding
 	// We build it here (Dependency Injection) and pass it to the Coder
-	if beacon, beaconErr := codebeacon.NewCodeBeaconAgent(ctx, repoRoot, retrieval, workspaceCtx); beaconErr != nil {
+	if beacon, beaconErr := codebeacon.NewCodeBeaconAgent(ctx, repoRoot, retrieval, workspaceCtx, runner); beaconErr != nil {
 		// Log warning but proceed without beacon
 		// We need to import log package since we removed it earlier
 		// For now, let's just skip adding the tool
@@ -25,7 +32,7 @@ func BuildBrainAgent(ctx context.Context, repoRoot string, retrieval indexer.Ret
 		opts = append(opts, coder.WithTool("code_beacon", beaconTool))
 	}
 
-	coderAgent, err := coder.NewAgent(ctx, repoRoot, retrieval, workspaceCtx, streaming, muteResponse, extraHooks, opts...)
+	coderAgent, err := coder.NewAgent(ctx, repoRoot, retrieval, workspaceCtx, runner, streaming, muteResponse, extraHooks, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -33,6 +40,6 @@ func BuildBrainAgent(ctx context.Context, repoRoot string, retrieval indexer.Ret
 }
 
 // BuildCodeBeaconAgent creates a CodeBeacon analysis agent
-func BuildCodeBeaconAgent(ctx context.Context, repoRoot string, retrieval indexer.Retrieval, workspaceCtx *indexer.WorkspaceContext) (*codebeacon.CodeBeaconAgent, error) {
-	return codebeacon.NewCodeBeaconAgent(ctx, repoRoot, retrieval, workspaceCtx)
+func BuildCodeBeaconAgent(ctx context.Context, repoRoot string, retrieval indexer.Retrieval, workspaceCtx *indexer.WorkspaceContext, runner execution.Runner) (*codebeacon.CodeBeaconAgent, error) {
+	return codebeacon.NewCodeBeaconAgent(ctx, repoRoot, retrieval, workspaceCtx, runner)
 }
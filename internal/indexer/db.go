@@ -146,6 +146,27 @@ func (d *DB) initSchema(ctx context.Context) error {
 		FOREIGN KEY (repo_id) REFERENCES repos(repo_id)
 	);
 
+	-- Chunks whose embeddings changed, in order, so that the vector index
+	-- can catch up with the changes since it last did
+	CREATE TABLE IF NOT EXISTS embedding_changes (
+		seq      INTEGER PRIMARY KEY AUTOINCREMENT,
+		repo_id  TEXT NOT NULL,
+		chunk_id TEXT NOT NULL
+	);
+	CREATE TRIGGER IF NOT EXISTS embeddings_inserted AFTER INSERT ON embeddings BEGIN
+		INSERT INTO embedding_changes (repo_id, chunk_id) VALUES (NEW.repo_id, NEW.chunk_id);
+	END;
+	CREATE TRIGGER IF NOT EXISTS embeddings_updated AFTER UPDATE ON embeddings BEGIN
+		INSERT INTO embedding_changes (repo_id, chunk_id) VALUES (NEW.repo_id, NEW.chunk_id);
+	END;
+	CREATE TRIGGER IF NOT EXISTS embeddings_deleted AFTER DELETE ON embeddings BEGIN
+		INSERT INTO embedding_changes (repo_id, chunk_id) VALUES (OLD.repo_id, OLD.chunk_id);
+	END;
+	-- Searches only see the embeddings of chunks that still exist
+	CREATE TRIGGER IF NOT EXISTS chunks_deleted AFTER DELETE ON chunks BEGIN
+		INSERT INTO embedding_changes (repo_id, chunk_id) VALUES (OLD.repo_id, OLD.chunk_id);
+	END;
+
 	-- Indexes for performance
 	CREATE INDEX IF NOT EXISTS idx_files_repo ON files(repo_id);
 	CREATE INDEX IF NOT EXISTS idx_files_deleted ON files(deleted);
@@ -161,6 +182,7 @@ func (d *DB) initSchema(ctx context.Context) error {
 	CREATE INDEX IF NOT EXISTS idx_chunks_symbol ON chunks(symbol_id);
 	
 	CREATE INDEX IF NOT EXISTS idx_embeddings_repo ON embeddings(repo_id);
+	CREATE INDEX IF NOT EXISTS idx_embedding_changes_repo ON embedding_changes(repo_id, seq);
 	`
 
 	_, err := d.db.ExecContext(ctx, schema)
@@ -536,6 +558,48 @@ func (d *DB) InsertEmbedding(ctx context.Context, e *Embedding) error {
 	return err
 }
 
+// EmbeddingsVersion returns the sequence number of the latest change to the
+// embeddings of repoID, or to the chunks they belong to; 0 if there is none.
+func (d *DB) EmbeddingsVersion(ctx context.Context, repoID string) (int64, error) {
+	var version int64
+	err := d.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(seq), 0) FROM embedding_changes WHERE repo_id = ?`, repoID).Scan(&version)
+	return version, err
+}
+
+// EmbeddingChanges returns the chunks of repoID whose embeddings changed
+// after version since, up to version upTo.
+func (d *DB) EmbeddingChanges(ctx context.Context, repoID string, since, upTo int64) ([]string, error) {
+	rows, err := d.db.QueryContext(ctx, `SELECT DISTINCT chunk_id FROM embedding_changes WHERE repo_id = ? AND seq > ? AND seq <= ?`, repoID, since, upTo)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var chunkIDs []string
+	for rows.Next() {
+		var chunkID string
+		if err := rows.Scan(&chunkID); err != nil {
+			return nil, err
+		}
+		chunkIDs = append(chunkIDs, chunkID)
+	}
+	return chunkIDs, rows.Err()
+}
+
+// OldestEmbeddingChange returns the sequence number of the oldest change to
+// the embeddings of repoID still recorded; 0 if there is none.
+func (d *DB) OldestEmbeddingChange(ctx context.Context, repoID string) (int64, error) {
+	var seq int64
+	err := d.db.QueryRowContext(ctx, `SELECT COALESCE(MIN(seq), 0) FROM embedding_changes WHERE repo_id = ?`, repoID).Scan(&seq)
+	return seq, err
+}
+
+// PruneEmbeddingChanges forgets the changes to the embeddings of repoID
+// before version, keeping the one that records it.
+func (d *DB) PruneEmbeddingChanges(ctx context.Context, repoID string, version int64) error {
+	_, err := d.db.ExecContext(ctx, `DELETE FROM embedding_changes WHERE repo_id = ? AND seq < ?`, repoID, version)
+	return err
+}
+
 // DeleteEmbeddingsByFile deletes all embeddings for chunks belonging to a file.
 func (d *DB) DeleteEmbeddingsByFile(ctx context.Context, fileID int64) error {
 	query := `
@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+
+	"github.com/ChamsBouzaiene/dodo/internal/ratelimit"
 )
 
 // NoOpEmbedder is a placeholder embedder that returns zero vectors.
@@ -48,6 +50,7 @@ type OpenAIEmbedder struct {
 	model     string
 	dimension int
 	client    *http.Client
+	limiter   *ratelimit.Limiter
 }
 
 // OpenAI embedding API request/response types
@@ -70,6 +73,9 @@ type openAIEmbeddingResponse struct {
 
 // NewOpenAIEmbedder creates an OpenAI embedder.
 // Common models: "text-embedding-3-small" (1536 dims), "text-embedding-3-large" (3072 dims)
+// Requests go through the shared "openai-embeddings" rate limiter, configured
+// from OPENAI_EMBEDDING_RPM and OPENAI_EMBEDDING_TPM, which the config's
+// embedding_requests_per_minute and embedding_tokens_per_minute set.
 func NewOpenAIEmbedder(apiKey, model string, dimension int) *OpenAIEmbedder {
 	if model == "" {
 		model = "text-embedding-3-small"
@@ -82,6 +88,7 @@ func NewOpenAIEmbedder(apiKey, model string, dimension int) *OpenAIEmbedder {
 		model:     model,
 		dimension: dimension,
 		client:    &http.Client{},
+		limiter:   ratelimit.Shared("openai-embeddings", ratelimit.ConfigFromEnv("OPENAI_EMBEDDING")),
 	}
 }
 
@@ -114,6 +121,15 @@ func (e *OpenAIEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]by
 		return nil, 0, fmt.Errorf("failed to marshal request: %w", err)
 	}
 	
+	// Queue behind other embedding calls instead of running into 429s
+	tokens := 0
+	for _, text := range texts {
+		tokens += estimateTokens(text)
+	}
+	if err := e.limiter.Wait(ctx, tokens); err != nil {
+		return nil, 0, fmt.Errorf("waiting for rate limit: %w", err)
+	}
+
 	// Create HTTP request
 	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.openai.com/v1/embeddings", bytes.NewBuffer(jsonData))
 	if err != nil {
@@ -129,6 +145,7 @@ func (e *OpenAIEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]by
 		return nil, 0, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
+	e.limiter.Observe(resp.StatusCode, resp.Header)
 	
 	// Read response
 	body, err := io.ReadAll(resp.Body)
@@ -11,6 +11,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -27,6 +28,7 @@ type Manager struct {
 	chunker  Chunker
 	embedder Embedder
 	bm25     *BM25Index
+	vectors  *VectorIndex
 
 	// Repository info
 	repoID   string
@@ -36,6 +38,12 @@ type Manager struct {
 	// Configuration
 	config ManagerConfig
 
+	// Held while the vector index catches up with the database
+	vectorSync sync.Mutex
+	// The embeddings version the vector index was last caught up with, or
+	// vectorsNotSynced
+	vectorsVersion atomic.Int64
+
 	// Lifecycle
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -136,8 +144,11 @@ func NewManager(ctx context.Context, config ManagerConfig) (*Manager, error) {
 	}
 	log.Println("📚 BM25 index ready")
 
+	// Load the vector index; Start catches it up with the database
+	vectors := NewVectorIndex(config.DBPath)
+
 	// Create worker
-	worker := NewIndexingWorker(indexer, config.Chunker, config.Embedder, bm25, config.RepoID, config.RepoRoot)
+	worker := NewIndexingWorker(indexer, config.Chunker, config.Embedder, bm25, vectors, config.RepoID, config.RepoRoot)
 	worker.batchSize = config.WorkerBatchSize
 	worker.tickInterval = config.WorkerTickInterval
 
@@ -149,6 +160,7 @@ func NewManager(ctx context.Context, config ManagerConfig) (*Manager, error) {
 		chunker:  config.Chunker,
 		embedder: config.Embedder,
 		bm25:     bm25,
+		vectors:  vectors,
 		repoID:   config.RepoID,
 		repoRoot: config.RepoRoot,
 		gitInfo:  gitInfo,
@@ -156,6 +168,8 @@ func NewManager(ctx context.Context, config ManagerConfig) (*Manager, error) {
 		ctx:      mgrCtx,
 		cancel:   cancel,
 	}
+	m.vectorsVersion.Store(vectors.SyncedVersion())
+	worker.syncVectors = m.syncVectors
 
 	// Create file watcher if enabled
 	if config.EnableFileWatcher {
@@ -211,6 +225,15 @@ func (m *Manager) Start() error {
 	m.wg.Add(1)
 	go m.safetyScanLoop()
 
+	// Catch the vector index up with embeddings written since it was saved
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		if err := m.syncVectors(m.ctx); err != nil {
+			log.Printf("⚠️  Failed to sync vector index: %v", err)
+		}
+	}()
+
 	// Start indexing worker
 	m.worker.Start()
 
@@ -243,6 +266,11 @@ func (m *Manager) Stop() error {
 	m.cancel()
 	m.wg.Wait()
 
+	// Save vector index
+	if err := m.vectors.Save(); err != nil {
+		log.Printf("⚠️  %v", err)
+	}
+
 	// Close BM25 index
 	if m.bm25 != nil {
 		m.bm25.Close()
@@ -293,6 +321,7 @@ func (m *Manager) InitialIndex(ctx context.Context) error {
 			log.Printf("❌ Failed to index %s: %v", file.Path, err)
 		}
 	}
+	m.worker.saveVectors()
 
 	log.Println("✅ Initial indexing complete")
 	return nil
@@ -709,96 +738,157 @@ type scoredChunk struct {
 	score float64
 }
 
-// searchEmbeddings performs embedding-based semantic search.
+// Vector search parameters.
+const (
+	vectorOversample = 4    // index candidates rescored per result wanted
+	vectorSyncLog    = 2000 // vectors added in one catch-up worth logging
+	vectorSyncBatch  = 500  // vectors loaded from the database at a time
+
+	vectorsNotSynced = -1 // vectorsVersion of an index of unknown version, which is rebuilt
+)
+
+// searchEmbeddings performs embedding-based semantic search: the vector
+// index, caught up with the database first, proposes candidates, which are
+// rescored exactly.
 func (m *Manager) searchEmbeddings(ctx context.Context, query string, globs []string, k int) ([]scoredChunk, error) {
 	// Step 1: Embed the query
 	queryVec, _, err := m.embedder.Embed(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to embed query: %w", err)
 	}
+	queryVector, err := DecodeVector(queryVec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode query vector: %w", err)
+	}
+	if _, ok := normalize(queryVector); !ok {
+		return []scoredChunk{}, nil // a zero vector is similar to nothing
+	}
 
-	// Step 2: Get candidate chunks
-	candidates, err := m.getCandidateChunks(ctx, globs, 500)
+	// Step 2: Rescore the nearest neighbors the index finds. Globs filter
+	// them afterwards, so look further and fall back to a scan of the
+	// matching files when too few are left.
+	if err := m.catchUpVectors(ctx); err != nil {
+		log.Printf("⚠️  Failed to sync vector index: %v", err)
+	}
+	n := k * vectorOversample
+	if len(globs) > 0 {
+		n *= 4
+	}
+	hits, err := m.vectors.Search(queryVector, n)
+	if err == nil {
+		ids := make([]string, len(hits))
+		for i, h := range hits {
+			ids[i] = h.ChunkID
+		}
+		var scored []scoredChunk
+		scored, err = m.scoreEmbeddings(ctx, queryVector, ids, globs, k)
+		if err == nil && (len(scored) >= k || len(globs) == 0) {
+			return scored, nil
+		}
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get candidates: %w", err)
+		log.Printf("⚠️  Vector index search failed, scanning embeddings: %v", err)
 	}
 
-	if len(candidates) == 0 {
+	// Step 3: Score every embedding of the matching files
+	return m.scoreEmbeddings(ctx, queryVector, nil, globs, k)
+}
+
+// scoreEmbeddings ranks the embeddings of the chunks in ids (all of the
+// repository's when nil) in files matching globs by their cosine similarity
+// to queryVector, and returns the top k with their chunks.
+func (m *Manager) scoreEmbeddings(ctx context.Context, queryVector []float32, ids []string, globs []string, k int) ([]scoredChunk, error) {
+	if ids != nil && len(ids) == 0 {
 		return []scoredChunk{}, nil
 	}
+	query := `
+		SELECT e.chunk_id, e.vector
+		FROM embeddings e JOIN chunks c ON c.chunk_id = e.chunk_id
+		WHERE e.repo_id = ?
+	`
+	args := []interface{}{m.repoID}
+	if ids != nil {
+		query += " AND e.chunk_id IN (?" + strings.Repeat(", ?", len(ids)-1) + ")"
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+	clause, globArgs := globClause(globs)
+	query += clause
+	args = append(args, globArgs...)
 
-	// Step 3: Compute cosine similarity
-	queryVector, err := DecodeVector(queryVec)
+	rows, err := m.indexer.db.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode query vector: %w", err)
+		return nil, fmt.Errorf("failed to query embeddings: %w", err)
 	}
+	defer rows.Close()
 
-	scored := make([]scoredChunk, 0, len(candidates))
-	for _, candidate := range candidates {
-		// Get embedding
-		var embeddingData []byte
-		embQuery := `SELECT vector FROM embeddings WHERE chunk_id = ?`
-		err := m.indexer.db.db.QueryRowContext(ctx, embQuery, candidate.ChunkID).Scan(&embeddingData)
-		if err != nil {
-			continue // Skip chunks without embeddings
+	type scoredID struct {
+		chunkID string
+		score   float64
+	}
+	var scored []scoredID
+	for rows.Next() {
+		var chunkID string
+		var data []byte
+		if err := rows.Scan(&chunkID, &data); err != nil {
+			return nil, err
 		}
-
-		chunkVector, err := DecodeVector(embeddingData)
+		chunkVector, err := DecodeVector(data)
 		if err != nil {
 			continue
 		}
-
-		similarity := cosineSimilarity(queryVector, chunkVector)
-		scored = append(scored, scoredChunk{chunk: candidate, score: similarity})
+		scored = append(scored, scoredID{chunkID, cosineSimilarity(queryVector, chunkVector)})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	// Step 4: Sort by score
 	sort.Slice(scored, func(i, j int) bool {
 		return scored[i].score > scored[j].score
 	})
-
-	// Step 5: Take top k
 	if len(scored) > k {
 		scored = scored[:k]
 	}
 
-	return scored, nil
+	top := make([]string, len(scored))
+	for i, s := range scored {
+		top[i] = s.chunkID
+	}
+	chunks, err := m.getChunks(ctx, top)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chunks: %w", err)
+	}
+	results := make([]scoredChunk, 0, len(scored))
+	for _, s := range scored {
+		if chunk, ok := chunks[s.chunkID]; ok {
+			results = append(results, scoredChunk{chunk: chunk, score: s.score})
+		}
+	}
+	return results, nil
 }
 
-// getCandidateChunks retrieves chunks from the database filtered by globs.
-func (m *Manager) getCandidateChunks(ctx context.Context, globs []string, limit int) ([]Chunk, error) {
+// getChunks retrieves chunks from the database by ID.
+func (m *Manager) getChunks(ctx context.Context, ids []string) (map[string]Chunk, error) {
+	chunks := make(map[string]Chunk, len(ids))
+	if len(ids) == 0 {
+		return chunks, nil
+	}
 	query := `
 		SELECT chunk_id, repo_id, file_id, file_path, lang, symbol_id, symbol_name, kind, start_line, end_line, text
 		FROM chunks
-		WHERE repo_id = ?
-	`
-
-	args := []interface{}{m.repoID}
-
-	// Add glob filtering
-	if len(globs) > 0 {
-		query += " AND ("
-		for i, glob := range globs {
-			if i > 0 {
-				query += " OR "
-			}
-			query += "file_path LIKE ?"
-			// Convert glob to SQL LIKE pattern (basic implementation)
-			pattern := strings.ReplaceAll(glob, "*", "%")
-			args = append(args, pattern)
-		}
-		query += ")"
+		WHERE chunk_id IN (?` + strings.Repeat(", ?", len(ids)-1) + `)`
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
 	}
 
-	query += fmt.Sprintf(" LIMIT %d", limit)
-
 	rows, err := m.indexer.db.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var chunks []Chunk
 	for rows.Next() {
 		var c Chunk
 		var symbolID, symbolName sql.NullString
@@ -812,12 +902,166 @@ func (m *Manager) getCandidateChunks(ctx context.Context, globs []string, limit
 		if symbolName.Valid {
 			c.SymbolName = symbolName.String
 		}
-		chunks = append(chunks, c)
+		chunks[c.ChunkID] = c
 	}
 
 	return chunks, rows.Err()
 }
 
+// globClause returns the SQL condition restricting chunks (as c) to the
+// files matching globs, and its arguments.
+func globClause(globs []string) (string, []interface{}) {
+	if len(globs) == 0 {
+		return "", nil
+	}
+	clause := " AND ("
+	args := make([]interface{}, 0, len(globs))
+	for i, glob := range globs {
+		if i > 0 {
+			clause += " OR "
+		}
+		clause += "c.file_path LIKE ?"
+		// Convert glob to SQL LIKE pattern (basic implementation)
+		args = append(args, strings.ReplaceAll(glob, "*", "%"))
+	}
+	return clause + ")", args
+}
+
+// catchUpVectors brings the vector index up to date with the embeddings
+// table if it has changed since the index last was, waiting for a catch-up
+// already under way.
+func (m *Manager) catchUpVectors(ctx context.Context) error {
+	version, err := m.indexer.db.EmbeddingsVersion(ctx, m.repoID)
+	if err != nil {
+		return err
+	}
+	if version == m.vectorsVersion.Load() {
+		return nil
+	}
+	return m.syncVectors(ctx)
+}
+
+// syncVectors catches the vector index up with the embeddings table.
+func (m *Manager) syncVectors(ctx context.Context) error {
+	m.vectorSync.Lock()
+	defer m.vectorSync.Unlock()
+	return m.syncVectorsLocked(ctx)
+}
+
+// syncVectorsLocked applies the changes to the embeddings made since the
+// vector index last caught up, then trains and saves it along with the
+// version it reached, and prunes the change log up to there. The index is
+// rebuilt from every embedding instead when the log doesn't reach back to
+// its version: one saved before the log was pruned further, or of unknown
+// version. The caller holds vectorSync.
+func (m *Manager) syncVectorsLocked(ctx context.Context) error {
+	db := m.indexer.db
+	// Changes made while the index catches up come after this version, so
+	// the next search catches up with them.
+	version, err := db.EmbeddingsVersion(ctx, m.repoID)
+	if err != nil {
+		return fmt.Errorf("failed to read embeddings version: %w", err)
+	}
+	since := m.vectorsVersion.Load()
+	if version == since {
+		return nil // caught up while we waited
+	}
+
+	oldest, err := db.OldestEmbeddingChange(ctx, m.repoID)
+	if err != nil {
+		return fmt.Errorf("failed to read embedding changes: %w", err)
+	}
+
+	var load []string
+	if since == vectorsNotSynced || since > version || oldest > since+1 {
+		if load, err = m.allEmbeddings(ctx); err != nil {
+			return err
+		}
+		m.vectors.Remove(m.vectors.IDs()...)
+	} else {
+		if load, err = db.EmbeddingChanges(ctx, m.repoID, since, version); err != nil {
+			return fmt.Errorf("failed to list embedding changes: %w", err)
+		}
+		m.vectors.Remove(load...) // reloaded below unless deleted
+	}
+	if len(load) > vectorSyncLog {
+		log.Printf("🧭 Building vector index (%d embeddings)", len(load))
+	}
+	if err := m.loadVectors(ctx, load); err != nil {
+		return err
+	}
+	if len(load) > vectorSyncLog {
+		log.Printf("🧭 Vector index ready (%d embeddings)", m.vectors.Len())
+	}
+
+	if m.vectors.NeedsTraining() {
+		m.vectors.Train()
+	}
+	m.vectors.SetSyncedVersion(version)
+	if err := m.vectors.Save(); err != nil {
+		log.Printf("⚠️  %v", err)
+	}
+	m.vectorsVersion.Store(version)
+	if err := db.PruneEmbeddingChanges(ctx, m.repoID, version); err != nil {
+		log.Printf("⚠️  Failed to prune embedding changes: %v", err)
+	}
+	return nil
+}
+
+// allEmbeddings returns every chunk with an embedding.
+func (m *Manager) allEmbeddings(ctx context.Context) ([]string, error) {
+	query := `SELECT e.chunk_id FROM embeddings e JOIN chunks c ON c.chunk_id = e.chunk_id WHERE e.repo_id = ?`
+	rows, err := m.indexer.db.db.QueryContext(ctx, query, m.repoID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list embeddings: %w", err)
+	}
+	defer rows.Close()
+	var chunkIDs []string
+	for rows.Next() {
+		var chunkID string
+		if err := rows.Scan(&chunkID); err != nil {
+			return nil, err
+		}
+		chunkIDs = append(chunkIDs, chunkID)
+	}
+	return chunkIDs, rows.Err()
+}
+
+// loadVectors adds the embeddings of the chunks in ids that still exist to
+// the vector index.
+func (m *Manager) loadVectors(ctx context.Context, ids []string) error {
+	for start := 0; start < len(ids); start += vectorSyncBatch {
+		batch := ids[start:min(start+vectorSyncBatch, len(ids))]
+		query := `SELECT e.chunk_id, e.vector FROM embeddings e JOIN chunks c ON c.chunk_id = e.chunk_id WHERE e.chunk_id IN (?` + strings.Repeat(", ?", len(batch)-1) + `)`
+		args := make([]interface{}, len(batch))
+		for i, id := range batch {
+			args[i] = id
+		}
+		rows, err := m.indexer.db.db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("failed to load embeddings: %w", err)
+		}
+		for rows.Next() {
+			var chunkID string
+			var data []byte
+			if err := rows.Scan(&chunkID, &data); err != nil {
+				rows.Close()
+				return err
+			}
+			vector, err := DecodeVector(data)
+			if err != nil {
+				vector = nil // recorded as unsearchable
+			}
+			m.vectors.Add(chunkID, vector)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // cosineSimilarity computes the cosine similarity between two vectors.
 func cosineSimilarity(a, b []float32) float64 {
 	if len(a) != len(b) {
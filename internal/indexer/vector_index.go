@@ -0,0 +1,715 @@
+package indexer
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// IVF parameters.
+const (
+	ivfTrainMin        = 1024 // vectors before the index is split into lists
+	ivfGrowth          = 4    // retrain once the index has grown this many times over
+	ivfMaxLists        = 1024
+	ivfSamplePerList   = 16 // training vectors per list
+	ivfTrainIterations = 6
+	ivfMinProbes       = 8 // lists searched at least; more search an eighth of them
+)
+
+// vectorIndexMagic starts a saved vector index; the version after it is
+// bumped whenever the format changes, and older files are rebuilt.
+const (
+	vectorIndexMagic   = "DODOVECS"
+	vectorIndexVersion = 2
+)
+
+// VectorResult represents a vector index search result.
+type VectorResult struct {
+	ChunkID string
+	Score   float64 // approximate cosine similarity
+}
+
+// VectorIndex is an approximate nearest neighbor index over chunk
+// embeddings: an inverted file (IVF) that splits the normalized vectors,
+// quantized to int8, into lists around k-means centroids, and searches only
+// the lists closest to the query. It lives next to the database
+// (index.db.vectors) and only proposes candidates; Manager rescores them
+// exactly against the vectors in the embeddings table.
+type VectorIndex struct {
+	path string
+
+	mu      sync.RWMutex
+	ivf     *ivfIndex
+	version uint64 // bumped by every change
+	saved   uint64 // version on disk
+	synced  int64  // embeddings version the index was caught up with; -1 if unknown
+
+	// While Train builds the new lists, changes are queued here too, to be
+	// applied to them.
+	training bool
+	pending  []vectorChange
+
+	saveMu sync.Mutex
+}
+
+type vectorChange struct {
+	chunkID string
+	vector  []float32 // nil to remove
+}
+
+// NewVectorIndex opens the vector index stored next to a database. A missing
+// or unreadable index starts out empty and is rebuilt from the database by
+// Manager.
+func NewVectorIndex(dbPath string) *VectorIndex {
+	x := &VectorIndex{path: dbPath + ".vectors", ivf: newIVFIndex(0), synced: -1}
+	f, err := os.Open(x.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return x
+	}
+	if err != nil {
+		log.Printf("⚠️  Failed to open vector index, rebuilding it: %v", err)
+		return x
+	}
+	defer f.Close()
+	ivf, synced, err := readIVFIndex(bufio.NewReader(f))
+	if err != nil {
+		log.Printf("⚠️  Vector index is unreadable (%v), rebuilding it", err)
+		x.version = 1 // overwrite it on the next save
+		return x
+	}
+	x.ivf, x.synced = ivf, synced
+	return x
+}
+
+// SyncedVersion returns the embeddings version (see DB.EmbeddingsVersion)
+// the index was last caught up with, which is saved with it; -1 if unknown.
+func (x *VectorIndex) SyncedVersion() int64 {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.synced
+}
+
+// SetSyncedVersion records that the index reflects every change to the
+// embeddings up to version.
+func (x *VectorIndex) SetSyncedVersion(version int64) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.synced != version {
+		x.synced = version
+		x.version++
+	}
+}
+
+// Len returns the number of chunks in the index, counting those whose
+// vectors could not be indexed.
+func (x *VectorIndex) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.ivf.ids) + len(x.ivf.skipped)
+}
+
+// IDs returns the chunk IDs in the index, in no particular order.
+func (x *VectorIndex) IDs() []string {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	ids := make([]string, 0, len(x.ivf.ids)+len(x.ivf.skipped))
+	for id := range x.ivf.ids {
+		ids = append(ids, id)
+	}
+	for id := range x.ivf.skipped {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Add indexes a chunk's vector, replacing any previous one. Zero vectors,
+// and vectors of another dimension than those already indexed, are only
+// recorded: they can't be searched.
+func (x *VectorIndex) Add(chunkID string, vector []float32) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.training {
+		x.pending = append(x.pending, vectorChange{chunkID, vector})
+	}
+	x.ivf.add(chunkID, vector)
+	x.version++
+}
+
+// Remove drops chunks from the index.
+func (x *VectorIndex) Remove(chunkIDs ...string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for _, id := range chunkIDs {
+		if x.training {
+			x.pending = append(x.pending, vectorChange{chunkID: id})
+		}
+		if x.ivf.remove(id) {
+			x.version++
+		}
+	}
+}
+
+// Search returns up to k chunks whose vectors are most similar to query,
+// best first.
+func (x *VectorIndex) Search(query []float32, k int) ([]VectorResult, error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	ix := x.ivf
+	if len(ix.ids) == 0 || k <= 0 {
+		return nil, nil
+	}
+	if len(query) != ix.dim {
+		return nil, fmt.Errorf("query has %d dimensions, index has %d", len(query), ix.dim)
+	}
+	q, ok := normalize(query)
+	if !ok {
+		return nil, nil
+	}
+
+	results := &resultHeap{}
+	for _, list := range ix.probe(q) {
+		for _, e := range ix.lists[list] {
+			score := float64(e.sim(q))
+			if results.Len() < k {
+				heap.Push(results, VectorResult{e.chunkID, score})
+			} else if score > (*results)[0].Score {
+				(*results)[0] = VectorResult{e.chunkID, score}
+				heap.Fix(results, 0)
+			}
+		}
+	}
+	sort.Slice(*results, func(i, j int) bool { return (*results)[i].Score > (*results)[j].Score })
+	return *results, nil
+}
+
+// NeedsTraining reports whether the index has grown enough since its lists
+// were formed to be worth splitting anew.
+func (x *VectorIndex) NeedsTraining() bool {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	n := len(x.ivf.ids)
+	return n >= ivfTrainMin && n >= x.ivf.trainedAt*ivfGrowth
+}
+
+// Train forms new lists with k-means over the indexed vectors. Searches and
+// changes proceed on the old lists meanwhile.
+func (x *VectorIndex) Train() {
+	x.mu.Lock()
+	if x.training {
+		x.mu.Unlock()
+		return
+	}
+	old := x.ivf
+	chunkIDs := make([]string, 0, len(old.ids))
+	vectors := make([][]float32, 0, len(old.ids))
+	for _, list := range old.lists {
+		for _, e := range list {
+			chunkIDs = append(chunkIDs, e.chunkID)
+			vectors = append(vectors, e.vector())
+		}
+	}
+	skipped := make(map[string]struct{}, len(old.skipped))
+	for id := range old.skipped {
+		skipped[id] = struct{}{}
+	}
+	x.training = true
+	x.pending = nil
+	x.mu.Unlock()
+
+	fresh := trainIVFIndex(old.dim, chunkIDs, vectors)
+	fresh.skipped = skipped
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for _, c := range x.pending {
+		if c.vector == nil {
+			fresh.remove(c.chunkID)
+		} else {
+			fresh.add(c.chunkID, c.vector)
+		}
+	}
+	x.ivf = fresh
+	x.training = false
+	x.pending = nil
+	x.version++
+	log.Printf("🧭 Vector index split into %d lists (%d vectors)", len(fresh.lists), len(chunkIDs))
+}
+
+// Save writes the index to disk if it changed since it was last saved.
+func (x *VectorIndex) Save() error {
+	x.saveMu.Lock()
+	defer x.saveMu.Unlock()
+
+	x.mu.RLock()
+	version := x.version
+	if version == x.saved {
+		x.mu.RUnlock()
+		return nil
+	}
+	tmp := x.path + ".tmp"
+	err := writeSynced(tmp, func(w io.Writer) error { return x.ivf.writeTo(w, x.synced) })
+	x.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to save vector index: %w", err)
+	}
+	if err := os.Rename(tmp, x.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to save vector index: %w", err)
+	}
+
+	x.mu.Lock()
+	x.saved = version
+	x.mu.Unlock()
+	return nil
+}
+
+// writeSynced writes path through a buffer and syncs it.
+func writeSynced(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriterSize(f, 1<<20)
+	err = write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+// ivfIndex holds the lists behind a VectorIndex; it does no locking.
+type ivfIndex struct {
+	dim       int
+	centroids [][]float32 // normalized; none before training, with everything in one list
+	lists     [][]ivfEntry
+	ids       map[string]ivfRef   // chunk ID -> place in lists
+	skipped   map[string]struct{} // chunks whose vectors can't be indexed
+	trainedAt int                 // vectors indexed when the centroids were computed
+}
+
+type ivfEntry struct {
+	chunkID string
+	vec     []int8 // the normalized vector is about vec * scale
+	scale   float32
+}
+
+type ivfRef struct {
+	list, pos int32
+}
+
+func newIVFIndex(dim int) *ivfIndex {
+	return &ivfIndex{
+		dim:     dim,
+		lists:   make([][]ivfEntry, 1),
+		ids:     make(map[string]ivfRef),
+		skipped: make(map[string]struct{}),
+	}
+}
+
+func (ix *ivfIndex) add(chunkID string, vector []float32) {
+	ix.remove(chunkID)
+	if len(ix.ids) == 0 && len(vector) != ix.dim && len(vector) > 0 {
+		// Nothing is indexed with the old dimension any more: switch, and
+		// let the chunks skipped for having the new one be added again.
+		*ix = *newIVFIndex(len(vector))
+	}
+	normalized, ok := normalize(vector)
+	if !ok || len(vector) != ix.dim {
+		ix.skipped[chunkID] = struct{}{}
+		return
+	}
+	vec, scale := quantize(normalized)
+	list := ix.nearest(normalized)
+	ix.ids[chunkID] = ivfRef{int32(list), int32(len(ix.lists[list]))}
+	ix.lists[list] = append(ix.lists[list], ivfEntry{chunkID, vec, scale})
+}
+
+// remove reports whether chunkID was in the index.
+func (ix *ivfIndex) remove(chunkID string) bool {
+	if _, ok := ix.skipped[chunkID]; ok {
+		delete(ix.skipped, chunkID)
+		return true
+	}
+	ref, ok := ix.ids[chunkID]
+	if !ok {
+		return false
+	}
+	delete(ix.ids, chunkID)
+	list := ix.lists[ref.list]
+	last := len(list) - 1
+	if int(ref.pos) != last {
+		list[ref.pos] = list[last]
+		ix.ids[list[ref.pos].chunkID] = ref
+	}
+	ix.lists[ref.list] = list[:last]
+	return true
+}
+
+// nearest returns the list whose centroid is most similar to a normalized
+// vector.
+func (ix *ivfIndex) nearest(v []float32) int {
+	best, bestSim := 0, float32(math.Inf(-1))
+	for i, c := range ix.centroids {
+		if s := dot(v, c); s > bestSim {
+			best, bestSim = i, s
+		}
+	}
+	return best
+}
+
+// probe returns the lists to search for a normalized query.
+func (ix *ivfIndex) probe(q []float32) []int {
+	if len(ix.centroids) == 0 {
+		return []int{0}
+	}
+	lists := make([]int, len(ix.centroids))
+	sims := make([]float32, len(ix.centroids))
+	for i, c := range ix.centroids {
+		lists[i] = i
+		sims[i] = dot(q, c)
+	}
+	sort.Slice(lists, func(i, j int) bool { return sims[lists[i]] > sims[lists[j]] })
+	return lists[:min(len(lists), max(ivfMinProbes, len(lists)/8))]
+}
+
+// trainIVFIndex indexes vectors in lists around centroids found by
+// spherical k-means on a sample of them.
+func trainIVFIndex(dim int, chunkIDs []string, vectors [][]float32) *ivfIndex {
+	ix := newIVFIndex(dim)
+	n := len(vectors)
+	nlist := min(ivfMaxLists, int(math.Sqrt(float64(n))))
+	if nlist > 1 {
+		rng := rand.New(rand.NewSource(int64(n)))
+		sample := make([][]float32, 0, min(n, nlist*ivfSamplePerList))
+		for _, i := range rng.Perm(n)[:cap(sample)] {
+			sample = append(sample, vectors[i])
+		}
+		ix.centroids = kmeans(rng, dim, sample, nlist)
+		ix.lists = make([][]ivfEntry, nlist)
+	}
+	lists := assign(vectors, ix.centroids)
+	for i, id := range chunkIDs {
+		vec, scale := quantize(vectors[i])
+		ix.ids[id] = ivfRef{int32(lists[i]), int32(len(ix.lists[lists[i]]))}
+		ix.lists[lists[i]] = append(ix.lists[lists[i]], ivfEntry{id, vec, scale})
+	}
+	ix.trainedAt = n
+	return ix
+}
+
+// assign returns the index of the centroid most similar to each of the
+// normalized vectors, spreading the work over the CPUs.
+func assign(vectors, centroids [][]float32) []int {
+	out := make([]int, len(vectors))
+	if len(centroids) == 0 {
+		return out
+	}
+	ix := &ivfIndex{centroids: centroids}
+	workers := runtime.GOMAXPROCS(0)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < len(vectors); i += workers {
+				out[i] = ix.nearest(vectors[i])
+			}
+		}(w)
+	}
+	wg.Wait()
+	return out
+}
+
+// kmeans clusters normalized vectors around k normalized centroids,
+// reseeding those left without vectors.
+func kmeans(rng *rand.Rand, dim int, vectors [][]float32, k int) [][]float32 {
+	centroids := make([][]float32, k)
+	for i := range centroids {
+		centroids[i] = append([]float32(nil), vectors[i]...)
+	}
+	sums := make([][]float64, k)
+	for i := range sums {
+		sums[i] = make([]float64, dim)
+	}
+	counts := make([]int, k)
+	for iter := 0; iter < ivfTrainIterations; iter++ {
+		for i := range sums {
+			clear(sums[i])
+			counts[i] = 0
+		}
+		for i, best := range assign(vectors, centroids) {
+			for j, x := range vectors[i] {
+				sums[best][j] += float64(x)
+			}
+			counts[best]++
+		}
+		for i := range centroids {
+			if counts[i] == 0 {
+				copy(centroids[i], vectors[rng.Intn(len(vectors))])
+				continue
+			}
+			mean := make([]float32, dim)
+			for j, s := range sums[i] {
+				mean[j] = float32(s)
+			}
+			if c, ok := normalize(mean); ok {
+				centroids[i] = c
+			}
+		}
+	}
+	return centroids
+}
+
+// sim approximates the cosine similarity of the entry and a normalized
+// query.
+func (e ivfEntry) sim(q []float32) float32 {
+	var s0, s1, s2, s3 float32
+	vec := e.vec[:len(q)]
+	i := 0
+	for ; i+4 <= len(vec); i += 4 {
+		s0 += q[i] * float32(vec[i])
+		s1 += q[i+1] * float32(vec[i+1])
+		s2 += q[i+2] * float32(vec[i+2])
+		s3 += q[i+3] * float32(vec[i+3])
+	}
+	for ; i < len(vec); i++ {
+		s0 += q[i] * float32(vec[i])
+	}
+	return (s0 + s1 + s2 + s3) * e.scale
+}
+
+// vector returns the entry's (normalized, quantized) vector.
+func (e ivfEntry) vector() []float32 {
+	v := make([]float32, len(e.vec))
+	for i, c := range e.vec {
+		v[i] = float32(c) * e.scale
+	}
+	return v
+}
+
+func dot(a, b []float32) float32 {
+	var s0, s1, s2, s3 float32
+	b = b[:len(a)]
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		s0 += a[i] * b[i]
+		s1 += a[i+1] * b[i+1]
+		s2 += a[i+2] * b[i+2]
+		s3 += a[i+3] * b[i+3]
+	}
+	for ; i < len(a); i++ {
+		s0 += a[i] * b[i]
+	}
+	return s0 + s1 + s2 + s3
+}
+
+// normalize scales v to unit length; it fails for zero and non-finite
+// vectors.
+func normalize(v []float32) ([]float32, bool) {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	norm := math.Sqrt(sum)
+	if norm == 0 || math.IsNaN(norm) || math.IsInf(norm, 0) {
+		return nil, false
+	}
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = float32(float64(x) / norm)
+	}
+	return out, true
+}
+
+// quantize maps a normalized vector to int8s and the scale that turns them
+// back into it.
+func quantize(v []float32) ([]int8, float32) {
+	var maxAbs float32
+	for _, x := range v {
+		maxAbs = max(maxAbs, float32(math.Abs(float64(x))))
+	}
+	scale := maxAbs / 127
+	q := make([]int8, len(v))
+	for i, x := range v {
+		q[i] = int8(math.Round(float64(x / scale)))
+	}
+	return q, scale
+}
+
+// resultHeap keeps the best results found so far, the worst on top.
+type resultHeap []VectorResult
+
+func (h resultHeap) Len() int           { return len(h) }
+func (h resultHeap) Less(i, j int) bool { return h[i].Score < h[j].Score }
+func (h resultHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *resultHeap) Push(v any)        { *h = append(*h, v.(VectorResult)) }
+func (h *resultHeap) Pop() any {
+	last := (*h)[len(*h)-1]
+	*h = (*h)[:len(*h)-1]
+	return last
+}
+
+// writeTo saves the index: a header, the embeddings version it was synced
+// with, the centroids, the entries with their lists, then the skipped chunk
+// IDs. Numbers are little-endian.
+func (ix *ivfIndex) writeTo(w io.Writer, synced int64) error {
+	put := func(v any) error { return binary.Write(w, binary.LittleEndian, v) }
+	putString := func(s string) error {
+		if err := put(uint32(len(s))); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, s)
+		return err
+	}
+
+	if _, err := io.WriteString(w, vectorIndexMagic); err != nil {
+		return err
+	}
+	header := []uint32{vectorIndexVersion, uint32(ix.dim), uint32(len(ix.centroids)), uint32(ix.trainedAt), uint32(len(ix.ids))}
+	if err := put(header); err != nil {
+		return err
+	}
+	if err := put(synced); err != nil {
+		return err
+	}
+	for _, c := range ix.centroids {
+		if err := put(c); err != nil {
+			return err
+		}
+	}
+	for list, entries := range ix.lists {
+		for _, e := range entries {
+			if err := put(uint32(list)); err != nil {
+				return err
+			}
+			if err := putString(e.chunkID); err != nil {
+				return err
+			}
+			if err := put(e.scale); err != nil {
+				return err
+			}
+			if err := put(e.vec); err != nil {
+				return err
+			}
+		}
+	}
+	if err := put(uint32(len(ix.skipped))); err != nil {
+		return err
+	}
+	for id := range ix.skipped {
+		if err := putString(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readIVFIndex loads an index saved by writeTo, along with the embeddings
+// version it was synced with.
+func readIVFIndex(r io.Reader) (*ivfIndex, int64, error) {
+	get := func(v any) error { return binary.Read(r, binary.LittleEndian, v) }
+	getString := func() (string, error) {
+		var n uint32
+		if err := get(&n); err != nil {
+			return "", err
+		}
+		if n > 1<<16 {
+			return "", fmt.Errorf("chunk ID of %d bytes", n)
+		}
+		b := make([]byte, n)
+		_, err := io.ReadFull(r, b)
+		return string(b), err
+	}
+
+	magic := make([]byte, len(vectorIndexMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, 0, err
+	}
+	if string(magic) != vectorIndexMagic {
+		return nil, 0, fmt.Errorf("not a vector index")
+	}
+	header := make([]uint32, 5)
+	if err := get(header); err != nil {
+		return nil, 0, err
+	}
+	if header[0] != vectorIndexVersion {
+		return nil, 0, fmt.Errorf("unsupported version %d", header[0])
+	}
+	var synced int64
+	if err := get(&synced); err != nil {
+		return nil, 0, err
+	}
+	dim, nlist, count := int(header[1]), int(header[2]), int(header[4])
+	if dim > 1<<16 || nlist > ivfMaxLists || nlist == 1 || count > math.MaxInt32 {
+		return nil, 0, fmt.Errorf("corrupt header")
+	}
+
+	ix := newIVFIndex(dim)
+	ix.trainedAt = int(header[3])
+	if nlist > 0 {
+		ix.centroids = make([][]float32, nlist)
+		for i := range ix.centroids {
+			ix.centroids[i] = make([]float32, dim)
+			if err := get(ix.centroids[i]); err != nil {
+				return nil, 0, err
+			}
+		}
+		ix.lists = make([][]ivfEntry, nlist)
+	}
+	for i := 0; i < count; i++ {
+		var list uint32
+		if err := get(&list); err != nil {
+			return nil, 0, err
+		}
+		if int(list) >= len(ix.lists) {
+			return nil, 0, fmt.Errorf("corrupt entry %d", i)
+		}
+		e := ivfEntry{vec: make([]int8, dim)}
+		var err error
+		if e.chunkID, err = getString(); err != nil {
+			return nil, 0, err
+		}
+		if err := get(&e.scale); err != nil {
+			return nil, 0, err
+		}
+		if err := get(e.vec); err != nil {
+			return nil, 0, err
+		}
+		if _, dup := ix.ids[e.chunkID]; dup {
+			return nil, 0, fmt.Errorf("corrupt entry %d", i)
+		}
+		ix.ids[e.chunkID] = ivfRef{int32(list), int32(len(ix.lists[list]))}
+		ix.lists[list] = append(ix.lists[list], e)
+	}
+
+	var skipped uint32
+	if err := get(&skipped); err != nil {
+		return nil, 0, err
+	}
+	for range skipped {
+		id, err := getString()
+		if err != nil {
+			return nil, 0, err
+		}
+		ix.skipped[id] = struct{}{}
+	}
+	return ix, synced, nil
+}
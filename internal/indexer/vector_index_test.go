@@ -0,0 +1,320 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func randomVectors(rng *rand.Rand, n, dim int) [][]float32 {
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		vectors[i] = make([]float32, dim)
+		for j := range vectors[i] {
+			vectors[i][j] = float32(rng.NormFloat64())
+		}
+	}
+	return vectors
+}
+
+// bruteForce returns the IDs of the k vectors most similar to query.
+func bruteForce(vectors [][]float32, query []float32, k int) []string {
+	order := make([]int, len(vectors))
+	scores := make([]float64, len(vectors))
+	for i := range order {
+		order[i] = i
+		scores[i] = cosineSimilarity(query, vectors[i])
+	}
+	sort.Slice(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+	ids := make([]string, k)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("c%d", order[i])
+	}
+	return ids
+}
+
+// clusteredVectors returns n vectors scattered around a few centers, as
+// embeddings of related code are.
+func clusteredVectors(rng *rand.Rand, centers [][]float32, n int) [][]float32 {
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		center := centers[rng.Intn(len(centers))]
+		vectors[i] = make([]float32, len(center))
+		for j := range center {
+			vectors[i][j] = center[j] + float32(rng.NormFloat64())*0.5
+		}
+	}
+	return vectors
+}
+
+func TestVectorIndex_Recall(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	centers := randomVectors(rng, 40, 64)
+	vectors := clusteredVectors(rng, centers, 5000)
+	index := NewVectorIndex(filepath.Join(t.TempDir(), "index.db"))
+	for i, v := range vectors {
+		index.Add(fmt.Sprintf("c%d", i), v)
+	}
+	if !index.NeedsTraining() {
+		t.Fatal("NeedsTraining = false for 5000 vectors")
+	}
+	index.Train()
+	if index.NeedsTraining() || len(index.ivf.centroids) < 2 {
+		t.Fatalf("after Train: NeedsTraining = %v, %d lists", index.NeedsTraining(), len(index.ivf.centroids))
+	}
+
+	const k = 10
+	found, total := 0, 0
+	for _, query := range clusteredVectors(rng, centers, 50) {
+		hits, err := index.Search(query, k)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		got := make(map[string]bool)
+		for _, h := range hits {
+			got[h.ChunkID] = true
+		}
+		for _, id := range bruteForce(vectors, query, k) {
+			if got[id] {
+				found++
+			}
+			total++
+		}
+	}
+	if recall := float64(found) / float64(total); recall < 0.9 {
+		t.Errorf("recall@%d = %.2f, want at least 0.9", k, recall)
+	}
+}
+
+func TestVectorIndex_UpdateAndReload(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "index.db")
+	rng := rand.New(rand.NewSource(2))
+	vectors := randomVectors(rng, 1500, 8)
+	index := NewVectorIndex(dbPath)
+	for i, v := range vectors {
+		index.Add(fmt.Sprintf("c%d", i), v)
+	}
+	index.Train()
+	index.Add("zero", make([]float32, 8))
+	index.Add("short", []float32{1, 2})
+	if index.Len() != 1502 {
+		t.Fatalf("Len = %d, want 1502", index.Len())
+	}
+
+	var removed []string
+	for i := 0; i < 500; i++ {
+		removed = append(removed, fmt.Sprintf("c%d", i))
+	}
+	index.Remove(removed...)
+	index.Remove("zero")
+	index.Add("c600", vectors[700]) // replaces c600's vector
+	if index.Len() != 1001 {
+		t.Errorf("Len = %d, want 1001", index.Len())
+	}
+
+	if err := index.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	reloaded := NewVectorIndex(dbPath)
+	if reloaded.Len() != 1001 || len(reloaded.ivf.centroids) != len(index.ivf.centroids) {
+		t.Fatalf("reloaded Len = %d with %d lists", reloaded.Len(), len(reloaded.ivf.centroids))
+	}
+	hits, err := reloaded.Search(vectors[700], 5)
+	if err != nil || len(hits) != 5 || hits[0].Score < 0.99 || hits[1].Score < 0.99 {
+		t.Fatalf("Search after reload = %+v, %v", hits, err)
+	}
+	for _, h := range hits {
+		var i int
+		fmt.Sscanf(h.ChunkID, "c%d", &i)
+		if i < 500 {
+			t.Errorf("removed chunk %s found", h.ChunkID)
+		}
+	}
+	if _, err := reloaded.Search([]float32{1, 0}, 5); err == nil {
+		t.Error("Search accepted a query of the wrong dimension")
+	}
+
+	// A damaged file is rebuilt rather than trusted.
+	if err := os.WriteFile(dbPath+".vectors", []byte("DODOVECS garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if n := NewVectorIndex(dbPath).Len(); n != 0 {
+		t.Errorf("Len of a damaged index = %d, want 0", n)
+	}
+}
+
+func TestManager_SearchFindsEveryEmbedding(t *testing.T) {
+	tmpDir := t.TempDir()
+	ctx := context.Background()
+	mgr, err := NewManager(ctx, ManagerConfig{
+		DBPath:   filepath.Join(tmpDir, "index.db"),
+		RepoID:   "test-repo",
+		RepoRoot: tmpDir,
+		Embedder: &MockEmbedder{vectors: map[string][]float32{"needle": {1, 2, 3, 4, 5, 6, 7, 8}}},
+	})
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	defer mgr.Stop()
+
+	// The best match comes after well over 500 others.
+	tx, err := mgr.GetDB().db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	insert := func(i int, vector []float32) {
+		t.Helper()
+		chunkID := fmt.Sprintf("chunk%d", i)
+		if _, err := tx.ExecContext(ctx, `INSERT INTO chunks (chunk_id, repo_id, file_id, file_path, lang, kind, start_line, end_line, text) VALUES (?, ?, 0, ?, 'go', '', 1, 2, 'x')`, chunkID, "test-repo", fmt.Sprintf("pkg/file%d.go", i)); err != nil {
+			t.Fatalf("Failed to insert chunk: %v", err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO embeddings (chunk_id, repo_id, vector, dim) VALUES (?, ?, ?, ?)`, chunkID, "test-repo", encodeVectorTest(vector), len(vector)); err != nil {
+			t.Fatalf("Failed to insert embedding: %v", err)
+		}
+	}
+	rng := rand.New(rand.NewSource(3))
+	for i, v := range randomVectors(rng, 1500, 8) {
+		insert(i, v)
+	}
+	insert(1500, []float32{1, 2, 3, 4, 5, 6, 7, 8.5})
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := mgr.searchEmbeddings(ctx, "needle", nil, 5)
+	if err != nil {
+		t.Fatalf("searchEmbeddings failed: %v", err)
+	}
+	if len(results) != 5 || results[0].chunk.ChunkID != "chunk1500" {
+		t.Fatalf("top result = %+v, want chunk1500", results)
+	}
+	if mgr.vectors.Len() != 1501 || len(mgr.vectors.ivf.centroids) == 0 {
+		t.Errorf("vector index holds %d embeddings in %d lists, want 1501 in several", mgr.vectors.Len(), len(mgr.vectors.ivf.centroids))
+	}
+	version, err := mgr.GetDB().EmbeddingsVersion(ctx, "test-repo")
+	if err != nil || version == 0 || mgr.vectorsVersion.Load() != version {
+		t.Errorf("vector index caught up with version %d, embeddings are at %d (%v)", mgr.vectorsVersion.Load(), version, err)
+	}
+
+	// Globs restrict the candidates.
+	results, err = mgr.searchEmbeddings(ctx, "needle", []string{"pkg/file79*"}, 5)
+	if err != nil || len(results) != 5 {
+		t.Fatalf("glob search = %+v, %v", results, err)
+	}
+	for _, r := range results {
+		if !strings.HasPrefix(r.chunk.FilePath, "pkg/file79") {
+			t.Errorf("glob search found %s", r.chunk.FilePath)
+		}
+	}
+
+	// Removed chunks drop out of the index when it catches up.
+	if _, err := mgr.indexer.db.db.ExecContext(ctx, `DELETE FROM chunks WHERE chunk_id = 'chunk1500'`); err != nil {
+		t.Fatal(err)
+	}
+	results, err = mgr.searchEmbeddings(ctx, "needle", nil, 5)
+	if err != nil || len(results) == 0 || results[0].chunk.ChunkID == "chunk1500" {
+		t.Fatalf("search after delete = %+v, %v", results, err)
+	}
+	if mgr.vectors.Len() != 1500 {
+		t.Errorf("vector index holds %d embeddings after the delete, want 1500", mgr.vectors.Len())
+	}
+
+	// A changed embedding of the same count is caught up with too.
+	if _, err := mgr.indexer.db.db.ExecContext(ctx, `UPDATE embeddings SET vector = ? WHERE chunk_id = 'chunk7'`, encodeVectorTest([]float32{1, 2, 3, 4, 5, 6, 7, 8.2})); err != nil {
+		t.Fatal(err)
+	}
+	results, err = mgr.searchEmbeddings(ctx, "needle", nil, 5)
+	if err != nil || len(results) == 0 || results[0].chunk.ChunkID != "chunk7" {
+		t.Fatalf("search after update = %+v, %v", results, err)
+	}
+	var changes int
+	if err := mgr.indexer.db.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM embedding_changes`).Scan(&changes); err != nil || changes != 1 {
+		t.Errorf("%d embedding changes kept after catching up, want 1 (%v)", changes, err)
+	}
+}
+
+func TestManager_VectorIndexAfterRestart(t *testing.T) {
+	tmpDir := t.TempDir()
+	ctx := context.Background()
+	open := func() *Manager {
+		t.Helper()
+		mgr, err := NewManager(ctx, ManagerConfig{
+			DBPath:   filepath.Join(tmpDir, "index.db"),
+			RepoID:   "test-repo",
+			RepoRoot: tmpDir,
+			Embedder: &MockEmbedder{vectors: map[string][]float32{"needle": {1, 0, 0, 0}}},
+		})
+		if err != nil {
+			t.Fatalf("NewManager failed: %v", err)
+		}
+		return mgr
+	}
+	// The manager was never started, so Stop would leave it open.
+	shut := func(mgr *Manager) {
+		mgr.bm25.Close()
+		mgr.indexer.Close()
+	}
+	exec := func(mgr *Manager, query string, args ...any) {
+		t.Helper()
+		if _, err := mgr.indexer.db.db.ExecContext(ctx, query, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	top := func(mgr *Manager) string {
+		t.Helper()
+		results, err := mgr.searchEmbeddings(ctx, "needle", nil, 1)
+		if err != nil || len(results) == 0 {
+			t.Fatalf("searchEmbeddings = %+v, %v", results, err)
+		}
+		return results[0].chunk.ChunkID
+	}
+
+	mgr := open()
+	for i, v := range [][]float32{{1, 0.1, 0, 0}, {0, 1, 0, 0}, {0, 0, 1, 0}} {
+		chunkID := fmt.Sprintf("chunk%d", i)
+		exec(mgr, `INSERT INTO chunks (chunk_id, repo_id, file_id, file_path, lang, kind, start_line, end_line, text) VALUES (?, ?, 0, ?, 'go', '', 1, 2, 'x')`, chunkID, "test-repo", chunkID+".go")
+		exec(mgr, `INSERT INTO embeddings (chunk_id, repo_id, vector, dim) VALUES (?, ?, ?, 4)`, chunkID, "test-repo", encodeVectorTest(v))
+	}
+	// The worker's saves catch up and prune the change log too.
+	mgr.worker.saveVectors()
+	var changes int
+	if err := mgr.indexer.db.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM embedding_changes`).Scan(&changes); err != nil || changes != 1 {
+		t.Errorf("%d embedding changes kept after the worker saved, want 1 (%v)", changes, err)
+	}
+	if got := top(mgr); got != "chunk0" {
+		t.Fatalf("top result = %s, want chunk0", got)
+	}
+	saved := mgr.vectorsVersion.Load()
+
+	// An embedding changed in place while the engine was down is caught up
+	// with from the change log.
+	exec(mgr, `UPDATE embeddings SET vector = ? WHERE chunk_id = 'chunk1'`, encodeVectorTest([]float32{1, 0, 0, 0}))
+	shut(mgr)
+	mgr = open()
+	if got := mgr.vectorsVersion.Load(); got != saved {
+		t.Errorf("reopened index is at version %d, want the saved %d", got, saved)
+	}
+	if got := top(mgr); got != "chunk1" {
+		t.Errorf("top result after restart = %s, want chunk1", got)
+	}
+
+	// When the log no longer reaches back to the saved index, it is rebuilt.
+	exec(mgr, `DELETE FROM embedding_changes`)
+	exec(mgr, `UPDATE embeddings SET vector = ? WHERE chunk_id = 'chunk2'`, encodeVectorTest([]float32{1, 0, 0, 0.01}))
+	exec(mgr, `UPDATE embeddings SET vector = ? WHERE chunk_id = 'chunk1'`, encodeVectorTest([]float32{0, 1, 0, 0}))
+	exec(mgr, `DELETE FROM embedding_changes WHERE chunk_id = 'chunk2'`)
+	shut(mgr)
+	mgr = open()
+	defer shut(mgr)
+	if got := top(mgr); got != "chunk2" {
+		t.Errorf("top result after a rebuild = %s, want chunk2", got)
+	}
+	if mgr.vectors.Len() != 3 {
+		t.Errorf("rebuilt index holds %d embeddings, want 3", mgr.vectors.Len())
+	}
+}
@@ -16,9 +16,14 @@ type IndexingWorker struct {
 	chunker  Chunker
 	embedder Embedder
 	bm25     *BM25Index
+	vectors  *VectorIndex
 	repoID   string
 	repoRoot string
 
+	// Set by Manager to catch the vector index up with the database, which
+	// saves it; saveVectors uses it when set.
+	syncVectors func(ctx context.Context) error
+
 	ctx    context.Context
 	cancel context.CancelFunc
 	wg     sync.WaitGroup
@@ -28,7 +33,7 @@ type IndexingWorker struct {
 }
 
 // NewIndexingWorker creates a new background indexing worker.
-func NewIndexingWorker(indexer *Indexer, chunker Chunker, embedder Embedder, bm25 *BM25Index, repoID, repoRoot string) *IndexingWorker {
+func NewIndexingWorker(indexer *Indexer, chunker Chunker, embedder Embedder, bm25 *BM25Index, vectors *VectorIndex, repoID, repoRoot string) *IndexingWorker {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &IndexingWorker{
@@ -36,6 +41,7 @@ func NewIndexingWorker(indexer *Indexer, chunker Chunker, embedder Embedder, bm2
 		chunker:      chunker,
 		embedder:     embedder,
 		bm25:         bm25,
+		vectors:      vectors,
 		repoID:       repoID,
 		repoRoot:     repoRoot,
 		ctx:          ctx,
@@ -104,6 +110,8 @@ func (w *IndexingWorker) processBatch() {
 			log.Printf("❌ Failed to index %s: %v", file.Path, err)
 		}
 	}
+
+	w.saveVectors()
 }
 
 // processFile processes a single file: chunk, embed, and store.
@@ -146,12 +154,13 @@ func (w *IndexingWorker) processFile(file FileRecord) error {
 	oldChunks, err := w.indexer.db.GetChunksByFile(w.ctx, file.FileID)
 	if err != nil {
 		log.Printf("⚠️  Failed to get old chunks: %v", err)
-	} else if len(oldChunks) > 0 && w.bm25 != nil {
+	}
+	oldChunkIDs := make([]string, len(oldChunks))
+	for i, c := range oldChunks {
+		oldChunkIDs[i] = c.ChunkID
+	}
+	if len(oldChunkIDs) > 0 && w.bm25 != nil {
 		// Delete from BM25 index
-		oldChunkIDs := make([]string, len(oldChunks))
-		for i, c := range oldChunks {
-			oldChunkIDs[i] = c.ChunkID
-		}
 		if err := w.bm25.DeleteByFileID(oldChunkIDs); err != nil {
 			log.Printf("⚠️  Failed to delete old chunks from BM25: %v", err)
 		}
@@ -166,6 +175,11 @@ func (w *IndexingWorker) processFile(file FileRecord) error {
 	if err := w.indexer.db.DeleteEmbeddingsByFile(w.ctx, file.FileID); err != nil {
 		log.Printf("⚠️  Failed to delete old embeddings: %v", err)
 	}
+	// The vector index follows the database, so that a search that finds
+	// it behind catches it up rather than undoing the worker's changes.
+	if w.vectors != nil {
+		w.vectors.Remove(oldChunkIDs...)
+	}
 
 	// Insert symbols
 	for i := range symbols {
@@ -226,6 +240,10 @@ func (w *IndexingWorker) processFile(file FileRecord) error {
 				}
 				if err := w.indexer.db.InsertEmbedding(w.ctx, &embedding); err != nil {
 					log.Printf("⚠️  Failed to insert embedding: %v", err)
+				} else if w.vectors != nil {
+					if vector, err := DecodeVector(embeddings[i]); err == nil {
+						w.vectors.Add(chunks[i].ChunkID, vector)
+					}
 				}
 			}
 		}
@@ -277,5 +295,28 @@ func (w *IndexingWorker) RunIndexingBatch(ctx context.Context, maxFiles int) err
 		}
 	}
 
+	w.saveVectors()
 	return nil
 }
+
+// saveVectors splits the vector index into new lists once it has grown
+// enough and writes it to disk if it changed.
+func (w *IndexingWorker) saveVectors() {
+	if w.vectors == nil {
+		return
+	}
+	if w.syncVectors != nil {
+		// Catching up also records how far the saved index goes and
+		// prunes the change log up to there.
+		if err := w.syncVectors(w.ctx); err != nil {
+			log.Printf("⚠️  Failed to sync vector index: %v", err)
+		}
+		return
+	}
+	if w.vectors.NeedsTraining() {
+		w.vectors.Train()
+	}
+	if err := w.vectors.Save(); err != nil {
+		log.Printf("⚠️  %v", err)
+	}
+}
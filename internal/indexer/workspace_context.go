@@ -275,7 +275,7 @@ func estimateLineCount(filePath string) int {
 		".png": true, ".jpg": true, ".jpeg": true, ".gif": true,
 		".pdf": true, ".zip": true, ".tar": true, ".gz": true,
 		".exe": true, ".dll": true, ".so": true, ".dylib": true,
-		".db": true, ".sqlite": true, ".bleve": true,
+		".db": true, ".sqlite": true, ".bleve": true, ".vectors": true,
 	}
 	if binaryExts[ext] {
 		return 0
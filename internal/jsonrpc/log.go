@@ -0,0 +1,30 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"log"
+	"sync"
+)
+
+// LogWriter logs each line written to it, as a server process's stderr.
+type LogWriter struct {
+	Prefix string
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (w *LogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		log.Print(w.Prefix + string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
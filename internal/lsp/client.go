@@ -0,0 +1,357 @@
+// Package lsp is a language server protocol client that answers the
+// navigation questions grep and semantic search answer only roughly:
+// where a symbol is defined, what references or implements it, its type
+// and documentation, and what problems a file has.
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ChamsBouzaiene/dodo/internal/jsonrpc"
+	"github.com/ChamsBouzaiene/dodo/internal/sandbox"
+)
+
+// shutdownGrace is how long a server gets to shut down before it is killed.
+const shutdownGrace = 2 * time.Second
+
+// Client is a connection to one language server for one repository.
+type Client struct {
+	root    string // the repository on the host
+	procDir string // the repository as the server sees it
+	proc    *sandbox.Process
+	conn    *conn
+
+	syncMu sync.Mutex // orders document notifications
+
+	mu           sync.Mutex
+	docs         map[string]*document // open documents by host path
+	diags        map[string]*published
+	diagsChanged chan struct{} // closed and replaced on each publish
+}
+
+type document struct {
+	version int
+	text    string
+}
+
+// published holds the diagnostics last published for a file.
+type published struct {
+	diags []Diagnostic
+	fresh bool // published for the text the server has
+}
+
+// Start initializes the language server running as proc for the
+// repository at root.
+func Start(ctx context.Context, proc *sandbox.Process, root string) (*Client, error) {
+	c := &Client{
+		root:         root,
+		procDir:      filepath.ToSlash(proc.Dir),
+		proc:         proc,
+		docs:         make(map[string]*document),
+		diags:        make(map[string]*published),
+		diagsChanged: make(chan struct{}),
+	}
+	c.conn = newConn(proc.Stdout, proc.Stdin, c.handle)
+
+	rootURI := c.uri(root)
+	err := c.conn.call(ctx, "initialize", map[string]any{
+		"processId":        nil, // a server in a container can't see our PID
+		"clientInfo":       map[string]any{"name": "dodo"},
+		"rootUri":          rootURI,
+		"rootPath":         c.procDir,
+		"workspaceFolders": []map[string]any{{"uri": rootURI, "name": filepath.Base(root)}},
+		"capabilities": map[string]any{
+			"workspace": map[string]any{"configuration": true, "workspaceFolders": true},
+			"textDocument": map[string]any{
+				"synchronization":    map[string]any{},
+				"definition":         map[string]any{"linkSupport": true},
+				"implementation":     map[string]any{"linkSupport": true},
+				"references":         map[string]any{},
+				"hover":              map[string]any{"contentFormat": []string{"markdown", "plaintext"}},
+				"publishDiagnostics": map[string]any{"versionSupport": true},
+			},
+		},
+	}, nil)
+	if err == nil {
+		err = c.conn.notify("initialized", map[string]any{})
+	}
+	if err != nil {
+		proc.Kill()
+		return nil, fmt.Errorf("initialize: %w", err)
+	}
+	return c, nil
+}
+
+// handle answers what the server sends unasked.
+func (c *Client) handle(m *jsonrpc.Message) (any, *jsonrpc.Error) {
+	switch m.Method {
+	case "textDocument/publishDiagnostics":
+		c.publish(m.Params)
+		return nil, nil
+	case "workspace/configuration":
+		// Every setting at its default
+		var params struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		json.Unmarshal(m.Params, &params)
+		return make([]any, len(params.Items)), nil
+	case "workspace/workspaceFolders":
+		return []map[string]any{{"uri": c.uri(c.root), "name": filepath.Base(c.root)}}, nil
+	case "client/registerCapability", "client/unregisterCapability",
+		"window/workDoneProgress/create", "window/showMessageRequest":
+		return nil, nil
+	}
+	if len(m.ID) == 0 {
+		return nil, nil // logs, progress and other notifications
+	}
+	return nil, &jsonrpc.Error{Code: jsonrpc.MethodNotFound, Message: "method not found: " + m.Method}
+}
+
+func (c *Client) publish(raw json.RawMessage) {
+	var params struct {
+		URI         string       `json:"uri"`
+		Version     *int         `json:"version"`
+		Diagnostics []Diagnostic `json:"diagnostics"`
+	}
+	if json.Unmarshal(raw, &params) != nil {
+		return
+	}
+	p, _ := c.path(params.URI)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fresh := true
+	if doc := c.docs[p]; doc != nil && params.Version != nil && *params.Version < doc.version {
+		fresh = false
+	}
+	c.diags[p] = &published{diags: params.Diagnostics, fresh: fresh}
+	close(c.diagsChanged)
+	c.diagsChanged = make(chan struct{})
+}
+
+// uri names a host path the way the server sees it.
+func (c *Client) uri(hostPath string) string {
+	rel, err := filepath.Rel(c.root, hostPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return (&url.URL{Scheme: "file", Path: filepath.ToSlash(hostPath)}).String()
+	}
+	return (&url.URL{Scheme: "file", Path: path.Join(c.procDir, filepath.ToSlash(rel))}).String()
+}
+
+// path returns the host path of a URI the server sent, and whether it is
+// in the repository. Paths outside it are returned as the server named
+// them; for a server in a container they don't exist on the host.
+func (c *Client) path(uri string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri, false
+	}
+	if u.Path == c.procDir {
+		return c.root, true
+	}
+	if rel, ok := strings.CutPrefix(u.Path, strings.TrimSuffix(c.procDir, "/")+"/"); ok {
+		return filepath.Join(c.root, filepath.FromSlash(rel)), true
+	}
+	return filepath.FromSlash(u.Path), false
+}
+
+// Rel returns p relative to the repository when it is inside it.
+func (c *Client) Rel(p string) string {
+	if rel, err := filepath.Rel(c.root, p); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return p
+}
+
+// sync gives the server the current text of the file at hostPath, opening
+// it on first use.
+func (c *Client) sync(hostPath string) error {
+	lang := languageID(hostPath)
+	if lang == "" {
+		return fmt.Errorf("no language server handles %s files", filepath.Ext(hostPath))
+	}
+	data, err := os.ReadFile(hostPath)
+	if err != nil {
+		return err
+	}
+	text := string(data)
+
+	c.syncMu.Lock()
+	defer c.syncMu.Unlock()
+	c.mu.Lock()
+	doc := c.docs[hostPath]
+	if doc != nil && doc.text == text {
+		c.mu.Unlock()
+		return nil
+	}
+	opening := doc == nil
+	if opening {
+		doc = &document{}
+		c.docs[hostPath] = doc
+	}
+	doc.version++
+	doc.text = text
+	version := doc.version
+	if p := c.diags[hostPath]; p != nil {
+		p.fresh = false
+	}
+	c.mu.Unlock()
+
+	uri := c.uri(hostPath)
+	if opening {
+		return c.conn.notify("textDocument/didOpen", map[string]any{
+			"textDocument": map[string]any{"uri": uri, "languageId": lang, "version": version, "text": text},
+		})
+	}
+	return c.conn.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uri, "version": version},
+		"contentChanges": []map[string]any{{"text": text}},
+	})
+}
+
+// Definition returns where the symbol at pos in the file at hostPath is
+// defined.
+func (c *Client) Definition(ctx context.Context, hostPath string, pos Position) ([]Location, error) {
+	return c.locations(ctx, "textDocument/definition", hostPath, pos, nil)
+}
+
+// Implementations returns the implementations of the interface or method
+// at pos.
+func (c *Client) Implementations(ctx context.Context, hostPath string, pos Position) ([]Location, error) {
+	return c.locations(ctx, "textDocument/implementation", hostPath, pos, nil)
+}
+
+// References returns every reference to the symbol at pos, its
+// declaration included.
+func (c *Client) References(ctx context.Context, hostPath string, pos Position) ([]Location, error) {
+	return c.locations(ctx, "textDocument/references", hostPath, pos, map[string]any{"includeDeclaration": true})
+}
+
+func (c *Client) locations(ctx context.Context, method, hostPath string, pos Position, refContext any) ([]Location, error) {
+	if err := c.sync(hostPath); err != nil {
+		return nil, err
+	}
+	params := map[string]any{
+		"textDocument": map[string]any{"uri": c.uri(hostPath)},
+		"position":     pos,
+	}
+	if refContext != nil {
+		params["context"] = refContext
+	}
+	var raw json.RawMessage
+	if err := c.conn.call(ctx, method, params, &raw); err != nil {
+		return nil, err
+	}
+
+	var many []location
+	if len(raw) > 0 && raw[0] == '{' {
+		var one location
+		if err := json.Unmarshal(raw, &one); err != nil {
+			return nil, err
+		}
+		many = []location{one}
+	} else if len(raw) > 0 && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &many); err != nil {
+			return nil, fmt.Errorf("%s: invalid result: %w", method, err)
+		}
+	}
+	locs := make([]Location, 0, len(many))
+	for _, l := range many {
+		uri, rng := l.URI, l.Range
+		if l.TargetURI != "" {
+			uri = l.TargetURI
+			if l.TargetSelectionRange != nil {
+				rng = *l.TargetSelectionRange
+			}
+		}
+		p, _ := c.path(uri)
+		locs = append(locs, Location{Path: p, Range: rng})
+	}
+	return locs, nil
+}
+
+// Hover returns the server's description of the symbol at pos: usually
+// its signature or type and its documentation.
+func (c *Client) Hover(ctx context.Context, hostPath string, pos Position) (string, error) {
+	if err := c.sync(hostPath); err != nil {
+		return "", err
+	}
+	var result *struct {
+		Contents json.RawMessage `json:"contents"`
+	}
+	err := c.conn.call(ctx, "textDocument/hover", map[string]any{
+		"textDocument": map[string]any{"uri": c.uri(hostPath)},
+		"position":     pos,
+	}, &result)
+	if err != nil || result == nil {
+		return "", err
+	}
+	return strings.TrimSpace(hoverContents(result.Contents)), nil
+}
+
+// Diagnostics returns the problems the server reports for the file at
+// hostPath, waiting until ctx is done for it to check the file's current
+// text. fresh is false when the server had not finished by then and the
+// diagnostics, if any, are for an earlier version.
+func (c *Client) Diagnostics(ctx context.Context, hostPath string) (diags []Diagnostic, fresh bool, err error) {
+	if err := c.sync(hostPath); err != nil {
+		return nil, false, err
+	}
+	for {
+		c.mu.Lock()
+		p, changed := c.diags[hostPath], c.diagsChanged
+		c.mu.Unlock()
+		if p != nil && p.fresh {
+			return p.diags, true, nil
+		}
+		select {
+		case <-changed:
+		case <-c.conn.done:
+			return nil, false, c.conn.err
+		case <-ctx.Done():
+			if p == nil {
+				return nil, false, nil
+			}
+			return p.diags, false, nil
+		}
+	}
+}
+
+// Alive reports whether the server is still running.
+func (c *Client) Alive() bool {
+	select {
+	case <-c.conn.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Close asks the server to shut down and stops it if it doesn't.
+func (c *Client) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownGrace)
+	defer cancel()
+	if err := c.conn.call(ctx, "shutdown", nil, nil); err == nil {
+		c.conn.notify("exit", nil)
+	}
+	c.proc.Stdin.Close()
+	select {
+	case <-c.conn.done:
+	case <-ctx.Done():
+	}
+	err := c.proc.Kill()
+	if errors.Is(err, os.ErrProcessDone) {
+		err = nil
+	}
+	c.proc.Wait() // its exit status is of no interest once we hang up
+	return err
+}
@@ -0,0 +1,203 @@
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChamsBouzaiene/dodo/internal/jsonrpc"
+)
+
+// TestMain lets the test binary stand in for a language server.
+func TestMain(m *testing.M) {
+	if os.Getenv("LSP_FAKE_SERVER") == "1" {
+		serveFake()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// serveFake answers like a language server for a repository whose files
+// all define "Foo" on their first line. It reports an error on every line
+// containing "bad".
+func serveFake() {
+	var c *conn
+	ready := make(chan struct{}) // c is set
+	var root string
+	handle := func(m *jsonrpc.Message) (any, *jsonrpc.Error) {
+		var params struct {
+			RootURI      string `json:"rootUri"`
+			TextDocument struct {
+				URI     string `json:"uri"`
+				Version int    `json:"version"`
+				Text    string `json:"text"`
+			} `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		json.Unmarshal(m.Params, &params)
+		uri := params.TextDocument.URI
+		at := func(line, char int) map[string]any {
+			pos := Position{Line: line, Character: char}
+			return map[string]any{"uri": uri, "range": Range{Start: pos, End: pos}}
+		}
+		switch m.Method {
+		case "initialize":
+			root = params.RootURI
+			return map[string]any{"capabilities": map[string]any{}}, nil
+		case "textDocument/definition":
+			return []map[string]any{{
+				"targetUri":            uri,
+				"targetRange":          Range{},
+				"targetSelectionRange": Range{Start: Position{Character: 5}, End: Position{Character: 8}},
+			}}, nil
+		case "textDocument/references":
+			return []map[string]any{at(0, 5), at(2, 1)}, nil
+		case "textDocument/implementation":
+			return map[string]any{"uri": root + "/impl.go", "range": Range{}}, nil
+		case "textDocument/hover":
+			return map[string]any{"contents": map[string]any{"kind": "markdown", "value": "func Foo()"}}, nil
+		case "textDocument/didOpen", "textDocument/didChange":
+			text := params.TextDocument.Text
+			if len(params.ContentChanges) > 0 {
+				text = params.ContentChanges[0].Text
+			}
+			diags := []Diagnostic{}
+			for i, line := range strings.Split(text, "\n") {
+				if strings.Contains(line, "bad") {
+					diags = append(diags, Diagnostic{Range: Range{Start: Position{Line: i}}, Severity: SeverityError, Message: "bad line"})
+				}
+			}
+			go func() {
+				<-ready
+				time.Sleep(20 * time.Millisecond) // published later, as servers do
+				c.notify("textDocument/publishDiagnostics", map[string]any{"uri": uri, "version": params.TextDocument.Version, "diagnostics": diags})
+			}()
+		case "shutdown":
+			return nil, nil
+		case "exit":
+			os.Exit(0)
+		}
+		return nil, nil
+	}
+	c = newConn(os.Stdin, os.Stdout, handle)
+	close(ready)
+	<-c.done
+}
+
+func startFake(t *testing.T) (*Manager, string) {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LSP_FAKE_SERVER", "1")
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte("func Foo() {}\n\nFoo()\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(root, nil, exe)
+	t.Cleanup(m.Close)
+	return m, root
+}
+
+func TestClientQueries(t *testing.T) {
+	m, root := startFake(t)
+	ctx := context.Background()
+	c, err := m.Client(ctx)
+	if err != nil {
+		t.Fatalf("Client() error = %v", err)
+	}
+	main := filepath.Join(root, "main.go")
+
+	defs, err := c.Definition(ctx, main, Position{Line: 2})
+	if err != nil || len(defs) != 1 || defs[0].Path != main || defs[0].Range.Start.Character != 5 {
+		t.Errorf("Definition() = %+v, %v", defs, err)
+	}
+	refs, err := c.References(ctx, main, Position{Line: 0, Character: 5})
+	if err != nil || len(refs) != 2 || refs[1].Range.Start.Line != 2 {
+		t.Errorf("References() = %+v, %v", refs, err)
+	}
+	impls, err := c.Implementations(ctx, main, Position{})
+	if err != nil || len(impls) != 1 || impls[0].Path != filepath.Join(root, "impl.go") {
+		t.Errorf("Implementations() = %+v, %v", impls, err)
+	}
+	if got, err := c.Hover(ctx, main, Position{}); err != nil || got != "func Foo()" {
+		t.Errorf("Hover() = %q, %v", got, err)
+	}
+	if c.Rel(main) != "main.go" {
+		t.Errorf("Rel() = %q", c.Rel(main))
+	}
+	if _, err := c.Hover(ctx, filepath.Join(root, "notes.txt"), Position{}); err == nil {
+		t.Error("Hover() on a file no server handles succeeded")
+	}
+}
+
+func TestClientDiagnostics(t *testing.T) {
+	m, root := startFake(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := m.Client(ctx)
+	if err != nil {
+		t.Fatalf("Client() error = %v", err)
+	}
+	main := filepath.Join(root, "main.go")
+
+	diags, fresh, err := c.Diagnostics(ctx, main)
+	if err != nil || !fresh || len(diags) != 0 {
+		t.Fatalf("Diagnostics() = %+v, %v, %v; want none", diags, fresh, err)
+	}
+
+	// An edit on disk is sent to the server before asking again
+	if err := os.WriteFile(main, []byte("func Foo() {}\nbad\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	diags, fresh, err = c.Diagnostics(ctx, main)
+	if err != nil || !fresh || len(diags) != 1 || diags[0].Range.Start.Line != 1 || diags[0].Severity.String() != "error" {
+		t.Fatalf("Diagnostics() after edit = %+v, %v, %v; want the bad line", diags, fresh, err)
+	}
+}
+
+func TestManagerRestartsServer(t *testing.T) {
+	m, _ := startFake(t)
+	ctx := context.Background()
+	c, err := m.Client(ctx)
+	if err != nil {
+		t.Fatalf("Client() error = %v", err)
+	}
+	c.proc.Kill()
+	<-c.conn.done
+
+	c2, err := m.Client(ctx)
+	if err != nil || c2 == c || !c2.Alive() {
+		t.Fatalf("Client() after exit = %p, %v; want a new running client", c2, err)
+	}
+}
+
+func TestManagerStartFailure(t *testing.T) {
+	m := NewManager(t.TempDir(), nil, "/no/such/language-server")
+	_, err := m.Client(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "lsp_command") {
+		t.Fatalf("Client() error = %v, want a hint to set lsp_command", err)
+	}
+	if !m.Available() || m.ServerName() != "/no/such/language-server" {
+		t.Errorf("Available() = %v, ServerName() = %q", m.Available(), m.ServerName())
+	}
+	if NewManager(t.TempDir(), nil, "").Available() {
+		t.Error("Available() for an empty directory, want no server")
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	in := "Content-Length: 38\r\nContent-Type: application/vscode-jsonrpc\r\n\r\n{\"jsonrpc\":\"2.0\",\"id\":1,\"result\":null}"
+	m, err := readMessage(bufio.NewReader(strings.NewReader(in)))
+	if err != nil || string(m.ID) != "1" {
+		t.Fatalf("readMessage() = %+v, %v", m, err)
+	}
+}
@@ -0,0 +1,178 @@
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ChamsBouzaiene/dodo/internal/jsonrpc"
+)
+
+// handler answers what a server sends unasked: requests (with an ID), whose
+// result is sent back, and notifications.
+type handler func(m *jsonrpc.Message) (result any, err *jsonrpc.Error)
+
+// conn is a JSON-RPC connection framed with Content-Length headers, as the
+// language server protocol's base protocol specifies.
+type conn struct {
+	w       io.Writer
+	writeMu sync.Mutex
+	handle  handler
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan *jsonrpc.Message
+	err     error         // why the connection ended, once it has
+	done    chan struct{} // closed when the server's output ends
+}
+
+func newConn(r io.Reader, w io.Writer, handle handler) *conn {
+	c := &conn{
+		w:       w,
+		handle:  handle,
+		pending: make(map[int64]chan *jsonrpc.Message),
+		done:    make(chan struct{}),
+	}
+	go c.read(r)
+	return c
+}
+
+func (c *conn) read(r io.Reader) {
+	br := bufio.NewReader(r)
+	var err error
+	for {
+		var m *jsonrpc.Message
+		if m, err = readMessage(br); err != nil {
+			break
+		}
+		switch {
+		case m.IsResponse():
+			id := m.ResponseID()
+			c.mu.Lock()
+			ch := c.pending[id]
+			delete(c.pending, id)
+			c.mu.Unlock()
+			if ch != nil {
+				ch <- m
+			}
+		case len(m.ID) > 0:
+			// Answered in turn, so the reply to a request that depends
+			// on an earlier notification is sent after it is handled.
+			result, rpcErr := c.handle(m)
+			reply := map[string]any{"jsonrpc": "2.0", "id": m.ID}
+			if rpcErr != nil {
+				reply["error"] = rpcErr
+			} else {
+				reply["result"] = result
+			}
+			c.write(reply)
+		default:
+			c.handle(m)
+		}
+	}
+
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrClosedPipe) {
+		err = errors.New("language server exited")
+	}
+	c.mu.Lock()
+	c.err = err
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+	close(c.done)
+}
+
+func readMessage(br *bufio.Reader) (*jsonrpc.Message, error) {
+	headers, err := textproto.NewReader(br).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(strings.TrimSpace(headers.Get("Content-Length")))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid Content-Length %q", headers.Get("Content-Length"))
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(br, body); err != nil {
+		return nil, err
+	}
+	var m jsonrpc.Message
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, fmt.Errorf("malformed message: %w", err)
+	}
+	return &m, nil
+}
+
+func (c *conn) write(v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = c.w.Write(body)
+	return err
+}
+
+// call sends a request and decodes its result into out, which may be nil.
+// A cancelled call is also cancelled on the server.
+func (c *conn) call(ctx context.Context, method string, params, out any) error {
+	ch := make(chan *jsonrpc.Message, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	if err := c.write(jsonrpc.Request{JSONRPC: "2.0", ID: &id, Method: method, Params: params}); err != nil {
+		c.forget(id)
+		return err
+	}
+	select {
+	case m, ok := <-ch:
+		if !ok {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return c.err
+		}
+		if m.Error != nil {
+			return m.Error
+		}
+		if out == nil || len(m.Result) == 0 {
+			return nil
+		}
+		if err := json.Unmarshal(m.Result, out); err != nil {
+			return fmt.Errorf("%s: invalid result: %w", method, err)
+		}
+		return nil
+	case <-ctx.Done():
+		c.forget(id)
+		c.notify("$/cancelRequest", map[string]any{"id": id})
+		return ctx.Err()
+	}
+}
+
+func (c *conn) forget(id int64) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+func (c *conn) notify(method string, params any) error {
+	return c.write(jsonrpc.Request{JSONRPC: "2.0", Method: method, Params: params})
+}
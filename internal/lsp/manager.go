@@ -0,0 +1,124 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ChamsBouzaiene/dodo/internal/jsonrpc"
+	"github.com/ChamsBouzaiene/dodo/internal/sandbox"
+	"github.com/ChamsBouzaiene/dodo/internal/workspace"
+)
+
+// startTimeout bounds starting and initializing a server.
+const startTimeout = time.Minute
+
+// retryAfter is how long a server that failed to start is left alone
+// before it is tried again.
+const retryAfter = 30 * time.Second
+
+// Manager runs the language server of one repository, starting it on first
+// use and again if it exits. The server runs where runner runs commands
+// when runner is a sandbox.Starter, and on the host otherwise.
+type Manager struct {
+	root   string
+	runner sandbox.Runner
+	server Server
+	known  bool
+
+	mu       sync.Mutex
+	client   *Client
+	err      error // why the server last failed to start
+	failedAt time.Time
+	closed   bool
+}
+
+// NewManager returns the manager for the repository at root. commandLine,
+// when set, replaces the server picked by the repository's project type.
+func NewManager(root string, runner sandbox.Runner, commandLine string) *Manager {
+	server, known := ParseServer(commandLine)
+	if !known {
+		server, known = ServerFor(workspace.DetectProjectType(root))
+	}
+	return &Manager{root: root, runner: runner, server: server, known: known}
+}
+
+// Available reports whether there is a language server for the
+// repository. It may still fail to start, e.g. when it isn't installed.
+func (m *Manager) Available() bool {
+	return m.known
+}
+
+// ServerName is the command of the repository's language server.
+func (m *Manager) ServerName() string {
+	return m.server.Command
+}
+
+// Client returns a running client, starting the server if needed.
+func (m *Manager) Client(ctx context.Context) (*Client, error) {
+	if !m.known {
+		return nil, fmt.Errorf("no language server is known for this project")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, fmt.Errorf("language server manager is closed")
+	}
+	if m.client != nil && m.client.Alive() {
+		return m.client, nil
+	}
+	if m.client != nil {
+		log.Printf("lsp: %s exited; restarting it", m.server.Command)
+		m.client.Close()
+		m.client = nil
+	}
+	if m.err != nil && time.Since(m.failedAt) < retryAfter {
+		return nil, m.err
+	}
+
+	client, err := m.start(ctx)
+	if err != nil {
+		m.err, m.failedAt = err, time.Now()
+		return nil, err
+	}
+	m.client, m.err = client, nil
+	return client, nil
+}
+
+func (m *Manager) start(ctx context.Context) (*Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, startTimeout)
+	defer cancel()
+
+	stderr := &jsonrpc.LogWriter{Prefix: "lsp[" + m.server.Command + "]: "}
+	var proc *sandbox.Process
+	var err error
+	if starter, ok := m.runner.(sandbox.Starter); ok {
+		proc, err = starter.Start(ctx, m.root, m.server.Command, m.server.Args, stderr)
+	} else {
+		proc, err = sandbox.StartOnHost(ctx, m.root, m.server.Command, m.server.Args, stderr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("start %s: %w (install it, or set lsp_command)", m.server.Command, err)
+	}
+	client, err := Start(ctx, proc, m.root)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", m.server.Command, err)
+	}
+	log.Printf("lsp: %s started for %s", m.server.Command, m.root)
+	return client, nil
+}
+
+// Close stops the server, if it runs.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	client := m.client
+	m.client, m.closed = nil, true
+	m.mu.Unlock()
+	if client != nil {
+		if err := client.Close(); err != nil {
+			log.Printf("lsp: stopping %s: %v", m.server.Command, err)
+		}
+	}
+}
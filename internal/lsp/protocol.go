@@ -0,0 +1,92 @@
+package lsp
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Position is a zero-based line and UTF-16 column in a document.
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// Range is a span of a document; End is exclusive.
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// Location is a range in a file, named by its path on the host.
+type Location struct {
+	Path  string
+	Range Range
+}
+
+// location is a Location as servers send it, or a LocationLink.
+type location struct {
+	URI                  string `json:"uri"`
+	Range                Range  `json:"range"`
+	TargetURI            string `json:"targetUri"`
+	TargetSelectionRange *Range `json:"targetSelectionRange"`
+}
+
+// DiagnosticSeverity ranks a diagnostic.
+type DiagnosticSeverity int
+
+const (
+	SeverityError       DiagnosticSeverity = 1
+	SeverityWarning     DiagnosticSeverity = 2
+	SeverityInformation DiagnosticSeverity = 3
+	SeverityHint        DiagnosticSeverity = 4
+)
+
+func (s DiagnosticSeverity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	case SeverityInformation:
+		return "info"
+	case SeverityHint:
+		return "hint"
+	default:
+		return "error" // servers that omit it report errors
+	}
+}
+
+// Diagnostic is a problem a server found in a document.
+type Diagnostic struct {
+	Range    Range              `json:"range"`
+	Severity DiagnosticSeverity `json:"severity,omitempty"`
+	Code     json.RawMessage    `json:"code,omitempty"` // a number or a string
+	Source   string             `json:"source,omitempty"`
+	Message  string             `json:"message"`
+}
+
+// hoverContents decodes the contents of a hover result, which may be a
+// MarkupContent, a MarkedString or a list of MarkedStrings.
+func hoverContents(raw json.RawMessage) string {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text
+	}
+	var one struct {
+		Value string `json:"value"`
+	}
+	if json.Unmarshal(raw, &one) == nil && one.Value != "" {
+		return one.Value
+	}
+	var many []json.RawMessage
+	if json.Unmarshal(raw, &many) == nil {
+		parts := make([]string, 0, len(many))
+		for _, m := range many {
+			if part := hoverContents(m); part != "" {
+				parts = append(parts, part)
+			}
+		}
+		return strings.Join(parts, "\n\n")
+	}
+	return ""
+}
@@ -0,0 +1,62 @@
+package lsp
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/ChamsBouzaiene/dodo/internal/workspace"
+)
+
+// Server is the command that runs a language server.
+type Server struct {
+	Command string
+	Args    []string
+}
+
+// ServerFor returns the language server for a project type.
+func ServerFor(projectType workspace.ProjectType) (Server, bool) {
+	switch projectType {
+	case workspace.ProjectTypeGo:
+		return Server{Command: "gopls"}, true
+	case workspace.ProjectTypeNode:
+		return Server{Command: "typescript-language-server", Args: []string{"--stdio"}}, true
+	case workspace.ProjectTypePython:
+		return Server{Command: "pyright-langserver", Args: []string{"--stdio"}}, true
+	case workspace.ProjectTypeRust:
+		return Server{Command: "rust-analyzer"}, true
+	default:
+		return Server{}, false
+	}
+}
+
+// ParseServer reads a server from a command line such as
+// "pylsp -v"; arguments are separated by spaces.
+func ParseServer(commandLine string) (Server, bool) {
+	fields := strings.Fields(commandLine)
+	if len(fields) == 0 {
+		return Server{}, false
+	}
+	return Server{Command: fields[0], Args: fields[1:]}, true
+}
+
+// languageIDs maps file extensions to LSP language identifiers.
+var languageIDs = map[string]string{
+	".go":  "go",
+	".ts":  "typescript",
+	".tsx": "typescriptreact",
+	".mts": "typescript",
+	".cts": "typescript",
+	".js":  "javascript",
+	".jsx": "javascriptreact",
+	".mjs": "javascript",
+	".cjs": "javascript",
+	".py":  "python",
+	".pyi": "python",
+	".rs":  "rust",
+}
+
+// languageID returns the language of the file at path, or "" if no
+// supported server handles it.
+func languageID(path string) string {
+	return languageIDs[strings.ToLower(filepath.Ext(path))]
+}
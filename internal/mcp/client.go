@@ -0,0 +1,205 @@
+// Package mcp speaks the Model Context Protocol: a client that lets
+// sessions call the tools MCP servers offer, and a server that offers
+// dodo's own tools to other MCP clients.
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ChamsBouzaiene/dodo/internal/config"
+	"github.com/ChamsBouzaiene/dodo/internal/jsonrpc"
+)
+
+// ProtocolVersion is the MCP revision this client speaks.
+const ProtocolVersion = "2025-06-18"
+
+// transport carries JSON-RPC messages to one server.
+type transport interface {
+	call(ctx context.Context, req jsonrpc.Request) (json.RawMessage, error)
+	notify(ctx context.Context, method string, params any) error
+	close() error
+}
+
+// reply answers a request the server sent us. Servers may ping; nothing
+// else a client can be asked is supported.
+func reply(m *jsonrpc.Message) jsonrpc.Response {
+	if m.Method == "ping" {
+		return jsonrpc.Response{JSONRPC: "2.0", ID: m.ID, Result: struct{}{}}
+	}
+	return jsonrpc.Response{JSONRPC: "2.0", ID: m.ID, Error: &jsonrpc.Error{Code: jsonrpc.MethodNotFound, Message: "method not found: " + m.Method}}
+}
+
+// Implementation names an MCP client or server.
+type Implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// Tool is a tool a server offers.
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"inputSchema,omitempty"`
+}
+
+// Content is one item of a tool result.
+type Content struct {
+	Type     string    `json:"type"` // text, image, audio, resource or resource_link
+	Text     string    `json:"text,omitempty"`
+	MimeType string    `json:"mimeType,omitempty"`
+	URI      string    `json:"uri,omitempty"`
+	Resource *Resource `json:"resource,omitempty"`
+}
+
+// Resource is the content of an embedded resource.
+type Resource struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+}
+
+// CallResult is the result of a tool call.
+type CallResult struct {
+	Content           []Content       `json:"content"`
+	StructuredContent json.RawMessage `json:"structuredContent,omitempty"`
+	IsError           bool            `json:"isError,omitempty"`
+}
+
+// Text renders r for a model: text items as they are, others as a short
+// placeholder, and structured content when there is nothing else.
+func (r *CallResult) Text() string {
+	var parts []string
+	for _, c := range r.Content {
+		switch {
+		case c.Type == "text":
+			parts = append(parts, c.Text)
+		case c.Type == "resource" && c.Resource != nil && c.Resource.Text != "":
+			parts = append(parts, c.Resource.Text)
+		case c.Type == "resource" && c.Resource != nil:
+			parts = append(parts, fmt.Sprintf("[resource %s]", c.Resource.URI))
+		case c.URI != "":
+			parts = append(parts, fmt.Sprintf("[%s %s]", c.Type, c.URI))
+		default:
+			parts = append(parts, fmt.Sprintf("[%s %s]", c.Type, c.MimeType))
+		}
+	}
+	if len(parts) == 0 && len(r.StructuredContent) > 0 {
+		return string(r.StructuredContent)
+	}
+	return strings.Join(parts, "\n")
+}
+
+// Client is a connection to one MCP server.
+type Client struct {
+	Name       string // the server's name in the configuration
+	ServerInfo Implementation
+
+	t       transport
+	timeout time.Duration
+	nextID  atomic.Int64
+}
+
+// Connect starts or dials the server declared as name and performs the
+// initialize handshake. Stdio servers run in dir.
+func Connect(ctx context.Context, name string, server config.MCPServer, dir string) (*Client, error) {
+	c := &Client{Name: name, timeout: server.RequestTimeout()}
+	if server.URL != "" {
+		c.t = newHTTP(name, server.URL, server.Headers)
+	} else {
+		t, err := startStdio(name, server.Command, server.Args, server.Env, dir)
+		if err != nil {
+			return nil, err
+		}
+		c.t = t
+	}
+
+	var init struct {
+		ProtocolVersion string         `json:"protocolVersion"`
+		ServerInfo      Implementation `json:"serverInfo"`
+	}
+	err := c.call(ctx, "initialize", map[string]any{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      Implementation{Name: "dodo"},
+	}, &init)
+	if err == nil {
+		if t, ok := c.t.(*httpTransport); ok {
+			t.setVersion(init.ProtocolVersion)
+		}
+		err = c.t.notify(ctx, "notifications/initialized", nil)
+	}
+	if err != nil {
+		c.t.close()
+		return nil, fmt.Errorf("initialize: %w", err)
+	}
+	c.ServerInfo = init.ServerInfo
+	return c, nil
+}
+
+// call sends a request and decodes its result into out, giving up after
+// the server's timeout.
+func (c *Client) call(ctx context.Context, method string, params, out any) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	id := c.nextID.Add(1)
+	result, err := c.t.call(ctx, jsonrpc.Request{JSONRPC: "2.0", ID: &id, Method: method, Params: params})
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%s timed out after %s", method, c.timeout)
+	}
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(result, out); err != nil {
+		return fmt.Errorf("%s: invalid result: %w", method, err)
+	}
+	return nil
+}
+
+// ListTools returns every tool the server offers.
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var tools []Tool
+	cursor := ""
+	for {
+		params := map[string]any{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		var page struct {
+			Tools      []Tool `json:"tools"`
+			NextCursor string `json:"nextCursor,omitempty"`
+		}
+		if err := c.call(ctx, "tools/list", params, &page); err != nil {
+			return nil, err
+		}
+		tools = append(tools, page.Tools...)
+		if page.NextCursor == "" || page.NextCursor == cursor {
+			return tools, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// CallTool calls the server's tool name with args.
+func (c *Client) CallTool(ctx context.Context, name string, args map[string]any) (*CallResult, error) {
+	if args == nil {
+		args = map[string]any{}
+	}
+	var result CallResult
+	if err := c.call(ctx, "tools/call", map[string]any{"name": name, "arguments": args}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Close disconnects from the server, stopping it if it is a command.
+func (c *Client) Close() error {
+	return c.t.close()
+}
@@ -0,0 +1,217 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ChamsBouzaiene/dodo/internal/config"
+	"github.com/ChamsBouzaiene/dodo/internal/jsonrpc"
+)
+
+// TestMain lets the test binary stand in for a stdio MCP server: a fake
+// one, or Server offering test tools.
+func TestMain(m *testing.M) {
+	switch os.Getenv("MCP_FAKE_SERVER") {
+	case "1":
+		serveFakeStdio()
+		os.Exit(0)
+	case "server":
+		serveTestTools()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeTools are served in two pages.
+var fakeTools = [][]map[string]any{
+	{{
+		"name":        "echo",
+		"description": "Echoes text",
+		"inputSchema": json.RawMessage(`{"$schema":"https://json-schema.org/draft/2020-12/schema","type":"object","properties":{"text":{"type":"string"}},"required":["text"]}`),
+	}},
+	{
+		{"name": "fail"},
+		{"name": "sleep"},
+		{"name": "weird.name"},
+	},
+}
+
+// handleFake answers one request the way an MCP server does.
+func handleFake(m *jsonrpc.Message) (any, *jsonrpc.Error) {
+	switch m.Method {
+	case "initialize":
+		return map[string]any{
+			"protocolVersion": ProtocolVersion,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      Implementation{Name: "fake", Version: "1.0"},
+		}, nil
+	case "tools/list":
+		var params struct{ Cursor string }
+		json.Unmarshal(m.Params, &params)
+		if params.Cursor == "" {
+			return map[string]any{"tools": fakeTools[0], "nextCursor": "2"}, nil
+		}
+		return map[string]any{"tools": fakeTools[1]}, nil
+	case "tools/call":
+		var params struct {
+			Name      string
+			Arguments map[string]any
+		}
+		json.Unmarshal(m.Params, &params)
+		switch params.Name {
+		case "echo":
+			return CallResult{Content: []Content{{Type: "text", Text: fmt.Sprintf("echo: %v", params.Arguments["text"])}}}, nil
+		case "fail":
+			return CallResult{Content: []Content{{Type: "text", Text: "nope"}}, IsError: true}, nil
+		case "sleep":
+			time.Sleep(time.Second)
+			return CallResult{}, nil
+		}
+	}
+	return nil, &jsonrpc.Error{Code: jsonrpc.MethodNotFound, Message: "no " + m.Method}
+}
+
+func serveFakeStdio() {
+	var mu sync.Mutex
+	out := json.NewEncoder(os.Stdout)
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var m jsonrpc.Message
+		if json.Unmarshal(scanner.Bytes(), &m) != nil || len(m.ID) == 0 || m.Method == "" {
+			continue
+		}
+		go func() {
+			result, rpcErr := handleFake(&m)
+			mu.Lock()
+			out.Encode(jsonrpc.Response{JSONRPC: "2.0", ID: m.ID, Result: result, Error: rpcErr})
+			mu.Unlock()
+		}()
+	}
+}
+
+func checkTools(t *testing.T, c *Client) {
+	t.Helper()
+	ctx := context.Background()
+	reg, err := c.EngineTools(ctx)
+	if err != nil {
+		t.Fatalf("EngineTools() error = %v", err)
+	}
+	var names []string
+	for name := range reg {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	want := "mcp__fake__echo,mcp__fake__fail,mcp__fake__sleep,mcp__fake__weird_name"
+	if got := strings.Join(names, ","); got != want {
+		t.Fatalf("tools = %s, want %s", got, want)
+	}
+
+	echo := reg["mcp__fake__echo"]
+	if err := echo.ValidateArgs(map[string]any{}); err == nil {
+		t.Error("ValidateArgs() accepted arguments missing the required text")
+	}
+	if err := echo.ValidateArgs(map[string]any{"text": "hi"}); err != nil {
+		t.Errorf("ValidateArgs() error = %v", err)
+	}
+	if got, err := echo.Fn(ctx, map[string]any{"text": "hi"}); err != nil || got != "echo: hi" {
+		t.Errorf("echo = %q, %v", got, err)
+	}
+	if _, err := reg["mcp__fake__fail"].Fn(ctx, nil); err == nil || err.Error() != "nope" {
+		t.Errorf("fail error = %v, want the tool's error text", err)
+	}
+	if _, err := reg["mcp__fake__sleep"].Fn(ctx, nil); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("sleep error = %v, want a timeout", err)
+	}
+}
+
+func TestStdioClient(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := config.MCPServer{Command: exe, Env: map[string]string{"MCP_FAKE_SERVER": "1"}, Timeout: "200ms"}
+	c, err := Connect(context.Background(), "fake", server, t.TempDir())
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	if c.ServerInfo.Name != "fake" {
+		t.Errorf("ServerInfo = %+v", c.ServerInfo)
+	}
+	checkTools(t, c)
+
+	if err := c.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if _, err := c.ListTools(context.Background()); err == nil {
+		t.Error("ListTools() after Close succeeded")
+	}
+}
+
+func TestHTTPClient(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		t.Run(fmt.Sprintf("stream=%v", stream), func(t *testing.T) {
+			var deleted atomic.Bool
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer s3c" {
+					http.Error(w, "unauthorized", http.StatusUnauthorized)
+					return
+				}
+				if r.Method == http.MethodDelete {
+					deleted.Store(true)
+					return
+				}
+				var m jsonrpc.Message
+				json.NewDecoder(r.Body).Decode(&m)
+				if m.Method != "initialize" && r.Header.Get("Mcp-Session-Id") != "sess-1" {
+					http.Error(w, "missing session", http.StatusBadRequest)
+					return
+				}
+				if len(m.ID) == 0 {
+					w.WriteHeader(http.StatusAccepted)
+					return
+				}
+				result, rpcErr := handleFake(&m)
+				data, _ := json.Marshal(jsonrpc.Response{JSONRPC: "2.0", ID: m.ID, Result: result, Error: rpcErr})
+				w.Header().Set("Mcp-Session-Id", "sess-1")
+				if stream {
+					w.Header().Set("Content-Type", "text/event-stream")
+					fmt.Fprintf(w, "event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\"}\n\n")
+					fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write(data)
+			}))
+			defer srv.Close()
+
+			server := config.MCPServer{URL: srv.URL, Headers: map[string]string{"Authorization": "Bearer s3c"}, Timeout: "200ms"}
+			c, err := Connect(context.Background(), "fake", server, "")
+			if err != nil {
+				t.Fatalf("Connect() error = %v", err)
+			}
+			checkTools(t, c)
+			c.Close()
+			if !deleted.Load() {
+				t.Error("Close() did not end the server-side session")
+			}
+		})
+	}
+}
+
+func TestConnectFailure(t *testing.T) {
+	_, err := Connect(context.Background(), "missing", config.MCPServer{Command: "/no/such/mcp-server"}, "")
+	if err == nil {
+		t.Fatal("Connect() to a missing command succeeded")
+	}
+}
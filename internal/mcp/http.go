@@ -0,0 +1,178 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/ChamsBouzaiene/dodo/internal/jsonrpc"
+)
+
+// httpTransport talks to a server over the Streamable HTTP transport: each
+// message is POSTed, and a request's response comes back as the JSON body
+// or as an event in a Server-Sent Events body.
+type httpTransport struct {
+	name    string
+	url     string
+	headers map[string]string
+	client  *http.Client
+
+	mu        sync.Mutex
+	sessionID string // Mcp-Session-Id assigned on initialize
+	version   string // negotiated protocol version, sent once known
+}
+
+func newHTTP(name, url string, headers map[string]string) *httpTransport {
+	return &httpTransport{name: name, url: url, headers: headers, client: &http.Client{}}
+}
+
+func (t *httpTransport) setVersion(v string) {
+	t.mu.Lock()
+	t.version = v
+	t.mu.Unlock()
+}
+
+func (t *httpTransport) newRequest(ctx context.Context, method string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, t.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	t.mu.Lock()
+	if t.sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", t.sessionID)
+	}
+	if t.version != "" {
+		req.Header.Set("MCP-Protocol-Version", t.version)
+	}
+	t.mu.Unlock()
+	return req, nil
+}
+
+// post sends v and returns the response, which the caller closes.
+func (t *httpTransport) post(ctx context.Context, v any) (*http.Response, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	req, err := t.newRequest(ctx, http.MethodPost, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("mcp server %s: %w", t.name, err)
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("mcp server %s: %s: %s", t.name, resp.Status, strings.TrimSpace(string(snippet)))
+	}
+	if id := resp.Header.Get("Mcp-Session-Id"); id != "" {
+		t.mu.Lock()
+		t.sessionID = id
+		t.mu.Unlock()
+	}
+	return resp, nil
+}
+
+func (t *httpTransport) call(ctx context.Context, req jsonrpc.Request) (json.RawMessage, error) {
+	resp, err := t.post(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var m *jsonrpc.Message
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		m, err = t.readStream(ctx, resp.Body, *req.ID)
+	} else {
+		m = new(jsonrpc.Message)
+		err = json.NewDecoder(resp.Body).Decode(m)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mcp server %s: %w", t.name, err)
+	}
+	if m.Error != nil {
+		return nil, m.Error
+	}
+	return m.Result, nil
+}
+
+// readStream reads Server-Sent Events until the response to request id,
+// answering requests the server makes along the way.
+func (t *httpTransport) readStream(ctx context.Context, body io.Reader, id int64) (*jsonrpc.Message, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if field, ok := strings.CutPrefix(line, "data:"); ok {
+			data = append(data, strings.TrimPrefix(field, " "))
+			continue
+		}
+		if line != "" || len(data) == 0 {
+			continue // other fields, or a blank line without data
+		}
+		payload := strings.Join(data, "\n")
+		data = nil
+
+		var m jsonrpc.Message
+		if err := json.Unmarshal([]byte(payload), &m); err != nil {
+			continue
+		}
+		switch {
+		case m.IsResponse() && m.ResponseID() == id:
+			return &m, nil
+		case !m.IsResponse() && len(m.ID) > 0:
+			if resp, err := t.post(ctx, reply(&m)); err == nil {
+				resp.Body.Close()
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("event stream ended without a response")
+}
+
+func (t *httpTransport) notify(ctx context.Context, method string, params any) error {
+	resp, err := t.post(ctx, jsonrpc.Request{JSONRPC: "2.0", Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// close ends the server-side session, if the server assigned one.
+func (t *httpTransport) close() error {
+	t.mu.Lock()
+	sessionID := t.sessionID
+	t.mu.Unlock()
+	if sessionID == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), closeGrace)
+	defer cancel()
+	req, err := t.newRequest(ctx, http.MethodDelete, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
@@ -0,0 +1,211 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/ChamsBouzaiene/dodo/internal/engine"
+	"github.com/ChamsBouzaiene/dodo/internal/jsonrpc"
+)
+
+// supportedVersions are the MCP revisions Server accepts from a client;
+// they don't differ in anything a tools-only server does.
+var supportedVersions = map[string]bool{
+	ProtocolVersion: true,
+	"2025-03-26":    true,
+	"2024-11-05":    true,
+}
+
+// Server offers engine tools to MCP clients.
+type Server struct {
+	Info         Implementation
+	Instructions string // optional hint for the client's model
+	Tools        engine.ToolRegistry
+
+	writeMu sync.Mutex
+	out     io.Writer
+
+	mu       sync.Mutex
+	inFlight map[string]context.CancelFunc // tools/call requests by ID
+}
+
+// ServeStdio answers the JSON-RPC messages read from in, one per line, on
+// out until in ends. Tool calls run concurrently and can be cancelled by the
+// client; those still running when in ends are cancelled and waited for.
+func (s *Server) ServeStdio(ctx context.Context, in io.Reader, out io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	s.out = out
+	s.inFlight = make(map[string]context.CancelFunc)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	reader := bufio.NewReader(in)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			s.handle(ctx, &wg, line)
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(ctx context.Context, wg *sync.WaitGroup, line []byte) {
+	var m jsonrpc.Message
+	if err := json.Unmarshal(line, &m); err != nil {
+		s.write(jsonrpc.Response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &jsonrpc.Error{Code: jsonrpc.ParseError, Message: err.Error()}})
+		return
+	}
+	if m.Method == "" {
+		return // a response; this server sends no requests
+	}
+	if len(m.ID) == 0 {
+		s.notification(&m)
+		return
+	}
+
+	switch m.Method {
+	case "initialize":
+		s.respond(&m, s.initialize(&m), nil)
+	case "ping":
+		s.respond(&m, struct{}{}, nil)
+	case "tools/list":
+		s.respond(&m, map[string]any{"tools": s.listTools()}, nil)
+	case "tools/call":
+		callCtx, cancel := context.WithCancel(ctx)
+		s.mu.Lock()
+		s.inFlight[string(m.ID)] = cancel
+		s.mu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, rpcErr := s.callTool(callCtx, &m)
+			s.mu.Lock()
+			delete(s.inFlight, string(m.ID))
+			s.mu.Unlock()
+			cancel()
+			s.respond(&m, result, rpcErr)
+		}()
+	default:
+		s.respond(&m, nil, &jsonrpc.Error{Code: jsonrpc.MethodNotFound, Message: "method not found: " + m.Method})
+	}
+}
+
+// notification acts on the notifications a client may send; only
+// cancellation needs anything done.
+func (s *Server) notification(m *jsonrpc.Message) {
+	if m.Method != "notifications/cancelled" {
+		return
+	}
+	var params struct {
+		RequestID json.RawMessage `json:"requestId"`
+	}
+	if json.Unmarshal(m.Params, &params) != nil {
+		return
+	}
+	s.mu.Lock()
+	cancel := s.inFlight[string(params.RequestID)]
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+func (s *Server) initialize(m *jsonrpc.Message) map[string]any {
+	var params struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	json.Unmarshal(m.Params, &params)
+	version := ProtocolVersion
+	if supportedVersions[params.ProtocolVersion] {
+		version = params.ProtocolVersion
+	}
+	result := map[string]any{
+		"protocolVersion": version,
+		"capabilities":    map[string]any{"tools": map[string]any{}},
+		"serverInfo":      s.Info,
+	}
+	if s.Instructions != "" {
+		result["instructions"] = s.Instructions
+	}
+	return result
+}
+
+func (s *Server) listTools() []Tool {
+	tools := make([]Tool, 0, len(s.Tools))
+	for name, t := range s.Tools {
+		tools = append(tools, Tool{
+			Name:        name,
+			Description: t.Description,
+			InputSchema: json.RawMessage(t.SchemaJSON),
+		})
+	}
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+	return tools
+}
+
+// callTool runs a tools/call request. A tool that fails, or is called with
+// arguments its schema rejects, is reported in the result for the client's
+// model to see; only an unknown tool is a protocol error.
+func (s *Server) callTool(ctx context.Context, m *jsonrpc.Message) (*CallResult, *jsonrpc.Error) {
+	var params struct {
+		Name      string         `json:"name"`
+		Arguments map[string]any `json:"arguments"`
+	}
+	if err := json.Unmarshal(m.Params, &params); err != nil {
+		return nil, &jsonrpc.Error{Code: jsonrpc.InvalidParams, Message: err.Error()}
+	}
+	tool, ok := s.Tools[params.Name]
+	if !ok {
+		return nil, &jsonrpc.Error{Code: jsonrpc.InvalidParams, Message: "unknown tool: " + params.Name}
+	}
+	if params.Arguments == nil {
+		params.Arguments = map[string]any{}
+	}
+	if err := tool.ValidateArgs(params.Arguments); err != nil {
+		return errorResult(err), nil
+	}
+	text, err := tool.Fn(ctx, params.Arguments)
+	if err != nil {
+		return errorResult(err), nil
+	}
+	return &CallResult{Content: []Content{{Type: "text", Text: text}}}, nil
+}
+
+func errorResult(err error) *CallResult {
+	return &CallResult{Content: []Content{{Type: "text", Text: err.Error()}}, IsError: true}
+}
+
+func (s *Server) respond(m *jsonrpc.Message, result any, rpcErr *jsonrpc.Error) {
+	if rpcErr != nil {
+		s.write(jsonrpc.Response{JSONRPC: "2.0", ID: m.ID, Error: rpcErr})
+		return
+	}
+	s.write(jsonrpc.Response{JSONRPC: "2.0", ID: m.ID, Result: result})
+}
+
+func (s *Server) write(r jsonrpc.Response) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		data, _ = json.Marshal(jsonrpc.Response{JSONRPC: "2.0", ID: r.ID, Error: &jsonrpc.Error{Code: jsonrpc.InternalError, Message: fmt.Sprintf("encoding result: %v", err)}})
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if _, err := s.out.Write(append(data, '\n')); err != nil {
+		log.Printf("mcp: writing response: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ChamsBouzaiene/dodo/internal/config"
+	"github.com/ChamsBouzaiene/dodo/internal/engine"
+	"github.com/ChamsBouzaiene/dodo/internal/jsonrpc"
+)
+
+func serveTestTools() {
+	server := &Server{
+		Info: Implementation{Name: "dodo-test"},
+		Tools: engine.ToolRegistry{
+			"add": {
+				Name:        "add",
+				Description: "Adds two numbers",
+				SchemaJSON:  `{"type":"object","properties":{"a":{"type":"number"},"b":{"type":"number"}},"required":["a","b"]}`,
+				Fn: func(_ context.Context, args map[string]any) (string, error) {
+					return fmt.Sprint(args["a"].(float64) + args["b"].(float64)), nil
+				},
+			},
+			"boom": {
+				Name:       "boom",
+				SchemaJSON: `{"type":"object","properties":{}}`,
+				Fn: func(context.Context, map[string]any) (string, error) {
+					return "", errors.New("it broke")
+				},
+			},
+		},
+	}
+	server.ServeStdio(context.Background(), os.Stdin, os.Stdout)
+}
+
+func TestServer(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	c, err := Connect(ctx, "dodo", config.MCPServer{Command: exe, Env: map[string]string{"MCP_FAKE_SERVER": "server"}}, t.TempDir())
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer c.Close()
+	if c.ServerInfo.Name != "dodo-test" {
+		t.Errorf("ServerInfo = %+v", c.ServerInfo)
+	}
+
+	tools, err := c.ListTools(ctx)
+	if err != nil {
+		t.Fatalf("ListTools() error = %v", err)
+	}
+	if len(tools) != 2 || tools[0].Name != "add" || tools[1].Name != "boom" || !strings.Contains(string(tools[0].InputSchema), `"required"`) {
+		t.Fatalf("ListTools() = %+v", tools)
+	}
+
+	res, err := c.CallTool(ctx, "add", map[string]any{"a": 2, "b": 3})
+	if err != nil || res.IsError || res.Text() != "5" {
+		t.Errorf("add = %+v, %v", res, err)
+	}
+	res, err = c.CallTool(ctx, "add", map[string]any{"a": 2})
+	if err != nil || !res.IsError || !strings.Contains(res.Text(), "b") {
+		t.Errorf("add without b = %+v, %v; want a validation error result", res, err)
+	}
+	res, err = c.CallTool(ctx, "boom", nil)
+	if err != nil || !res.IsError || res.Text() != "it broke" {
+		t.Errorf("boom = %+v, %v", res, err)
+	}
+	var rpcErr *jsonrpc.Error
+	if _, err := c.CallTool(ctx, "missing", nil); !errors.As(err, &rpcErr) || rpcErr.Code != jsonrpc.InvalidParams {
+		t.Errorf("missing tool error = %v, want invalid params", err)
+	}
+}
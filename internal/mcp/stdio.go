@@ -0,0 +1,176 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/ChamsBouzaiene/dodo/internal/jsonrpc"
+)
+
+// stdioTransport talks to a server process over its stdin and stdout, one
+// JSON-RPC message per line.
+type stdioTransport struct {
+	name string
+	cmd  *exec.Cmd
+	in   io.WriteCloser
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[int64]chan *jsonrpc.Message
+	err     error         // why the connection ended, once it has
+	done    chan struct{} // closed when stdout ends
+}
+
+// closeGrace is how long a server gets to exit after its stdin is closed.
+const closeGrace = 2 * time.Second
+
+func startStdio(name, command string, args []string, env map[string]string, dir string) (*stdioTransport, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Stderr = &jsonrpc.LogWriter{Prefix: "mcp[" + name + "]: "}
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", command, err)
+	}
+
+	t := &stdioTransport{
+		name:    name,
+		cmd:     cmd,
+		in:      in,
+		pending: make(map[int64]chan *jsonrpc.Message),
+		done:    make(chan struct{}),
+	}
+	go t.read(out)
+	return t, nil
+}
+
+func (t *stdioTransport) read(out io.Reader) {
+	scanner := bufio.NewScanner(out)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var m jsonrpc.Message
+		if err := json.Unmarshal(line, &m); err != nil {
+			log.Printf("mcp[%s]: ignoring malformed message: %v", t.name, err)
+			continue
+		}
+		switch {
+		case m.IsResponse():
+			t.mu.Lock()
+			ch := t.pending[m.ResponseID()]
+			delete(t.pending, m.ResponseID())
+			t.mu.Unlock()
+			if ch != nil {
+				ch <- &m
+			}
+		case len(m.ID) > 0:
+			if err := t.write(reply(&m)); err != nil {
+				log.Printf("mcp[%s]: reply to %s: %v", t.name, m.Method, err)
+			}
+		}
+		// Notifications (logging, progress, list changes) are not acted on.
+	}
+
+	err := scanner.Err()
+	if err == nil {
+		err = errors.New("server closed its output")
+	}
+	t.mu.Lock()
+	t.err = fmt.Errorf("mcp server %s: %w", t.name, err)
+	for id, ch := range t.pending {
+		close(ch)
+		delete(t.pending, id)
+	}
+	t.mu.Unlock()
+	close(t.done)
+}
+
+func (t *stdioTransport) write(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	_, err = t.in.Write(append(data, '\n'))
+	return err
+}
+
+func (t *stdioTransport) call(ctx context.Context, req jsonrpc.Request) (json.RawMessage, error) {
+	ch := make(chan *jsonrpc.Message, 1)
+	t.mu.Lock()
+	if t.err != nil {
+		t.mu.Unlock()
+		return nil, t.err
+	}
+	t.pending[*req.ID] = ch
+	t.mu.Unlock()
+
+	if err := t.write(req); err != nil {
+		t.forget(*req.ID)
+		return nil, fmt.Errorf("mcp server %s: %w", t.name, err)
+	}
+	select {
+	case m, ok := <-ch:
+		if !ok {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			return nil, t.err
+		}
+		if m.Error != nil {
+			return nil, m.Error
+		}
+		return m.Result, nil
+	case <-ctx.Done():
+		t.forget(*req.ID)
+		return nil, ctx.Err()
+	}
+}
+
+func (t *stdioTransport) forget(id int64) {
+	t.mu.Lock()
+	delete(t.pending, id)
+	t.mu.Unlock()
+}
+
+func (t *stdioTransport) notify(_ context.Context, method string, params any) error {
+	return t.write(jsonrpc.Request{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// close ends the server's input and gives it closeGrace to exit before
+// killing it.
+func (t *stdioTransport) close() error {
+	t.in.Close()
+	select {
+	case <-t.done:
+	case <-time.After(closeGrace):
+		t.cmd.Process.Kill()
+	}
+	t.cmd.Wait() // its exit status is of no interest once we hang up
+	return nil
+}
@@ -0,0 +1,116 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+
+	"github.com/ChamsBouzaiene/dodo/internal/engine"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// ToolPrefix starts the name of every tool imported from an MCP server:
+// mcp__<server>__<tool>.
+const ToolPrefix = "mcp__"
+
+// maxToolNameLen is the longest tool name the providers accept.
+const maxToolNameLen = 64
+
+// maxResultChars bounds what a tool call returns to the model.
+const maxResultChars = 50_000
+
+var invalidToolNameChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// ToolName returns the name a server's tool is registered under.
+func ToolName(server, tool string) string {
+	name := ToolPrefix + server + "__" + invalidToolNameChars.ReplaceAllString(tool, "_")
+	if len(name) > maxToolNameLen {
+		name = name[:maxToolNameLen]
+	}
+	return name
+}
+
+// EngineTools lists the server's tools and wraps each as an engine.Tool
+// named by ToolName. Arguments are checked against the tool's input schema
+// by engine.Tool.ValidateArgs before the server is called; tools whose
+// schema cannot be compiled are left out.
+func (c *Client) EngineTools(ctx context.Context) (engine.ToolRegistry, error) {
+	tools, err := c.ListTools(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reg := make(engine.ToolRegistry, len(tools))
+	for _, t := range tools {
+		name := ToolName(c.Name, t.Name)
+		if _, dup := reg[name]; dup {
+			log.Printf("mcp[%s]: skipping tool %q: its name collides as %s", c.Name, t.Name, name)
+			continue
+		}
+		schema, err := inputSchema(t.InputSchema)
+		if err != nil {
+			log.Printf("mcp[%s]: skipping tool %q: %v", c.Name, t.Name, err)
+			continue
+		}
+		description := t.Description
+		if description == "" {
+			description = t.Name
+		}
+		reg[name] = engine.Tool{
+			Name:        name,
+			Description: fmt.Sprintf("[MCP server %s] %s", c.Name, description),
+			SchemaJSON:  schema,
+			Fn:          c.toolFunc(t.Name),
+			Metadata: engine.ToolMetadata{
+				Category: "mcp",
+				Tags:     []string{"mcp:" + c.Name},
+			},
+		}
+	}
+	return reg, nil
+}
+
+// inputSchema prepares a tool's input schema for the model and for
+// ValidateArgs: "$schema" is dropped, since servers may name drafts the
+// validator doesn't know, and a missing type is taken to be an object.
+func inputSchema(raw json.RawMessage) (string, error) {
+	schema := map[string]any{}
+	if len(raw) > 0 && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &schema); err != nil {
+			return "", fmt.Errorf("invalid input schema: %w", err)
+		}
+	}
+	delete(schema, "$schema")
+	if _, ok := schema["type"]; !ok {
+		schema["type"] = "object"
+	}
+	if _, ok := schema["properties"]; !ok {
+		schema["properties"] = map[string]any{}
+	}
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return "", err
+	}
+	if _, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(data)); err != nil {
+		return "", fmt.Errorf("invalid input schema: %w", err)
+	}
+	return string(data), nil
+}
+
+func (c *Client) toolFunc(tool string) engine.ToolFunc {
+	return func(ctx context.Context, args map[string]any) (string, error) {
+		result, err := c.CallTool(ctx, tool, args)
+		if err != nil {
+			return "", err
+		}
+		text := result.Text()
+		if len(text) > maxResultChars {
+			text = text[:maxResultChars] + fmt.Sprintf("\n[truncated: result exceeded %d characters]", maxResultChars)
+		}
+		if result.IsError {
+			return "", fmt.Errorf("%s", text)
+		}
+		return text, nil
+	}
+}
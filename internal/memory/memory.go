@@ -0,0 +1,318 @@
+// Package memory keeps what the agent learns about a repository across
+// sessions: facts, conventions and decisions, one Markdown file each under
+// .dodo/memory, so that they can be reviewed, edited and committed like the
+// rest of the project's .dodo files.
+package memory
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dir is where a repository's memories are kept, relative to its root.
+const Dir = ".dodo/memory"
+
+// Kinds of memory.
+const (
+	KindFact       = "fact"       // how the project is, e.g. where things live
+	KindConvention = "convention" // how the project does things
+	KindDecision   = "decision"   // a choice made, with its reason
+)
+
+// ErrNotFound reports a memory that does not exist.
+var ErrNotFound = errors.New("memory not found")
+
+// validID matches the file names memories can have; hand-written memories
+// may use any such name.
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Memory is one remembered item.
+type Memory struct {
+	ID        string
+	Kind      string
+	Content   string
+	Tags      []string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// ValidKind reports whether kind is one of the kinds of memory.
+func ValidKind(kind string) bool {
+	switch kind {
+	case KindFact, KindConvention, KindDecision:
+		return true
+	}
+	return false
+}
+
+// Store reads and writes a repository's memories.
+type Store struct {
+	dir string
+	mu  sync.Mutex // serializes the duplicate check and write of Remember
+}
+
+// NewStore returns the store of the repository at repoRoot. The directory
+// is created with the first memory.
+func NewStore(repoRoot string) *Store {
+	return &Store{dir: filepath.Join(repoRoot, filepath.FromSlash(Dir))}
+}
+
+// List returns every memory, most recently updated first. Files that cannot
+// be read are skipped.
+func (s *Store) List() ([]Memory, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", Dir, err)
+	}
+	var memories []Memory
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".md")
+		if !ok || e.IsDir() || !validID.MatchString(id) {
+			continue
+		}
+		if m, err := s.read(id); err == nil {
+			memories = append(memories, m)
+		}
+	}
+	sort.SliceStable(memories, func(i, j int) bool {
+		return memories[i].UpdatedAt.After(memories[j].UpdatedAt)
+	})
+	return memories, nil
+}
+
+// Get returns the memory with the given ID.
+func (s *Store) Get(id string) (Memory, error) {
+	if !validID.MatchString(id) {
+		return Memory{}, ErrNotFound
+	}
+	return s.read(id)
+}
+
+// Remember stores a new memory and returns it. A memory with the same
+// content is updated instead, taking the new kind and tags.
+func (s *Store) Remember(kind, content string, tags []string) (Memory, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return Memory{}, errors.New("memory content is empty")
+	}
+	if !ValidKind(kind) {
+		return Memory{}, fmt.Errorf("unknown memory kind %q", kind)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, err := s.List()
+	if err != nil {
+		return Memory{}, err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	m := Memory{Kind: kind, Content: content, Tags: cleanTags(tags), CreatedAt: now, UpdatedAt: now}
+	for _, e := range existing {
+		if normalize(e.Content) == normalize(content) {
+			m.ID, m.CreatedAt = e.ID, e.CreatedAt
+			break
+		}
+	}
+	if m.ID == "" {
+		if m.ID, err = newID(); err != nil {
+			return Memory{}, err
+		}
+	}
+	return m, s.write(m)
+}
+
+// Update replaces the kind, content and tags of an existing memory.
+func (s *Store) Update(id, kind, content string, tags []string) (Memory, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return Memory{}, errors.New("memory content is empty")
+	}
+	if !ValidKind(kind) {
+		return Memory{}, fmt.Errorf("unknown memory kind %q", kind)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, err := s.Get(id)
+	if err != nil {
+		return Memory{}, err
+	}
+	m.Kind, m.Content, m.Tags = kind, content, cleanTags(tags)
+	m.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	return m, s.write(m)
+}
+
+// Forget deletes a memory.
+func (s *Store) Forget(id string) error {
+	if !validID.MatchString(id) {
+		return ErrNotFound
+	}
+	err := os.Remove(s.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Recall returns the memories relevant to query, best match first, at most
+// limit of them (0 means all). With kind, only memories of that kind are
+// returned; an empty query then returns all of them, newest first.
+func (s *Store) Recall(query, kind string, limit int) ([]Memory, error) {
+	memories, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	if kind != "" {
+		var filtered []Memory
+		for _, m := range memories {
+			if m.Kind == kind {
+				filtered = append(filtered, m)
+			}
+		}
+		memories = filtered
+	}
+	var found []Memory
+	if strings.TrimSpace(query) == "" {
+		found = memories
+	} else {
+		for _, r := range Rank(memories, query) {
+			if r.Score > 0 {
+				found = append(found, r.Memory)
+			}
+		}
+	}
+	if limit > 0 && len(found) > limit {
+		found = found[:limit]
+	}
+	return found, nil
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+".md")
+}
+
+// read parses a memory file: a front matter block of "key: value" lines
+// between "---" lines, then the content. A file without front matter is a
+// fact made of the whole file.
+func (s *Store) read(id string) (Memory, error) {
+	path := s.path(id)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Memory{}, ErrNotFound
+	}
+	if err != nil {
+		return Memory{}, err
+	}
+	m := Memory{ID: id, Kind: KindFact}
+	if info, err := os.Stat(path); err == nil {
+		m.CreatedAt, m.UpdatedAt = info.ModTime().UTC(), info.ModTime().UTC()
+	}
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	if header, body, ok := strings.Cut(strings.TrimPrefix(text, "---\n"), "\n---\n"); ok && strings.HasPrefix(text, "---\n") {
+		text = body
+		sc := bufio.NewScanner(strings.NewReader(header))
+		for sc.Scan() {
+			key, value, _ := strings.Cut(sc.Text(), ":")
+			value = strings.TrimSpace(value)
+			switch strings.TrimSpace(key) {
+			case "kind":
+				if ValidKind(value) {
+					m.Kind = value
+				}
+			case "tags":
+				m.Tags = cleanTags(strings.Split(value, ","))
+			case "created":
+				if t, err := time.Parse(time.RFC3339, value); err == nil {
+					m.CreatedAt = t
+				}
+			case "updated":
+				if t, err := time.Parse(time.RFC3339, value); err == nil {
+					m.UpdatedAt = t
+				}
+			}
+		}
+	}
+	m.Content = strings.TrimSpace(text)
+	if m.Content == "" {
+		return Memory{}, fmt.Errorf("memory %s is empty", id)
+	}
+	return m, nil
+}
+
+// write stores m, replacing its file atomically.
+func (s *Store) write(m Memory) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", Dir, err)
+	}
+	var b strings.Builder
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "kind: %s\n", m.Kind)
+	if len(m.Tags) > 0 {
+		fmt.Fprintf(&b, "tags: %s\n", strings.Join(m.Tags, ", "))
+	}
+	fmt.Fprintf(&b, "created: %s\n", m.CreatedAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "updated: %s\n", m.UpdatedAt.Format(time.RFC3339))
+	b.WriteString("---\n")
+	b.WriteString(m.Content)
+	b.WriteString("\n")
+
+	tmp, err := os.CreateTemp(s.dir, ".memory-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly once renamed
+	if _, err := tmp.WriteString(b.String()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path(m.ID)); err != nil {
+		return fmt.Errorf("failed to save memory: %w", err)
+	}
+	return nil
+}
+
+func newID() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// cleanTags lowercases and trims tags, dropping empty and repeated ones.
+// Commas would split a tag when the file is read back, so they end it.
+func cleanTags(tags []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, t := range tags {
+		t, _, _ = strings.Cut(t, ",")
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t != "" && !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// normalize is content as compared for duplicates.
+func normalize(content string) string {
+	return strings.ToLower(strings.Join(strings.Fields(content), " "))
+}
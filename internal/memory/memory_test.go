@@ -0,0 +1,154 @@
+package memory
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChamsBouzaiene/dodo/internal/engine"
+)
+
+func TestStoreRememberAndForget(t *testing.T) {
+	repo := t.TempDir()
+	store := NewStore(repo)
+	if memories, err := store.List(); err != nil || len(memories) != 0 {
+		t.Fatalf("List(empty) = %v, %v", memories, err)
+	}
+
+	m, err := store.Remember(KindConvention, "Tests are table-driven.", []string{"Testing", "go, style"})
+	if err != nil {
+		t.Fatalf("Remember failed: %v", err)
+	}
+	if strings.Join(m.Tags, "|") != "testing|go" {
+		t.Errorf("tags = %q", m.Tags)
+	}
+	data, err := os.ReadFile(filepath.Join(repo, ".dodo", "memory", m.ID+".md"))
+	if err != nil || !strings.Contains(string(data), "kind: convention\n") || !strings.HasSuffix(string(data), "---\nTests are table-driven.\n") {
+		t.Fatalf("memory file = %q, %v", data, err)
+	}
+
+	// The same content again updates the memory rather than adding one.
+	again, err := store.Remember(KindDecision, "  tests are   TABLE-DRIVEN. ", nil)
+	if err != nil || again.ID != m.ID || again.Kind != KindDecision {
+		t.Fatalf("Remember(duplicate) = %+v, %v", again, err)
+	}
+	if _, err := store.Remember("opinion", "x", nil); err == nil {
+		t.Error("Remember accepted an unknown kind")
+	}
+	if _, err := store.Remember(KindFact, " ", nil); err == nil {
+		t.Error("Remember accepted empty content")
+	}
+
+	updated, err := store.Update(m.ID, KindFact, "Tests use testify.", []string{"testing"})
+	if err != nil || updated.Content != "Tests use testify." || !updated.CreatedAt.Equal(m.CreatedAt) {
+		t.Fatalf("Update = %+v, %v", updated, err)
+	}
+	got, err := store.Get(m.ID)
+	if err != nil || got.Content != updated.Content || got.Kind != KindFact || strings.Join(got.Tags, ",") != "testing" {
+		t.Errorf("Get = %+v, %v", got, err)
+	}
+
+	if err := store.Forget(m.ID); err != nil {
+		t.Fatalf("Forget failed: %v", err)
+	}
+	if err := store.Forget(m.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Forget(again) = %v, want ErrNotFound", err)
+	}
+	if _, err := store.Get("../config"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(path) = %v, want ErrNotFound", err)
+	}
+	if _, err := store.Update("missing", KindFact, "x", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Update(missing) = %v, want ErrNotFound", err)
+	}
+}
+
+func TestStoreReadsHandWrittenMemories(t *testing.T) {
+	repo := t.TempDir()
+	dir := filepath.Join(repo, ".dodo", "memory")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"release.md": "Releases are cut from the release/* branches.\n",
+		"api.md":     "---\nkind: decision\ntags: api\n---\nKeep the v1 API; clients pin it.\n",
+		"notes.txt":  "not a memory",
+		"empty.md":   "",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	memories, err := NewStore(repo).List()
+	if err != nil || len(memories) != 2 {
+		t.Fatalf("List = %+v, %v", memories, err)
+	}
+	byID := map[string]Memory{}
+	for _, m := range memories {
+		byID[m.ID] = m
+	}
+	if m := byID["release"]; m.Kind != KindFact || m.Content != "Releases are cut from the release/* branches." {
+		t.Errorf("plain file = %+v", m)
+	}
+	if m := byID["api"]; m.Kind != KindDecision || m.Content != "Keep the v1 API; clients pin it." || len(m.Tags) != 1 {
+		t.Errorf("front matter file = %+v", m)
+	}
+}
+
+func TestRecallAndSelect(t *testing.T) {
+	store := NewStore(t.TempDir())
+	remember := func(kind, content string, tags ...string) Memory {
+		t.Helper()
+		m, err := store.Remember(kind, content, tags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	tests := remember(KindConvention, "Run the integration tests with make itest; they need Docker.", "testing")
+	schema := remember(KindFact, "The protocol schema in testdata is generated; regenerate it with -update.", "protocol")
+	remember(KindDecision, "Sessions are stored in SQLite, not JSON files.")
+
+	found, err := store.Recall("how do I run the tests?", "", 0)
+	if err != nil || len(found) != 1 || found[0].ID != tests.ID {
+		t.Fatalf("Recall = %+v, %v", found, err)
+	}
+	if found, _ := store.Recall("", KindFact, 0); len(found) != 1 || found[0].ID != schema.ID {
+		t.Errorf("Recall(kind) = %+v", found)
+	}
+	if found, _ := store.Recall("", "", 2); len(found) != 2 {
+		t.Errorf("Recall(limit) = %+v", found)
+	}
+
+	all, _ := store.List()
+	picked := Select(all, "update the protocol schema", 1000)
+	if len(picked) != 3 || picked[0].ID != schema.ID {
+		t.Errorf("Select = %+v, want the schema memory first", picked)
+	}
+	if picked := Select(all, "update the protocol schema", engine.EstimateTokens(Section([]Memory{schema}))); len(picked) != 1 || picked[0].ID != schema.ID {
+		t.Errorf("Select(budget for one) = %+v, want the schema memory", picked)
+	}
+	if picked := Select(all, "tests", 60); len(picked) != 0 {
+		t.Errorf("Select over budget = %+v", picked)
+	}
+	if section := Section(nil); section != "" {
+		t.Errorf("Section(nil) = %q", section)
+	}
+}
+
+func TestRankPrefersRecentOnTies(t *testing.T) {
+	now := time.Now()
+	memories := []Memory{
+		{ID: "old", Content: "Use zap for logging", UpdatedAt: now.Add(-time.Hour)},
+		{ID: "new", Content: "Use slog for logging", UpdatedAt: now},
+		{ID: "other", Content: "Unrelated", UpdatedAt: now.Add(time.Hour)},
+	}
+	ranked := Rank(memories, "logging")
+	if ranked[0].ID != "new" || ranked[1].ID != "old" || ranked[2].Score != 0 {
+		t.Errorf("Rank = %+v", ranked)
+	}
+}
@@ -0,0 +1,155 @@
+package memory
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/ChamsBouzaiene/dodo/internal/engine"
+)
+
+// Ranked is a memory with its relevance to a query.
+type Ranked struct {
+	Memory
+	Score float64 // 0 when no word of the query occurs in the memory
+}
+
+// BM25 parameters.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// stopWords are left out of matching; they say nothing about relevance.
+var stopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "are": true, "but": true, "not": true,
+	"you": true, "all": true, "can": true, "was": true, "this": true, "that": true,
+	"with": true, "from": true, "have": true, "has": true, "into": true, "its": true,
+	"use": true, "when": true, "what": true, "how": true, "should": true, "would": true,
+	"please": true, "them": true, "then": true, "they": true, "there": true, "our": true,
+}
+
+// Rank orders memories by BM25 relevance to query, best first, ties and
+// unrelated memories most recently updated first. Tags count twice.
+func Rank(memories []Memory, query string) []Ranked {
+	docs := make([]map[string]int, len(memories))
+	var totalLen float64
+	df := make(map[string]int)
+	for i, m := range memories {
+		words := terms(m.Content)
+		for _, t := range m.Tags {
+			tagWords := terms(t)
+			words = append(words, tagWords...)
+			words = append(words, tagWords...)
+		}
+		tf := make(map[string]int)
+		for _, t := range words {
+			if tf[t] == 0 {
+				df[t]++
+			}
+			tf[t]++
+		}
+		docs[i] = tf
+		totalLen += float64(len(words))
+	}
+	avgLen := 1.0
+	if len(memories) > 0 && totalLen > 0 {
+		avgLen = totalLen / float64(len(memories))
+	}
+
+	queryTerms := make(map[string]bool)
+	for _, t := range terms(query) {
+		queryTerms[t] = true
+	}
+	n := float64(len(memories))
+	ranked := make([]Ranked, len(memories))
+	for i, m := range memories {
+		ranked[i].Memory = m
+		var docLen float64
+		for _, c := range docs[i] {
+			docLen += float64(c)
+		}
+		for t := range queryTerms {
+			f := float64(docs[i][t])
+			if f == 0 {
+				continue
+			}
+			idf := math.Log(1 + (n-float64(df[t])+0.5)/(float64(df[t])+0.5))
+			ranked[i].Score += idf * f * (bm25K1 + 1) / (f + bm25K1*(1-bm25B+bm25B*docLen/avgLen))
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].UpdatedAt.After(ranked[j].UpdatedAt)
+	})
+	return ranked
+}
+
+// Select picks the memories to put in a prompt about query, as many as fit
+// in budget tokens: those relevant to it, best first, then the others,
+// newest first.
+func Select(memories []Memory, query string, budget int) []Memory {
+	var picked []Memory
+	used := engine.EstimateTokens(formatSection(nil))
+	for _, r := range Rank(memories, query) {
+		cost := engine.EstimateTokens(formatLine(r.Memory))
+		if used+cost > budget {
+			continue // a shorter one may still fit
+		}
+		used += cost
+		picked = append(picked, r.Memory)
+	}
+	return picked
+}
+
+// Section formats memories for the agent's system prompt, or returns "" when
+// there are none.
+func Section(memories []Memory) string {
+	if len(memories) == 0 {
+		return ""
+	}
+	return formatSection(memories)
+}
+
+func formatSection(memories []Memory) string {
+	var b strings.Builder
+	b.WriteString("[PROJECT MEMORY]\nFacts, conventions and decisions remembered in earlier sessions in this repository (.dodo/memory). Rely on them unless the code shows otherwise; use 'forget' on any that turn out to be wrong and 'remember' for new lessons worth keeping.\n\n")
+	for _, m := range memories {
+		b.WriteString(formatLine(m))
+	}
+	b.WriteString("[END PROJECT MEMORY]")
+	return b.String()
+}
+
+func formatLine(m Memory) string {
+	return fmt.Sprintf("- (%s, id %s) %s\n", m.Kind, m.ID, strings.ReplaceAll(m.Content, "\n", "\n  "))
+}
+
+// terms splits text into the lowercased, lightly stemmed words matching
+// compares.
+func terms(text string) []string {
+	var out []string
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len(w) < 2 || stopWords[w] {
+			continue
+		}
+		out = append(out, stem(w))
+	}
+	return out
+}
+
+// stem strips common English suffixes, so that "tests" matches "testing".
+func stem(w string) string {
+	for _, suffix := range []string{"ing", "ed", "es", "s"} {
+		if len(w) > len(suffix)+3 && strings.HasSuffix(w, suffix) {
+			return strings.TrimSuffix(w, suffix)
+		}
+	}
+	return w
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+
+	"github.com/ChamsBouzaiene/dodo/internal/config"
 )
 
 const (
@@ -18,6 +20,7 @@ const (
 
 // ProjectConfig holds per-project configuration settings.
 type ProjectConfig struct {
+	Version         int  `json:"version,omitempty"` // file format, see config.SchemaVersion
 	IndexingEnabled bool `json:"indexing_enabled"`
 }
 
@@ -37,8 +40,27 @@ func ConfigExists(repoRoot string) bool {
 	return !os.IsNotExist(err)
 }
 
+// HasIndexingDecision reports whether the user has answered the indexing
+// permission prompt for this project. The config file can exist without an
+// answer when it only carries other settings.
+func HasIndexingDecision(repoRoot string) bool {
+	data, err := os.ReadFile(configPath(repoRoot))
+	if err != nil {
+		return false
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return false
+	}
+	_, ok := raw["indexing_enabled"]
+	return ok
+}
+
 // LoadConfig reads the project configuration from disk.
 // Returns nil and no error if the config file does not exist.
+// Older files are upgraded to the current format first. Problems with
+// settings this package doesn't own are left for the config loader to
+// report.
 func LoadConfig(repoRoot string) (*ProjectConfig, error) {
 	path := configPath(repoRoot)
 
@@ -47,6 +69,13 @@ func LoadConfig(repoRoot string) (*ProjectConfig, error) {
 		return nil, nil
 	}
 
+	problems, _ := config.MigrateProjectFile(repoRoot)
+	for _, fe := range problems {
+		if fe.Field == "version" || fe.Field == "indexing_enabled" {
+			return nil, fe
+		}
+	}
+
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read project config: %w", err)
@@ -61,7 +90,8 @@ func LoadConfig(repoRoot string) (*ProjectConfig, error) {
 }
 
 // SaveConfig writes the project configuration to disk.
-// Creates the .dodo directory if it doesn't exist.
+// Creates the .dodo directory if it doesn't exist. Other settings stored in
+// the same file (such as layered config overrides) are preserved.
 func SaveConfig(repoRoot string, cfg *ProjectConfig) error {
 	dodoPath := filepath.Join(repoRoot, DodoDir)
 
@@ -70,12 +100,32 @@ func SaveConfig(repoRoot string, cfg *ProjectConfig) error {
 		return fmt.Errorf("failed to create .dodo directory: %w", err)
 	}
 
-	data, err := json.MarshalIndent(cfg, "", "  ")
+	path := configPath(repoRoot)
+	if _, err := config.MigrateProjectFile(repoRoot); err != nil {
+		return fmt.Errorf("failed to upgrade project config: %w", err)
+	}
+	merged := make(map[string]json.RawMessage)
+	if existing, err := os.ReadFile(path); err == nil && len(existing) > 0 {
+		if err := json.Unmarshal(existing, &merged); err != nil {
+			return fmt.Errorf("failed to parse project config: %w", err)
+		}
+	}
+
+	cp := *cfg
+	cp.Version = config.SchemaVersion
+	fields, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("failed to marshal project config: %w", err)
+	}
+	if err := json.Unmarshal(fields, &merged); err != nil {
+		return fmt.Errorf("failed to marshal project config: %w", err)
+	}
+
+	data, err := json.MarshalIndent(merged, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal project config: %w", err)
 	}
 
-	path := configPath(repoRoot)
 	if err := os.WriteFile(path, data, 0644); err != nil {
 		return fmt.Errorf("failed to write project config: %w", err)
 	}
@@ -3,7 +3,10 @@ package project
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/ChamsBouzaiene/dodo/internal/config"
 )
 
 func TestConfigExists(t *testing.T) {
@@ -121,3 +124,67 @@ func TestLoadRules(t *testing.T) {
 		t.Errorf("Expected rules:\n%s\nGot:\n%s", expectedRules, rules)
 	}
 }
+
+func TestSaveConfigPreservesOtherSettings(t *testing.T) {
+	tempDir := t.TempDir()
+	dodoDir := filepath.Join(tempDir, DodoDir)
+	if err := os.MkdirAll(dodoDir, 0755); err != nil {
+		t.Fatalf("Failed to create .dodo dir: %v", err)
+	}
+	configPath := filepath.Join(dodoDir, ConfigFile)
+	if err := os.WriteFile(configPath, []byte(`{"model": "gpt-4o", "sandbox_mode": "docker"}`), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	if HasIndexingDecision(tempDir) {
+		t.Error("HasIndexingDecision should be false before indexing_enabled is saved")
+	}
+
+	if err := SaveConfig(tempDir, &ProjectConfig{IndexingEnabled: true}); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+
+	if !HasIndexingDecision(tempDir) {
+		t.Error("HasIndexingDecision should be true after SaveConfig")
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Failed to read config file: %v", err)
+	}
+	for _, want := range []string{`"model": "gpt-4o"`, `"sandbox_mode": "docker"`, `"indexing_enabled": true`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("config file missing %s:\n%s", want, data)
+		}
+	}
+}
+
+func TestLoadConfigMigratesAndValidates(t *testing.T) {
+	tempDir := t.TempDir()
+	dodoDir := filepath.Join(tempDir, DodoDir)
+	if err := os.MkdirAll(dodoDir, 0755); err != nil {
+		t.Fatalf("Failed to create .dodo dir: %v", err)
+	}
+	configPath := filepath.Join(dodoDir, ConfigFile)
+	if err := os.WriteFile(configPath, []byte(`{"indexing_enabled": true, "max_steps": "20"}`), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	cfg, err := LoadConfig(tempDir)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Version != config.SchemaVersion || !cfg.IndexingEnabled {
+		t.Errorf("LoadConfig = %+v, want an upgraded file with indexing enabled", cfg)
+	}
+	if _, err := os.Stat(configPath + ".v0.bak"); err != nil {
+		t.Errorf("no backup of the original file: %v", err)
+	}
+
+	if err := os.WriteFile(configPath, []byte(`{"version": 1, "indexing_enabled": "yes"}`), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	if _, err := LoadConfig(tempDir); err == nil || !strings.Contains(err.Error(), "indexing_enabled") {
+		t.Errorf("LoadConfig error = %v, want one naming indexing_enabled", err)
+	}
+}
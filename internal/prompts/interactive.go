@@ -238,6 +238,7 @@ Common errors → fixes:
 </step>
 
 <step id="5" name="VALIDATE">
+- When 'diagnostics' is offered, check each edited file with it first.
 - Run 'run_build'; run 'run_tests' for fixes/features.
 - Report only the first ~10 relevant failure lines.
 - If failing: summarize cause + one concrete fix; set next_phase=edit.
@@ -257,6 +258,7 @@ After calling 'respond', you are DONE. The task is complete.
 <tool_selection_guide>
 Explore: 'think', 'grep', 'list_files', 'codebase_search', 'read_file'
 Focused read: 'read_span' (when 'read_file' returned OUTLINE)
+Navigate (when offered): 'goto_definition', 'find_references', 'find_implementations', 'hover' — exact, where 'grep' misses implementers and call sites
 Edit: 'search_replace' (most edits); 'write_file' (new files/full rewrites)
 Cleanup: 'delete_file' (remove conflicts, temp files)
 Validate: 'run_build', 'run_tests'
@@ -276,6 +278,13 @@ For high-level goals that span multiple sessions or days, use the 'project_plan'
 - This is different from 'plan' (MiniPlan), which is for the current session's immediate steps.
 </strategic_planning>
 
+<project_memory>
+The project memory (.dodo/memory) carries what earlier sessions learned about this repository. The memories relevant to each user message appear under [PROJECT MEMORY].
+- 'remember' lessons worth keeping across sessions: facts the code doesn't say, conventions the user states, decisions and their reasons. One fact per memory.
+- 'recall' to look for other memories before working in an unfamiliar area.
+- 'forget' memories that turn out to be wrong or outdated.
+</project_memory>
+
 <internal_planning>
 For NON-TRIVIAL code changes, you MUST create an internal execution plan BEFORE making any edits.
 
@@ -18,8 +18,13 @@ type AnthropicClient struct {
 }
 
 // NewAnthropicClient creates a new Anthropic client for the engine.
-func NewAnthropicClient(apiKey, modelName string) (*AnthropicClient, error) {
-	client := anthropic.NewClient(apiKey)
+// baseURL is optional and overrides the default Anthropic API endpoint.
+func NewAnthropicClient(apiKey, modelName, baseURL string) (*AnthropicClient, error) {
+	opts := []anthropic.ClientOption{anthropic.WithHTTPClient(newHTTPClient())}
+	if baseURL != "" {
+		opts = append(opts, anthropic.WithBaseURL(baseURL))
+	}
+	client := anthropic.NewClient(apiKey, opts...)
 
 	return &AnthropicClient{
 		client: client,
@@ -150,12 +155,10 @@ func (c *AnthropicClient) Chat(ctx context.Context, modelName string, messages [
 	}
 
 	// Call Anthropic API
+	ctx, meta := withResponseMeta(ctx)
 	resp, err := c.client.CreateMessages(ctx, req)
 	if err != nil {
-		// Extract HTTP status and Retry-After from error
-		httpStatus, retryAfter := extractErrorMetadata(err)
-		wrappedErr := engine.WrapLLMError(err, httpStatus, retryAfter)
-		return engine.LLMResponse{}, wrappedErr
+		return engine.LLMResponse{}, wrapProviderError(err, meta)
 	}
 
 	// Extract text content and tool calls
@@ -189,13 +192,9 @@ func (c *AnthropicClient) Chat(ctx context.Context, modelName string, messages [
 	}
 
 	// Determine finish reason
-	finishReason := "stop"
+	finishReason := anthropicFinishReason(resp.StopReason)
 	if len(toolCalls) > 0 {
 		finishReason = "tool_calls"
-	} else if resp.StopReason == "max_tokens" {
-		finishReason = "length"
-	} else if resp.StopReason == "content_filtered" {
-		finishReason = "content_filter"
 	}
 
 	// Extract usage
@@ -334,10 +333,7 @@ func (c *AnthropicClient) Stream(ctx context.Context, modelName string, messages
 		}
 
 		// Set up streaming callbacks
-		req.OnError = func(errResp anthropic.ErrorResponse) {
-			errCh <- fmt.Errorf("anthropic streaming error: %s", errResp.Error.Message)
-		}
-
+		// Error events are returned by CreateMessagesStream, so no OnError callback is needed.
 		req.OnContentBlockDelta = func(delta anthropic.MessagesEventContentBlockDeltaData) {
 			// Handle text deltas
 			if delta.Delta.Type == "text_delta" && delta.Delta.Text != nil {
@@ -356,19 +352,18 @@ func (c *AnthropicClient) Stream(ctx context.Context, modelName string, messages
 			// Handle completed tool use blocks
 			if content.Type == "tool_use" && content.MessageContentToolUse != nil {
 				tc := content.MessageContentToolUse
-				var args map[string]any
-				if len(tc.Input) > 0 {
-					if err := json.Unmarshal(tc.Input, &args); err != nil {
-						args = make(map[string]any)
-					}
-				} else {
-					args = make(map[string]any)
-				}
-
 				toolCall := engine.ToolCall{
 					ID:   tc.ID,
 					Name: tc.Name,
-					Args: args,
+					Args: make(map[string]any),
+				}
+				if len(tc.Input) > 0 {
+					if err := json.Unmarshal(tc.Input, &toolCall.Args); err != nil {
+						// Same contract as the OpenAI client: the engine reports the
+						// failure back to the model instead of running with empty args.
+						toolCall.Args = make(map[string]any)
+						toolCall.Error = fmt.Sprintf("Invalid or incomplete JSON in arguments (%d bytes): %v. This usually indicates MaxOutputTokens is too low.", len(tc.Input), err)
+					}
 				}
 
 				// Emit tool call event
@@ -385,23 +380,28 @@ func (c *AnthropicClient) Stream(ctx context.Context, modelName string, messages
 
 		// Track usage separately (Anthropic may provide it in response, not callbacks)
 		var finalUsage engine.Usage
-		req.OnMessageStop = func(stop anthropic.MessagesEventMessageStopData) {
-			// Message stop event - stream is complete
-			// Note: Usage information may be available in the response object returned by CreateMessagesStream
-			// For now, we'll emit a zero usage (can be enhanced if SDK provides usage in callbacks)
-		}
 
 		// Call streaming API
 		// Note: CreateMessagesStream returns a MessagesResponse which may contain usage info
-		resp, err := c.client.CreateMessagesStream(ctx, req)
+		streamCtx, meta := withResponseMeta(ctx)
+		resp, err := c.client.CreateMessagesStream(streamCtx, req)
 		if err != nil {
-			// Extract HTTP status and Retry-After from error
-			httpStatus, retryAfter := extractErrorMetadata(err)
-			wrappedErr := engine.WrapLLMError(err, httpStatus, retryAfter)
-			errCh <- wrappedErr
+			errCh <- wrapProviderError(err, meta)
 			return
 		}
 
+		// Emit the stop reason accumulated from message_delta events
+		if resp.StopReason != "" {
+			select {
+			case eventCh <- engine.StreamEvent{
+				Type:         "finish",
+				FinishReason: anthropicFinishReason(resp.StopReason),
+			}:
+			case <-ctx.Done():
+				return
+			}
+		}
+
 		// Extract usage from response if available
 		if resp.Usage.InputTokens > 0 {
 			finalUsage = engine.Usage{
@@ -426,3 +426,17 @@ func (c *AnthropicClient) Stream(ctx context.Context, modelName string, messages
 
 	return eventCh, errCh
 }
+
+// anthropicFinishReason normalizes an Anthropic stop_reason to the engine's vocabulary.
+func anthropicFinishReason(reason anthropic.MessagesStopReason) string {
+	switch reason {
+	case anthropic.MessagesStopReasonMaxTokens:
+		return "length"
+	case anthropic.MessagesStopReasonToolUse:
+		return "tool_calls"
+	case anthropic.MessagesStopRefusal:
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
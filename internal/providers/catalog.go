@@ -0,0 +1,78 @@
+package providers
+
+import "strings"
+
+// CatalogEntry is static metadata about a model that provider model endpoints
+// don't return. Prices are USD per million tokens.
+type CatalogEntry struct {
+	ContextWindow   int
+	MaxOutputTokens int
+	InputCostPer1M  float64
+	OutputCostPer1M float64
+}
+
+// modelCatalog is keyed by model ID or ID prefix. Dated snapshots such as
+// "gpt-4o-2024-08-06" or "claude-3-5-sonnet-20241022" resolve to their family
+// via the longest matching prefix.
+var modelCatalog = map[string]CatalogEntry{
+	// OpenAI
+	"gpt-4o":        {ContextWindow: 128000, MaxOutputTokens: 16384, InputCostPer1M: 2.50, OutputCostPer1M: 10.00},
+	"gpt-4o-mini":   {ContextWindow: 128000, MaxOutputTokens: 16384, InputCostPer1M: 0.15, OutputCostPer1M: 0.60},
+	"gpt-4.1":       {ContextWindow: 1047576, MaxOutputTokens: 32768, InputCostPer1M: 2.00, OutputCostPer1M: 8.00},
+	"gpt-4.1-mini":  {ContextWindow: 1047576, MaxOutputTokens: 32768, InputCostPer1M: 0.40, OutputCostPer1M: 1.60},
+	"gpt-4.1-nano":  {ContextWindow: 1047576, MaxOutputTokens: 32768, InputCostPer1M: 0.10, OutputCostPer1M: 0.40},
+	"gpt-4-turbo":   {ContextWindow: 128000, MaxOutputTokens: 4096, InputCostPer1M: 10.00, OutputCostPer1M: 30.00},
+	"gpt-3.5-turbo": {ContextWindow: 16385, MaxOutputTokens: 4096, InputCostPer1M: 0.50, OutputCostPer1M: 1.50},
+	"o1":            {ContextWindow: 200000, MaxOutputTokens: 100000, InputCostPer1M: 15.00, OutputCostPer1M: 60.00},
+	"o3-mini":       {ContextWindow: 200000, MaxOutputTokens: 100000, InputCostPer1M: 1.10, OutputCostPer1M: 4.40},
+
+	// Anthropic
+	"claude-3-haiku":    {ContextWindow: 200000, MaxOutputTokens: 4096, InputCostPer1M: 0.25, OutputCostPer1M: 1.25},
+	"claude-3-sonnet":   {ContextWindow: 200000, MaxOutputTokens: 4096, InputCostPer1M: 3.00, OutputCostPer1M: 15.00},
+	"claude-3-opus":     {ContextWindow: 200000, MaxOutputTokens: 4096, InputCostPer1M: 15.00, OutputCostPer1M: 75.00},
+	"claude-3-5-haiku":  {ContextWindow: 200000, MaxOutputTokens: 8192, InputCostPer1M: 0.80, OutputCostPer1M: 4.00},
+	"claude-3-5-sonnet": {ContextWindow: 200000, MaxOutputTokens: 8192, InputCostPer1M: 3.00, OutputCostPer1M: 15.00},
+	"claude-3-7-sonnet": {ContextWindow: 200000, MaxOutputTokens: 64000, InputCostPer1M: 3.00, OutputCostPer1M: 15.00},
+	"claude-sonnet-4":   {ContextWindow: 200000, MaxOutputTokens: 64000, InputCostPer1M: 3.00, OutputCostPer1M: 15.00},
+	"claude-opus-4":     {ContextWindow: 200000, MaxOutputTokens: 32000, InputCostPer1M: 15.00, OutputCostPer1M: 75.00},
+
+	// Kimi (BytePlus ModelArk)
+	"kimi-k2": {ContextWindow: 128000, InputCostPer1M: 0.60, OutputCostPer1M: 2.50},
+
+	// Google Gemini
+	"gemini-1.5-flash": {ContextWindow: 1048576, MaxOutputTokens: 8192, InputCostPer1M: 0.075, OutputCostPer1M: 0.30},
+	"gemini-1.5-pro":   {ContextWindow: 2097152, MaxOutputTokens: 8192, InputCostPer1M: 1.25, OutputCostPer1M: 5.00},
+	"gemini-2.0-flash": {ContextWindow: 1048576, MaxOutputTokens: 8192, InputCostPer1M: 0.10, OutputCostPer1M: 0.40},
+
+	// DeepSeek
+	"deepseek-chat":     {ContextWindow: 64000, MaxOutputTokens: 8192, InputCostPer1M: 0.27, OutputCostPer1M: 1.10},
+	"deepseek-reasoner": {ContextWindow: 64000, MaxOutputTokens: 8192, InputCostPer1M: 0.55, OutputCostPer1M: 2.19},
+
+	// Groq
+	"llama-3.1-8b-instant":    {ContextWindow: 131072, MaxOutputTokens: 8192, InputCostPer1M: 0.05, OutputCostPer1M: 0.08},
+	"llama-3.1-70b-versatile": {ContextWindow: 131072, MaxOutputTokens: 8192, InputCostPer1M: 0.59, OutputCostPer1M: 0.79},
+
+	// ZhipuAI / MiniMax
+	"glm-4-plus":    {ContextWindow: 128000, MaxOutputTokens: 4096},
+	"abab6.5s-chat": {ContextWindow: 245760},
+}
+
+// LookupCatalog returns catalog data for modelID, matching the longest known
+// prefix. Provider prefixes such as "models/" (Gemini) are ignored.
+func LookupCatalog(modelID string) (CatalogEntry, bool) {
+	id := strings.TrimPrefix(modelID, "models/")
+	if entry, ok := modelCatalog[id]; ok {
+		return entry, true
+	}
+
+	best := ""
+	for key := range modelCatalog {
+		if len(key) > len(best) && strings.HasPrefix(id, key+"-") {
+			best = key
+		}
+	}
+	if best == "" {
+		return CatalogEntry{}, false
+	}
+	return modelCatalog[best], true
+}
@@ -0,0 +1,588 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChamsBouzaiene/dodo/internal/engine"
+	"github.com/ChamsBouzaiene/dodo/internal/ratelimit"
+)
+
+// Conformance harness for engine.LLMClient implementations.
+//
+// Each scenario describes provider-neutral expectations plus the raw wire
+// responses a mock server replays for every supported API format. Each target
+// pairs an LLMClient constructor with the wire format it speaks. Every target
+// runs every scenario, and a scenario without a fixture for a target's wire
+// format fails the suite, so a new client (or a new wire format) cannot be
+// added without covering the whole behaviour matrix.
+
+// conformanceTarget is one LLMClient implementation under test.
+type conformanceTarget struct {
+	name      string
+	wire      string
+	newClient func(baseURL string) (engine.LLMClient, error)
+}
+
+var conformanceTargets = []conformanceTarget{
+	{
+		name: "openai",
+		wire: wireOpenAI,
+		newClient: func(baseURL string) (engine.LLMClient, error) {
+			return NewOpenAIClient("test-key", "gpt-test", baseURL)
+		},
+	},
+	{
+		name: "anthropic",
+		wire: wireAnthropic,
+		newClient: func(baseURL string) (engine.LLMClient, error) {
+			return NewAnthropicClient("test-key", "claude-test", baseURL)
+		},
+	},
+	{
+		name: "openai_rate_limited",
+		wire: wireOpenAI,
+		newClient: func(baseURL string) (engine.LLMClient, error) {
+			client, err := NewOpenAIClient("test-key", "gpt-test", baseURL)
+			if err != nil {
+				return nil, err
+			}
+			return NewRateLimitedClient(client, ratelimit.New(ratelimit.Config{})), nil
+		},
+	},
+	{
+		name: "anthropic_rate_limited",
+		wire: wireAnthropic,
+		newClient: func(baseURL string) (engine.LLMClient, error) {
+			client, err := NewAnthropicClient("test-key", "claude-test", baseURL)
+			if err != nil {
+				return nil, err
+			}
+			return NewRateLimitedClient(client, ratelimit.New(ratelimit.Config{})), nil
+		},
+	},
+	{
+		name: "openai_generation",
+		wire: wireOpenAI,
+		newClient: func(baseURL string) (engine.LLMClient, error) {
+			client, err := NewOpenAIClient("test-key", "gpt-test", baseURL)
+			if err != nil {
+				return nil, err
+			}
+			return &generationClient{inner: client, temperature: 0.2, maxOutputTokens: 1024}, nil
+		},
+	},
+	{
+		name: "anthropic_generation",
+		wire: wireAnthropic,
+		newClient: func(baseURL string) (engine.LLMClient, error) {
+			client, err := NewAnthropicClient("test-key", "claude-test", baseURL)
+			if err != nil {
+				return nil, err
+			}
+			return &generationClient{inner: client, temperature: 0.2, maxOutputTokens: 1024}, nil
+		},
+	},
+}
+
+// wireFixture is the HTTP response a mock server replays.
+type wireFixture struct {
+	status  int
+	headers map[string]string
+	body    string // JSON body, or raw text/event-stream for streaming fixtures
+}
+
+// conformanceResult normalizes the outcome of Chat and Stream calls.
+type conformanceResult struct {
+	text         string
+	toolCalls    []engine.ToolCall
+	usage        engine.Usage
+	finishReason string
+	err          error
+}
+
+type conformanceScenario struct {
+	name     string
+	stream   bool
+	fixtures map[string]wireFixture
+	check    func(t *testing.T, res conformanceResult)
+}
+
+// conformanceTools is sent with every request so providers exercise tool plumbing.
+var conformanceTools = []engine.ToolSchema{
+	{Name: "read_file", Description: "Read a file", JSONSchema: `{"type":"object","properties":{"path":{"type":"string"}},"required":["path"]}`},
+	{Name: "grep", Description: "Search files", JSONSchema: `{"type":"object","properties":{"pattern":{"type":"string"}},"required":["pattern"]}`},
+}
+
+// newMockProviderServer serves fixture on the endpoint of the given wire format.
+// Requests to other paths, or whose stream flag disagrees with the scenario,
+// are rejected so that request shaping regressions also fail the suite.
+func newMockProviderServer(t *testing.T, wire string, stream bool, fixture wireFixture) *httptest.Server {
+	t.Helper()
+
+	path := "/chat/completions"
+	if wire == wireAnthropic {
+		path = "/messages"
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != path {
+			http.Error(w, fmt.Sprintf("unexpected request %s %s", r.Method, r.URL.Path), http.StatusNotFound)
+			return
+		}
+
+		var req struct {
+			Stream bool              `json:"stream"`
+			Tools  []json.RawMessage `json:"tools"`
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &req); err != nil {
+			http.Error(w, "request body is not JSON", http.StatusBadRequest)
+			return
+		}
+		if req.Stream != stream {
+			http.Error(w, fmt.Sprintf("stream=%v, want %v", req.Stream, stream), http.StatusBadRequest)
+			return
+		}
+		if len(req.Tools) != len(conformanceTools) {
+			http.Error(w, fmt.Sprintf("got %d tools, want %d", len(req.Tools), len(conformanceTools)), http.StatusBadRequest)
+			return
+		}
+
+		status := fixture.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		contentType := "application/json"
+		if stream && status == http.StatusOK {
+			contentType = "text/event-stream"
+		}
+		w.Header().Set("Content-Type", contentType)
+		for k, v := range fixture.headers {
+			w.Header().Set(k, v)
+		}
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, fixture.body)
+	}))
+}
+
+// runConformanceCall performs one Chat or Stream call and normalizes the result.
+// Streams are drained the same way the engine's stepOnceStream does, with a
+// deadline so a client that never closes its channels fails instead of hanging.
+func runConformanceCall(t *testing.T, client engine.LLMClient, stream bool) conformanceResult {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	msgs := []engine.ChatMessage{
+		{Role: engine.RoleSystem, Content: "You are a test."},
+		{Role: engine.RoleUser, Content: "Say hello."},
+	}
+	opts := engine.ChatOptions{MaxOutputTokens: 64}
+
+	if !stream {
+		resp, err := client.Chat(ctx, "test-model", msgs, conformanceTools, opts)
+		return conformanceResult{
+			text:         resp.Assistant.Content,
+			toolCalls:    resp.ToolCalls,
+			usage:        resp.Usage,
+			finishReason: resp.FinishReason,
+			err:          err,
+		}
+	}
+
+	var res conformanceResult
+	var text strings.Builder
+	eventCh, errCh := client.Stream(ctx, "test-model", msgs, conformanceTools, opts)
+	for eventCh != nil || errCh != nil {
+		select {
+		case ev, ok := <-eventCh:
+			if !ok {
+				eventCh = nil
+				continue
+			}
+			switch ev.Type {
+			case "text_delta":
+				text.WriteString(ev.Text)
+			case "tool_call":
+				res.toolCalls = append(res.toolCalls, ev.ToolCall)
+			case "usage":
+				res.usage = ev.Usage
+			case "finish":
+				res.finishReason = ev.FinishReason
+			}
+		case err, ok := <-errCh:
+			if !ok || err == nil {
+				errCh = nil
+				continue
+			}
+			res.err = err
+			res.text = text.String()
+			return res
+		case <-ctx.Done():
+			t.Fatalf("stream did not complete: %v", ctx.Err())
+		}
+	}
+	res.text = text.String()
+	return res
+}
+
+func TestLLMClientConformance(t *testing.T) {
+	for _, target := range conformanceTargets {
+		t.Run(target.name, func(t *testing.T) {
+			for _, sc := range conformanceScenarios {
+				fixture, ok := sc.fixtures[target.wire]
+				if !ok {
+					t.Errorf("scenario %q has no %s fixture", sc.name, target.wire)
+					continue
+				}
+				t.Run(sc.name, func(t *testing.T) {
+					srv := newMockProviderServer(t, target.wire, sc.stream, fixture)
+					defer srv.Close()
+
+					client, err := target.newClient(srv.URL)
+					if err != nil {
+						t.Fatalf("newClient: %v", err)
+					}
+					sc.check(t, runConformanceCall(t, client, sc.stream))
+				})
+			}
+		})
+	}
+}
+
+// sse renders server-sent events. Each event is [eventName, data]; an empty
+// event name emits a data-only frame as OpenAI does.
+func sse(events ...[2]string) string {
+	var b strings.Builder
+	for _, ev := range events {
+		if ev[0] != "" {
+			fmt.Fprintf(&b, "event: %s\n", ev[0])
+		}
+		fmt.Fprintf(&b, "data: %s\n\n", ev[1])
+	}
+	return b.String()
+}
+
+func openAIChunk(delta string, finishReason string) [2]string {
+	fr := "null"
+	if finishReason != "" {
+		fr = fmt.Sprintf("%q", finishReason)
+	}
+	return [2]string{"", fmt.Sprintf(`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-test","choices":[{"index":0,"delta":%s,"finish_reason":%s}]}`, delta, fr)}
+}
+
+func openAIUsageChunk(prompt, completion int) [2]string {
+	return [2]string{"", fmt.Sprintf(`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-test","choices":[],"usage":{"prompt_tokens":%d,"completion_tokens":%d,"total_tokens":%d}}`, prompt, completion, prompt+completion)}
+}
+
+var openAIDone = [2]string{"", "[DONE]"}
+
+func anthropicEvent(name, data string) [2]string { return [2]string{name, data} }
+
+func anthropicMessageStart(inputTokens int) [2]string {
+	return anthropicEvent("message_start", fmt.Sprintf(`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude-test","content":[],"stop_reason":null,"usage":{"input_tokens":%d,"output_tokens":1}}}`, inputTokens))
+}
+
+func anthropicMessageEnd(stopReason string, outputTokens int) [][2]string {
+	return [][2]string{
+		anthropicEvent("message_delta", fmt.Sprintf(`{"type":"message_delta","delta":{"stop_reason":%q,"stop_sequence":null},"usage":{"output_tokens":%d}}`, stopReason, outputTokens)),
+		anthropicEvent("message_stop", `{"type":"message_stop"}`),
+	}
+}
+
+func anthropicToolUse(index int, id, name string, fragments ...string) [][2]string {
+	events := [][2]string{
+		anthropicEvent("content_block_start", fmt.Sprintf(`{"type":"content_block_start","index":%d,"content_block":{"type":"tool_use","id":%q,"name":%q,"input":{}}}`, index, id, name)),
+	}
+	for _, f := range fragments {
+		events = append(events, anthropicEvent("content_block_delta", fmt.Sprintf(`{"type":"content_block_delta","index":%d,"delta":{"type":"input_json_delta","partial_json":%q}}`, index, f)))
+	}
+	return append(events, anthropicEvent("content_block_stop", fmt.Sprintf(`{"type":"content_block_stop","index":%d}`, index)))
+}
+
+func anthropicText(index int, chunks ...string) [][2]string {
+	events := [][2]string{
+		anthropicEvent("content_block_start", fmt.Sprintf(`{"type":"content_block_start","index":%d,"content_block":{"type":"text","text":""}}`, index)),
+	}
+	for _, c := range chunks {
+		events = append(events, anthropicEvent("content_block_delta", fmt.Sprintf(`{"type":"content_block_delta","index":%d,"delta":{"type":"text_delta","text":%q}}`, index, c)))
+	}
+	return append(events, anthropicEvent("content_block_stop", fmt.Sprintf(`{"type":"content_block_stop","index":%d}`, index)))
+}
+
+func concatEvents(groups ...[][2]string) [][2]string {
+	var out [][2]string
+	for _, g := range groups {
+		out = append(out, g...)
+	}
+	return out
+}
+
+func wantNoError(t *testing.T, res conformanceResult) {
+	t.Helper()
+	if res.err != nil {
+		t.Fatalf("unexpected error: %v", res.err)
+	}
+}
+
+func wantUsage(t *testing.T, res conformanceResult, prompt, completion int) {
+	t.Helper()
+	want := engine.Usage{Prompt: prompt, Completion: completion, Total: prompt + completion}
+	if res.usage != want {
+		t.Errorf("usage = %+v, want %+v", res.usage, want)
+	}
+}
+
+func wantParallelToolCalls(t *testing.T, res conformanceResult) {
+	t.Helper()
+	if len(res.toolCalls) != 2 {
+		t.Fatalf("got %d tool calls, want 2: %+v", len(res.toolCalls), res.toolCalls)
+	}
+	first, second := res.toolCalls[0], res.toolCalls[1]
+	if first.ID != "call_a" || first.Name != "read_file" || first.Args["path"] != "main.go" || first.Error != "" {
+		t.Errorf("first tool call = %+v, want read_file(path=main.go) with ID call_a", first)
+	}
+	if second.ID != "call_b" || second.Name != "grep" || second.Args["pattern"] != "TODO" || second.Error != "" {
+		t.Errorf("second tool call = %+v, want grep(pattern=TODO) with ID call_b", second)
+	}
+	if res.finishReason != "tool_calls" {
+		t.Errorf("finish reason = %q, want tool_calls", res.finishReason)
+	}
+}
+
+func wantRateLimited(t *testing.T, res conformanceResult) {
+	t.Helper()
+	if res.err == nil {
+		t.Fatal("expected a rate limit error")
+	}
+	var engineErr *engine.EngineError
+	if !errors.As(res.err, &engineErr) {
+		t.Fatalf("error %T is not an *engine.EngineError: %v", res.err, res.err)
+	}
+	if engineErr.HTTPStatus != http.StatusTooManyRequests || !engineErr.IsRateLimit {
+		t.Errorf("HTTPStatus=%d IsRateLimit=%v, want 429 rate limit", engineErr.HTTPStatus, engineErr.IsRateLimit)
+	}
+	if class := engine.ClassifyLLMError(res.err); class != engine.RetryClassRetryable {
+		t.Errorf("retry class = %s, want %s", class, engine.RetryClassRetryable)
+	}
+	if got := engine.ExtractRetryAfter(res.err); got != 7*time.Second {
+		t.Errorf("Retry-After = %s, want 7s", got)
+	}
+}
+
+var rateLimitFixtures = map[string]wireFixture{
+	wireOpenAI: {
+		status:  http.StatusTooManyRequests,
+		headers: map[string]string{"Retry-After": "7"},
+		body:    `{"error":{"message":"Rate limit reached for requests","type":"requests","code":"rate_limit_exceeded"}}`,
+	},
+	wireAnthropic: {
+		status:  http.StatusTooManyRequests,
+		headers: map[string]string{"Retry-After": "7"},
+		body:    `{"type":"error","error":{"type":"rate_limit_error","message":"Number of requests has exceeded your rate limit"}}`,
+	},
+}
+
+var conformanceScenarios = []conformanceScenario{
+	{
+		name: "chat_text",
+		fixtures: map[string]wireFixture{
+			wireOpenAI:    {body: `{"id":"chatcmpl-1","object":"chat.completion","created":1,"model":"gpt-test","choices":[{"index":0,"message":{"role":"assistant","content":"Hello there"},"finish_reason":"stop"}],"usage":{"prompt_tokens":12,"completion_tokens":3,"total_tokens":15}}`},
+			wireAnthropic: {body: `{"id":"msg_1","type":"message","role":"assistant","model":"claude-test","content":[{"type":"text","text":"Hello there"}],"stop_reason":"end_turn","usage":{"input_tokens":12,"output_tokens":3}}`},
+		},
+		check: func(t *testing.T, res conformanceResult) {
+			wantNoError(t, res)
+			if res.text != "Hello there" {
+				t.Errorf("text = %q, want %q", res.text, "Hello there")
+			}
+			if len(res.toolCalls) != 0 {
+				t.Errorf("unexpected tool calls: %+v", res.toolCalls)
+			}
+			if res.finishReason != "stop" {
+				t.Errorf("finish reason = %q, want stop", res.finishReason)
+			}
+			wantUsage(t, res, 12, 3)
+		},
+	},
+	{
+		name: "chat_parallel_tool_calls",
+		fixtures: map[string]wireFixture{
+			wireOpenAI:    {body: `{"id":"chatcmpl-1","object":"chat.completion","created":1,"model":"gpt-test","choices":[{"index":0,"message":{"role":"assistant","content":null,"tool_calls":[{"id":"call_a","type":"function","function":{"name":"read_file","arguments":"{\"path\":\"main.go\"}"}},{"id":"call_b","type":"function","function":{"name":"grep","arguments":"{\"pattern\":\"TODO\"}"}}]},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":20,"completion_tokens":9,"total_tokens":29}}`},
+			wireAnthropic: {body: `{"id":"msg_1","type":"message","role":"assistant","model":"claude-test","content":[{"type":"tool_use","id":"call_a","name":"read_file","input":{"path":"main.go"}},{"type":"tool_use","id":"call_b","name":"grep","input":{"pattern":"TODO"}}],"stop_reason":"tool_use","usage":{"input_tokens":20,"output_tokens":9}}`},
+		},
+		check: func(t *testing.T, res conformanceResult) {
+			wantNoError(t, res)
+			wantParallelToolCalls(t, res)
+			wantUsage(t, res, 20, 9)
+		},
+	},
+	{
+		name: "chat_length",
+		fixtures: map[string]wireFixture{
+			wireOpenAI:    {body: `{"id":"chatcmpl-1","object":"chat.completion","created":1,"model":"gpt-test","choices":[{"index":0,"message":{"role":"assistant","content":"Once upon a"},"finish_reason":"length"}],"usage":{"prompt_tokens":5,"completion_tokens":64,"total_tokens":69}}`},
+			wireAnthropic: {body: `{"id":"msg_1","type":"message","role":"assistant","model":"claude-test","content":[{"type":"text","text":"Once upon a"}],"stop_reason":"max_tokens","usage":{"input_tokens":5,"output_tokens":64}}`},
+		},
+		check: func(t *testing.T, res conformanceResult) {
+			wantNoError(t, res)
+			if res.finishReason != "length" {
+				t.Errorf("finish reason = %q, want length", res.finishReason)
+			}
+		},
+	},
+	{
+		name:     "chat_rate_limited",
+		fixtures: rateLimitFixtures,
+		check:    wantRateLimited,
+	},
+	{
+		name:   "stream_text_with_usage_chunk",
+		stream: true,
+		fixtures: map[string]wireFixture{
+			wireOpenAI: {body: sse(
+				openAIChunk(`{"role":"assistant","content":"Hel"}`, ""),
+				openAIChunk(`{"content":"lo there"}`, ""),
+				openAIChunk(`{}`, "stop"),
+				openAIUsageChunk(12, 3),
+				openAIDone,
+			)},
+			wireAnthropic: {body: sse(concatEvents(
+				[][2]string{anthropicMessageStart(12)},
+				anthropicText(0, "Hel", "lo there"),
+				anthropicMessageEnd("end_turn", 3),
+			)...)},
+		},
+		check: func(t *testing.T, res conformanceResult) {
+			wantNoError(t, res)
+			if res.text != "Hello there" {
+				t.Errorf("text = %q, want %q", res.text, "Hello there")
+			}
+			if res.finishReason != "stop" {
+				t.Errorf("finish reason = %q, want stop", res.finishReason)
+			}
+			wantUsage(t, res, 12, 3)
+		},
+	},
+	{
+		name:   "stream_parallel_tool_calls_fragmented",
+		stream: true,
+		fixtures: map[string]wireFixture{
+			wireOpenAI: {body: sse(
+				openAIChunk(`{"role":"assistant","tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"read_file","arguments":""}}]}`, ""),
+				openAIChunk(`{"tool_calls":[{"index":0,"function":{"arguments":"{\"pa"}}]}`, ""),
+				openAIChunk(`{"tool_calls":[{"index":0,"function":{"arguments":"th\":\"main"}}]}`, ""),
+				openAIChunk(`{"tool_calls":[{"index":1,"id":"call_b","type":"function","function":{"name":"grep","arguments":"{\"pattern\""}}]}`, ""),
+				openAIChunk(`{"tool_calls":[{"index":0,"function":{"arguments":".go\"}"}}]}`, ""),
+				openAIChunk(`{"tool_calls":[{"index":1,"function":{"arguments":":\"TODO\"}"}}]}`, ""),
+				openAIChunk(`{}`, "tool_calls"),
+				openAIUsageChunk(20, 9),
+				openAIDone,
+			)},
+			wireAnthropic: {body: sse(concatEvents(
+				[][2]string{anthropicMessageStart(20)},
+				anthropicToolUse(0, "call_a", "read_file", `{"pa`, `th":"main`, `.go"}`),
+				anthropicToolUse(1, "call_b", "grep", `{"pattern"`, `:"TODO"}`),
+				anthropicMessageEnd("tool_use", 9),
+			)...)},
+		},
+		check: func(t *testing.T, res conformanceResult) {
+			wantNoError(t, res)
+			wantParallelToolCalls(t, res)
+			wantUsage(t, res, 20, 9)
+		},
+	},
+	{
+		name:   "stream_length",
+		stream: true,
+		fixtures: map[string]wireFixture{
+			wireOpenAI: {body: sse(
+				openAIChunk(`{"role":"assistant","content":"Once upon a"}`, ""),
+				openAIChunk(`{}`, "length"),
+				openAIUsageChunk(5, 64),
+				openAIDone,
+			)},
+			wireAnthropic: {body: sse(concatEvents(
+				[][2]string{anthropicMessageStart(5)},
+				anthropicText(0, "Once upon a"),
+				anthropicMessageEnd("max_tokens", 64),
+			)...)},
+		},
+		check: func(t *testing.T, res conformanceResult) {
+			wantNoError(t, res)
+			if res.text != "Once upon a" {
+				t.Errorf("text = %q, want %q", res.text, "Once upon a")
+			}
+			if res.finishReason != "length" {
+				t.Errorf("finish reason = %q, want length", res.finishReason)
+			}
+		},
+	},
+	{
+		name:   "stream_length_truncates_tool_call",
+		stream: true,
+		fixtures: map[string]wireFixture{
+			wireOpenAI: {body: sse(
+				openAIChunk(`{"role":"assistant","tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"read_file","arguments":"{\"path\":\"ma"}}]}`, ""),
+				openAIChunk(`{}`, "length"),
+				openAIUsageChunk(5, 64),
+				openAIDone,
+			)},
+			wireAnthropic: {body: sse(concatEvents(
+				[][2]string{anthropicMessageStart(5)},
+				anthropicToolUse(0, "call_a", "read_file", `{"path":"ma`),
+				anthropicMessageEnd("max_tokens", 64),
+			)...)},
+		},
+		check: func(t *testing.T, res conformanceResult) {
+			wantNoError(t, res)
+			if res.finishReason != "length" {
+				t.Errorf("finish reason = %q, want length", res.finishReason)
+			}
+			if len(res.toolCalls) != 1 {
+				t.Fatalf("got %d tool calls, want 1", len(res.toolCalls))
+			}
+			if tc := res.toolCalls[0]; tc.ID != "call_a" || tc.Name != "read_file" || tc.Error == "" {
+				t.Errorf("truncated tool call = %+v, want read_file with Error set", tc)
+			}
+		},
+	},
+	{
+		name:     "stream_rate_limited",
+		stream:   true,
+		fixtures: rateLimitFixtures,
+		check:    wantRateLimited,
+	},
+	{
+		name:   "stream_malformed_sse",
+		stream: true,
+		fixtures: map[string]wireFixture{
+			wireOpenAI: {body: sse(
+				openAIChunk(`{"role":"assistant","content":"Hel"}`, ""),
+				[2]string{"", `{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"content":"lo`},
+				openAIDone,
+			)},
+			wireAnthropic: {body: sse(concatEvents(
+				[][2]string{anthropicMessageStart(5)},
+				[][2]string{
+					anthropicEvent("content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`),
+					anthropicEvent("content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"lo`),
+				},
+				anthropicMessageEnd("end_turn", 3),
+			)...)},
+		},
+		check: func(t *testing.T, res conformanceResult) {
+			if res.err == nil {
+				t.Fatalf("expected an error for malformed SSE, got text=%q finish=%q", res.text, res.finishReason)
+			}
+		},
+	},
+}
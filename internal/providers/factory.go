@@ -4,241 +4,171 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/ChamsBouzaiene/dodo/internal/engine"
+	"github.com/ChamsBouzaiene/dodo/internal/ratelimit"
 )
 
-// NewLLMClientFromEnv creates an engine.LLMClient based on environment variables.
-// This is a factory function that creates provider-specific clients without Eino.
-func NewLLMClientFromEnv(ctx context.Context) (engine.LLMClient, string, error) {
-	provider := os.Getenv("LLM_PROVIDER")
-	if provider == "" {
-		// Default to OpenAI if not set
-		provider = "openai"
-	}
-
-	switch provider {
-	case "openai":
-		apiKey := os.Getenv("OPENAI_API_KEY")
-		if apiKey == "" {
-			return nil, "", fmt.Errorf("OPENAI_API_KEY not set")
-		}
-
-		modelName := os.Getenv("OPENAI_MODEL")
-		if modelName == "" {
-			modelName = "gpt-4o-mini"
-		}
-
-		baseURL := os.Getenv("OPENAI_BASE_URL") // For OpenAI-compatible APIs like Kimi
-
-		client, err := NewOpenAIClient(apiKey, modelName, baseURL)
-		if err != nil {
-			return nil, "", fmt.Errorf("failed to create OpenAI client: %w", err)
-		}
-
-		return client, modelName, nil
-
-	case "anthropic":
-		apiKey := os.Getenv("ANTHROPIC_API_KEY")
-		if apiKey == "" {
-			return nil, "", fmt.Errorf("ANTHROPIC_API_KEY not set")
-		}
-
-		modelName := os.Getenv("ANTHROPIC_MODEL")
-		if modelName == "" {
-			modelName = "claude-3-sonnet-20240229"
-		}
-
-		client, err := NewAnthropicClient(apiKey, modelName)
-		if err != nil {
-			return nil, "", fmt.Errorf("failed to create Anthropic client: %w", err)
-		}
-
-		return client, modelName, nil
-
-	case "kimi":
-		// Kimi uses OpenAI-compatible API via BytePlus ModelArk
-		// Base URL: https://ark.ap-southeast.bytepluses.com/api/v3
-		apiKey := os.Getenv("KIMI_API_KEY")
-		if apiKey == "" {
-			return nil, "", fmt.Errorf("KIMI_API_KEY not set")
-		}
-
-		modelName := os.Getenv("KIMI_MODEL")
-		if modelName == "" {
-			modelName = "kimi-k2-250711"
-		}
-
-		// Use the correct BytePlus ModelArk base URL (matches old Eino implementation)
-		// Can be overridden via KIMI_BASE_URL environment variable
-		baseURL := os.Getenv("KIMI_BASE_URL")
-		if baseURL == "" {
-			baseURL = "https://ark.ap-southeast.bytepluses.com/api/v3"
-		}
-
-		client, err := NewOpenAIClient(apiKey, modelName, baseURL)
-		if err != nil {
-			return nil, "", fmt.Errorf("failed to create Kimi client: %w", err)
-		}
-
-		return client, modelName, nil
-
-	case "gemini":
-		// Google Gemini via OpenAI-compatible endpoint
-		apiKey := os.Getenv("GEMINI_API_KEY")
-		if apiKey == "" {
-			return nil, "", fmt.Errorf("GEMINI_API_KEY not set")
-		}
-
-		modelName := os.Getenv("GEMINI_MODEL")
-		if modelName == "" {
-			modelName = "gemini-1.5-flash"
-		}
-
-		// Gemini OpenAI-compatible endpoint
-		baseURL := "https://generativelanguage.googleapis.com/v1beta/openai"
-
-		client, err := NewOpenAIClient(apiKey, modelName, baseURL)
-		if err != nil {
-			return nil, "", fmt.Errorf("failed to create Gemini client: %w", err)
-		}
-
-		return client, modelName, nil
-
-	case "lmstudio":
-		// LM Studio local server (OpenAI-compatible)
-		baseURL := os.Getenv("LMSTUDIO_BASE_URL")
-		if baseURL == "" {
-			baseURL = "http://localhost:1234/v1"
-		}
-
-		modelName := os.Getenv("LMSTUDIO_MODEL")
-		if modelName == "" {
-			modelName = "local-model"
-		}
-
-		// API key can be anything for local models
-		apiKey := os.Getenv("LMSTUDIO_API_KEY")
-		if apiKey == "" {
-			apiKey = "lm-studio"
-		}
-
-		client, err := NewOpenAIClient(apiKey, modelName, baseURL)
-		if err != nil {
-			return nil, "", fmt.Errorf("failed to create LM Studio client: %w", err)
-		}
-
-		return client, modelName, nil
-
-	case "ollama":
-		// Ollama local server (OpenAI-compatible)
-		baseURL := os.Getenv("OLLAMA_BASE_URL")
-		if baseURL == "" {
-			baseURL = "http://localhost:11434/v1"
-		}
-
-		modelName := os.Getenv("OLLAMA_MODEL")
-		if modelName == "" {
-			modelName = "llama3.1"
-		}
-
-		apiKey := os.Getenv("OLLAMA_API_KEY")
-		if apiKey == "" {
-			apiKey = "ollama"
-		}
-
-		client, err := NewOpenAIClient(apiKey, modelName, baseURL)
-		if err != nil {
-			return nil, "", fmt.Errorf("failed to create Ollama client: %w", err)
-		}
-
-		return client, modelName, nil
-
-	case "glm":
-		// ZhipuAI GLM-4 (OpenAI-compatible)
-		apiKey := os.Getenv("GLM_API_KEY")
-		if apiKey == "" {
-			return nil, "", fmt.Errorf("GLM_API_KEY not set")
-		}
-
-		modelName := os.Getenv("GLM_MODEL")
-		if modelName == "" {
-			modelName = "glm-4-plus"
-		}
+// providerSpec describes how to reach one supported provider. Every provider
+// reads <PREFIX>_API_KEY, <PREFIX>_MODEL and <PREFIX>_BASE_URL, where PREFIX is
+// the upper-cased provider name.
+type providerSpec struct {
+	name           string
+	displayName    string
+	wire           string // wireOpenAI or wireAnthropic
+	defaultModel   string
+	defaultBaseURL string // empty means the SDK default
+	defaultAPIKey  string // local servers accept any key
+	local          bool   // served from the user's machine
+}
 
-		baseURL := "https://open.bigmodel.cn/api/paas/v4"
+var providerSpecs = []providerSpec{
+	{name: "openai", displayName: "OpenAI", wire: wireOpenAI, defaultModel: "gpt-4o-mini"},
+	{name: "anthropic", displayName: "Anthropic", wire: wireAnthropic, defaultModel: "claude-3-sonnet-20240229"},
+	// Kimi uses the OpenAI-compatible API of BytePlus ModelArk
+	{name: "kimi", displayName: "Kimi", wire: wireOpenAI, defaultModel: "kimi-k2-250711", defaultBaseURL: "https://ark.ap-southeast.bytepluses.com/api/v3"},
+	{name: "gemini", displayName: "Gemini", wire: wireOpenAI, defaultModel: "gemini-1.5-flash", defaultBaseURL: "https://generativelanguage.googleapis.com/v1beta/openai"},
+	{name: "lmstudio", displayName: "LM Studio", wire: wireOpenAI, defaultModel: "local-model", defaultBaseURL: "http://localhost:1234/v1", defaultAPIKey: "lm-studio", local: true},
+	{name: "ollama", displayName: "Ollama", wire: wireOpenAI, defaultModel: "llama3.1", defaultBaseURL: "http://localhost:11434/v1", defaultAPIKey: "ollama", local: true},
+	{name: "glm", displayName: "GLM", wire: wireOpenAI, defaultModel: "glm-4-plus", defaultBaseURL: "https://open.bigmodel.cn/api/paas/v4"},
+	{name: "minimax", displayName: "MiniMax", wire: wireOpenAI, defaultModel: "abab6.5s-chat", defaultBaseURL: "https://api.minimax.chat/v1"},
+	{name: "deepseek", displayName: "DeepSeek", wire: wireOpenAI, defaultModel: "deepseek-chat", defaultBaseURL: "https://api.deepseek.com/v1"},
+	{name: "groq", displayName: "Groq", wire: wireOpenAI, defaultModel: "llama-3.1-70b-versatile", defaultBaseURL: "https://api.groq.com/openai/v1"},
+}
 
-		client, err := NewOpenAIClient(apiKey, modelName, baseURL)
-		if err != nil {
-			return nil, "", fmt.Errorf("failed to create GLM client: %w", err)
+func lookupProviderSpec(name string) (providerSpec, bool) {
+	for _, spec := range providerSpecs {
+		if spec.name == name {
+			return spec, true
 		}
+	}
+	return providerSpec{}, false
+}
 
-		return client, modelName, nil
+// KnownProviders returns the names of every supported provider.
+func KnownProviders() []string {
+	names := make([]string, len(providerSpecs))
+	for i, spec := range providerSpecs {
+		names[i] = spec.name
+	}
+	return names
+}
 
-	case "minimax":
-		// MiniMax LLM (OpenAI-compatible)
-		apiKey := os.Getenv("MINIMAX_API_KEY")
-		if apiKey == "" {
-			return nil, "", fmt.Errorf("MINIMAX_API_KEY not set")
-		}
+// EnvPrefix returns the environment variable prefix for provider, e.g. "OPENAI".
+func EnvPrefix(provider string) string {
+	return strings.ToUpper(provider)
+}
 
-		modelName := os.Getenv("MINIMAX_MODEL")
-		if modelName == "" {
-			modelName = "abab6.5s-chat"
-		}
+// DefaultModel returns the model used for provider when none is configured.
+func DefaultModel(provider string) string {
+	spec, _ := lookupProviderSpec(provider)
+	return spec.defaultModel
+}
 
-		baseURL := "https://api.minimax.chat/v1"
+// settingsFromEnv resolves the key, model and base URL for spec.
+func (spec providerSpec) settingsFromEnv() (apiKey, model, baseURL string) {
+	prefix := EnvPrefix(spec.name)
+	apiKey = envOr(prefix+"_API_KEY", spec.defaultAPIKey)
+	model = envOr(prefix+"_MODEL", spec.defaultModel)
+	baseURL = envOr(prefix+"_BASE_URL", spec.defaultBaseURL)
+	return apiKey, model, baseURL
+}
 
-		client, err := NewOpenAIClient(apiKey, modelName, baseURL)
-		if err != nil {
-			return nil, "", fmt.Errorf("failed to create MiniMax client: %w", err)
-		}
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
 
-		return client, modelName, nil
+// ClientSettings selects and configures a provider explicitly, e.g. from a
+// named profile. Empty fields fall back to the provider defaults.
+type ClientSettings struct {
+	Provider        string
+	Model           string
+	BaseURL         string
+	APIKey          string
+	Temperature     float32 // used when the caller doesn't set one
+	MaxOutputTokens int     // caps the caller's output budget; 0 = no cap
+}
 
-	case "deepseek":
-		// DeepSeek (OpenAI-compatible)
-		apiKey := os.Getenv("DEEPSEEK_API_KEY")
-		if apiKey == "" {
-			return nil, "", fmt.Errorf("DEEPSEEK_API_KEY not set")
-		}
+// SettingsFromEnv reads the settings NewLLMClientFromEnv uses: LLM_PROVIDER,
+// the provider's <PROVIDER>_* variables, DODO_TEMPERATURE and
+// DODO_MAX_OUTPUT_TOKENS.
+func SettingsFromEnv() ClientSettings {
+	s := ClientSettings{Provider: envOr("LLM_PROVIDER", "openai")}
+	if spec, ok := lookupProviderSpec(s.Provider); ok {
+		s.APIKey, s.Model, s.BaseURL = spec.settingsFromEnv()
+	}
+	if t, err := strconv.ParseFloat(os.Getenv("DODO_TEMPERATURE"), 32); err == nil {
+		s.Temperature = float32(t)
+	}
+	if n, err := strconv.Atoi(os.Getenv("DODO_MAX_OUTPUT_TOKENS")); err == nil {
+		s.MaxOutputTokens = n
+	}
+	return s
+}
 
-		modelName := os.Getenv("DEEPSEEK_MODEL")
-		if modelName == "" {
-			modelName = "deepseek-chat"
-		}
+// NewLLMClientFromEnv creates an engine.LLMClient based on environment variables.
+// This is a factory function that creates provider-specific clients without Eino.
+// The client is placed behind the provider's shared rate limiter, configured
+// from <PROVIDER>_RPM and <PROVIDER>_TPM (e.g. OPENAI_RPM).
+func NewLLMClientFromEnv(ctx context.Context) (engine.LLMClient, string, error) {
+	return NewLLMClient(ctx, SettingsFromEnv())
+}
 
-		baseURL := "https://api.deepseek.com/v1"
+// NewLLMClient creates an engine.LLMClient for s. Like NewLLMClientFromEnv,
+// the client shares the provider's rate limiter.
+func NewLLMClient(ctx context.Context, s ClientSettings) (engine.LLMClient, string, error) {
+	client, modelName, err := newProviderClient(s)
+	if err != nil {
+		return nil, "", err
+	}
 
-		client, err := NewOpenAIClient(apiKey, modelName, baseURL)
-		if err != nil {
-			return nil, "", fmt.Errorf("failed to create DeepSeek client: %w", err)
-		}
+	limiter := ratelimit.Shared(s.Provider, ratelimit.ConfigFromEnv(EnvPrefix(s.Provider)))
+	var llm engine.LLMClient = NewRateLimitedClient(client, limiter)
+	if s.Temperature > 0 || s.MaxOutputTokens > 0 {
+		llm = &generationClient{inner: llm, temperature: s.Temperature, maxOutputTokens: s.MaxOutputTokens}
+	}
+	return llm, modelName, nil
+}
 
-		return client, modelName, nil
+// newProviderClient builds the bare client for s.
+func newProviderClient(s ClientSettings) (engine.LLMClient, string, error) {
+	spec, ok := lookupProviderSpec(s.Provider)
+	if !ok {
+		return nil, "", fmt.Errorf("unknown LLM_PROVIDER: %s (supported: %s)", s.Provider, strings.Join(KnownProviders(), ", "))
+	}
 
-	case "groq":
-		// Groq (OpenAI-compatible, very fast inference)
-		apiKey := os.Getenv("GROQ_API_KEY")
-		if apiKey == "" {
-			return nil, "", fmt.Errorf("GROQ_API_KEY not set")
-		}
+	apiKey := firstNonEmpty(s.APIKey, spec.defaultAPIKey)
+	modelName := firstNonEmpty(s.Model, spec.defaultModel)
+	baseURL := firstNonEmpty(s.BaseURL, spec.defaultBaseURL)
+	if apiKey == "" {
+		return nil, "", fmt.Errorf("%s_API_KEY not set", EnvPrefix(s.Provider))
+	}
 
-		modelName := os.Getenv("GROQ_MODEL")
-		if modelName == "" {
-			modelName = "llama-3.1-70b-versatile"
-		}
+	var client engine.LLMClient
+	var err error
+	switch spec.wire {
+	case wireAnthropic:
+		client, err = NewAnthropicClient(apiKey, modelName, baseURL)
+	default:
+		client, err = NewOpenAIClient(apiKey, modelName, baseURL)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create %s client: %w", spec.displayName, err)
+	}
 
-		baseURL := "https://api.groq.com/openai/v1"
+	return client, modelName, nil
+}
 
-		client, err := NewOpenAIClient(apiKey, modelName, baseURL)
-		if err != nil {
-			return nil, "", fmt.Errorf("failed to create Groq client: %w", err)
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
 		}
-
-		return client, modelName, nil
-
-	default:
-		return nil, "", fmt.Errorf("unknown LLM_PROVIDER: %s (supported: openai, anthropic, kimi, gemini, lmstudio, ollama, glm, minimax, deepseek, groq)", provider)
 	}
+	return ""
 }
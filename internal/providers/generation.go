@@ -0,0 +1,37 @@
+package providers
+
+import (
+	"context"
+
+	"github.com/ChamsBouzaiene/dodo/internal/engine"
+)
+
+// generationClient applies a profile's generation parameters to every call.
+// The temperature fills in for callers that leave it unset; the output token
+// limit only ever lowers the caller's budget, so small internal requests
+// (titles, summaries) keep their own limits.
+type generationClient struct {
+	inner           engine.LLMClient
+	temperature     float32
+	maxOutputTokens int
+}
+
+func (c *generationClient) apply(opts engine.ChatOptions) engine.ChatOptions {
+	if opts.Temperature == 0 {
+		opts.Temperature = c.temperature
+	}
+	if c.maxOutputTokens > 0 && (opts.MaxOutputTokens == 0 || opts.MaxOutputTokens > c.maxOutputTokens) {
+		opts.MaxOutputTokens = c.maxOutputTokens
+	}
+	return opts
+}
+
+// Chat implements engine.LLMClient.
+func (c *generationClient) Chat(ctx context.Context, model string, messages []engine.ChatMessage, toolSchemas []engine.ToolSchema, opts engine.ChatOptions) (engine.LLMResponse, error) {
+	return c.inner.Chat(ctx, model, messages, toolSchemas, c.apply(opts))
+}
+
+// Stream implements engine.LLMClient.
+func (c *generationClient) Stream(ctx context.Context, model string, messages []engine.ChatMessage, toolSchemas []engine.ToolSchema, opts engine.ChatOptions) (<-chan engine.StreamEvent, <-chan error) {
+	return c.inner.Stream(ctx, model, messages, toolSchemas, c.apply(opts))
+}
@@ -0,0 +1,257 @@
+package providers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ModelInfo describes one model offered by a provider, annotated with catalog
+// data where the model is known.
+type ModelInfo struct {
+	ID              string
+	Provider        string
+	DisplayName     string
+	ContextWindow   int
+	MaxOutputTokens int
+	InputCostPer1M  float64
+	OutputCostPer1M float64
+	InCatalog       bool
+}
+
+// modelEndpoint describes where and how to list a provider's models.
+type modelEndpoint struct {
+	wire    string // wireOpenAI or wireAnthropic
+	baseURL string
+	apiKey  string
+}
+
+// Wire formats spoken by the supported providers.
+const (
+	wireOpenAI    = "openai"    // POST /chat/completions, GET /models
+	wireAnthropic = "anthropic" // POST /messages, GET /models
+)
+
+const (
+	defaultOpenAIBaseURL    = "https://api.openai.com/v1"
+	defaultAnthropicBaseURL = "https://api.anthropic.com/v1"
+)
+
+// modelEndpointFromEnv resolves the models endpoint for provider using the same
+// environment variables as NewLLMClientFromEnv. ok is false when the provider
+// is unknown or has no credentials. Local servers need no key, so they only
+// count as configured when the user points at one or selected it as the
+// active provider.
+func modelEndpointFromEnv(provider string) (modelEndpoint, bool) {
+	spec, known := lookupProviderSpec(provider)
+	if !known {
+		return modelEndpoint{}, false
+	}
+
+	apiKey, _, baseURL := spec.settingsFromEnv()
+	if baseURL == "" {
+		baseURL = defaultOpenAIBaseURL
+		if spec.wire == wireAnthropic {
+			baseURL = defaultAnthropicBaseURL
+		}
+	}
+
+	configured := apiKey != ""
+	if spec.local {
+		configured = os.Getenv(EnvPrefix(provider)+"_BASE_URL") != "" || os.Getenv("LLM_PROVIDER") == provider
+	}
+	return modelEndpoint{wire: spec.wire, baseURL: baseURL, apiKey: apiKey}, configured
+}
+
+// ConfiguredProviders returns the known providers that have credentials (or,
+// for local servers, an endpoint) in the environment.
+func ConfiguredProviders() []string {
+	var out []string
+	for _, p := range KnownProviders() {
+		if _, ok := modelEndpointFromEnv(p); ok {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// DefaultModelCacheTTL is how long ModelLister reuses a provider's model list.
+const DefaultModelCacheTTL = 10 * time.Minute
+
+type modelCacheEntry struct {
+	models  []ModelInfo
+	fetched time.Time
+}
+
+// ModelLister queries provider model endpoints and caches the results per
+// provider, endpoint and credential.
+type ModelLister struct {
+	client *http.Client
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]modelCacheEntry
+}
+
+// NewModelLister creates a lister with DefaultModelCacheTTL.
+func NewModelLister() *ModelLister {
+	return &ModelLister{
+		client: &http.Client{Timeout: 15 * time.Second},
+		ttl:    DefaultModelCacheTTL,
+		now:    time.Now,
+		cache:  make(map[string]modelCacheEntry),
+	}
+}
+
+// List returns the models for provider, served from cache unless refresh is
+// set or the entry has expired.
+func (l *ModelLister) List(ctx context.Context, provider string, refresh bool) ([]ModelInfo, error) {
+	ep, ok := modelEndpointFromEnv(provider)
+	if !ok {
+		return nil, fmt.Errorf("provider %q is not configured", provider)
+	}
+
+	key := cacheKey(provider, ep)
+	if !refresh {
+		l.mu.Lock()
+		entry, hit := l.cache[key]
+		l.mu.Unlock()
+		if hit && l.now().Sub(entry.fetched) < l.ttl {
+			return entry.models, nil
+		}
+	}
+
+	models, err := l.fetch(ctx, provider, ep)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	l.cache[key] = modelCacheEntry{models: models, fetched: l.now()}
+	l.mu.Unlock()
+	return models, nil
+}
+
+func cacheKey(provider string, ep modelEndpoint) string {
+	sum := sha256.Sum256([]byte(ep.apiKey))
+	return provider + "|" + ep.baseURL + "|" + hex.EncodeToString(sum[:8])
+}
+
+func (l *ModelLister) fetch(ctx context.Context, provider string, ep modelEndpoint) ([]ModelInfo, error) {
+	var models []ModelInfo
+	var err error
+	switch ep.wire {
+	case wireAnthropic:
+		models, err = l.fetchAnthropic(ctx, provider, ep)
+	default:
+		models, err = l.fetchOpenAI(ctx, provider, ep)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list %s models: %w", provider, err)
+	}
+
+	for i := range models {
+		if entry, ok := LookupCatalog(models[i].ID); ok {
+			models[i].ContextWindow = entry.ContextWindow
+			models[i].MaxOutputTokens = entry.MaxOutputTokens
+			models[i].InputCostPer1M = entry.InputCostPer1M
+			models[i].OutputCostPer1M = entry.OutputCostPer1M
+			models[i].InCatalog = true
+		}
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+	return models, nil
+}
+
+// fetchOpenAI reads GET {base}/models, which OpenAI and the OpenAI-compatible
+// providers (including LM Studio and Ollama) all implement.
+func (l *ModelLister) fetchOpenAI(ctx context.Context, provider string, ep modelEndpoint) ([]ModelInfo, error) {
+	var page struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	header := http.Header{"Authorization": {"Bearer " + ep.apiKey}}
+	if err := l.getJSON(ctx, strings.TrimRight(ep.baseURL, "/")+"/models", header, &page); err != nil {
+		return nil, err
+	}
+
+	models := make([]ModelInfo, 0, len(page.Data))
+	for _, m := range page.Data {
+		models = append(models, ModelInfo{ID: m.ID, Provider: provider})
+	}
+	return models, nil
+}
+
+// fetchAnthropic pages through GET {base}/models.
+func (l *ModelLister) fetchAnthropic(ctx context.Context, provider string, ep modelEndpoint) ([]ModelInfo, error) {
+	header := http.Header{
+		"X-Api-Key":         {ep.apiKey},
+		"Anthropic-Version": {"2023-06-01"},
+	}
+
+	var models []ModelInfo
+	afterID := ""
+	for {
+		url := strings.TrimRight(ep.baseURL, "/") + "/models?limit=100"
+		if afterID != "" {
+			url += "&after_id=" + afterID
+		}
+		var page struct {
+			Data []struct {
+				ID          string `json:"id"`
+				DisplayName string `json:"display_name"`
+			} `json:"data"`
+			HasMore bool   `json:"has_more"`
+			LastID  string `json:"last_id"`
+		}
+		if err := l.getJSON(ctx, url, header, &page); err != nil {
+			return nil, err
+		}
+		for _, m := range page.Data {
+			models = append(models, ModelInfo{ID: m.ID, Provider: provider, DisplayName: m.DisplayName})
+		}
+		if !page.HasMore || page.LastID == "" {
+			return models, nil
+		}
+		afterID = page.LastID
+	}
+}
+
+func (l *ModelLister) getJSON(ctx context.Context, url string, header http.Header, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
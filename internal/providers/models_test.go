@@ -0,0 +1,151 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLookupCatalog(t *testing.T) {
+	tests := []struct {
+		id        string
+		wantOK    bool
+		wantInput float64
+	}{
+		{id: "gpt-4o", wantOK: true, wantInput: 2.50},
+		{id: "gpt-4o-2024-08-06", wantOK: true, wantInput: 2.50},
+		{id: "gpt-4o-mini-2024-07-18", wantOK: true, wantInput: 0.15},
+		{id: "claude-3-5-sonnet-20241022", wantOK: true, wantInput: 3.00},
+		{id: "models/gemini-1.5-flash", wantOK: true, wantInput: 0.075},
+		{id: "gpt-4ox", wantOK: false},
+		{id: "my-finetune", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			entry, ok := LookupCatalog(tt.id)
+			if ok != tt.wantOK {
+				t.Fatalf("LookupCatalog(%q) ok = %v, want %v", tt.id, ok, tt.wantOK)
+			}
+			if ok && entry.InputCostPer1M != tt.wantInput {
+				t.Errorf("InputCostPer1M = %v, want %v", entry.InputCostPer1M, tt.wantInput)
+			}
+		})
+	}
+}
+
+func TestModelListerOpenAICompatible(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.URL.Path != "/models" || r.Header.Get("Authorization") != "Bearer sk-test" {
+			http.Error(w, "bad request", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"object":"list","data":[{"id":"gpt-4o-mini","object":"model"},{"id":"gpt-4o","object":"model"},{"id":"custom-ft","object":"model"}]}`))
+	}))
+	defer srv.Close()
+
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	t.Setenv("OPENAI_BASE_URL", srv.URL)
+
+	lister := NewModelLister()
+	models, err := lister.List(context.Background(), "openai", false)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	want := []string{"custom-ft", "gpt-4o", "gpt-4o-mini"}
+	if len(models) != len(want) {
+		t.Fatalf("got %d models, want %d", len(models), len(want))
+	}
+	for i, id := range want {
+		if models[i].ID != id || models[i].Provider != "openai" {
+			t.Errorf("models[%d] = %s/%s, want openai/%s", i, models[i].Provider, models[i].ID, id)
+		}
+	}
+	if models[0].InCatalog {
+		t.Error("custom-ft should not be in the catalog")
+	}
+	if !models[1].InCatalog || models[1].ContextWindow != 128000 {
+		t.Errorf("gpt-4o catalog data = %+v", models[1])
+	}
+
+	// Second call is served from cache; refresh and expiry go back to the API.
+	if _, err := lister.List(context.Background(), "openai", false); err != nil {
+		t.Fatalf("cached List: %v", err)
+	}
+	if got := hits.Load(); got != 1 {
+		t.Fatalf("hits after cached call = %d, want 1", got)
+	}
+	if _, err := lister.List(context.Background(), "openai", true); err != nil {
+		t.Fatalf("refresh List: %v", err)
+	}
+	lister.now = func() time.Time { return time.Now().Add(DefaultModelCacheTTL + time.Second) }
+	if _, err := lister.List(context.Background(), "openai", false); err != nil {
+		t.Fatalf("expired List: %v", err)
+	}
+	if got := hits.Load(); got != 3 {
+		t.Fatalf("hits after refresh and expiry = %d, want 3", got)
+	}
+}
+
+func TestModelListerAnthropicPagination(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "ak-test" || r.Header.Get("Anthropic-Version") == "" {
+			http.Error(w, "missing headers", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Query().Get("after_id") {
+		case "":
+			w.Write([]byte(`{"data":[{"type":"model","id":"claude-3-5-sonnet-20241022","display_name":"Claude 3.5 Sonnet"}],"has_more":true,"first_id":"claude-3-5-sonnet-20241022","last_id":"claude-3-5-sonnet-20241022"}`))
+		case "claude-3-5-sonnet-20241022":
+			w.Write([]byte(`{"data":[{"type":"model","id":"claude-3-haiku-20240307","display_name":"Claude 3 Haiku"}],"has_more":false,"first_id":"claude-3-haiku-20240307","last_id":"claude-3-haiku-20240307"}`))
+		default:
+			http.Error(w, "unexpected cursor", http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	t.Setenv("ANTHROPIC_API_KEY", "ak-test")
+	t.Setenv("ANTHROPIC_BASE_URL", srv.URL)
+
+	models, err := NewModelLister().List(context.Background(), "anthropic", false)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(models) != 2 {
+		t.Fatalf("got %d models, want 2", len(models))
+	}
+	if models[0].ID != "claude-3-5-sonnet-20241022" || models[0].DisplayName != "Claude 3.5 Sonnet" || models[0].OutputCostPer1M != 15.00 {
+		t.Errorf("models[0] = %+v", models[0])
+	}
+	if models[1].ID != "claude-3-haiku-20240307" || !models[1].InCatalog {
+		t.Errorf("models[1] = %+v", models[1])
+	}
+}
+
+func TestModelListerErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"invalid api key"}`, http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	t.Setenv("OPENAI_API_KEY", "sk-bad")
+	t.Setenv("OPENAI_BASE_URL", srv.URL)
+	t.Setenv("GROQ_API_KEY", "")
+
+	lister := NewModelLister()
+	if _, err := lister.List(context.Background(), "openai", false); err == nil {
+		t.Error("List with rejected key succeeded, want error")
+	}
+	if _, err := lister.List(context.Background(), "groq", false); err == nil {
+		t.Error("List for unconfigured provider succeeded, want error")
+	}
+	if _, err := lister.List(context.Background(), "nope", false); err == nil {
+		t.Error("List for unknown provider succeeded, want error")
+	}
+}
@@ -29,6 +29,7 @@ func NewOpenAIClient(apiKey, modelName, baseURL string) (*OpenAIClient, error) {
 	if baseURL != "" {
 		config.BaseURL = baseURL
 	}
+	config.HTTPClient = newHTTPClient()
 
 	client := openai.NewClientWithConfig(config)
 
@@ -168,12 +169,10 @@ func (c *OpenAIClient) Chat(ctx context.Context, modelName string, messages []en
 	}
 
 	// Call OpenAI API
+	ctx, meta := withResponseMeta(ctx)
 	resp, err := c.client.CreateChatCompletion(ctx, req)
 	if err != nil {
-		// Extract HTTP status and Retry-After from error
-		httpStatus, retryAfter := extractErrorMetadata(err)
-		wrappedErr := engine.WrapLLMError(err, httpStatus, retryAfter)
-		return engine.LLMResponse{}, wrappedErr
+		return engine.LLMResponse{}, wrapProviderError(err, meta)
 	}
 
 	if len(resp.Choices) == 0 {
@@ -361,11 +360,10 @@ func (c *OpenAIClient) Stream(ctx context.Context, modelName string, messages []
 		}
 
 		// Create stream
-		stream, err := c.client.CreateChatCompletionStream(ctx, req)
+		streamCtx, meta := withResponseMeta(ctx)
+		stream, err := c.client.CreateChatCompletionStream(streamCtx, req)
 		if err != nil {
-			httpStatus, retryAfter := extractErrorMetadata(err)
-			wrappedErr := engine.WrapLLMError(err, httpStatus, retryAfter)
-			errCh <- wrappedErr
+			errCh <- wrapProviderError(err, meta)
 			return
 		}
 		defer stream.Close()
@@ -380,6 +378,7 @@ func (c *OpenAIClient) Stream(ctx context.Context, modelName string, messages []
 		toolCallAccum := make(map[string]*toolCallAccumulator) // Map by tool call ID
 		toolCallIndex := 0
 		var finalUsage engine.Usage
+		var finishReason string
 
 		// Read from stream
 		for {
@@ -394,9 +393,7 @@ func (c *OpenAIClient) Stream(ctx context.Context, modelName string, messages []
 					errStr := err.Error()
 					if !(strings.Contains(errStr, "EOF") || strings.Contains(errStr, "end of file")) {
 						// Real error, not EOF
-						httpStatus, retryAfter := extractErrorMetadata(err)
-						wrappedErr := engine.WrapLLMError(err, httpStatus, retryAfter)
-						errCh <- wrappedErr
+						errCh <- wrapProviderError(err, meta)
 						close(errCh)
 						return
 					}
@@ -496,6 +493,14 @@ func (c *OpenAIClient) Stream(ctx context.Context, modelName string, messages []
 							return
 						}
 					}
+					// Emit the finish reason reported by the last choice
+					if finishReason != "" {
+						select {
+						case eventCh <- engine.StreamEvent{Type: "finish", FinishReason: finishReason}:
+						case <-ctx.Done():
+							return
+						}
+					}
 					// Emit final usage if available
 					if finalUsage.Total > 0 {
 						select {
@@ -535,6 +540,9 @@ func (c *OpenAIClient) Stream(ctx context.Context, modelName string, messages []
 
 			choice := response.Choices[0]
 			delta := choice.Delta
+			if choice.FinishReason != "" {
+				finishReason = openAIFinishReason(choice.FinishReason)
+			}
 
 			// Handle text content delta
 			if delta.Content != "" {
@@ -633,6 +641,20 @@ func (c *OpenAIClient) Stream(ctx context.Context, modelName string, messages []
 	return eventCh, errCh
 }
 
+// openAIFinishReason normalizes an OpenAI finish_reason to the engine's vocabulary.
+func openAIFinishReason(reason openai.FinishReason) string {
+	switch reason {
+	case openai.FinishReasonLength:
+		return "length"
+	case openai.FinishReasonToolCalls, openai.FinishReasonFunctionCall:
+		return "tool_calls"
+	case openai.FinishReasonContentFilter:
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
 // extractErrorMetadata extracts HTTP status code and Retry-After header from an error.
 // This is a helper function to extract metadata from SDK errors.
 func extractErrorMetadata(err error) (int, string) {
@@ -0,0 +1,67 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ChamsBouzaiene/dodo/internal/engine"
+	"github.com/ChamsBouzaiene/dodo/internal/ratelimit"
+)
+
+// RateLimitedClient queues calls to an engine.LLMClient through a shared
+// ratelimit.Limiter. The limiter is also attached to the request context so the
+// provider transport can feed rate-limit headers back into it.
+type RateLimitedClient struct {
+	inner   engine.LLMClient
+	limiter *ratelimit.Limiter
+}
+
+// NewRateLimitedClient wraps inner with limiter.
+func NewRateLimitedClient(inner engine.LLMClient, limiter *ratelimit.Limiter) *RateLimitedClient {
+	return &RateLimitedClient{inner: inner, limiter: limiter}
+}
+
+// Limiter returns the limiter in front of the client.
+func (c *RateLimitedClient) Limiter() *ratelimit.Limiter {
+	return c.limiter
+}
+
+// Chat waits for capacity and then delegates to the wrapped client.
+func (c *RateLimitedClient) Chat(ctx context.Context, model string, messages []engine.ChatMessage, toolSchemas []engine.ToolSchema, opts engine.ChatOptions) (engine.LLMResponse, error) {
+	if err := c.limiter.Wait(ctx, estimateRequestTokens(messages, toolSchemas, opts)); err != nil {
+		return engine.LLMResponse{}, fmt.Errorf("waiting for rate limit: %w", err)
+	}
+	return c.inner.Chat(ratelimit.NewContext(ctx, c.limiter), model, messages, toolSchemas, opts)
+}
+
+// Stream waits for capacity and then delegates to the wrapped client.
+func (c *RateLimitedClient) Stream(ctx context.Context, model string, messages []engine.ChatMessage, toolSchemas []engine.ToolSchema, opts engine.ChatOptions) (<-chan engine.StreamEvent, <-chan error) {
+	if err := c.limiter.Wait(ctx, estimateRequestTokens(messages, toolSchemas, opts)); err != nil {
+		events := make(chan engine.StreamEvent)
+		errs := make(chan error, 1)
+		errs <- fmt.Errorf("waiting for rate limit: %w", err)
+		close(events)
+		close(errs)
+		return events, errs
+	}
+	return c.inner.Stream(ratelimit.NewContext(ctx, c.limiter), model, messages, toolSchemas, opts)
+}
+
+// estimateRequestTokens approximates what a request counts against a
+// tokens-per-minute limit: the prompt plus the requested completion budget,
+// which is how OpenAI-style limiters account for max_tokens.
+func estimateRequestTokens(messages []engine.ChatMessage, toolSchemas []engine.ToolSchema, opts engine.ChatOptions) int {
+	total := opts.MaxOutputTokens
+	for _, msg := range messages {
+		total += engine.EstimateTokens(msg.Content)
+		for _, tc := range msg.ToolCalls {
+			args, _ := json.Marshal(tc.Args)
+			total += engine.EstimateTokens(tc.Name) + engine.EstimateTokens(string(args))
+		}
+	}
+	for _, ts := range toolSchemas {
+		total += engine.EstimateTokens(ts.Description) + engine.EstimateTokens(ts.JSONSchema)
+	}
+	return total
+}
@@ -0,0 +1,106 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/ChamsBouzaiene/dodo/internal/engine"
+	"github.com/ChamsBouzaiene/dodo/internal/ratelimit"
+)
+
+func TestRateLimitedClientObservesHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		headers map[string]string
+		body    string
+		want    ratelimit.Config
+	}{
+		{
+			name:   "openai",
+			target: "openai",
+			headers: map[string]string{
+				"x-ratelimit-limit-requests":     "500",
+				"x-ratelimit-remaining-requests": "499",
+				"x-ratelimit-limit-tokens":       "30000",
+				"x-ratelimit-remaining-tokens":   "29900",
+			},
+			body: `{"id":"chatcmpl-1","object":"chat.completion","created":1,"model":"gpt-test","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`,
+			want: ratelimit.Config{RequestsPerMinute: 500, TokensPerMinute: 30000},
+		},
+		{
+			name:   "anthropic",
+			target: "anthropic",
+			headers: map[string]string{
+				"anthropic-ratelimit-requests-limit":     "50",
+				"anthropic-ratelimit-requests-remaining": "49",
+				"anthropic-ratelimit-tokens-limit":       "80000",
+				"anthropic-ratelimit-tokens-remaining":   "79000",
+			},
+			body: `{"id":"msg_1","type":"message","role":"assistant","model":"claude-test","content":[{"type":"text","text":"ok"}],"stop_reason":"end_turn","usage":{"input_tokens":1,"output_tokens":1}}`,
+			want: ratelimit.Config{RequestsPerMinute: 50, TokensPerMinute: 80000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var target conformanceTarget
+			for _, ct := range conformanceTargets {
+				if ct.name == tt.target {
+					target = ct
+				}
+			}
+
+			srv := newMockProviderServer(t, target.wire, false, wireFixture{headers: tt.headers, body: tt.body})
+			defer srv.Close()
+
+			inner, err := target.newClient(srv.URL)
+			if err != nil {
+				t.Fatalf("newClient: %v", err)
+			}
+			limiter := ratelimit.New(ratelimit.Config{})
+			client := NewRateLimitedClient(inner, limiter)
+
+			msgs := []engine.ChatMessage{{Role: engine.RoleUser, Content: "hi"}}
+			if _, err := client.Chat(context.Background(), "test-model", msgs, conformanceTools, engine.ChatOptions{}); err != nil {
+				t.Fatalf("Chat: %v", err)
+			}
+			if got := limiter.Limits(); got != tt.want {
+				t.Fatalf("Limits() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitedClientCancelledWhileQueued(t *testing.T) {
+	srv := newMockProviderServer(t, wireOpenAI, false, wireFixture{
+		status:  http.StatusTooManyRequests,
+		headers: map[string]string{"Retry-After": "60"},
+		body:    `{"error":{"message":"Rate limit reached","type":"requests","code":"rate_limit_exceeded"}}`,
+	})
+	defer srv.Close()
+
+	inner, err := NewOpenAIClient("test-key", "gpt-test", srv.URL)
+	if err != nil {
+		t.Fatalf("NewOpenAIClient: %v", err)
+	}
+	client := NewRateLimitedClient(inner, ratelimit.New(ratelimit.Config{}))
+	msgs := []engine.ChatMessage{{Role: engine.RoleUser, Content: "hi"}}
+
+	if _, err := client.Chat(context.Background(), "test-model", msgs, conformanceTools, engine.ChatOptions{}); err == nil {
+		t.Fatal("first Chat succeeded, want 429")
+	}
+
+	// Retry-After paused the limiter, so the next call queues until ctx ends
+	// instead of hitting the server again.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.Chat(ctx, "test-model", msgs, conformanceTools, engine.ChatOptions{}); err == nil {
+		t.Fatal("second Chat succeeded, want context error")
+	}
+	_, errCh := client.Stream(ctx, "test-model", msgs, conformanceTools, engine.ChatOptions{})
+	if err := <-errCh; err == nil {
+		t.Fatal("Stream succeeded, want context error")
+	}
+}
@@ -0,0 +1,87 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/ChamsBouzaiene/dodo/internal/engine"
+	"github.com/ChamsBouzaiene/dodo/internal/ratelimit"
+)
+
+// responseMeta records the status code and headers of the HTTP responses seen
+// while serving one client call. The provider SDKs drop response headers when
+// they turn a non-2xx reply into an error, so clients attach a responseMeta to
+// the request context and consult it when classifying the failure.
+type responseMeta struct {
+	mu     sync.Mutex
+	status int
+	header http.Header
+}
+
+type responseMetaKey struct{}
+
+// withResponseMeta returns a child context that captures response metadata.
+func withResponseMeta(ctx context.Context) (context.Context, *responseMeta) {
+	meta := &responseMeta{}
+	return context.WithValue(ctx, responseMetaKey{}, meta), meta
+}
+
+func responseMetaFrom(ctx context.Context) *responseMeta {
+	meta, _ := ctx.Value(responseMetaKey{}).(*responseMeta)
+	return meta
+}
+
+func (m *responseMeta) record(resp *http.Response) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.status = resp.StatusCode
+	m.header = resp.Header.Clone()
+}
+
+// snapshot returns the last recorded status code and headers.
+func (m *responseMeta) snapshot() (int, http.Header) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status, m.header
+}
+
+// metaTransport is an http.RoundTripper that feeds every response into the
+// responseMeta and ratelimit.Limiter attached to the request context, if any.
+type metaTransport struct {
+	base http.RoundTripper
+}
+
+func (t metaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil {
+		if meta := responseMetaFrom(req.Context()); meta != nil {
+			meta.record(resp)
+		}
+		if limiter := ratelimit.FromContext(req.Context()); limiter != nil {
+			limiter.Observe(resp.StatusCode, resp.Header)
+		}
+	}
+	return resp, err
+}
+
+// newHTTPClient returns the HTTP client shared by the SDK-backed providers.
+func newHTTPClient() *http.Client {
+	return &http.Client{Transport: metaTransport{base: http.DefaultTransport}}
+}
+
+// wrapProviderError classifies an SDK error for the engine's retry logic.
+// Status and Retry-After are taken from the captured response when available
+// and otherwise parsed out of the error text.
+func wrapProviderError(err error, meta *responseMeta) error {
+	httpStatus, retryAfter := extractErrorMetadata(err)
+	if meta != nil {
+		if status, header := meta.snapshot(); status >= http.StatusBadRequest {
+			httpStatus = status
+			if ra := header.Get("Retry-After"); ra != "" {
+				retryAfter = ra
+			}
+		}
+	}
+	return engine.WrapLLMError(err, httpStatus, retryAfter)
+}
@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// headerSet names the headers one provider uses for a single dimension.
+type headerSet struct {
+	limit, remaining, reset string
+}
+
+var (
+	openAIRequests = headerSet{"x-ratelimit-limit-requests", "x-ratelimit-remaining-requests", "x-ratelimit-reset-requests"}
+	openAITokens   = headerSet{"x-ratelimit-limit-tokens", "x-ratelimit-remaining-tokens", "x-ratelimit-reset-tokens"}
+
+	anthropicRequests    = headerSet{"anthropic-ratelimit-requests-limit", "anthropic-ratelimit-requests-remaining", "anthropic-ratelimit-requests-reset"}
+	anthropicTokens      = headerSet{"anthropic-ratelimit-tokens-limit", "anthropic-ratelimit-tokens-remaining", "anthropic-ratelimit-tokens-reset"}
+	anthropicInputTokens = headerSet{"anthropic-ratelimit-input-tokens-limit", "anthropic-ratelimit-input-tokens-remaining", "anthropic-ratelimit-input-tokens-reset"}
+)
+
+// Observe updates the limiter from a provider response. It understands the
+// OpenAI-style x-ratelimit-* headers (also sent by most compatible APIs), the
+// anthropic-ratelimit-* headers, and Retry-After on 429 and 503 responses.
+func (l *Limiter) Observe(status int, header http.Header) {
+	if l == nil || header == nil {
+		return
+	}
+
+	if status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable {
+		if d, ok := parseRetryAfter(header.Get("Retry-After")); ok {
+			l.Pause(d)
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+
+	reqs := openAIRequests
+	toks := openAITokens
+	if header.Get(anthropicRequests.remaining) != "" || header.Get(anthropicTokens.remaining) != "" || header.Get(anthropicInputTokens.remaining) != "" {
+		reqs = anthropicRequests
+		toks = anthropicTokens
+		if header.Get(toks.remaining) == "" {
+			toks = anthropicInputTokens
+		}
+	}
+
+	if limit, remaining, reset, ok := readHeaderSet(header, reqs, now); ok {
+		l.requests.observe(limit, remaining, reset, l.cfg.RequestsPerMinute > 0, now)
+	}
+	if limit, remaining, reset, ok := readHeaderSet(header, toks, now); ok {
+		l.tokens.observe(limit, remaining, reset, l.cfg.TokensPerMinute > 0, now)
+	}
+}
+
+// readHeaderSet parses one dimension. Missing values come back as -1 (or 0
+// for reset); ok is false when the response carries none of the headers.
+func readHeaderSet(header http.Header, hs headerSet, now time.Time) (limit, remaining int, reset time.Duration, ok bool) {
+	limit, remaining = -1, -1
+	if v, err := strconv.Atoi(strings.TrimSpace(header.Get(hs.limit))); err == nil {
+		limit, ok = v, true
+	}
+	if v, err := strconv.Atoi(strings.TrimSpace(header.Get(hs.remaining))); err == nil {
+		remaining, ok = v, true
+	}
+	if v := strings.TrimSpace(header.Get(hs.reset)); v != "" {
+		reset = parseReset(v, now)
+	}
+	return limit, remaining, reset, ok
+}
+
+// parseReset accepts Go-style durations ("1s", "6m0s", "20ms") as sent by
+// OpenAI, RFC 3339 timestamps as sent by Anthropic, and bare seconds.
+func parseReset(v string, now time.Time) time.Duration {
+	if d, err := time.ParseDuration(v); err == nil {
+		return d
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d
+		}
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	return 0
+}
+
+// parseRetryAfter handles both delta-seconds and HTTP-date forms.
+func parseRetryAfter(v string) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil && secs >= 0 {
+		return time.Duration(secs * float64(time.Second)), true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t), true
+	}
+	return 0, false
+}
+
+type contextKey struct{}
+
+// NewContext returns a child context carrying l, so that HTTP transports
+// deep inside an SDK can report response headers back to it.
+func NewContext(ctx context.Context, l *Limiter) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the limiter stored by NewContext, or nil.
+func FromContext(ctx context.Context) *Limiter {
+	l, _ := ctx.Value(contextKey{}).(*Limiter)
+	return l
+}
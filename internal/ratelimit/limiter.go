@@ -0,0 +1,243 @@
+// Package ratelimit provides client-side rate limiting for provider APIs.
+//
+// A Limiter combines two token buckets, one for requests per minute and one
+// for tokens per minute. Buckets start from the configured limits and are
+// corrected by the rate-limit headers the provider returns, so callers queue
+// locally instead of collecting 429s.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Config holds the per-minute limits for one provider.
+// Zero means "unknown": the bucket stays open until headers report a limit.
+type Config struct {
+	RequestsPerMinute int
+	TokensPerMinute   int
+}
+
+// ConfigFromEnv reads <PREFIX>_RPM and <PREFIX>_TPM, e.g. OPENAI_RPM.
+// Missing or invalid values are treated as zero.
+func ConfigFromEnv(prefix string) Config {
+	return Config{
+		RequestsPerMinute: envInt(prefix + "_RPM"),
+		TokensPerMinute:   envInt(prefix + "_TPM"),
+	}
+}
+
+func envInt(key string) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || v < 0 {
+		return 0
+	}
+	return v
+}
+
+// bucket is a token bucket refilled continuously at limit/minute.
+// A bucket with limit 0 never blocks.
+type bucket struct {
+	limit     float64
+	available float64
+	last      time.Time
+}
+
+func (b *bucket) setLimit(limit int, now time.Time) {
+	b.refill(now)
+	wasUnlimited := b.limit == 0
+	b.limit = float64(limit)
+	if wasUnlimited || b.available > b.limit {
+		b.available = b.limit
+	}
+}
+
+func (b *bucket) refill(now time.Time) {
+	if b.limit == 0 {
+		b.last = now
+		return
+	}
+	if !b.last.IsZero() && now.After(b.last) {
+		b.available += now.Sub(b.last).Minutes() * b.limit
+		if b.available > b.limit {
+			b.available = b.limit
+		}
+	}
+	b.last = now
+}
+
+// reserve takes n units, allowing the balance to go negative, and returns how
+// long the caller must wait for the debt to be repaid. Requests larger than the
+// bucket are clamped so they can eventually proceed.
+func (b *bucket) reserve(n float64, now time.Time) time.Duration {
+	if b.limit == 0 || n <= 0 {
+		return 0
+	}
+	b.refill(now)
+	if n > b.limit {
+		n = b.limit
+	}
+	b.available -= n
+	if b.available >= 0 {
+		return 0
+	}
+	return time.Duration(-b.available / b.limit * float64(time.Minute))
+}
+
+func (b *bucket) release(n float64) {
+	if b.limit == 0 || n <= 0 {
+		return
+	}
+	if n > b.limit {
+		n = b.limit
+	}
+	b.available = math.Min(b.available+n, b.limit)
+}
+
+// observe lowers the balance to what the server reports as remaining.
+// Reported limits are adopted when no limit was configured.
+func (b *bucket) observe(limit, remaining int, reset time.Duration, configured bool, now time.Time) {
+	if limit > 0 && !configured {
+		b.setLimit(limit, now)
+	}
+	if remaining < 0 || b.limit == 0 {
+		return
+	}
+	b.refill(now)
+	if float64(remaining) < b.available {
+		b.available = float64(remaining)
+	}
+	// The server knows best when the window rolls over; if it says nothing is
+	// left, don't let the local refill rate hand out capacity before then.
+	if remaining == 0 && reset > 0 {
+		if need := -reset.Minutes() * b.limit; need < b.available {
+			b.available = need
+		}
+	}
+}
+
+// Limiter queues calls against one provider's request and token budgets.
+// A nil *Limiter is valid and never blocks.
+type Limiter struct {
+	mu          sync.Mutex
+	cfg         Config
+	requests    bucket
+	tokens      bucket
+	pausedUntil time.Time
+	now         func() time.Time
+}
+
+// New creates a limiter with the given limits.
+func New(cfg Config) *Limiter {
+	l := &Limiter{now: time.Now}
+	l.Configure(cfg)
+	return l
+}
+
+// Configure replaces the configured limits. Header-derived limits are kept
+// for any dimension left at zero.
+func (l *Limiter) Configure(cfg Config) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if cfg.RequestsPerMinute > 0 {
+		l.requests.setLimit(cfg.RequestsPerMinute, now)
+	}
+	if cfg.TokensPerMinute > 0 {
+		l.tokens.setLimit(cfg.TokensPerMinute, now)
+	}
+	l.cfg = cfg
+}
+
+// Wait blocks until one request costing roughly tokens can be sent, or ctx is
+// done. Capacity is reserved up front so concurrent callers queue in arrival
+// order; it is handed back if ctx ends first.
+func (l *Limiter) Wait(ctx context.Context, tokens int) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	l.mu.Lock()
+	now := l.now()
+	delay := l.requests.reserve(1, now)
+	if d := l.tokens.reserve(float64(tokens), now); d > delay {
+		delay = d
+	}
+	if d := l.pausedUntil.Sub(now); d > delay {
+		delay = d
+	}
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.requests.release(1)
+		l.tokens.release(float64(tokens))
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Pause holds every caller until d has elapsed, e.g. after a 429 with
+// Retry-After.
+func (l *Limiter) Pause(d time.Duration) {
+	if l == nil || d <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := l.now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// Limits returns the limits currently enforced, whether configured or learned
+// from headers.
+func (l *Limiter) Limits() Config {
+	if l == nil {
+		return Config{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Config{
+		RequestsPerMinute: int(l.requests.limit),
+		TokensPerMinute:   int(l.tokens.limit),
+	}
+}
+
+var (
+	sharedMu sync.Mutex
+	shared   = make(map[string]*Limiter)
+)
+
+// Shared returns the process-wide limiter for name, creating it on first use.
+// Every client talking to the same provider should use the same name so that
+// sessions, sub-agents and background indexing draw from one budget. A
+// non-zero cfg updates the limits of an existing limiter.
+func Shared(name string, cfg Config) *Limiter {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	if l, ok := shared[name]; ok {
+		if cfg != (Config{}) {
+			l.Configure(cfg)
+		}
+		return l
+	}
+	l := New(cfg)
+	shared[name] = l
+	return l
+}
@@ -0,0 +1,234 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// fakeClock lets tests move time without sleeping.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLimiter(cfg Config) (*Limiter, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l := &Limiter{now: clock.now}
+	l.Configure(cfg)
+	return l, clock
+}
+
+// reserveDelay reserves capacity like Wait does and reports how long Wait
+// would sleep.
+func reserveDelay(l *Limiter, tokens int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	delay := l.requests.reserve(1, now)
+	if d := l.tokens.reserve(float64(tokens), now); d > delay {
+		delay = d
+	}
+	if d := l.pausedUntil.Sub(now); d > delay {
+		delay = d
+	}
+	return delay
+}
+
+func TestLimiterTokenBucket(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    Config
+		calls  []int // tokens per call, all issued at the same instant
+		delays []time.Duration
+	}{
+		{
+			name:   "unconfigured never blocks",
+			cfg:    Config{},
+			calls:  []int{1000, 1000, 1000},
+			delays: []time.Duration{0, 0, 0},
+		},
+		{
+			name:   "requests per minute queue in order",
+			cfg:    Config{RequestsPerMinute: 2},
+			calls:  []int{0, 0, 0, 0},
+			delays: []time.Duration{0, 0, 30 * time.Second, time.Minute},
+		},
+		{
+			name:   "tokens per minute",
+			cfg:    Config{TokensPerMinute: 600},
+			calls:  []int{500, 200},
+			delays: []time.Duration{0, 10 * time.Second},
+		},
+		{
+			name:   "oversized request is clamped to the bucket",
+			cfg:    Config{TokensPerMinute: 100},
+			calls:  []int{1000},
+			delays: []time.Duration{0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, _ := newTestLimiter(tt.cfg)
+			for i, tokens := range tt.calls {
+				if got := reserveDelay(l, tokens); got != tt.delays[i] {
+					t.Errorf("call %d: delay = %v, want %v", i, got, tt.delays[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLimiterRefill(t *testing.T) {
+	l, clock := newTestLimiter(Config{RequestsPerMinute: 60})
+	for i := 0; i < 60; i++ {
+		reserveDelay(l, 0)
+	}
+	if got := reserveDelay(l, 0); got != time.Second {
+		t.Fatalf("delay with empty bucket = %v, want 1s", got)
+	}
+	clock.advance(10 * time.Second)
+	if got := reserveDelay(l, 0); got != 0 {
+		t.Fatalf("delay after refill = %v, want 0", got)
+	}
+}
+
+func TestLimiterObserveHeaders(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       Config
+		status    int
+		header    map[string]string
+		wantLimit Config
+		wantDelay time.Duration
+	}{
+		{
+			name: "openai headers teach limits",
+			header: map[string]string{
+				"x-ratelimit-limit-requests":     "60",
+				"x-ratelimit-remaining-requests": "30",
+				"x-ratelimit-limit-tokens":       "6000",
+				"x-ratelimit-remaining-tokens":   "5000",
+			},
+			wantLimit: Config{RequestsPerMinute: 60, TokensPerMinute: 6000},
+		},
+		{
+			name: "openai exhausted requests wait for reset",
+			header: map[string]string{
+				"x-ratelimit-limit-requests":     "60",
+				"x-ratelimit-remaining-requests": "0",
+				"x-ratelimit-reset-requests":     "6s",
+			},
+			wantLimit: Config{RequestsPerMinute: 60},
+			wantDelay: 7 * time.Second, // 6s until reset plus 1s for this request
+		},
+		{
+			name: "configured limits win over reported limits",
+			cfg:  Config{RequestsPerMinute: 10},
+			header: map[string]string{
+				"x-ratelimit-limit-requests":     "1000",
+				"x-ratelimit-remaining-requests": "999",
+			},
+			wantLimit: Config{RequestsPerMinute: 10},
+		},
+		{
+			name: "anthropic headers",
+			header: map[string]string{
+				"anthropic-ratelimit-requests-limit":     "50",
+				"anthropic-ratelimit-requests-remaining": "49",
+				"anthropic-ratelimit-tokens-limit":       "40000",
+				"anthropic-ratelimit-tokens-remaining":   "0",
+				"anthropic-ratelimit-tokens-reset":       "2025-01-01T00:00:03Z",
+			},
+			wantLimit: Config{RequestsPerMinute: 50, TokensPerMinute: 40000},
+			wantDelay: 3*time.Second + 150*time.Millisecond, // reset plus 100 tokens at 40000/min
+		},
+		{
+			name: "anthropic input token headers",
+			header: map[string]string{
+				"anthropic-ratelimit-input-tokens-limit":     "20000",
+				"anthropic-ratelimit-input-tokens-remaining": "19000",
+			},
+			wantLimit: Config{TokensPerMinute: 20000},
+		},
+		{
+			name:      "retry-after pauses on 429",
+			status:    http.StatusTooManyRequests,
+			header:    map[string]string{"Retry-After": "4"},
+			wantDelay: 4 * time.Second,
+		},
+		{
+			name:   "retry-after ignored on success",
+			status: http.StatusOK,
+			header: map[string]string{"Retry-After": "4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, _ := newTestLimiter(tt.cfg)
+			h := http.Header{}
+			for k, v := range tt.header {
+				h.Set(k, v)
+			}
+			status := tt.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			l.Observe(status, h)
+
+			if got := l.Limits(); got != tt.wantLimit {
+				t.Errorf("Limits() = %+v, want %+v", got, tt.wantLimit)
+			}
+			if got := reserveDelay(l, 100); got != tt.wantDelay {
+				t.Errorf("delay = %v, want %v", got, tt.wantDelay)
+			}
+		})
+	}
+}
+
+func TestLimiterWaitCancelReleases(t *testing.T) {
+	l := New(Config{RequestsPerMinute: 1})
+	if err := l.Wait(context.Background(), 0); err != nil {
+		t.Fatalf("first Wait: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx, 0); err == nil {
+		t.Fatal("second Wait succeeded, want deadline error")
+	}
+
+	// The cancelled reservation must not push later callers further back.
+	if got := reserveDelay(l, 0); got > time.Minute {
+		t.Fatalf("delay after cancelled wait = %v, want <= 1m", got)
+	}
+}
+
+func TestNilLimiter(t *testing.T) {
+	var l *Limiter
+	if err := l.Wait(context.Background(), 1000); err != nil {
+		t.Fatalf("nil Wait: %v", err)
+	}
+	l.Observe(http.StatusTooManyRequests, http.Header{"Retry-After": {"10"}})
+	l.Pause(time.Second)
+	if got := l.Limits(); got != (Config{}) {
+		t.Fatalf("nil Limits() = %+v", got)
+	}
+}
+
+func TestShared(t *testing.T) {
+	a := Shared("test-shared", Config{RequestsPerMinute: 5})
+	b := Shared("test-shared", Config{})
+	if a != b {
+		t.Fatal("Shared returned different limiters for the same name")
+	}
+	if got := b.Limits().RequestsPerMinute; got != 5 {
+		t.Fatalf("RequestsPerMinute = %d, want 5", got)
+	}
+	if Shared("test-shared-other", Config{}) == a {
+		t.Fatal("Shared returned the same limiter for different names")
+	}
+}
@@ -92,7 +92,13 @@ func IsDockerAvailable(ctx context.Context) bool {
 // - "host": Use host executor (no isolation)
 // - "auto": Use Docker if available, fallback to host
 func NewDefaultRunner() Runner {
-	config := DefaultConfig()
+	return NewConfiguredRunner(DefaultConfig())
+}
+
+// NewConfiguredRunner selects a runner for config the way NewDefaultRunner
+// does, for callers that resolve the configuration themselves (e.g. per
+// repository) instead of from the environment.
+func NewConfiguredRunner(config Config) Runner {
 	ctx := context.Background()
 
 	switch config.Mode {
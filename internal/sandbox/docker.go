@@ -71,50 +71,7 @@ func (r *DockerRunner) RunCmd(ctx context.Context, repoDir, name string, args []
 		return Result{}, fmt.Errorf("failed to get absolute path: %w", err)
 	}
 
-	// Create container configuration
-	containerConfig := &container.Config{
-		Image:      image,
-		Cmd:        append([]string{name}, args...),
-		WorkingDir: "/workspace",
-		User:       "1000:1000",           // Non-root user
-		Env:        []string{"HOME=/tmp"}, // Set HOME to writable location
-		// Disable network access
-		NetworkDisabled: true,
-	}
-
-	// Host configuration with security restrictions
-	hostConfig := &container.HostConfig{
-		// Mount repository directory
-		Mounts: []mount.Mount{
-			{
-				Type:   mount.TypeBind,
-				Source: absRepoDir,
-				Target: "/workspace",
-			},
-		},
-		// Resource limits
-		Resources: container.Resources{
-			Memory:   parseMemory(r.config.Memory),
-			NanoCPUs: parseCPU(r.config.CPU) * 1e9, // Convert to nanoseconds
-			Ulimits: []*units.Ulimit{
-				{
-					Name: "nofile",
-					Soft: 1024,
-					Hard: 1024,
-				},
-			},
-		},
-		// Security options
-		SecurityOpt:    []string{"no-new-privileges"},
-		CapDrop:        []string{"ALL"},
-		ReadonlyRootfs: true,
-		// Temporary filesystem for /tmp
-		Tmpfs: map[string]string{
-			"/tmp": "rw,noexec,nosuid,size=100m",
-		},
-		// Auto-remove container after execution
-		AutoRemove: true,
-	}
+	containerConfig, hostConfig := r.containerSpec(image, absRepoDir, append([]string{name}, args...))
 
 	// Create container
 	createResp, err := r.client.ContainerCreate(ctx, containerConfig, hostConfig, nil, nil, "")
@@ -195,6 +152,56 @@ func (r *DockerRunner) RunCmd(ctx context.Context, repoDir, name string, args []
 	}, nil
 }
 
+// containerSpec is the locked-down container that runs cmd with the
+// repository at absRepoDir mounted as its working directory.
+func (r *DockerRunner) containerSpec(image, absRepoDir string, cmd []string) (*container.Config, *container.HostConfig) {
+	containerConfig := &container.Config{
+		Image:      image,
+		Cmd:        cmd,
+		WorkingDir: "/workspace",
+		User:       "1000:1000",           // Non-root user
+		Env:        []string{"HOME=/tmp"}, // Set HOME to writable location
+		// Disable network access
+		NetworkDisabled: true,
+	}
+
+	// Host configuration with security restrictions
+	hostConfig := &container.HostConfig{
+		// Mount repository directory
+		Mounts: []mount.Mount{
+			{
+				Type:   mount.TypeBind,
+				Source: absRepoDir,
+				Target: "/workspace",
+			},
+		},
+		// Resource limits
+		Resources: container.Resources{
+			Memory:   parseMemory(r.config.Memory),
+			NanoCPUs: parseCPU(r.config.CPU) * 1e9, // Convert to nanoseconds
+			Ulimits: []*units.Ulimit{
+				{
+					Name: "nofile",
+					Soft: 1024,
+					Hard: 1024,
+				},
+			},
+		},
+		// Security options
+		SecurityOpt:    []string{"no-new-privileges"},
+		CapDrop:        []string{"ALL"},
+		ReadonlyRootfs: true,
+		// Temporary filesystem for /tmp
+		Tmpfs: map[string]string{
+			"/tmp": "rw,noexec,nosuid,size=100m",
+		},
+		// Auto-remove container after execution
+		AutoRemove: true,
+	}
+
+	return containerConfig, hostConfig
+}
+
 // ensureImage checks if the image exists locally, and pulls it if not.
 func (r *DockerRunner) ensureImage(ctx context.Context, imageName string) error {
 	// Check if image exists
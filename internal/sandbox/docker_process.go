@@ -0,0 +1,109 @@
+package sandbox
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ChamsBouzaiene/dodo/internal/workspace"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// Start starts a process in a container with the same isolation as RunCmd
+// and attaches to its standard streams. The container is removed when the
+// process exits or is killed.
+func (r *DockerRunner) Start(ctx context.Context, repoDir, name string, args []string, stderr io.Writer) (*Process, error) {
+	image := GetDockerImage(workspace.DetectProjectType(repoDir), r.config)
+	if err := r.ensureImage(ctx, image); err != nil {
+		return nil, fmt.Errorf("failed to ensure image %s: %w", image, err)
+	}
+	absRepoDir, err := filepath.Abs(repoDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	containerConfig, hostConfig := r.containerSpec(image, absRepoDir, append([]string{name}, args...))
+	containerConfig.OpenStdin = true
+	containerConfig.StdinOnce = true
+	containerConfig.AttachStdin = true
+	containerConfig.AttachStdout = true
+	containerConfig.AttachStderr = true
+
+	createResp, err := r.client.ContainerCreate(ctx, containerConfig, hostConfig, nil, nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create container: %w", err)
+	}
+	containerID := createResp.ID
+	remove := func() error {
+		removeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return r.client.ContainerRemove(removeCtx, containerID, container.RemoveOptions{Force: true})
+	}
+
+	attach, err := r.client.ContainerAttach(ctx, containerID, container.AttachOptions{
+		Stream: true,
+		Stdin:  true,
+		Stdout: true,
+		Stderr: true,
+	})
+	if err != nil {
+		remove()
+		return nil, fmt.Errorf("failed to attach to container: %w", err)
+	}
+	if err := r.client.ContainerStart(ctx, containerID, container.StartOptions{}); err != nil {
+		attach.Close()
+		remove()
+		return nil, fmt.Errorf("failed to start container: %w", err)
+	}
+
+	// The attached stream interleaves stdout and stderr
+	stdout, stdoutW := io.Pipe()
+	go func() {
+		_, err := stdcopy.StdCopy(stdoutW, stderr, attach.Reader)
+		stdoutW.CloseWithError(err)
+	}()
+
+	var killOnce sync.Once
+	var killErr error
+	return &Process{
+		Stdin:  &attachedStdin{attach.CloseWrite, attach.Conn},
+		Stdout: stdout,
+		Dir:    "/workspace",
+		wait: func() error {
+			statusCh, errCh := r.client.ContainerWait(context.Background(), containerID, container.WaitConditionNotRunning)
+			select {
+			case err := <-errCh:
+				return err
+			case status := <-statusCh:
+				if status.StatusCode != 0 {
+					return fmt.Errorf("exit status %d", status.StatusCode)
+				}
+				return nil
+			}
+		},
+		kill: func() error {
+			killOnce.Do(func() {
+				attach.Close()
+				// AutoRemove may have removed it already
+				if err := remove(); err != nil && !errdefs.IsNotFound(err) {
+					killErr = err
+				}
+			})
+			return killErr
+		},
+	}, nil
+}
+
+// attachedStdin writes to a container's attached stdin; closing it ends
+// the container's input but keeps reading its output.
+type attachedStdin struct {
+	closeWrite func() error
+	io.Writer
+}
+
+func (s *attachedStdin) Close() error { return s.closeWrite() }
@@ -0,0 +1,71 @@
+package sandbox
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+)
+
+// Process is a long-running command, such as a language server, talked to
+// over its standard streams.
+type Process struct {
+	Stdin  io.WriteCloser
+	Stdout io.Reader
+	// Dir is the repository directory as the process sees it, which
+	// differs from the host path inside a container.
+	Dir string
+
+	wait func() error
+	kill func() error
+}
+
+// Wait waits for the process to exit.
+func (p *Process) Wait() error { return p.wait() }
+
+// Kill stops the process and releases what it holds.
+func (p *Process) Kill() error { return p.kill() }
+
+// Starter is implemented by runners that can also start long-running
+// processes, in the same place their commands run.
+type Starter interface {
+	// Start runs name with args in repoDir until the process exits or is
+	// killed. Its stderr is copied to stderr.
+	Start(ctx context.Context, repoDir, name string, args []string, stderr io.Writer) (*Process, error)
+}
+
+// StartOnHost starts a process directly on the host, for runners that
+// cannot start processes themselves.
+func StartOnHost(ctx context.Context, repoDir, name string, args []string, stderr io.Writer) (*Process, error) {
+	absRepoDir, err := filepath.Abs(repoDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	cmd := exec.Command(name, args...)
+	cmd.Dir = absRepoDir
+	cmd.Stderr = stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &Process{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Dir:    absRepoDir,
+		wait:   cmd.Wait,
+		kill:   cmd.Process.Kill,
+	}, nil
+}
+
+// Start starts a process on the host.
+func (r *HostRunner) Start(ctx context.Context, repoDir, name string, args []string, stderr io.Writer) (*Process, error) {
+	return StartOnHost(ctx, repoDir, name, args, stderr)
+}
@@ -0,0 +1,140 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ChamsBouzaiene/dodo/internal/engine"
+)
+
+// MaxCheckpointSize is the largest file a checkpoint keeps the content of.
+const MaxCheckpointSize = 1 << 20
+
+// editToolPaths names the argument holding the file each editing tool
+// changes.
+var editToolPaths = map[string]string{
+	"search_replace": "file_path",
+	"write":          "path",
+	"write_file":     "path",
+	"delete_file":    "path",
+}
+
+// Checkpoint is a file's content before the session first changed it in
+// reply to the message at MessageIndex.
+type Checkpoint struct {
+	MessageIndex int    `json:"message_index"` // in History
+	Path         string `json:"path"`          // relative to the repository
+	Exists       bool   `json:"exists"`        // false when the file was created
+	TooLarge     bool   `json:"too_large,omitempty"`
+	Content      []byte `json:"content,omitempty"`
+}
+
+// EditedPath returns the repository-relative file a tool call changes, or
+// false when the call doesn't edit a file.
+func EditedPath(call engine.ToolCall) (string, bool) {
+	arg, ok := editToolPaths[call.Name]
+	if !ok {
+		return "", false
+	}
+	p, _ := call.Args[arg].(string)
+	if p == "" || filepath.IsAbs(p) {
+		return "", false
+	}
+	p = filepath.Clean(p)
+	if p == ".." || strings.HasPrefix(p, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(p), true
+}
+
+// TakeCheckpoint records the current content of the file at rel in
+// repoRoot.
+func TakeCheckpoint(repoRoot, rel string, messageIndex int) (Checkpoint, error) {
+	cp := Checkpoint{MessageIndex: messageIndex, Path: rel}
+	info, err := os.Stat(filepath.Join(repoRoot, filepath.FromSlash(rel)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return cp, err
+	}
+	cp.Exists = true
+	if info.Size() > MaxCheckpointSize {
+		cp.TooLarge = true
+		return cp, nil
+	}
+	cp.Content, err = os.ReadFile(filepath.Join(repoRoot, filepath.FromSlash(rel)))
+	return cp, err
+}
+
+// AddCheckpoint appends cp unless checkpoints already hold the file as it
+// was before the same message's edits.
+func AddCheckpoint(checkpoints []Checkpoint, cp Checkpoint) []Checkpoint {
+	for _, c := range checkpoints {
+		if c.MessageIndex == cp.MessageIndex && c.Path == cp.Path {
+			return checkpoints
+		}
+	}
+	return append(checkpoints, cp)
+}
+
+// CheckpointsBefore returns the checkpoints of edits made in reply to the
+// first messageIndex messages.
+func CheckpointsBefore(checkpoints []Checkpoint, messageIndex int) []Checkpoint {
+	var out []Checkpoint
+	for _, c := range checkpoints {
+		if c.MessageIndex < messageIndex {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// RestoreCheckpoints puts back every file in repoRoot that was changed in
+// reply to messages from messageIndex on, as it was before the first of
+// those changes. It returns the files restored and those it could not
+// restore because they were too large to keep.
+func RestoreCheckpoints(repoRoot string, checkpoints []Checkpoint, messageIndex int) (restored, skipped []string, err error) {
+	earliest := make(map[string]Checkpoint)
+	for _, c := range checkpoints {
+		if c.MessageIndex < messageIndex {
+			continue
+		}
+		if prev, ok := earliest[c.Path]; !ok || c.MessageIndex < prev.MessageIndex {
+			earliest[c.Path] = c
+		}
+	}
+	paths := make([]string, 0, len(earliest))
+	for p := range earliest {
+		paths = append(paths, p)
+	}
+	slices.Sort(paths)
+
+	for _, p := range paths {
+		c := earliest[p]
+		abs := filepath.Join(repoRoot, filepath.FromSlash(p))
+		switch {
+		case c.TooLarge:
+			skipped = append(skipped, p)
+			continue
+		case !c.Exists:
+			if err := os.Remove(abs); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return restored, skipped, fmt.Errorf("restore %s: %w", p, err)
+			}
+		default:
+			if err := os.MkdirAll(filepath.Dir(abs), 0755); err != nil {
+				return restored, skipped, fmt.Errorf("restore %s: %w", p, err)
+			}
+			if err := os.WriteFile(abs, c.Content, 0644); err != nil {
+				return restored, skipped, fmt.Errorf("restore %s: %w", p, err)
+			}
+		}
+		restored = append(restored, p)
+	}
+	return restored, skipped, nil
+}
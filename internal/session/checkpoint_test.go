@@ -0,0 +1,79 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/ChamsBouzaiene/dodo/internal/engine"
+)
+
+func TestEditedPath(t *testing.T) {
+	tests := []struct {
+		call engine.ToolCall
+		want string
+		ok   bool
+	}{
+		{engine.ToolCall{Name: "search_replace", Args: map[string]any{"file_path": "./pkg/a.go"}}, "pkg/a.go", true},
+		{engine.ToolCall{Name: "write", Args: map[string]any{"path": "b.go"}}, "b.go", true},
+		{engine.ToolCall{Name: "delete_file", Args: map[string]any{"path": "../c.go"}}, "", false},
+		{engine.ToolCall{Name: "read_file", Args: map[string]any{"path": "b.go"}}, "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := EditedPath(tt.call); got != tt.want || ok != tt.ok {
+			t.Errorf("EditedPath(%s %v) = %q, %v; want %q, %v", tt.call.Name, tt.call.Args, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRestoreCheckpoints(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(root, name))
+		if err != nil {
+			return "<missing>"
+		}
+		return string(data)
+	}
+
+	// Message 1 edits a.go twice; message 3 edits it again and creates new.go
+	write("a.go", "v0")
+	var cps []Checkpoint
+	take := func(name string, index int) {
+		t.Helper()
+		cp, err := TakeCheckpoint(root, name, index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cps = AddCheckpoint(cps, cp)
+	}
+	take("a.go", 1)
+	write("a.go", "v1")
+	take("a.go", 1)
+	write("a.go", "v2")
+	take("a.go", 3)
+	write("a.go", "v3")
+	take("new.go", 3)
+	write("new.go", "new")
+	if len(cps) != 3 {
+		t.Fatalf("checkpoints = %+v, want one per file and message", cps)
+	}
+
+	restored, skipped, err := RestoreCheckpoints(root, cps, 2)
+	if err != nil || !slices.Equal(restored, []string{"a.go", "new.go"}) || len(skipped) != 0 {
+		t.Fatalf("RestoreCheckpoints(2) = %v, %v, %v", restored, skipped, err)
+	}
+	if read("a.go") != "v2" || read("new.go") != "<missing>" {
+		t.Errorf("after restoring to message 2: a.go = %q, new.go = %q", read("a.go"), read("new.go"))
+	}
+	if _, _, err := RestoreCheckpoints(root, cps, 0); err != nil || read("a.go") != "v0" {
+		t.Errorf("after restoring to message 0: a.go = %q, %v", read("a.go"), err)
+	}
+}
@@ -0,0 +1,296 @@
+package session
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ChamsBouzaiene/dodo/internal/engine"
+)
+
+// archiveDir holds the compressed histories of sessions, in the store's
+// directory.
+const archiveDir = "session-archive"
+
+// RetentionPolicy bounds what the store keeps. Zero fields impose no limit.
+// Pinned sessions and sessions with a run in progress are never collected.
+type RetentionPolicy struct {
+	MaxAge          time.Duration // sessions not updated for longer are deleted
+	MaxPerRepo      int           // a repository's older sessions beyond this many are deleted
+	MaxTotalBytes   int64         // the oldest sessions are deleted until the rest fit
+	MaxHistoryBytes int64         // larger histories are moved to compressed files
+}
+
+// GC reasons.
+const (
+	GCAge      = "age"
+	GCCount    = "count"
+	GCSize     = "size"
+	GCArchived = "archived"
+)
+
+// GCAction is a session garbage collection deleted or whose history it
+// archived.
+type GCAction struct {
+	RepoPath string
+	ID       string
+	Title    string
+	Bytes    int64  // stored before
+	Reason   string // GCAge, GCCount, GCSize or GCArchived
+}
+
+// gcEntry is a session as garbage collection weighs it.
+type gcEntry struct {
+	GCAction
+	repoHash  string
+	updated   time.Time
+	messages  int
+	exempt    bool // pinned or running
+	archived  bool // history already compressed
+	collected bool
+}
+
+// GC applies policy to every repository's sessions, newest kept first,
+// and returns what it deleted and archived. With dryRun nothing is changed;
+// sizes are then counted before archiving, so deletions for MaxTotalBytes
+// may be overstated.
+func (s *Store) GC(policy RetentionPolicy, dryRun bool) ([]GCAction, error) {
+	entries, err := s.gcEntries()
+	if err != nil {
+		return nil, err
+	}
+	var actions []GCAction
+	collect := func(e *gcEntry, reason string) error {
+		e.collected = true
+		e.Reason = reason
+		actions = append(actions, e.GCAction)
+		if dryRun {
+			return nil
+		}
+		if err := s.delete(e.repoHash, e.ID); err != nil {
+			return fmt.Errorf("failed to delete session %s: %w", e.ID, err)
+		}
+		return nil
+	}
+
+	now := time.Now()
+	kept := make(map[string]int) // per repository
+	for _, e := range entries {
+		switch {
+		case e.exempt:
+		case policy.MaxAge > 0 && now.Sub(e.updated) > policy.MaxAge:
+			err = collect(e, GCAge)
+		case policy.MaxPerRepo > 0 && kept[e.repoHash] >= policy.MaxPerRepo:
+			err = collect(e, GCCount)
+		default:
+			kept[e.repoHash]++
+		}
+		if err != nil {
+			return actions, err
+		}
+	}
+
+	for _, e := range entries {
+		if e.collected || e.exempt || e.archived || policy.MaxHistoryBytes <= 0 || e.Bytes <= policy.MaxHistoryBytes {
+			continue
+		}
+		action := e.GCAction
+		action.Reason = GCArchived
+		actions = append(actions, action)
+		if dryRun {
+			continue
+		}
+		size, err := s.archiveHistory(e.repoHash, e.ID, e.messages)
+		if errors.Is(err, errSessionChanged) {
+			actions = actions[:len(actions)-1]
+			continue
+		}
+		if err != nil {
+			return actions, fmt.Errorf("failed to archive session %s: %w", e.ID, err)
+		}
+		e.Bytes = size
+	}
+
+	if policy.MaxTotalBytes > 0 {
+		var total int64
+		for _, e := range entries {
+			if !e.collected {
+				total += e.Bytes
+			}
+		}
+		for i := len(entries) - 1; i >= 0 && total > policy.MaxTotalBytes; i-- {
+			e := entries[i]
+			if e.collected || e.exempt {
+				continue
+			}
+			if err := collect(e, GCSize); err != nil {
+				return actions, err
+			}
+			total -= e.Bytes
+		}
+	}
+
+	if len(actions) > 0 && !dryRun {
+		// Give the space back to the file system.
+		if _, err := s.db.Exec("VACUUM"); err != nil {
+			log.Printf("failed to compact session database: %v", err)
+		}
+	}
+	return actions, nil
+}
+
+// gcEntries returns every session with its stored size, newest first.
+func (s *Store) gcEntries() ([]*gcEntry, error) {
+	rows, err := s.db.Query(`
+		SELECT s.repo_hash, s.id, s.repo_path, s.title, s.updated_at, s.message_count,
+			s.pinned, s.run_pid, s.history_archive,
+			length(CAST(s.checkpoints AS BLOB)) + coalesce((
+				SELECT sum(length(CAST(content AS BLOB)) + length(CAST(tool_calls AS BLOB)) + length(CAST(name AS BLOB)))
+				FROM messages m WHERE m.repo_hash = s.repo_hash AND m.session_id = s.id), 0)
+		FROM sessions s` + newestFirst)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+	var entries []*gcEntry
+	for rows.Next() {
+		var e gcEntry
+		var updated int64
+		var pinned bool
+		var pid int
+		var archive string
+		if err := rows.Scan(&e.repoHash, &e.ID, &e.RepoPath, &e.Title, &updated, &e.messages, &pinned, &pid, &archive, &e.Bytes); err != nil {
+			return nil, fmt.Errorf("failed to read session: %w", err)
+		}
+		e.updated = fromUnixNano(updated)
+		e.exempt = pinned || (pid != 0 && processAlive(pid))
+		if archive != "" {
+			e.archived = true
+			if info, err := os.Stat(s.archivePath(archive)); err == nil {
+				e.Bytes += info.Size()
+			}
+		}
+		entries = append(entries, &e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	return entries, nil
+}
+
+// errSessionChanged reports a session saved while it was being archived.
+var errSessionChanged = errors.New("session changed while being archived")
+
+// archiveHistory moves a session's messages to a compressed file, keeping
+// its title and summary inline, and returns the session's size after. Load
+// reads the history back; saving the session stores it inline again. The
+// archived messages are no longer found by Search.
+func (s *Store) archiveHistory(repoHash string, id string, messages int) (int64, error) {
+	sess, err := s.load(repoHash, id)
+	if err != nil {
+		return 0, err
+	}
+	name := repoHash + "/" + url.PathEscape(id) + ".json.gz"
+	size, err := s.writeArchive(name, sess.History)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	// A save since the history was read leaves the session inline.
+	res, err := tx.Exec("UPDATE sessions SET history_archive = ? WHERE repo_hash = ? AND id = ? AND message_count = ? AND history_archive = ''",
+		name, repoHash, id, messages)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		s.removeArchive(name)
+		return 0, errSessionChanged
+	}
+	if _, err := tx.Exec("DELETE FROM messages WHERE repo_hash = ? AND session_id = ?", repoHash, id); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM session_fts WHERE repo_hash = ? AND session_id = ? AND message_index != -1", repoHash, id); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		s.removeArchive(name)
+		return 0, err
+	}
+	checkpoints, _ := json.Marshal(orEmpty(sess.Checkpoints))
+	return size + int64(len(checkpoints)), nil
+}
+
+func (s *Store) archivePath(name string) string {
+	return filepath.Join(s.dir, archiveDir, filepath.FromSlash(name))
+}
+
+// writeArchive writes history to the named archive, replacing it
+// atomically, and returns its size.
+func (s *Store) writeArchive(name string, history []engine.ChatMessage) (int64, error) {
+	path := s.archivePath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".archive-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly once renamed
+	zw := gzip.NewWriter(tmp)
+	if err := json.NewEncoder(zw).Encode(orEmpty(history)); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	info, err := tmp.Stat()
+	if err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	return info.Size(), os.Rename(tmp.Name(), path)
+}
+
+func (s *Store) readArchive(name string) ([]engine.ChatMessage, error) {
+	f, err := os.Open(s.archivePath(name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	var history []engine.ChatMessage
+	if err := json.NewDecoder(zr).Decode(&history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// removeArchive deletes the named archive, if any.
+func (s *Store) removeArchive(name string) {
+	if name == "" {
+		return
+	}
+	if err := os.Remove(s.archivePath(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("failed to remove session archive %s: %v", name, err)
+	}
+}
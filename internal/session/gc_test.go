@@ -0,0 +1,134 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChamsBouzaiene/dodo/internal/engine"
+)
+
+func TestStoreGC(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestStore(t, dir)
+	now := time.Now()
+	day := 24 * time.Hour
+	sessions := []*Session{
+		{ID: "old", RepoPath: "/a", UpdatedAt: now.Add(-100 * day)},
+		{ID: "old-pinned", RepoPath: "/a", UpdatedAt: now.Add(-100 * day), Pinned: true},
+		{ID: "old-running", RepoPath: "/a", UpdatedAt: now.Add(-101 * day)},
+		{ID: "a1", RepoPath: "/a", UpdatedAt: now.Add(-3 * day)},
+		{ID: "a2", RepoPath: "/a", UpdatedAt: now.Add(-2 * day)},
+		{ID: "a3", RepoPath: "/a", UpdatedAt: now.Add(-1 * day)},
+		{ID: "b1", RepoPath: "/b", UpdatedAt: now.Add(-3 * day)},
+	}
+	for _, s := range sessions {
+		if err := store.Save(s); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+	if err := store.BeginRun("old-running", "/a", "still going"); err != nil {
+		t.Fatal(err)
+	}
+	policy := RetentionPolicy{MaxAge: 90 * day, MaxPerRepo: 2}
+
+	actions, err := store.GC(policy, true)
+	if err != nil || len(actions) != 2 {
+		t.Fatalf("GC(dry run) = %+v, %v", actions, err)
+	}
+	if metas, _ := store.List("/a"); len(metas) != 6 {
+		t.Errorf("dry run deleted sessions: %+v", metas)
+	}
+
+	actions, err = store.GC(policy, false)
+	if err != nil {
+		t.Fatalf("GC failed: %v", err)
+	}
+	if len(actions) != 2 || actions[0].ID != "a1" || actions[0].Reason != GCCount || actions[1].ID != "old" || actions[1].Reason != GCAge {
+		t.Errorf("GC = %+v, want a1 (count) and old (age)", actions)
+	}
+	var ids []string
+	metas, _ := store.List("/a")
+	for _, m := range metas {
+		ids = append(ids, m.ID)
+	}
+	if strings.Join(ids, ",") != "a3,a2,old-pinned,old-running" {
+		t.Errorf("kept %v", ids)
+	}
+	if metas, _ := store.List("/b"); len(metas) != 1 {
+		t.Errorf("other repository's sessions = %+v", metas)
+	}
+}
+
+func TestStoreGCArchivesLargeHistories(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestStore(t, dir)
+	big := &Session{ID: "big", RepoPath: "/a", Title: "Big", Summary: "Read the logs", UpdatedAt: time.Now(), History: []engine.ChatMessage{
+		{Role: engine.RoleUser, Content: "read the logs"},
+		{Role: engine.RoleTool, Name: "c1", Content: strings.Repeat("log line\n", 1000)},
+	}}
+	small := &Session{ID: "small", RepoPath: "/a", UpdatedAt: time.Now().Add(-time.Hour), History: []engine.ChatMessage{{Role: engine.RoleUser, Content: "hi"}}}
+	for _, s := range []*Session{big, small} {
+		if err := store.Save(s); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+
+	actions, err := store.GC(RetentionPolicy{MaxHistoryBytes: 4096}, false)
+	if err != nil || len(actions) != 1 || actions[0].ID != "big" || actions[0].Reason != GCArchived {
+		t.Fatalf("GC = %+v, %v", actions, err)
+	}
+	archive := filepath.Join(dir, archiveDir, store.RepoHash("/a"), "big.json.gz")
+	if _, err := os.Stat(archive); err != nil {
+		t.Fatalf("archive not written: %v", err)
+	}
+	loaded, err := store.Load("big", "/a")
+	if err != nil || len(loaded.History) != 2 || loaded.History[1].Name != "c1" || loaded.Summary != "Read the logs" {
+		t.Fatalf("Load archived = %+v, %v", loaded, err)
+	}
+	if results, _ := store.Search("/a", "logs", ListOptions{}); len(results) != 1 || results[0].MessageIndex != -1 {
+		t.Errorf("Search archived = %+v, want the summary only", results)
+	}
+	if _, err := store.Rename("big", "/a", "Renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(archive); err != nil {
+		t.Errorf("Rename brought the history back inline: %v", err)
+	}
+
+	// The oldest sessions go first, and a deleted session's archive with it.
+	actions, err = store.GC(RetentionPolicy{MaxTotalBytes: 100}, false)
+	if err != nil || len(actions) != 2 || actions[0].ID != "small" || actions[1].ID != "big" || actions[1].Reason != GCSize {
+		t.Fatalf("GC(MaxTotalBytes) = %+v, %v", actions, err)
+	}
+	if _, err := os.Stat(archive); !os.IsNotExist(err) {
+		t.Errorf("archive of deleted session kept: %v", err)
+	}
+}
+
+func TestStoreSaveArchivedHistory(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestStore(t, dir)
+	sess := &Session{ID: "s", RepoPath: "/a", History: []engine.ChatMessage{{Role: engine.RoleUser, Content: strings.Repeat("x", 2000)}}}
+	if err := store.Save(sess); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GC(RetentionPolicy{MaxHistoryBytes: 1000}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Resuming and appending stores the whole history inline again.
+	sess.History = append(sess.History, engine.ChatMessage{Role: engine.RoleAssistant, Content: "done"})
+	if err := store.Append(sess, 1); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, archiveDir, store.RepoHash("/a"), "s.json.gz")); !os.IsNotExist(err) {
+		t.Errorf("archive kept after saving inline: %v", err)
+	}
+	loaded, err := store.Load("s", "/a")
+	if err != nil || len(loaded.History) != 2 {
+		t.Errorf("Load = %+v, %v", loaded, err)
+	}
+}
@@ -16,6 +16,33 @@ type Session struct {
 	UpdatedAt time.Time            `json:"updated_at"`
 	History   []engine.ChatMessage `json:"history"`
 	Summary   string               `json:"summary,omitempty"` // Context injection for next session
+
+	Archived     bool     `json:"archived,omitempty"`      // Hidden from listings unless asked for
+	Pinned       bool     `json:"pinned,omitempty"`        // Exempt from garbage collection
+	TokensUsed   int      `json:"tokens_used,omitempty"`   // Total tokens across the session's runs
+	FilesTouched []string `json:"files_touched,omitempty"` // Files changed by the session's runs
+
+	ParentID    string       `json:"parent_id,omitempty"`   // Session this one was forked from
+	ForkIndex   int          `json:"fork_index,omitempty"`  // Messages of the parent's history it started with
+	Checkpoints []Checkpoint `json:"checkpoints,omitempty"` // Files before the session's edits, for restoring
+}
+
+// Meta returns the listing metadata for s.
+func (s *Session) Meta() SessionMeta {
+	return SessionMeta{
+		ID:           s.ID,
+		Title:        s.Title,
+		CreatedAt:    s.CreatedAt,
+		UpdatedAt:    s.UpdatedAt,
+		Summary:      s.Summary,
+		MessageCount: len(s.History),
+		TokensUsed:   s.TokensUsed,
+		FilesTouched: s.FilesTouched,
+		Archived:     s.Archived,
+		Pinned:       s.Pinned,
+		ParentID:     s.ParentID,
+		ForkIndex:    s.ForkIndex,
+	}
 }
 
 // SessionMeta is a lightweight representation for listing in the UI.
@@ -25,4 +52,50 @@ type SessionMeta struct {
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	Summary   string    `json:"summary,omitempty"`
+
+	MessageCount int      `json:"message_count"`
+	TokensUsed   int      `json:"tokens_used"`
+	FilesTouched []string `json:"files_touched,omitempty"`
+	Archived     bool     `json:"archived,omitempty"`
+	Pinned       bool     `json:"pinned,omitempty"`
+	ParentID     string   `json:"parent_id,omitempty"`
+	ForkIndex    int      `json:"fork_index,omitempty"`
+}
+
+// ListOptions selects a page of sessions.
+type ListOptions struct {
+	Offset          int
+	Limit           int // 0 means no limit
+	IncludeArchived bool
+}
+
+// InterruptedToolResult is the result given to tool calls a run was
+// interrupted before finishing.
+const InterruptedToolResult = "Error: the engine stopped before this tool call finished; its effects are unknown."
+
+// AnswerPendingToolCalls returns history with a result added after each
+// assistant message for its tool calls that have none, as a run that was
+// interrupted mid-step leaves them. Models reject a conversation with
+// unanswered tool calls.
+func AnswerPendingToolCalls(history []engine.ChatMessage) []engine.ChatMessage {
+	out := make([]engine.ChatMessage, 0, len(history))
+	for i := 0; i < len(history); {
+		msg := history[i]
+		out = append(out, msg)
+		i++
+		if len(msg.ToolCalls) == 0 {
+			continue
+		}
+		answered := make(map[string]bool)
+		for ; i < len(history) && history[i].Role == engine.RoleTool; i++ {
+			answered[history[i].Name] = true
+			out = append(out, history[i])
+		}
+		for _, call := range msg.ToolCalls {
+			if !answered[call.ID] {
+				out = append(out, engine.ChatMessage{Role: engine.RoleTool, Name: call.ID, Content: InterruptedToolResult})
+			}
+		}
+	}
+	return out
 }
@@ -0,0 +1,16 @@
+//go:build windows
+// +build windows
+
+package session
+
+import "os"
+
+// processAlive reports whether a process with the given PID is running.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
@@ -2,25 +2,170 @@ package session
 
 import (
 	"crypto/sha256"
+	"database/sql"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ChamsBouzaiene/dodo/internal/engine"
+
+	_ "modernc.org/sqlite"
 )
 
-// Store handles persistence of sessions.
+// Store handles persistence of sessions, in a SQLite database with a
+// full-text index over their titles, summaries and messages.
 type Store struct {
-	basePath string
+	db  *sql.DB
+	dir string // configPath
 }
 
-// NewStore creates a new session store.
-// configPath is typically ~/.dodo
-func NewStore(configPath string) *Store {
-	return &Store{
-		basePath: filepath.Join(configPath, "sessions"),
+// NewStore opens the session store in configPath, typically ~/.dodo,
+// creating it if needed. Sessions saved as JSON files by earlier versions
+// are imported on first use.
+func NewStore(configPath string) (*Store, error) {
+	if err := os.MkdirAll(configPath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create session directory: %w", err)
+	}
+	dsn := filepath.Join(configPath, "sessions.db") + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session database: %w", err)
+	}
+	db.SetMaxOpenConns(1) // SQLite doesn't support multiple writers well
+
+	s := &Store{db: db, dir: configPath}
+	if err := s.initSchema(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize session database: %w", err)
+	}
+	s.importJSON(filepath.Join(configPath, "sessions"))
+	return s, nil
+}
+
+// Close closes the database, first folding its write-ahead log, where
+// saves are appended, back into it.
+func (s *Store) Close() error {
+	if _, err := s.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		log.Printf("failed to checkpoint session database: %v", err)
+	}
+	return s.db.Close()
+}
+
+func (s *Store) initSchema() error {
+	_, err := s.db.Exec(`
+	CREATE TABLE IF NOT EXISTS sessions (
+		repo_hash     TEXT NOT NULL,
+		id            TEXT NOT NULL,
+		repo_path     TEXT NOT NULL,
+		title         TEXT NOT NULL,
+		summary       TEXT NOT NULL DEFAULT '',
+		created_at    INTEGER NOT NULL,
+		updated_at    INTEGER NOT NULL,
+		archived      INTEGER NOT NULL DEFAULT 0,
+		tokens_used   INTEGER NOT NULL DEFAULT 0,
+		files_touched TEXT NOT NULL DEFAULT '[]',
+		parent_id     TEXT NOT NULL DEFAULT '',
+		fork_index    INTEGER NOT NULL DEFAULT 0,
+		message_count INTEGER NOT NULL DEFAULT 0,
+		checkpoints   TEXT NOT NULL DEFAULT '[]',
+		run_pid       INTEGER NOT NULL DEFAULT 0,  -- of the engine running a user message, 0 when idle
+		run_message   TEXT NOT NULL DEFAULT '',
+		pinned        INTEGER NOT NULL DEFAULT 0,  -- exempt from garbage collection
+		history_archive TEXT NOT NULL DEFAULT '', -- compressed file holding the messages, see archiveHistory
+		PRIMARY KEY (repo_hash, id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_sessions_updated ON sessions(repo_hash, updated_at);
+
+	-- Conversation history, one row per message
+	CREATE TABLE IF NOT EXISTS messages (
+		repo_hash  TEXT NOT NULL,
+		session_id TEXT NOT NULL,
+		seq        INTEGER NOT NULL,
+		role       TEXT NOT NULL,
+		content    TEXT NOT NULL,
+		name       TEXT NOT NULL DEFAULT '',
+		tool_calls TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (repo_hash, session_id, seq)
+	);
+
+	-- Searchable text: the title and summary (message_index -1) and the
+	-- user and assistant messages, by their index among the visible ones
+	CREATE VIRTUAL TABLE IF NOT EXISTS session_fts USING fts5(
+		repo_hash UNINDEXED,
+		session_id UNINDEXED,
+		message_index UNINDEXED,
+		text,
+		tokenize = 'porter unicode61'
+	);
+	`)
+	if err != nil {
+		return err
+	}
+	return s.addColumns("sessions", map[string]string{
+		"run_pid":         "INTEGER NOT NULL DEFAULT 0",
+		"run_message":     "TEXT NOT NULL DEFAULT ''",
+		"pinned":          "INTEGER NOT NULL DEFAULT 0",
+		"history_archive": "TEXT NOT NULL DEFAULT ''",
+	})
+}
+
+// addColumns adds the columns a table created by an earlier version lacks.
+func (s *Store) addColumns(table string, columns map[string]string) error {
+	rows, err := s.db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for name, def := range columns {
+		if existing[name] {
+			continue
+		}
+		if _, err := s.db.Exec("ALTER TABLE " + table + " ADD COLUMN " + name + " " + def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importJSON moves sessions saved as <dir>/<repohash>/<id>.json into the
+// database, renaming each file imported so it is not imported again.
+func (s *Store) importJSON(dir string) {
+	files, _ := filepath.Glob(filepath.Join(dir, "*", "*.json"))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var sess Session
+		if err := json.Unmarshal(data, &sess); err != nil || sess.ID == "" {
+			continue // Skip invalid files
+		}
+		if err := s.Save(&sess); err != nil {
+			log.Printf("failed to import session %s: %v", file, err)
+			continue
+		}
+		if err := os.Rename(file, file+".imported"); err != nil {
+			log.Printf("failed to mark session %s imported: %v", file, err)
+		}
 	}
 }
 
@@ -31,95 +176,567 @@ func (s *Store) RepoHash(repoPath string) string {
 	return hex.EncodeToString(hash[:])[:12] // Short hash is sufficient
 }
 
-// Save persists a session to disk.
+// Save persists a session, replacing the stored copy.
 func (s *Store) Save(session *Session) error {
+	return s.save(session, -1)
+}
+
+// Append persists a session whose stored copy holds the first from
+// messages of its history, adding only the messages after them. When the
+// stored copy holds a different number of messages, e.g. because a save
+// failed or the history was rewritten, the session is saved whole instead.
+// Either way the stored copy is replaced atomically.
+func (s *Store) Append(session *Session, from int) error {
+	return s.save(session, from)
+}
+
+// save writes session, keeping the first from of its stored messages when
+// the stored copy holds exactly that many; from < 0 rewrites them all.
+func (s *Store) save(session *Session, from int) error {
 	if session.RepoHash == "" {
 		session.RepoHash = s.RepoHash(session.RepoPath)
 	}
+	filesTouched, err := json.Marshal(orEmpty(session.FilesTouched))
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+	checkpoints, err := json.Marshal(orEmpty(session.Checkpoints))
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	defer tx.Rollback()
 
-	dir := filepath.Join(s.basePath, session.RepoHash)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("failed to create session directory: %w", err)
+	key := []any{session.RepoHash, session.ID}
+	var stored int
+	var archive string
+	err = tx.QueryRow("SELECT message_count, history_archive FROM sessions WHERE repo_hash = ? AND id = ?", key...).Scan(&stored, &archive)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	if from > len(session.History) || stored != from || archive != "" {
+		from = -1 // the history is stored inline again
 	}
 
-	filename := filepath.Join(dir, fmt.Sprintf("%s.json", session.ID))
-	data, err := json.MarshalIndent(session, "", "  ")
+	_, err = tx.Exec(`
+		INSERT INTO sessions (repo_hash, id, repo_path, title, summary, created_at, updated_at, archived,
+			tokens_used, files_touched, parent_id, fork_index, message_count, checkpoints, pinned, history_archive)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, '')
+		ON CONFLICT (repo_hash, id) DO UPDATE SET
+			repo_path = excluded.repo_path, title = excluded.title, summary = excluded.summary,
+			created_at = excluded.created_at, updated_at = excluded.updated_at, archived = excluded.archived,
+			tokens_used = excluded.tokens_used, files_touched = excluded.files_touched,
+			parent_id = excluded.parent_id, fork_index = excluded.fork_index,
+			message_count = excluded.message_count, checkpoints = excluded.checkpoints,
+			pinned = excluded.pinned, history_archive = ''`,
+		session.RepoHash, session.ID, session.RepoPath, session.Title, session.Summary,
+		unixNano(session.CreatedAt), unixNano(session.UpdatedAt), session.Archived,
+		session.TokensUsed, string(filesTouched), session.ParentID, session.ForkIndex,
+		len(session.History), string(checkpoints), session.Pinned)
 	if err != nil {
-		return fmt.Errorf("failed to marshal session: %w", err)
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	if from < 0 {
+		from = 0
+		for _, table := range []string{"messages", "session_fts"} {
+			if _, err := tx.Exec("DELETE FROM "+table+" WHERE repo_hash = ? AND session_id = ?", key...); err != nil {
+				return fmt.Errorf("failed to save session: %w", err)
+			}
+		}
+	} else if _, err := tx.Exec("DELETE FROM session_fts WHERE repo_hash = ? AND session_id = ? AND message_index = -1", key...); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
 	}
 
-	if err := os.WriteFile(filename, data, 0644); err != nil {
-		return fmt.Errorf("failed to write session file: %w", err)
+	insertFTS := func(index int, text string) error {
+		_, err := tx.Exec("INSERT INTO session_fts (repo_hash, session_id, message_index, text) VALUES (?, ?, ?, ?)",
+			session.RepoHash, session.ID, index, text)
+		return err
+	}
+	if err := insertFTS(-1, session.Title+"\n"+session.Summary); err != nil {
+		return fmt.Errorf("failed to index session: %w", err)
+	}
+	visible := 0
+	for _, msg := range session.History[:from] {
+		if visibleMessage(msg) {
+			visible++
+		}
+	}
+	for seq := from; seq < len(session.History); seq++ {
+		msg := session.History[seq]
+		var toolCalls []byte
+		if len(msg.ToolCalls) > 0 {
+			if toolCalls, err = json.Marshal(msg.ToolCalls); err != nil {
+				return fmt.Errorf("failed to marshal session: %w", err)
+			}
+		}
+		_, err := tx.Exec("INSERT INTO messages (repo_hash, session_id, seq, role, content, name, tool_calls) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			session.RepoHash, session.ID, seq, string(msg.Role), msg.Content, msg.Name, string(toolCalls))
+		if err != nil {
+			return fmt.Errorf("failed to save session: %w", err)
+		}
+		if !visibleMessage(msg) {
+			continue
+		}
+		if msg.Role != engine.RoleSystem {
+			if err := insertFTS(visible, msg.Content); err != nil {
+				return fmt.Errorf("failed to index session: %w", err)
+			}
+		}
+		visible++
 	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	s.removeArchive(archive)
 	return nil
 }
 
+// visibleMessage reports whether msg is one of the user, assistant and
+// system messages a conversation is shown as.
+func visibleMessage(msg engine.ChatMessage) bool {
+	switch msg.Role {
+	case engine.RoleUser, engine.RoleAssistant, engine.RoleSystem:
+		return msg.Content != ""
+	}
+	return false
+}
+
 // Load retrieves a specific session.
 func (s *Store) Load(id string, repoPath string) (*Session, error) {
-	repoHash := s.RepoHash(repoPath)
-	filename := filepath.Join(s.basePath, repoHash, fmt.Sprintf("%s.json", id))
+	return s.load(s.RepoHash(repoPath), id)
+}
 
-	data, err := os.ReadFile(filename)
+func (s *Store) load(repoHash string, id string) (*Session, error) {
+	metas, err := s.query("WHERE repo_hash = ? AND id = ?", repoHash, id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read session file: %w", err)
+		return nil, err
+	}
+	if len(metas) == 0 {
+		return nil, fmt.Errorf("session not found: %s", id)
+	}
+	sess := metas[0].session
+	if metas[0].historyArchive != "" {
+		if sess.History, err = s.readArchive(metas[0].historyArchive); err != nil {
+			return nil, fmt.Errorf("failed to load session: %w", err)
+		}
+		return sess, nil
 	}
 
-	var session Session
-	if err := json.Unmarshal(data, &session); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal session: %w", err)
+	rows, err := s.db.Query("SELECT role, content, name, tool_calls FROM messages WHERE repo_hash = ? AND session_id = ? ORDER BY seq", repoHash, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+	defer rows.Close()
+	sess.History = []engine.ChatMessage{}
+	for rows.Next() {
+		var msg engine.ChatMessage
+		var role, toolCalls string
+		if err := rows.Scan(&role, &msg.Content, &msg.Name, &toolCalls); err != nil {
+			return nil, fmt.Errorf("failed to load session: %w", err)
+		}
+		msg.Role = engine.MessageRole(role)
+		if toolCalls != "" {
+			if err := json.Unmarshal([]byte(toolCalls), &msg.ToolCalls); err != nil {
+				return nil, fmt.Errorf("failed to load session: %w", err)
+			}
+		}
+		sess.History = append(sess.History, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load session: %w", err)
 	}
+	return sess, nil
+}
+
+// storedSession is a sessions row: a session without its history.
+type storedSession struct {
+	session        *Session
+	messageCount   int
+	historyArchive string
+}
+
+func (r storedSession) meta() SessionMeta {
+	meta := r.session.Meta()
+	meta.MessageCount = r.messageCount
+	return meta
+}
+
+const sessionColumns = `repo_hash, id, repo_path, title, summary, created_at, updated_at, archived,
+	tokens_used, files_touched, parent_id, fork_index, message_count, checkpoints, pinned, history_archive`
+
+// newestFirst orders sessions rows.
+const newestFirst = " ORDER BY updated_at DESC"
 
-	return &session, nil
+// query returns the sessions rows selected by clause (WHERE, ORDER BY,
+// LIMIT).
+func (s *Store) query(clause string, args ...any) ([]storedSession, error) {
+	rows, err := s.db.Query("SELECT "+sessionColumns+" FROM sessions "+clause, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+	var out []storedSession
+	for rows.Next() {
+		r, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	return out, nil
+}
+
+// scanSession reads the sessionColumns of a row, followed by extra.
+func scanSession(rows *sql.Rows, extra ...any) (storedSession, error) {
+	var sess Session
+	var created, updated int64
+	var filesTouched, checkpoints string
+	var r storedSession
+	dest := append([]any{&sess.RepoHash, &sess.ID, &sess.RepoPath, &sess.Title, &sess.Summary,
+		&created, &updated, &sess.Archived, &sess.TokensUsed, &filesTouched, &sess.ParentID,
+		&sess.ForkIndex, &r.messageCount, &checkpoints, &sess.Pinned, &r.historyArchive}, extra...)
+	if err := rows.Scan(dest...); err != nil {
+		return r, fmt.Errorf("failed to read session: %w", err)
+	}
+	sess.CreatedAt = fromUnixNano(created)
+	sess.UpdatedAt = fromUnixNano(updated)
+	if err := json.Unmarshal([]byte(filesTouched), &sess.FilesTouched); err != nil {
+		return r, fmt.Errorf("failed to read session: %w", err)
+	}
+	if err := json.Unmarshal([]byte(checkpoints), &sess.Checkpoints); err != nil {
+		return r, fmt.Errorf("failed to read session: %w", err)
+	}
+	if len(sess.FilesTouched) == 0 {
+		sess.FilesTouched = nil
+	}
+	if len(sess.Checkpoints) == 0 {
+		sess.Checkpoints = nil
+	}
+	r.session = &sess
+	return r, nil
 }
 
 // List returns all sessions for a given repository.
 // Sessions are sorted by UpdatedAt (newest first).
 func (s *Store) List(repoPath string) ([]SessionMeta, error) {
+	return s.metas("WHERE repo_hash = ?"+newestFirst, s.RepoHash(repoPath))
+}
+
+func (s *Store) metas(clause string, args ...any) ([]SessionMeta, error) {
+	rows, err := s.query(clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	metas := make([]SessionMeta, 0, len(rows))
+	for _, r := range rows {
+		metas = append(metas, r.meta())
+	}
+	return metas, nil
+}
+
+// Page returns one page of a repository's sessions, newest first, and the
+// number of sessions matching opts before paging.
+func (s *Store) Page(repoPath string, opts ListOptions) ([]SessionMeta, int, error) {
+	where := "WHERE repo_hash = ?"
+	if !opts.IncludeArchived {
+		where += " AND archived = 0"
+	}
 	repoHash := s.RepoHash(repoPath)
-	dir := filepath.Join(s.basePath, repoHash)
 
-	entries, err := os.ReadDir(dir)
-	if os.IsNotExist(err) {
-		return []SessionMeta{}, nil
+	var total int
+	if err := s.db.QueryRow("SELECT count(*) FROM sessions "+where, repoHash).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count sessions: %w", err)
 	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = -1 // no limit
+	}
+	page, err := s.metas(where+newestFirst+" LIMIT ? OFFSET ?", repoHash, limit, max(opts.Offset, 0))
 	if err != nil {
-		return nil, fmt.Errorf("failed to list session directory: %w", err)
+		return nil, 0, err
 	}
+	return page, total, nil
+}
 
-	var sessions []SessionMeta
-	for _, entry := range entries {
-		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
-			continue
+// Delete removes a session from the store.
+func (s *Store) Delete(id string, repoPath string) error {
+	if err := s.delete(s.RepoHash(repoPath), id); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) delete(repoHash string, id string) error {
+	var archive string
+	err := s.db.QueryRow("SELECT history_archive FROM sessions WHERE repo_hash = ? AND id = ?", repoHash, id).Scan(&archive)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("session not found: %s", id)
+	} else if err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, table := range []string{"sessions", "messages", "session_fts"} {
+		column := "session_id"
+		if table == "sessions" {
+			column = "id"
+		}
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE repo_hash = ? AND "+column+" = ?", repoHash, id); err != nil {
+			return err
 		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.removeArchive(archive)
+	return nil
+}
+
+// BeginRun marks a stored session as running message in this process, so
+// that if the process dies before EndRun the run can be found by
+// Interrupted.
+func (s *Store) BeginRun(id string, repoPath string, message string) error {
+	return s.setRun(id, repoPath, os.Getpid(), message)
+}
+
+// EndRun clears the mark BeginRun left.
+func (s *Store) EndRun(id string, repoPath string) error {
+	return s.setRun(id, repoPath, 0, "")
+}
+
+func (s *Store) setRun(id string, repoPath string, pid int, message string) error {
+	_, err := s.db.Exec("UPDATE sessions SET run_pid = ?, run_message = ? WHERE repo_hash = ? AND id = ?",
+		pid, message, s.RepoHash(repoPath), id)
+	if err != nil {
+		return fmt.Errorf("failed to mark session run: %w", err)
+	}
+	return nil
+}
 
-		// Optimization: checking only basic metadata without loading full history?
-		// For now, we load the file to get accurate title/times.
-		// If performance becomes an issue, we can peek or store separate index.
-		filepath := filepath.Join(dir, entry.Name())
-		data, err := os.ReadFile(filepath)
+// InterruptedRun is a run that never ended because the process running it
+// exited or crashed.
+type InterruptedRun struct {
+	Meta    SessionMeta
+	Message string // the user message being run
+}
+
+// Interrupted returns a repository's sessions whose last run was
+// interrupted, newest first.
+func (s *Store) Interrupted(repoPath string) ([]InterruptedRun, error) {
+	rows, err := s.db.Query("SELECT "+sessionColumns+", run_pid, run_message FROM sessions WHERE repo_hash = ? AND run_pid != 0"+newestFirst,
+		s.RepoHash(repoPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+	var runs []InterruptedRun
+	for rows.Next() {
+		var run InterruptedRun
+		var pid int
+		r, err := scanSession(rows, &pid, &run.Message)
 		if err != nil {
-			continue // Skip unreadable files
+			return nil, err
+		}
+		if processAlive(pid) {
+			continue // still running, possibly in another engine
 		}
+		run.Meta = r.meta()
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	return runs, nil
+}
 
-		var sess Session
-		if err := json.Unmarshal(data, &sess); err != nil {
-			continue // Skip invalid files
+// Rename changes a stored session's title.
+func (s *Store) Rename(id string, repoPath string, title string) (*Session, error) {
+	return s.update(id, repoPath, func(sess *Session) { sess.Title = title })
+}
+
+// SetPinned pins a stored session, exempting it from garbage collection, or
+// unpins it.
+func (s *Store) SetPinned(id string, repoPath string, pinned bool) (*Session, error) {
+	return s.update(id, repoPath, func(sess *Session) { sess.Pinned = pinned })
+}
+
+// SetArchived archives or restores a stored session.
+func (s *Store) SetArchived(id string, repoPath string, archived bool) (*Session, error) {
+	return s.update(id, repoPath, func(sess *Session) { sess.Archived = archived })
+}
+
+// Fork saves a new session, forkID, that starts with the first
+// messageIndex messages of session id's history and is linked to it as a
+// child. The fork keeps the checkpoints of edits made before that point.
+func (s *Store) Fork(id string, repoPath string, forkID string, messageIndex int) (*Session, error) {
+	parent, err := s.Load(id, repoPath)
+	if err != nil {
+		return nil, err
+	}
+	if messageIndex < 0 || messageIndex > len(parent.History) {
+		return nil, fmt.Errorf("message index %d is out of range (the session has %d messages)", messageIndex, len(parent.History))
+	}
+	now := time.Now()
+	fork := &Session{
+		ID:          forkID,
+		RepoPath:    parent.RepoPath,
+		Title:       parent.Title + " (fork)",
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		History:     parent.History[:messageIndex],
+		ParentID:    parent.ID,
+		ForkIndex:   messageIndex,
+		Checkpoints: CheckpointsBefore(parent.Checkpoints, messageIndex),
+	}
+	if err := s.Save(fork); err != nil {
+		return nil, err
+	}
+	return fork, nil
+}
+
+// Children returns the sessions forked from session id, newest first.
+func (s *Store) Children(id string, repoPath string) ([]SessionMeta, error) {
+	return s.metas("WHERE repo_hash = ? AND parent_id = ?"+newestFirst, s.RepoHash(repoPath), id)
+}
+
+// SearchResult is a session matching a search, with the text that matched
+// best.
+type SearchResult struct {
+	Meta         SessionMeta
+	Snippet      string // the matching words are marked with ** **
+	MessageIndex int    // among the visible messages; -1 when the title or summary matched
+}
+
+// Search returns a repository's sessions whose title, summary or user and
+// assistant messages contain any word of query, best match first. Words
+// match their inflections too, e.g. "fix" matches "fixed".
+func (s *Store) Search(repoPath string, query string, opts ListOptions) ([]SearchResult, error) {
+	match := ftsQuery(query)
+	if match == "" {
+		return nil, errors.New("search query has no words")
+	}
+	repoHash := s.RepoHash(repoPath)
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = -1 // no limit
+	}
+	archived := ""
+	if !opts.IncludeArchived {
+		archived = "AND s.archived = 0"
+	}
+
+	// The matches are materialized because bm25 and snippet can't be used
+	// in an aggregate; min picks the row of the best match per session.
+	rows, err := s.db.Query(`
+		WITH m AS MATERIALIZED (
+			SELECT session_id, message_index, snippet(session_fts, 3, '**', '**', '…', 16) AS snippet, bm25(session_fts) AS rank
+			FROM session_fts WHERE session_fts MATCH ? AND repo_hash = ?
+		), best AS (
+			SELECT session_id, message_index, snippet, min(rank) AS rank FROM m GROUP BY session_id
+		)
+		SELECT `+prefixed("s.", sessionColumns)+`, best.message_index, best.snippet
+		FROM best JOIN sessions s ON s.repo_hash = ? AND s.id = best.session_id `+archived+`
+		ORDER BY best.rank LIMIT ? OFFSET ?`,
+		match, repoHash, repoHash, limit, max(opts.Offset, 0))
+	if err != nil {
+		return nil, fmt.Errorf("failed to search sessions: %w", err)
+	}
+	defer rows.Close()
+	var results []SearchResult
+	for rows.Next() {
+		var res SearchResult
+		r, err := scanSession(rows, &res.MessageIndex, &res.Snippet)
+		if err != nil {
+			return nil, err
 		}
+		res.Meta = r.meta()
+		results = append(results, res)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search sessions: %w", err)
+	}
+	return results, nil
+}
 
-		sessions = append(sessions, SessionMeta{
-			ID:        sess.ID,
-			Title:     sess.Title,
-			CreatedAt: sess.CreatedAt,
-			UpdatedAt: sess.UpdatedAt,
-			Summary:   sess.Summary,
-		})
+// ftsQuery turns free text into an FTS5 query matching any of its words.
+func ftsQuery(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	for i, w := range words {
+		words[i] = `"` + w + `"`
 	}
+	return strings.Join(words, " OR ")
+}
 
-	// Sort by UpdatedAt descending
-	sort.Slice(sessions, func(i, j int) bool {
-		return sessions[i].UpdatedAt.After(sessions[j].UpdatedAt)
-	})
+// prefixed qualifies each of a comma-separated list of columns.
+func prefixed(prefix, columns string) string {
+	cols := strings.Split(columns, ",")
+	for i, c := range cols {
+		cols[i] = prefix + strings.TrimSpace(c)
+	}
+	return strings.Join(cols, ", ")
+}
+
+// update loads a session, applies fn and saves the title, archived and
+// pinned flags back; its messages are left as they are stored.
+func (s *Store) update(id string, repoPath string, fn func(*Session)) (*Session, error) {
+	sess, err := s.Load(id, repoPath)
+	if err != nil {
+		return nil, err
+	}
+	fn(sess)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to update session: %w", err)
+	}
+	defer tx.Rollback()
+	key := []any{sess.RepoHash, sess.ID}
+	if _, err := tx.Exec("UPDATE sessions SET title = ?, archived = ?, pinned = ? WHERE repo_hash = ? AND id = ?",
+		append([]any{sess.Title, sess.Archived, sess.Pinned}, key...)...); err != nil {
+		return nil, fmt.Errorf("failed to update session: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM session_fts WHERE repo_hash = ? AND session_id = ? AND message_index = -1", key...); err != nil {
+		return nil, fmt.Errorf("failed to update session: %w", err)
+	}
+	if _, err := tx.Exec("INSERT INTO session_fts (repo_hash, session_id, message_index, text) VALUES (?, ?, -1, ?)",
+		append(key, sess.Title+"\n"+sess.Summary)...); err != nil {
+		return nil, fmt.Errorf("failed to index session: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to update session: %w", err)
+	}
+	return sess, nil
+}
+
+func orEmpty[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
+
+// unixNano stores t; the zero time is stored as 0.
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
 
-	return sessions, nil
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
 }
@@ -2,6 +2,7 @@ package session
 
 import (
 	"os"
+	"os/exec"
 	"path/filepath"
 	"testing"
 	"time"
@@ -9,6 +10,16 @@ import (
 	"github.com/ChamsBouzaiene/dodo/internal/engine"
 )
 
+func newTestStore(t *testing.T, dir string) *Store {
+	t.Helper()
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
 func TestStore(t *testing.T) {
 	// Create a temporary directory for the store
 	tmpDir, err := os.MkdirTemp("", "dodo-session-test")
@@ -17,7 +28,7 @@ func TestStore(t *testing.T) {
 	}
 	defer os.RemoveAll(tmpDir)
 
-	store := NewStore(tmpDir)
+	store := newTestStore(t, tmpDir)
 	repoPath := "/path/to/my/project"
 
 	// Create a dummy session
@@ -38,11 +49,10 @@ func TestStore(t *testing.T) {
 		t.Fatalf("Save failed: %v", err)
 	}
 
-	// Verify file existence
-	repoHash := store.RepoHash(repoPath)
-	expectedPath := filepath.Join(tmpDir, "sessions", repoHash, "test-session-id.json")
+	// Verify database existence
+	expectedPath := filepath.Join(tmpDir, "sessions.db")
 	if _, err := os.Stat(expectedPath); os.IsNotExist(err) {
-		t.Errorf("Expected session file to exist at %s", expectedPath)
+		t.Errorf("Expected session database to exist at %s", expectedPath)
 	}
 
 	// Test Load
@@ -71,3 +81,254 @@ func TestStore(t *testing.T) {
 		t.Errorf("Expected title %s, got %s", session.Title, list[0].Title)
 	}
 }
+
+func TestStorePageAndManage(t *testing.T) {
+	store := newTestStore(t, t.TempDir())
+	repoPath := "/path/to/my/project"
+	base := time.Now()
+
+	for i, id := range []string{"a", "b", "c"} {
+		err := store.Save(&Session{
+			ID:         id,
+			RepoPath:   repoPath,
+			Title:      id,
+			UpdatedAt:  base.Add(time.Duration(i) * time.Minute),
+			History:    []engine.ChatMessage{{Role: engine.RoleUser, Content: "hi"}},
+			TokensUsed: 10 * (i + 1),
+		})
+		if err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+
+	if _, err := store.SetArchived("c", repoPath, true); err != nil {
+		t.Fatalf("SetArchived failed: %v", err)
+	}
+	page, total, err := store.Page(repoPath, ListOptions{Limit: 1})
+	if err != nil {
+		t.Fatalf("Page failed: %v", err)
+	}
+	if total != 2 || len(page) != 1 || page[0].ID != "b" {
+		t.Fatalf("Page(limit 1) = %+v, total %d; want [b], 2", page, total)
+	}
+	if page[0].MessageCount != 1 || page[0].TokensUsed != 20 {
+		t.Errorf("metadata = %+v", page[0])
+	}
+	if page, total, _ = store.Page(repoPath, ListOptions{Offset: 1, IncludeArchived: true}); total != 3 || len(page) != 2 || page[0].ID != "b" {
+		t.Errorf("Page(offset 1, archived) = %+v, total %d", page, total)
+	}
+	if page, _, _ = store.Page(repoPath, ListOptions{Offset: 5}); len(page) != 0 {
+		t.Errorf("Page past the end = %+v", page)
+	}
+
+	renamed, err := store.Rename("a", repoPath, "Renamed")
+	if err != nil || renamed.Title != "Renamed" {
+		t.Fatalf("Rename = %+v, %v", renamed, err)
+	}
+	if err := store.Delete("a", repoPath); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := store.Load("a", repoPath); err == nil {
+		t.Error("Load succeeded after Delete")
+	}
+	if err := store.Delete("a", repoPath); err == nil {
+		t.Error("Delete of a missing session succeeded")
+	}
+}
+
+func TestStoreFork(t *testing.T) {
+	store := newTestStore(t, t.TempDir())
+	repoPath := "/path/to/my/project"
+	parent := &Session{
+		ID:       "parent",
+		RepoPath: repoPath,
+		Title:    "Fix login",
+		History: []engine.ChatMessage{
+			{Role: engine.RoleUser, Content: "one"},
+			{Role: engine.RoleAssistant, Content: "done"},
+			{Role: engine.RoleUser, Content: "two"},
+		},
+		Checkpoints: []Checkpoint{
+			{MessageIndex: 1, Path: "a.go", Exists: true},
+			{MessageIndex: 2, Path: "b.go"},
+		},
+	}
+	if err := store.Save(parent); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	fork, err := store.Fork("parent", repoPath, "child", 2)
+	if err != nil {
+		t.Fatalf("Fork failed: %v", err)
+	}
+	if fork.ParentID != "parent" || fork.ForkIndex != 2 || len(fork.History) != 2 || fork.Title != "Fix login (fork)" {
+		t.Errorf("Fork = %+v", fork)
+	}
+	if len(fork.Checkpoints) != 1 || fork.Checkpoints[0].Path != "a.go" {
+		t.Errorf("fork checkpoints = %+v, want only a.go's", fork.Checkpoints)
+	}
+	children, err := store.Children("parent", repoPath)
+	if err != nil || len(children) != 1 || children[0].ID != "child" || children[0].ParentID != "parent" {
+		t.Errorf("Children = %+v, %v", children, err)
+	}
+	if _, err := store.Fork("parent", repoPath, "other", 4); err == nil {
+		t.Error("Fork past the end of the history succeeded")
+	}
+}
+
+func TestStoreSearch(t *testing.T) {
+	store := newTestStore(t, t.TempDir())
+	repoPath := "/path/to/my/project"
+	sessions := []*Session{
+		{ID: "bleve", Title: "Search index", History: []engine.ChatMessage{
+			{Role: engine.RoleSystem, Content: "You are dodo"},
+			{Role: engine.RoleUser, Content: "the bleve mapping drops camelCase tokens"},
+			{Role: engine.RoleAssistant, Content: "", ToolCalls: []engine.ToolCall{{ID: "c1", Name: "grep", Args: map[string]any{"pattern": "mapping"}}}},
+			{Role: engine.RoleTool, Name: "c1", Content: "index/mapping.go"},
+			{Role: engine.RoleAssistant, Content: "I fixed the bleve mapping."},
+		}},
+		{ID: "login", Title: "Fix login mapping", History: []engine.ChatMessage{{Role: engine.RoleUser, Content: "login fails"}}},
+		{ID: "old", Title: "Bleve upgrade", Archived: true},
+	}
+	for _, s := range sessions {
+		s.RepoPath = repoPath
+		if err := store.Save(s); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+
+	results, err := store.Search(repoPath, "that session where we fixed the bleve mapping", ListOptions{})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 2 || results[0].Meta.ID != "bleve" || results[1].Meta.ID != "login" {
+		t.Fatalf("Search = %+v, want bleve then login", results)
+	}
+	if results[0].MessageIndex != 2 || results[0].Snippet != "I **fixed** **the** **bleve** **mapping**." {
+		t.Errorf("best match = %d %q, want the assistant's reply", results[0].MessageIndex, results[0].Snippet)
+	}
+	if results[1].MessageIndex != -1 || results[0].Meta.MessageCount != 5 {
+		t.Errorf("results = %+v", results)
+	}
+	if results, _ := store.Search(repoPath, "upgrade", ListOptions{IncludeArchived: true}); len(results) != 1 || results[0].Meta.ID != "old" {
+		t.Errorf("Search(archived) = %+v", results)
+	}
+	if _, err := store.Search(repoPath, "  ?! ", ListOptions{}); err == nil {
+		t.Error("Search with no words succeeded")
+	}
+
+	loaded, err := store.Load("bleve", repoPath)
+	if err != nil || len(loaded.History) != 5 || loaded.History[2].ToolCalls[0].Args["pattern"] != "mapping" || loaded.History[3].Name != "c1" {
+		t.Errorf("Load = %+v, %v", loaded, err)
+	}
+}
+
+func TestStoreImportsJSON(t *testing.T) {
+	dir := t.TempDir()
+	legacy := filepath.Join(dir, "sessions", "abc123")
+	if err := os.MkdirAll(legacy, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	doc := `{"id":"s1","repo_path":"/repo","title":"Old","history":[{"Role":"user","Content":"hi"}]}`
+	if err := os.WriteFile(filepath.Join(legacy, "s1.json"), []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := newTestStore(t, dir)
+	metas, err := store.List("/repo")
+	if err != nil || len(metas) != 1 || metas[0].Title != "Old" || metas[0].MessageCount != 1 {
+		t.Fatalf("List after import = %+v, %v", metas, err)
+	}
+	if _, err := os.Stat(filepath.Join(legacy, "s1.json.imported")); err != nil {
+		t.Errorf("imported file not renamed: %v", err)
+	}
+}
+
+func TestStoreAppend(t *testing.T) {
+	store := newTestStore(t, t.TempDir())
+	sess := &Session{ID: "s1", RepoPath: "/repo", Title: "Untitled Session", History: []engine.ChatMessage{
+		{Role: engine.RoleSystem, Content: "You are dodo"},
+		{Role: engine.RoleUser, Content: "rename the config loader"},
+	}}
+	if err := store.Append(sess, 0); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	sess.Title = "Rename loader"
+	sess.History = append(sess.History, engine.ChatMessage{Role: engine.RoleAssistant, Content: "Updated all callers."})
+	if err := store.Append(sess, 2); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	loaded, err := store.Load("s1", "/repo")
+	if err != nil || len(loaded.History) != 3 || loaded.History[2].Content != "Updated all callers." || loaded.Title != "Rename loader" {
+		t.Fatalf("Load after Append = %+v, %v", loaded, err)
+	}
+	if results, _ := store.Search("/repo", "callers", ListOptions{}); len(results) != 1 || results[0].MessageIndex != 2 {
+		t.Errorf("Search after Append = %+v", results)
+	}
+	if results, _ := store.Search("/repo", "untitled", ListOptions{}); len(results) != 0 {
+		t.Errorf("old title still indexed: %+v", results)
+	}
+
+	// A history that no longer starts with the stored messages is saved whole.
+	sess.History = []engine.ChatMessage{{Role: engine.RoleUser, Content: "start over"}, {Role: engine.RoleAssistant, Content: "ok"}}
+	if err := store.Append(sess, 1); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	loaded, err = store.Load("s1", "/repo")
+	if err != nil || len(loaded.History) != 2 || loaded.History[0].Content != "start over" {
+		t.Errorf("Load after diverging Append = %+v, %v", loaded, err)
+	}
+}
+
+func TestStoreInterrupted(t *testing.T) {
+	store := newTestStore(t, t.TempDir())
+	for _, id := range []string{"crashed", "running", "idle"} {
+		if err := store.Save(&Session{ID: id, RepoPath: "/repo", Title: id}); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+	exited := exec.Command(os.Args[0], "-test.run=^$")
+	if err := exited.Run(); err != nil {
+		t.Fatalf("failed to run a process: %v", err)
+	}
+	if err := store.setRun("crashed", "/repo", exited.ProcessState.Pid(), "add retries"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.BeginRun("running", "/repo", "still going"); err != nil {
+		t.Fatal(err)
+	}
+	// Saving doesn't clear the mark.
+	if _, err := store.Rename("crashed", "/repo", "Retries"); err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err := store.Interrupted("/repo")
+	if err != nil || len(runs) != 1 || runs[0].Meta.ID != "crashed" || runs[0].Message != "add retries" || runs[0].Meta.Title != "Retries" {
+		t.Fatalf("Interrupted = %+v, %v", runs, err)
+	}
+	if err := store.EndRun("crashed", "/repo"); err != nil {
+		t.Fatal(err)
+	}
+	if runs, _ := store.Interrupted("/repo"); len(runs) != 0 {
+		t.Errorf("Interrupted after EndRun = %+v", runs)
+	}
+}
+
+func TestAnswerPendingToolCalls(t *testing.T) {
+	history := []engine.ChatMessage{
+		{Role: engine.RoleUser, Content: "fix it"},
+		{Role: engine.RoleAssistant, ToolCalls: []engine.ToolCall{{ID: "a"}, {ID: "b"}}},
+		{Role: engine.RoleTool, Name: "a", Content: "ok"},
+		{Role: engine.RoleAssistant, ToolCalls: []engine.ToolCall{{ID: "c"}}},
+	}
+	got := AnswerPendingToolCalls(history)
+	if len(got) != 6 {
+		t.Fatalf("AnswerPendingToolCalls = %+v", got)
+	}
+	if got[3].Name != "b" || got[3].Content != InterruptedToolResult || got[4].ToolCalls[0].ID != "c" || got[5].Name != "c" {
+		t.Errorf("AnswerPendingToolCalls = %+v", got)
+	}
+	if len(history) != 4 {
+		t.Error("AnswerPendingToolCalls changed its argument")
+	}
+}
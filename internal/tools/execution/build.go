@@ -91,8 +91,8 @@ func runBuildImpl(ctx context.Context, runner Runner, repoRoot string) (string,
 }
 
 // NewRunBuildTool creates an engine.Tool that wraps the run_build functionality.
-func NewRunBuildTool(repoRoot string) engine.Tool {
-	runner := NewSandboxRunner()
+// Builds run through runner.
+func NewRunBuildTool(repoRoot string, runner Runner) engine.Tool {
 	return engine.Tool{
 		Name:        "run_build",
 		Description: "Runs the appropriate build command for the project type. Auto-detects project type (Go, Node, Python, Rust) and runs the corresponding build command.",
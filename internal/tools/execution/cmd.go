@@ -237,8 +237,8 @@ func truncateOutput(output string, maxLines int) (string, bool) {
 }
 
 // NewRunCmdTool creates an engine.Tool that wraps the run_cmd functionality.
-func NewRunCmdTool(repoRoot string) engine.Tool {
-	runner := NewSandboxRunner()
+// Commands run through runner.
+func NewRunCmdTool(repoRoot string, runner Runner) engine.Tool {
 	return engine.Tool{
 		Name:        "run_cmd",
 		Description: "Runs a command with strict allowlist enforcement. Allowed: build tools (go, npm, yarn, python, pip, cargo, make), linters (eslint, prettier, ruff, tsc), file ops (ls, cat, grep, find, mkdir, rm, cp), git, curl/wget, shells (sh, bash), and utilities (jq, tar, zip). Supports optional timeout and output truncation.",
@@ -89,8 +89,8 @@ func runTestsImpl(ctx context.Context, runner Runner, repoRoot string) (string,
 }
 
 // NewRunTestsTool creates an engine.Tool that wraps the run_tests functionality.
-func NewRunTestsTool(repoRoot string) engine.Tool {
-	runner := NewSandboxRunner()
+// Tests run through runner.
+func NewRunTestsTool(repoRoot string, runner Runner) engine.Tool {
 	return engine.Tool{
 		Name:        "run_tests",
 		Description: "Runs the appropriate test command for the project type. Auto-detects project type (Go, Node, Python, Rust) and runs the corresponding test command.",
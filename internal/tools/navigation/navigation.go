@@ -0,0 +1,286 @@
+// Package navigation offers language-server tools: exact definitions,
+// references, implementations, hover information and diagnostics, where
+// grep and semantic search only find likely matches.
+package navigation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/ChamsBouzaiene/dodo/internal/engine"
+	"github.com/ChamsBouzaiene/dodo/internal/lsp"
+)
+
+// queryTimeout bounds a definition, reference or hover query, which may
+// wait for the server to load the workspace.
+const queryTimeout = 60 * time.Second
+
+// diagnosticsWait is how long diagnostics waits for the server to check a
+// file.
+const diagnosticsWait = 15 * time.Second
+
+// maxLocations caps the locations a tool lists.
+const maxLocations = 100
+
+const positionSchema = `{"type":"object","properties":{"path":{"type":"string","description":"File path relative to repository root"},"line":{"type":"integer","minimum":1,"description":"Line number (1-indexed) the symbol is on"},"symbol":{"type":"string","description":"The identifier on that line to ask about (its first occurrence is used)"},"column":{"type":"integer","minimum":1,"description":"Column (1-indexed, in characters) of the symbol, instead of symbol"}},"required":["path","line"]}`
+
+// NewTools returns the navigation tools backed by the repository's
+// language server.
+func NewTools(repoRoot string, manager *lsp.Manager) engine.ToolRegistry {
+	server := manager.ServerName()
+	tool := func(name, description, schema string, fn engine.ToolFunc) engine.Tool {
+		return engine.Tool{
+			Name:        name,
+			Description: description,
+			SchemaJSON:  schema,
+			Fn:          fn,
+			Retryable:   true,
+			Metadata: engine.ToolMetadata{
+				Version:  "1.0.0",
+				Category: "navigation",
+				Tags:     []string{"read-only", "lsp:" + server},
+			},
+		}
+	}
+	locations := func(query func(*lsp.Client, context.Context, string, lsp.Position) ([]lsp.Location, error)) engine.ToolFunc {
+		return func(ctx context.Context, args map[string]any) (string, error) {
+			client, path, pos, err := resolve(ctx, repoRoot, manager, args)
+			if err != nil {
+				return "", err
+			}
+			ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+			defer cancel()
+			locs, err := query(client, ctx, path, pos)
+			if err != nil {
+				return "", err
+			}
+			return formatLocations(client, locs)
+		}
+	}
+
+	return engine.ToolRegistry{
+		"goto_definition": tool("goto_definition",
+			"Finds where a symbol is defined, using the language server ("+server+"). Exact, unlike grep: follows imports, methods and aliases. Give the file, the line and the symbol on it.",
+			positionSchema,
+			locations((*lsp.Client).Definition)),
+		"find_references": tool("find_references",
+			"Lists every reference to a symbol (call sites, uses, its declaration), using the language server ("+server+"). Give the file, the line and the symbol on it.",
+			positionSchema,
+			locations((*lsp.Client).References)),
+		"find_implementations": tool("find_implementations",
+			"Lists the implementations of an interface or interface method (or the interfaces a type implements), using the language server ("+server+").",
+			positionSchema,
+			locations((*lsp.Client).Implementations)),
+		"hover": tool("hover",
+			"Shows the type or signature and documentation of a symbol, using the language server ("+server+").",
+			positionSchema,
+			func(ctx context.Context, args map[string]any) (string, error) {
+				client, path, pos, err := resolve(ctx, repoRoot, manager, args)
+				if err != nil {
+					return "", err
+				}
+				ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+				defer cancel()
+				text, err := client.Hover(ctx, path, pos)
+				if err != nil {
+					return "", err
+				}
+				return marshal(map[string]any{"path": client.Rel(path), "hover": text})
+			}),
+		"diagnostics": tool("diagnostics",
+			"Lists the compile errors and warnings the language server ("+server+") reports for a file, e.g. after editing it.",
+			`{"type":"object","properties":{"path":{"type":"string","description":"File path relative to repository root"}},"required":["path"]}`,
+			func(ctx context.Context, args map[string]any) (string, error) {
+				path, err := repoPath(repoRoot, args)
+				if err != nil {
+					return "", err
+				}
+				client, err := manager.Client(ctx)
+				if err != nil {
+					return "", err
+				}
+				ctx, cancel := context.WithTimeout(ctx, diagnosticsWait)
+				defer cancel()
+				diags, fresh, err := client.Diagnostics(ctx, path)
+				if err != nil {
+					return "", err
+				}
+				return formatDiagnostics(client.Rel(path), diags, fresh)
+			}),
+	}
+}
+
+// repoPath resolves the path argument, which must name a file in the
+// repository.
+func repoPath(repoRoot string, args map[string]any) (string, error) {
+	rel, _ := args["path"].(string)
+	if rel == "" {
+		return "", fmt.Errorf("path must be a non-empty string")
+	}
+	path := filepath.Clean(filepath.Join(repoRoot, rel))
+	if r, err := filepath.Rel(repoRoot, path); err != nil || strings.HasPrefix(r, "..") {
+		return "", fmt.Errorf("path %s is outside repository root", rel)
+	}
+	return path, nil
+}
+
+// resolve turns a tool's position arguments into a client, a file and the
+// position to ask about.
+func resolve(ctx context.Context, repoRoot string, manager *lsp.Manager, args map[string]any) (*lsp.Client, string, lsp.Position, error) {
+	path, err := repoPath(repoRoot, args)
+	if err != nil {
+		return nil, "", lsp.Position{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", lsp.Position{}, err
+	}
+	line, _ := args["line"].(float64)
+	column, _ := args["column"].(float64)
+	symbol, _ := args["symbol"].(string)
+	pos, err := position(string(data), int(line), symbol, int(column))
+	if err != nil {
+		return nil, "", lsp.Position{}, err
+	}
+	client, err := manager.Client(ctx)
+	if err != nil {
+		return nil, "", lsp.Position{}, err
+	}
+	return client, path, pos, nil
+}
+
+// position finds the LSP position of symbol on the 1-indexed line of text,
+// or of the 1-indexed character column. With neither, it is the line's
+// first non-blank character.
+func position(text string, line int, symbol string, column int) (lsp.Position, error) {
+	lines := strings.Split(text, "\n")
+	if line < 1 || line > len(lines) {
+		return lsp.Position{}, fmt.Errorf("line %d is out of range (the file has %d lines)", line, len(lines))
+	}
+	lineText := strings.TrimSuffix(lines[line-1], "\r")
+
+	var offset int // byte offset in lineText
+	switch {
+	case symbol != "":
+		offset = identifierIndex(lineText, symbol)
+		if offset < 0 {
+			return lsp.Position{}, fmt.Errorf("symbol %q is not on line %d: %s", symbol, line, strings.TrimSpace(lineText))
+		}
+	case column > 0:
+		if column > utf8.RuneCountInString(lineText)+1 {
+			return lsp.Position{}, fmt.Errorf("column %d is past the end of line %d", column, line)
+		}
+		offset = 0
+		for i := 1; i < column; i++ {
+			_, size := utf8.DecodeRuneInString(lineText[offset:])
+			offset += size
+		}
+	default:
+		offset = len(lineText) - len(strings.TrimLeftFunc(lineText, unicode.IsSpace))
+	}
+	return lsp.Position{Line: line - 1, Character: utf16Len(lineText[:offset])}, nil
+}
+
+// identifierIndex returns the byte offset of the first occurrence of
+// symbol in s that is a whole identifier, or else of the first occurrence
+// at all, or -1.
+func identifierIndex(s, symbol string) int {
+	isIdent := func(r rune) bool { return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) }
+	for from := 0; ; {
+		i := strings.Index(s[from:], symbol)
+		if i < 0 {
+			break
+		}
+		i += from
+		before, _ := utf8.DecodeLastRuneInString(s[:i])
+		after, _ := utf8.DecodeRuneInString(s[i+len(symbol):])
+		if !isIdent(before) && !isIdent(after) {
+			return i
+		}
+		from = i + 1
+	}
+	return strings.Index(s, symbol)
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// location is a location as the tools report it, 1-indexed.
+type location struct {
+	Path   string `json:"path"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Text   string `json:"text,omitempty"`
+}
+
+func formatLocations(client *lsp.Client, locs []lsp.Location) (string, error) {
+	result := map[string]any{"count": len(locs)}
+	if len(locs) > maxLocations {
+		result["truncated"] = true
+		locs = locs[:maxLocations]
+	}
+	files := make(map[string][]string)
+	out := make([]location, 0, len(locs))
+	for _, l := range locs {
+		loc := location{Path: client.Rel(l.Path), Line: l.Range.Start.Line + 1, Column: l.Range.Start.Character + 1}
+		lines, ok := files[l.Path]
+		if !ok {
+			if data, err := os.ReadFile(l.Path); err == nil {
+				lines = strings.Split(string(data), "\n")
+			}
+			files[l.Path] = lines
+		}
+		if l.Range.Start.Line < len(lines) {
+			loc.Text = strings.TrimSpace(lines[l.Range.Start.Line])
+		}
+		out = append(out, loc)
+	}
+	result["locations"] = out
+	return marshal(result)
+}
+
+func formatDiagnostics(path string, diags []lsp.Diagnostic, fresh bool) (string, error) {
+	type diagnostic struct {
+		Line     int    `json:"line"`
+		Column   int    `json:"column"`
+		Severity string `json:"severity"`
+		Source   string `json:"source,omitempty"`
+		Message  string `json:"message"`
+	}
+	out := make([]diagnostic, 0, len(diags))
+	for _, d := range diags {
+		out = append(out, diagnostic{
+			Line:     d.Range.Start.Line + 1,
+			Column:   d.Range.Start.Character + 1,
+			Severity: d.Severity.String(),
+			Source:   d.Source,
+			Message:  d.Message,
+		})
+	}
+	result := map[string]any{"path": path, "diagnostics": out}
+	if !fresh {
+		result["note"] = "the language server had not finished checking the file's current text; these may be incomplete or stale"
+	}
+	return marshal(result)
+}
+
+func marshal(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,50 @@
+package navigation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ChamsBouzaiene/dodo/internal/lsp"
+)
+
+func TestPosition(t *testing.T) {
+	const text = "package main\n\n\tfmt.Println(x, xs)\nvar é = \"日😀\"; Println()\r\n"
+	tests := []struct {
+		line    int
+		symbol  string
+		column  int
+		want    lsp.Position
+		wantErr string
+	}{
+		{line: 3, symbol: "Println", want: lsp.Position{Line: 2, Character: 5}},
+		{line: 3, symbol: "xs", want: lsp.Position{Line: 2, Character: 16}},
+		{line: 3, symbol: "x", want: lsp.Position{Line: 2, Character: 13}}, // the whole identifier, not the x in xs
+		{line: 3, want: lsp.Position{Line: 2, Character: 1}},
+		{line: 4, symbol: "Println", want: lsp.Position{Line: 3, Character: 15}}, // UTF-16 columns
+		{line: 4, column: 5, want: lsp.Position{Line: 3, Character: 4}},
+		{line: 3, symbol: "Printf", wantErr: "not on line 3"},
+		{line: 9, symbol: "x", wantErr: "out of range"},
+		{line: 1, column: 40, wantErr: "past the end"},
+	}
+	for _, tt := range tests {
+		got, err := position(text, tt.line, tt.symbol, tt.column)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("position(%d, %q, %d) error = %v, want %q", tt.line, tt.symbol, tt.column, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("position(%d, %q, %d) = %+v, %v; want %+v", tt.line, tt.symbol, tt.column, got, err, tt.want)
+		}
+	}
+}
+
+func TestRepoPath(t *testing.T) {
+	if _, err := repoPath("/repo", map[string]any{"path": "../etc/passwd"}); err == nil {
+		t.Error("repoPath() accepted a path outside the repository")
+	}
+	if got, err := repoPath("/repo", map[string]any{"path": "pkg/a.go"}); err != nil || got != "/repo/pkg/a.go" {
+		t.Errorf("repoPath() = %q, %v", got, err)
+	}
+}
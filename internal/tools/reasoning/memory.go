@@ -0,0 +1,145 @@
+package reasoning
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ChamsBouzaiene/dodo/internal/engine"
+	"github.com/ChamsBouzaiene/dodo/internal/memory"
+)
+
+// NewRememberTool creates the tool that saves a memory to .dodo/memory.
+func NewRememberTool(store *memory.Store) engine.Tool {
+	return engine.Tool{
+		Name: "remember",
+		Description: `Save a lesson about this repository to the project memory (.dodo/memory), so that later sessions know it.
+
+WHEN TO USE:
+- You learned something non-obvious the code doesn't say (how to run the tests, a generated file not to edit)
+- The user states a convention or preference ("always use table-driven tests")
+- A decision was made, with its reason ("we keep the v1 API because clients pin it")
+
+Keep each memory to one self-contained fact in 1-3 sentences. Don't save what the code or git history already records, or details that only matter to the current task. Saving the same content again updates the existing memory.
+
+KINDS: "fact", "convention", "decision"`,
+		SchemaJSON: `{
+			"type": "object",
+			"properties": {
+				"content": {"type": "string", "description": "The memory, self-contained"},
+				"kind": {"type": "string", "enum": ["fact", "convention", "decision"], "description": "What kind of memory this is"},
+				"tags": {"type": "array", "items": {"type": "string"}, "description": "A few keywords to find it by, e.g. module names"}
+			},
+			"required": ["content", "kind"]
+		}`,
+		Fn: func(ctx context.Context, args map[string]any) (string, error) {
+			content, _ := args["content"].(string)
+			kind, _ := args["kind"].(string)
+			m, err := store.Remember(kind, content, stringList(args["tags"]))
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("✅ Remembered %s %s.", m.Kind, m.ID), nil
+		},
+		Retryable: false,
+		Metadata: engine.ToolMetadata{
+			Version:  "1.0.0",
+			Category: "memory",
+			Tags:     []string{"memory", "persistent"},
+		},
+	}
+}
+
+// NewRecallTool creates the tool that searches the project memory.
+func NewRecallTool(store *memory.Store) engine.Tool {
+	return engine.Tool{
+		Name: "recall",
+		Description: `Search the project memory (.dodo/memory) for facts, conventions and decisions saved in earlier sessions.
+
+The memories most relevant to each user message are already in your context under [PROJECT MEMORY]; use this tool to look for others, e.g. before changing an area of the code. Without a query, lists every memory (of the given kind).`,
+		SchemaJSON: `{
+			"type": "object",
+			"properties": {
+				"query": {"type": "string", "description": "Words to look for"},
+				"kind": {"type": "string", "enum": ["fact", "convention", "decision"], "description": "Only memories of this kind"},
+				"limit": {"type": "integer", "description": "Maximum number of memories (default: 10)"}
+			}
+		}`,
+		Fn: func(ctx context.Context, args map[string]any) (string, error) {
+			query, _ := args["query"].(string)
+			kind, _ := args["kind"].(string)
+			limit := 10
+			if l, ok := args["limit"].(float64); ok && l > 0 {
+				limit = int(l)
+			}
+			found, err := store.Recall(query, kind, limit)
+			if err != nil {
+				return "", err
+			}
+			if len(found) == 0 {
+				return "No matching memories.", nil
+			}
+			var b strings.Builder
+			fmt.Fprintf(&b, "Found %d memories:\n", len(found))
+			for _, m := range found {
+				fmt.Fprintf(&b, "- (%s, id %s) %s", m.Kind, m.ID, m.Content)
+				if len(m.Tags) > 0 {
+					fmt.Fprintf(&b, " [tags: %s]", strings.Join(m.Tags, ", "))
+				}
+				b.WriteString("\n")
+			}
+			return b.String(), nil
+		},
+		Retryable: false,
+		Metadata: engine.ToolMetadata{
+			Version:  "1.0.0",
+			Category: "memory",
+			Tags:     []string{"memory", "persistent"},
+		},
+	}
+}
+
+// NewForgetTool creates the tool that deletes a memory.
+func NewForgetTool(store *memory.Store) engine.Tool {
+	return engine.Tool{
+		Name: "forget",
+		Description: `Delete a memory from the project memory (.dodo/memory) by its id.
+
+Use it when a memory turns out to be wrong or outdated, or the user asks for it. To correct a memory, forget it and remember the corrected version.`,
+		SchemaJSON: `{
+			"type": "object",
+			"properties": {
+				"id": {"type": "string", "description": "The memory's id, as shown in [PROJECT MEMORY] or by recall"}
+			},
+			"required": ["id"]
+		}`,
+		Fn: func(ctx context.Context, args map[string]any) (string, error) {
+			id, _ := args["id"].(string)
+			if err := store.Forget(id); errors.Is(err, memory.ErrNotFound) {
+				return "", fmt.Errorf("no memory with id %q", id)
+			} else if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("✅ Forgot memory %s.", id), nil
+		},
+		Retryable: false,
+		Metadata: engine.ToolMetadata{
+			Version:  "1.0.0",
+			Category: "memory",
+			Tags:     []string{"memory", "persistent"},
+		},
+	}
+}
+
+// stringList returns the strings of a JSON array argument.
+func stringList(v any) []string {
+	raw, _ := v.([]interface{})
+	var out []string
+	for _, item := range raw {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
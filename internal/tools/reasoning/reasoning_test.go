@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/ChamsBouzaiene/dodo/internal/engine"
+	"github.com/ChamsBouzaiene/dodo/internal/memory"
 )
 
 func TestThinkTool(t *testing.T) {
@@ -298,3 +299,34 @@ func TestProjectPlanTool(t *testing.T) {
 		t.Error("Appended content missing")
 	}
 }
+
+func TestMemoryTools(t *testing.T) {
+	store := memory.NewStore(t.TempDir())
+	remember, recall, forget := NewRememberTool(store), NewRecallTool(store), NewForgetTool(store)
+
+	if _, err := remember.Fn(context.Background(), map[string]any{
+		"content": "Run make gen after editing the schema",
+		"kind":    "convention",
+		"tags":    []interface{}{"schema"},
+	}); err != nil {
+		t.Fatalf("remember failed: %v", err)
+	}
+	if _, err := remember.Fn(context.Background(), map[string]any{"content": "x", "kind": "opinion"}); err == nil {
+		t.Error("remember accepted an unknown kind")
+	}
+
+	result, err := recall.Fn(context.Background(), map[string]any{"query": "schema"})
+	if err != nil || !strings.Contains(result, "make gen") {
+		t.Fatalf("recall = %q, %v", result, err)
+	}
+	memories, _ := store.List()
+	if _, err := forget.Fn(context.Background(), map[string]any{"id": memories[0].ID}); err != nil {
+		t.Fatalf("forget failed: %v", err)
+	}
+	if result, _ := recall.Fn(context.Background(), map[string]any{}); result != "No matching memories." {
+		t.Errorf("recall after forget = %q", result)
+	}
+	if _, err := forget.Fn(context.Background(), map[string]any{"id": memories[0].ID}); err == nil {
+		t.Error("forget of a missing memory succeeded")
+	}
+}
@@ -12,9 +12,14 @@ import (
 
 // NewToolRegistry creates a new engine.ToolRegistry based on the provided ToolSet.
 // It copies implementations from internal/tools/*.go and wraps them as engine.Tool.
-func NewToolRegistry(repoRoot string, retrieval indexer.Retrieval, set engine.ToolSet) (engine.ToolRegistry, error) {
+// Commands run through runner; nil selects the default sandbox runner.
+func NewToolRegistry(repoRoot string, retrieval indexer.Retrieval, runner execution.Runner, set engine.ToolSet) (engine.ToolRegistry, error) {
 	reg := make(engine.ToolRegistry)
 
+	if runner == nil && (set.Search || set.Execution) {
+		runner = execution.NewSandboxRunner()
+	}
+
 	if set.Filesystem {
 		reg["read_file"] = filesystem.NewReadFileTool(repoRoot)
 		reg["list_files"] = filesystem.NewListFilesTool(repoRoot)
@@ -23,7 +28,7 @@ func NewToolRegistry(repoRoot string, retrieval indexer.Retrieval, set engine.To
 	}
 
 	if set.Search {
-		reg["grep"] = search.NewGrepTool(repoRoot)
+		reg["grep"] = search.NewGrepTool(repoRoot, runner)
 		if retrieval != nil && set.Semantic {
 			reg["codebase_search"] = search.NewCodebaseSearchTool(retrieval)
 			reg["read_span"] = search.NewReadSpanTool(retrieval)
@@ -31,9 +36,9 @@ func NewToolRegistry(repoRoot string, retrieval indexer.Retrieval, set engine.To
 	}
 
 	if set.Execution {
-		reg["run_tests"] = execution.NewRunTestsTool(repoRoot)
-		reg["run_build"] = execution.NewRunBuildTool(repoRoot)
-		reg["run_cmd"] = execution.NewRunCmdTool(repoRoot)
+		reg["run_tests"] = execution.NewRunTestsTool(repoRoot, runner)
+		reg["run_build"] = execution.NewRunBuildTool(repoRoot, runner)
+		reg["run_cmd"] = execution.NewRunCmdTool(repoRoot, runner)
 	}
 
 	if set.Editing {
@@ -130,8 +130,8 @@ func grepImpl(ctx context.Context, runner execution.Runner, repoRoot, pattern, p
 }
 
 // NewGrepTool creates an engine.Tool that wraps the grep functionality.
-func NewGrepTool(repoRoot string) engine.Tool {
-	runner := execution.NewSandboxRunner()
+// ripgrep runs through runner.
+func NewGrepTool(repoRoot string, runner execution.Runner) engine.Tool {
 	return engine.Tool{
 		Name:        "grep",
 		Description: "Fast, regex-based code search using ripgrep. Use this to find code patterns, function definitions, or references. Supports case-insensitive search and glob patterns.",
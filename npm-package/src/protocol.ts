@@ -38,7 +38,13 @@ export type ProjectPermissionCommand = {
   indexing_enabled: boolean;
 };
 
-export type Command = StartSessionCommand | UserMessageCommand | SaveConfigCommand | GetConfigCommand | ReloadConfigCommand | CancelRequestCommand | ProjectPermissionCommand;
+export type ListModelsCommand = {
+  type: "list_models";
+  provider?: string;
+  refresh?: boolean;
+};
+
+export type Command = StartSessionCommand | UserMessageCommand | SaveConfigCommand | GetConfigCommand | ReloadConfigCommand | CancelRequestCommand | ProjectPermissionCommand | ListModelsCommand;
 
 export type StatusEvent = {
   type: "status";
@@ -187,6 +193,29 @@ export type ProjectPermissionRequiredEvent = {
   repo_root: string;
 };
 
+export type ModelInfo = {
+  id: string;
+  provider: string;
+  display_name?: string;
+  context_window?: number;
+  max_output_tokens?: number;
+  input_cost_per_1m?: number;
+  output_cost_per_1m?: number;
+  current?: boolean;
+};
+
+export type ProviderError = {
+  provider: string;
+  message: string;
+};
+
+export type ModelsListedEvent = {
+  type: "models_listed";
+  session_id?: string;
+  models: ModelInfo[];
+  errors?: ProviderError[];
+};
+
 export type Event =
   | StatusEvent
   | AssistantTextEvent
@@ -204,7 +233,8 @@ export type Event =
   | ConfigReloadedEvent
   | CancelledEvent
   | SessionHistoryEvent
-  | ProjectPermissionRequiredEvent;
+  | ProjectPermissionRequiredEvent
+  | ModelsListedEvent;
 
 export const serializeCommand = (command: Command): string => {
   return JSON.stringify(command);
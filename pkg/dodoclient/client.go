@@ -0,0 +1,339 @@
+// Package dodoclient drives a dodo engine from Go. It spawns
+// `dodo engine --stdio`, performs the protocol handshake, and offers typed
+// methods for the engine's commands along with a channel of its events.
+//
+//	c, err := dodoclient.Start(ctx, dodoclient.Options{Repo: "/path/to/repo"})
+//	if err != nil { ... }
+//	defer c.Close()
+//	go func() {
+//		for env := range c.Events() {
+//			if t, ok := env.Event.(dodoclient.AssistantTextEvent); ok {
+//				fmt.Print(t.Content)
+//			}
+//		}
+//	}()
+//	id, err := c.StartSession(ctx, dodoclient.StartSessionCommand{})
+//	_, err = c.SendMessage(ctx, id, "add a test for parseArgs")
+package dodoclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ChamsBouzaiene/dodo/internal/engine/protocol"
+)
+
+// ErrClosed is returned by calls on a client whose engine has exited.
+var ErrClosed = errors.New("dodoclient: engine closed")
+
+// Options configure the engine process.
+type Options struct {
+	Path         string    // dodo binary; default "dodo" from $PATH
+	Repo         string    // repository the engine works in (--repo); default the working directory
+	Args         []string  // extra engine flags, e.g. "--set", "model=gpt-4o"
+	Env          []string  // added to the current environment
+	Stderr       io.Writer // engine logs; discarded when nil
+	ClientName   string    // reported in hello, for the engine's logs
+	Capabilities []string  // to negotiate; default every capability this package knows
+}
+
+// Envelope is one event received from the engine.
+type Envelope struct {
+	Event     Event
+	RequestID string // of the command that caused it, if any
+	Seq       uint64 // position in its session's event stream; 0 for replies
+}
+
+// Reply holds what the engine answered to one command.
+type Reply struct {
+	Result ResultEvent
+	Events []Event // every event tagged with the command's request ID, in order
+}
+
+// Client is a running engine. Its methods are safe for concurrent use.
+type Client struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+
+	writeMu sync.Mutex
+	nextID  atomic.Uint64
+
+	mu      sync.Mutex
+	pending map[string]*call
+	readErr error // set once the engine's output ends
+
+	queue     chan Envelope
+	events    chan Envelope
+	done      chan struct{} // closed when the engine's output ends
+	closed    chan struct{} // closed by Close
+	closeOnce sync.Once
+
+	// Welcome is the engine's answer to the handshake.
+	Welcome WelcomeEvent
+}
+
+type call struct {
+	events []Event
+	result chan ResultEvent
+}
+
+// Start spawns the engine and completes the handshake.
+func Start(ctx context.Context, opts Options) (*Client, error) {
+	path := opts.Path
+	if path == "" {
+		path = "dodo"
+	}
+	args := []string{"engine", "--stdio"}
+	if opts.Repo != "" {
+		args = append(args, "--repo", opts.Repo)
+	}
+	args = append(args, opts.Args...)
+
+	cmd := exec.Command(path, args...)
+	cmd.Env = append(os.Environ(), opts.Env...)
+	cmd.Stderr = opts.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("dodoclient: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("dodoclient: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("dodoclient: start engine: %w", err)
+	}
+
+	c := &Client{
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: make(map[string]*call),
+		queue:   make(chan Envelope, 64),
+		events:  make(chan Envelope),
+		done:    make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+	go c.read(stdout)
+	go c.deliver()
+
+	caps := opts.Capabilities
+	if caps == nil {
+		caps = protocol.EngineCapabilities
+	}
+	reply, err := c.Do(ctx, HelloCommand{ProtocolVersion: ProtocolVersion, Client: opts.ClientName, Capabilities: caps})
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("dodoclient: handshake: %w", err)
+	}
+	c.Welcome, err = find[WelcomeEvent](reply)
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("dodoclient: handshake: %w", err)
+	}
+	return c, nil
+}
+
+// Events returns every event the engine emits, including those also
+// returned in a Reply. It is closed when the engine exits. Events are
+// buffered without limit, so a caller that isn't interested may ignore it.
+func (c *Client) Events() <-chan Envelope { return c.events }
+
+// Close ends the engine's input and waits for it to exit, killing it after
+// five seconds. Events not yet received from Events are dropped.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	c.writeMu.Lock()
+	c.stdin.Close()
+	c.writeMu.Unlock()
+
+	select {
+	case <-c.done:
+	case <-time.After(5 * time.Second):
+		_ = c.cmd.Process.Kill()
+		<-c.done
+	}
+	// Wait closes stdout, so it must wait for read to finish with it.
+	err := c.cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && !exitErr.Exited() {
+		return nil // killed above
+	}
+	return err
+}
+
+// Do sends cmd and waits for its result. A request_id is assigned unless
+// cmd carries one. When the command fails, the Reply is returned along with
+// its *CommandError.
+func (c *Client) Do(ctx context.Context, cmd Command) (*Reply, error) {
+	id := cmd.GetRequestID()
+	if id == "" {
+		id = "go-" + strconv.FormatUint(c.nextID.Add(1), 10)
+	}
+	line, err := encode(cmd, id)
+	if err != nil {
+		return nil, err
+	}
+
+	pc := &call{result: make(chan ResultEvent, 1)}
+	c.mu.Lock()
+	if c.readErr != nil {
+		c.mu.Unlock()
+		return nil, c.readErr
+	}
+	if _, dup := c.pending[id]; dup {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("dodoclient: request_id %q is already in flight", id)
+	}
+	c.pending[id] = pc
+	c.mu.Unlock()
+
+	c.writeMu.Lock()
+	_, err = c.stdin.Write(line)
+	c.writeMu.Unlock()
+	if err != nil {
+		c.forget(id)
+		return nil, fmt.Errorf("dodoclient: send %s: %w", cmd.GetType(), err)
+	}
+
+	select {
+	case res := <-pc.result:
+		c.mu.Lock()
+		reply := &Reply{Result: res, Events: pc.events}
+		c.mu.Unlock()
+		if !res.OK {
+			if res.Error == nil {
+				return reply, fmt.Errorf("dodoclient: %s failed", cmd.GetType())
+			}
+			return reply, res.Error
+		}
+		return reply, nil
+	case <-c.done:
+		c.forget(id)
+		return nil, c.readErr
+	case <-ctx.Done():
+		c.forget(id)
+		return nil, ctx.Err()
+	}
+}
+
+// encode marshals cmd as one NDJSON line with its type and request_id set,
+// so callers may leave the Type field empty.
+func encode(cmd Command, requestID string) ([]byte, error) {
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("dodoclient: encode %s: %w", cmd.GetType(), err)
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("dodoclient: encode %s: %w", cmd.GetType(), err)
+	}
+	fields["type"], _ = json.Marshal(cmd.GetType())
+	fields["request_id"], _ = json.Marshal(requestID)
+	line, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("dodoclient: encode %s: %w", cmd.GetType(), err)
+	}
+	return append(line, '\n'), nil
+}
+
+func (c *Client) forget(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, id)
+}
+
+// read decodes the engine's output until it ends.
+func (c *Client) read(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for scanner.Scan() {
+		ev, tags, err := protocol.DecodeEvent(scanner.Bytes())
+		if err != nil {
+			continue // newer engine; unknown events are skipped
+		}
+		if tags.RequestID != "" {
+			c.route(ev, tags.RequestID)
+		}
+		// Once closed, nothing delivers the queue; the rest of the
+		// output is read and dropped so that the engine can exit.
+		select {
+		case c.queue <- Envelope{Event: ev, RequestID: tags.RequestID, Seq: tags.Seq}:
+		case <-c.closed:
+		}
+	}
+
+	err := scanner.Err()
+	if err == nil {
+		err = ErrClosed
+	}
+	c.mu.Lock()
+	c.readErr = err
+	c.mu.Unlock()
+	close(c.done)
+	close(c.queue)
+}
+
+// route hands an event to the call it answers.
+func (c *Client) route(ev Event, requestID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pc, ok := c.pending[requestID]
+	if !ok {
+		return
+	}
+	switch e := ev.(type) {
+	case AckEvent:
+	case ResultEvent:
+		delete(c.pending, requestID)
+		pc.result <- e
+	default:
+		pc.events = append(pc.events, ev)
+	}
+}
+
+// deliver moves queued events to Events without ever blocking read.
+func (c *Client) deliver() {
+	defer close(c.events)
+	var buf []Envelope
+	queue := c.queue
+	for queue != nil || len(buf) > 0 {
+		var out chan Envelope
+		var next Envelope
+		if len(buf) > 0 {
+			out, next = c.events, buf[0]
+		}
+		select {
+		case env, ok := <-queue:
+			if !ok {
+				queue = nil
+				continue
+			}
+			buf = append(buf, env)
+		case out <- next:
+			buf = buf[1:]
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// find returns the first event of type T in the reply.
+func find[T Event](reply *Reply) (T, error) {
+	for _, ev := range reply.Events {
+		if e, ok := ev.(T); ok {
+			return e, nil
+		}
+	}
+	var zero T
+	return zero, fmt.Errorf("dodoclient: %s reply has no %T", reply.Result.Command, zero)
+}
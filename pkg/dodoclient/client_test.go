@@ -0,0 +1,181 @@
+package dodoclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ChamsBouzaiene/dodo/internal/engine/protocol"
+)
+
+// TestMain lets the test binary stand in for `dodo engine --stdio`.
+func TestMain(m *testing.M) {
+	if os.Getenv("DODOCLIENT_FAKE_ENGINE") == "1" {
+		fakeEngine()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeEngine answers commands the way the engine does: ack, reply events
+// tagged with the request ID, then result.
+func fakeEngine() {
+	var mu sync.Mutex
+	out := json.NewEncoder(os.Stdout)
+	emit := func(ev protocol.Event, requestID string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return out.Encode(protocol.WithRequestID(ev, requestID))
+	}
+	emit(protocol.NewStatusEvent("", "engine_ready", "stdio protocol ready"), "")
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		cmd, err := protocol.DecodeCommand(scanner.Bytes())
+		if err != nil {
+			continue
+		}
+		id := cmd.GetRequestID()
+		emit(protocol.NewAckEvent("", id, cmd.GetType()), "")
+		var failure *protocol.CommandError
+		switch c := cmd.(type) {
+		case protocol.HelloCommand:
+			emit(protocol.NewWelcomeEvent(protocol.NegotiateCapabilities(c.Capabilities)), id)
+		case protocol.StartSessionCommand:
+			emit(protocol.NewStatusEvent("s1", "session_ready", "repo=/tmp"), id)
+		case protocol.UserMessageCommand:
+			if c.Message == "flood" {
+				// Streams until the client goes away.
+				go func() {
+					for emit(protocol.NewAssistantTextEvent("s1", "more", "assistant", false), "") == nil {
+					}
+				}()
+				break
+			}
+			emit(protocol.NewAssistantTextEvent("s1", "echo: "+c.Message, "assistant", true), id)
+			emit(protocol.NewDoneEvent("s1", "said hi", nil), id)
+		case protocol.RenameSessionCommand:
+			emit(protocol.NewSessionUpdatedEvent(protocol.SessionInfo{ID: c.SessionID, Title: c.Title}), id)
+		default:
+			failure = &protocol.CommandError{Kind: "session_error", Message: fmt.Sprintf("no %s here", c.GetType())}
+			emit(protocol.NewErrorEvent("", failure.Message, failure.Kind, ""), id)
+		}
+		emit(protocol.NewResultEvent("", id, cmd.GetType(), failure), "")
+	}
+}
+
+func startFake(t *testing.T) *Client {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c, err := Start(ctx, Options{Path: exe, Env: []string{"DODOCLIENT_FAKE_ENGINE=1"}, ClientName: "dodoclient-test"})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	return c
+}
+
+func TestClient(t *testing.T) {
+	c := startFake(t)
+	ctx := context.Background()
+
+	if len(c.Welcome.Capabilities) != len(protocol.EngineCapabilities) {
+		t.Errorf("Welcome.Capabilities = %v", c.Welcome.Capabilities)
+	}
+
+	id, err := c.StartSession(ctx, StartSessionCommand{})
+	if err != nil || id != "s1" {
+		t.Fatalf("StartSession() = %q, %v", id, err)
+	}
+
+	reply, err := c.SendMessage(ctx, id, "hi")
+	if err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	if len(reply.Events) != 2 {
+		t.Fatalf("SendMessage() events = %#v", reply.Events)
+	}
+	if text, ok := reply.Events[0].(AssistantTextEvent); !ok || text.Content != "echo: hi" {
+		t.Errorf("first event = %#v", reply.Events[0])
+	}
+
+	info, err := c.RenameSession(ctx, id, "Greeting")
+	if err != nil || info.Title != "Greeting" {
+		t.Errorf("RenameSession() = %+v, %v", info, err)
+	}
+
+	_, err = c.ListSessions(ctx, ListSessionsCommand{})
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) || cmdErr.Kind != "session_error" {
+		t.Errorf("ListSessions() error = %v, want a session_error CommandError", err)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if _, err := c.Do(ctx, GetConfigCommand{}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Do() after Close error = %v, want ErrClosed", err)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	c := startFake(t)
+	defer c.Close()
+
+	if _, err := c.SendMessage(context.Background(), "s1", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	var got []EventType
+	timeout := time.After(5 * time.Second)
+	for len(got) < 4 {
+		select {
+		case env := <-c.Events():
+			if env.RequestID != "" && env.RequestID != "go-2" {
+				continue // the handshake
+			}
+			got = append(got, env.Event.GetType())
+		case <-timeout:
+			t.Fatalf("events so far: %v", got)
+		}
+	}
+	want := []EventType{protocol.EventStatus, protocol.EventAck, protocol.EventAssistantText, protocol.EventDone}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("events = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestCloseWhileEngineSends(t *testing.T) {
+	c := startFake(t)
+	ctx := context.Background()
+	if _, err := c.SendMessage(ctx, "s1", "flood"); err != nil {
+		t.Fatal(err)
+	}
+	// Nobody reads Events, so the event queue is full by now.
+	time.Sleep(100 * time.Millisecond)
+
+	closed := make(chan error, 1)
+	go func() { closed <- c.Close() }()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("Close() error = %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Close() hangs while the engine is sending")
+	}
+	if _, err := c.Do(ctx, GetConfigCommand{}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Do() after Close error = %v, want ErrClosed", err)
+	}
+}
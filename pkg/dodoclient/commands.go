@@ -0,0 +1,173 @@
+package dodoclient
+
+import (
+	"context"
+	"fmt"
+)
+
+// StartSession creates a session, or resumes a stored one when
+// cmd.SessionID is set, and returns its ID.
+func (c *Client) StartSession(ctx context.Context, cmd StartSessionCommand) (string, error) {
+	reply, err := c.Do(ctx, cmd)
+	if err != nil {
+		return "", err
+	}
+	for _, ev := range reply.Events {
+		if s, ok := ev.(StatusEvent); ok && s.Status == "session_ready" {
+			return s.SessionID, nil
+		}
+	}
+	return "", fmt.Errorf("dodoclient: start_session reply has no session_ready status")
+}
+
+// SendMessage runs the agent on message and returns once the run is over.
+// The run's events are in the Reply and, as they happen, on Events.
+func (c *Client) SendMessage(ctx context.Context, sessionID, message string) (*Reply, error) {
+	return c.Do(ctx, UserMessageCommand{SessionID: sessionID, Message: message})
+}
+
+// Cancel stops the session's current run.
+func (c *Client) Cancel(ctx context.Context, sessionID string) error {
+	_, err := c.Do(ctx, CancelRequestCommand{SessionID: sessionID})
+	return err
+}
+
+// SetProjectPermission answers project_permission_required.
+func (c *Client) SetProjectPermission(ctx context.Context, sessionID string, indexingEnabled bool) error {
+	_, err := c.Do(ctx, ProjectPermissionCommand{SessionID: sessionID, IndexingEnabled: indexingEnabled})
+	return err
+}
+
+// GetConfig returns the engine's configuration. API keys are masked.
+func (c *Client) GetConfig(ctx context.Context) (map[string]string, error) {
+	ev, err := doFind[ConfigLoadedEvent](ctx, c, GetConfigCommand{})
+	return ev.Config, err
+}
+
+// ReloadConfig re-reads the configuration and rebuilds the session's LLM
+// client from it.
+func (c *Client) ReloadConfig(ctx context.Context, sessionID string) (ConfigReloadedEvent, error) {
+	return doFind[ConfigReloadedEvent](ctx, c, ReloadConfigCommand{SessionID: sessionID})
+}
+
+// ListModels lists the models of every configured provider, or of
+// cmd.Provider.
+func (c *Client) ListModels(ctx context.Context, cmd ListModelsCommand) (ModelsListedEvent, error) {
+	return doFind[ModelsListedEvent](ctx, c, cmd)
+}
+
+// ListProfiles lists the provider profiles; with a session ID, the one it
+// uses is marked active.
+func (c *Client) ListProfiles(ctx context.Context, sessionID string) ([]ProfileInfo, error) {
+	ev, err := doFind[ProfilesListedEvent](ctx, c, ListProfilesCommand{SessionID: sessionID})
+	return ev.Profiles, err
+}
+
+// SwitchProfile moves the session to another provider profile.
+func (c *Client) SwitchProfile(ctx context.Context, sessionID, profile string) (ProfileSwitchedEvent, error) {
+	return doFind[ProfileSwitchedEvent](ctx, c, SwitchProfileCommand{SessionID: sessionID, Profile: profile})
+}
+
+// Subscribe starts delivering a live session's events on Events.
+func (c *Client) Subscribe(ctx context.Context, sessionID string) (SubscribedEvent, error) {
+	return doFind[SubscribedEvent](ctx, c, SubscribeCommand{SessionID: sessionID})
+}
+
+// Unsubscribe stops delivering a session's events.
+func (c *Client) Unsubscribe(ctx context.Context, sessionID string) error {
+	_, err := c.Do(ctx, UnsubscribeCommand{SessionID: sessionID})
+	return err
+}
+
+// ListSessions returns a page of the stored sessions.
+func (c *Client) ListSessions(ctx context.Context, cmd ListSessionsCommand) (SessionsListedEvent, error) {
+	return doFind[SessionsListedEvent](ctx, c, cmd)
+}
+
+// SearchSessions returns the stored sessions matching a query, best match
+// first.
+func (c *Client) SearchSessions(ctx context.Context, cmd SearchSessionsCommand) ([]SessionSearchResult, error) {
+	ev, err := doFind[SessionsFoundEvent](ctx, c, cmd)
+	return ev.Results, err
+}
+
+// GetSession returns a stored session's metadata and, with
+// includeMessages, its conversation.
+func (c *Client) GetSession(ctx context.Context, sessionID string, includeMessages bool) (SessionInfoEvent, error) {
+	return doFind[SessionInfoEvent](ctx, c, GetSessionCommand{SessionID: sessionID, IncludeMessages: includeMessages})
+}
+
+// RenameSession changes a session's title.
+func (c *Client) RenameSession(ctx context.Context, sessionID, title string) (SessionInfo, error) {
+	ev, err := doFind[SessionUpdatedEvent](ctx, c, RenameSessionCommand{SessionID: sessionID, Title: title})
+	return ev.Session, err
+}
+
+// ArchiveSession hides a session from ListSessions, or with restore brings
+// it back.
+func (c *Client) ArchiveSession(ctx context.Context, sessionID string, restore bool) (SessionInfo, error) {
+	ev, err := doFind[SessionUpdatedEvent](ctx, c, ArchiveSessionCommand{SessionID: sessionID, Restore: restore})
+	return ev.Session, err
+}
+
+// PinSession exempts a session from garbage collection, or with unpin
+// makes it collectable again.
+func (c *Client) PinSession(ctx context.Context, sessionID string, unpin bool) (SessionInfo, error) {
+	ev, err := doFind[SessionUpdatedEvent](ctx, c, PinSessionCommand{SessionID: sessionID, Unpin: unpin})
+	return ev.Session, err
+}
+
+// DeleteSession deletes a stored session.
+func (c *Client) DeleteSession(ctx context.Context, sessionID string) error {
+	_, err := c.Do(ctx, DeleteSessionCommand{SessionID: sessionID})
+	return err
+}
+
+// ExportSession returns a session's transcript in format ("" for JSON).
+func (c *Client) ExportSession(ctx context.Context, sessionID, format string) (string, error) {
+	ev, err := doFind[SessionExportedEvent](ctx, c, ExportSessionCommand{SessionID: sessionID, Format: format})
+	return ev.Content, err
+}
+
+// ForkSession starts a new stored session from the first messageIndex
+// messages of a session's conversation, and with restoreFiles puts back the
+// files it changed from there on. Resume the fork with StartSession.
+func (c *Client) ForkSession(ctx context.Context, sessionID string, messageIndex int, restoreFiles bool) (SessionForkedEvent, error) {
+	return doFind[SessionForkedEvent](ctx, c, ForkSessionCommand{SessionID: sessionID, MessageIndex: messageIndex, RestoreFiles: restoreFiles})
+}
+
+// ListMemories returns the project memories relevant to cmd.Query, or
+// all of them without one.
+func (c *Client) ListMemories(ctx context.Context, cmd ListMemoriesCommand) ([]MemoryInfo, error) {
+	ev, err := doFind[MemoriesListedEvent](ctx, c, cmd)
+	return ev.Memories, err
+}
+
+// SaveMemory adds a project memory or, with cmd.MemoryID, replaces one.
+func (c *Client) SaveMemory(ctx context.Context, cmd SaveMemoryCommand) (MemoryInfo, error) {
+	ev, err := doFind[MemorySavedEvent](ctx, c, cmd)
+	return ev.Memory, err
+}
+
+// ForgetMemory deletes a project memory.
+func (c *Client) ForgetMemory(ctx context.Context, memoryID string) error {
+	_, err := c.Do(ctx, ForgetMemoryCommand{MemoryID: memoryID})
+	return err
+}
+
+// Resync has the engine resend the session's events from fromSeq on. They
+// arrive on Events with their original seq, before the returned
+// ResyncedEvent; events seen twice can be told apart by seq.
+func (c *Client) Resync(ctx context.Context, sessionID string, fromSeq uint64) (ResyncedEvent, error) {
+	return doFind[ResyncedEvent](ctx, c, ResyncCommand{SessionID: sessionID, FromSeq: fromSeq})
+}
+
+// doFind runs cmd and returns the reply event of type T.
+func doFind[T Event](ctx context.Context, c *Client, cmd Command) (T, error) {
+	reply, err := c.Do(ctx, cmd)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return find[T](reply)
+}
@@ -0,0 +1,94 @@
+package dodoclient
+
+import "github.com/ChamsBouzaiene/dodo/internal/engine/protocol"
+
+// The protocol's types, re-exported so programs outside this module can
+// build commands and type-switch on events. They are the engine's own
+// types, so they cannot drift from what it sends.
+type (
+	Command     = protocol.Command
+	CommandType = protocol.CommandType
+	Event       = protocol.Event
+	EventType   = protocol.EventType
+
+	HelloCommand             = protocol.HelloCommand
+	StartSessionCommand      = protocol.StartSessionCommand
+	UserMessageCommand       = protocol.UserMessageCommand
+	SaveConfigCommand        = protocol.SaveConfigCommand
+	GetConfigCommand         = protocol.GetConfigCommand
+	ReloadConfigCommand      = protocol.ReloadConfigCommand
+	CancelRequestCommand     = protocol.CancelRequestCommand
+	ProjectPermissionCommand = protocol.ProjectPermissionCommand
+	ListModelsCommand        = protocol.ListModelsCommand
+	SwitchProfileCommand     = protocol.SwitchProfileCommand
+	ListProfilesCommand      = protocol.ListProfilesCommand
+	SubscribeCommand         = protocol.SubscribeCommand
+	UnsubscribeCommand       = protocol.UnsubscribeCommand
+	ListSessionsCommand      = protocol.ListSessionsCommand
+	GetSessionCommand        = protocol.GetSessionCommand
+	SearchSessionsCommand    = protocol.SearchSessionsCommand
+	RenameSessionCommand     = protocol.RenameSessionCommand
+	DeleteSessionCommand     = protocol.DeleteSessionCommand
+	ArchiveSessionCommand    = protocol.ArchiveSessionCommand
+	PinSessionCommand        = protocol.PinSessionCommand
+	ExportSessionCommand     = protocol.ExportSessionCommand
+	ForkSessionCommand       = protocol.ForkSessionCommand
+	ListMemoriesCommand      = protocol.ListMemoriesCommand
+	SaveMemoryCommand        = protocol.SaveMemoryCommand
+	ForgetMemoryCommand      = protocol.ForgetMemoryCommand
+	ResyncCommand            = protocol.ResyncCommand
+
+	AssistantTextEvent             = protocol.AssistantTextEvent
+	StatusEvent                    = protocol.StatusEvent
+	ToolEvent                      = protocol.ToolEvent
+	FilesChangedEvent              = protocol.FilesChangedEvent
+	DoneEvent                      = protocol.DoneEvent
+	ErrorEvent                     = protocol.ErrorEvent
+	ActivityEvent                  = protocol.ActivityEvent
+	TokenUsageEvent                = protocol.TokenUsageEvent
+	ProjectPlanEvent               = protocol.ProjectPlanEvent
+	ToolOutputEvent                = protocol.ToolOutputEvent
+	ContextEvent                   = protocol.ContextEvent
+	SetupRequiredEvent             = protocol.SetupRequiredEvent
+	ConfigLoadedEvent              = protocol.ConfigLoadedEvent
+	ConfigReloadedEvent            = protocol.ConfigReloadedEvent
+	CancelledEvent                 = protocol.CancelledEvent
+	SessionHistoryEvent            = protocol.SessionHistoryEvent
+	ProjectPermissionRequiredEvent = protocol.ProjectPermissionRequiredEvent
+	ModelsListedEvent              = protocol.ModelsListedEvent
+	ProfileSwitchedEvent           = protocol.ProfileSwitchedEvent
+	ProfilesListedEvent            = protocol.ProfilesListedEvent
+	WelcomeEvent                   = protocol.WelcomeEvent
+	AckEvent                       = protocol.AckEvent
+	ResultEvent                    = protocol.ResultEvent
+	SubscribedEvent                = protocol.SubscribedEvent
+	SessionsListedEvent            = protocol.SessionsListedEvent
+	SessionInfoEvent               = protocol.SessionInfoEvent
+	SessionsFoundEvent             = protocol.SessionsFoundEvent
+	SessionUpdatedEvent            = protocol.SessionUpdatedEvent
+	SessionDeletedEvent            = protocol.SessionDeletedEvent
+	SessionExportedEvent           = protocol.SessionExportedEvent
+	SessionForkedEvent             = protocol.SessionForkedEvent
+	MemoriesListedEvent            = protocol.MemoriesListedEvent
+	MemorySavedEvent               = protocol.MemorySavedEvent
+	MemoryForgottenEvent           = protocol.MemoryForgottenEvent
+	ResyncedEvent                  = protocol.ResyncedEvent
+	MCPServerStatusEvent           = protocol.MCPServerStatusEvent
+
+	CodeChange          = protocol.CodeChange
+	CommandError        = protocol.CommandError
+	HistoryMessage      = protocol.HistoryMessage
+	MemoryInfo          = protocol.MemoryInfo
+	ModelInfo           = protocol.ModelInfo
+	ProfileInfo         = protocol.ProfileInfo
+	ProviderError       = protocol.ProviderError
+	SessionInfo         = protocol.SessionInfo
+	SessionSearchResult = protocol.SessionSearchResult
+)
+
+// ProtocolVersion is the protocol version this package speaks.
+const ProtocolVersion = protocol.ProtocolVersion
+
+// Schema returns the protocol's JSON Schema, for clients in other
+// languages.
+func Schema() ([]byte, error) { return protocol.Schema() }